@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cardigann/cardigann/backup"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+func configureBackupCommand(app *kingpin.Application) {
+	var dir, archive string
+
+	cmd := app.Command("backup", "Back up and restore the config, definitions and data store")
+
+	create := cmd.Command("create", "Make a backup now").Default()
+	create.Flag("dir", "The directory to write the backup to, instead of the backupdir config").
+		StringVar(&dir)
+
+	configureGlobalFlags(create)
+	create.Action(func(c *kingpin.ParseContext) error {
+		applyGlobalFlags()
+		return createBackupCommand(dir)
+	})
+
+	list := cmd.Command("list", "List the backups that have been made")
+	list.Flag("dir", "The directory to list backups in, instead of the backupdir config").
+		StringVar(&dir)
+
+	configureGlobalFlags(list)
+	list.Action(func(c *kingpin.ParseContext) error {
+		applyGlobalFlags()
+		return listBackupsCommand(dir)
+	})
+
+	restore := cmd.Command("restore", "Restore a backup over the current files, stop the server first")
+	restore.Arg("file", "The backup to restore").
+		Required().
+		ExistingFileVar(&archive)
+
+	configureGlobalFlags(restore)
+	restore.Action(func(c *kingpin.ParseContext) error {
+		applyGlobalFlags()
+		return restoreBackupCommand(archive)
+	})
+}
+
+// backupSettings returns the backup config, with dir taking the place of backupdir if set
+func backupSettings(dir string) (backup.Settings, error) {
+	settings := backup.Settings{Retention: backup.DefaultRetention}
+
+	// a broken config is what backups are for, so it's not needed if there's a dir. The
+	// config is only read when a key is looked up, so a corrupt one fails in LoadSettings
+	conf, err := newConfig()
+	if err == nil {
+		var loaded backup.Settings
+		if loaded, err = backup.LoadSettings(conf); err == nil {
+			settings = loaded
+		}
+	}
+	if err != nil && dir == "" {
+		return settings, err
+	}
+
+	if dir != "" {
+		settings.Dir = dir
+	}
+
+	if settings.Dir == "" {
+		return settings, errors.New("No backupdir is configured, pass --dir to choose one")
+	}
+
+	return settings, nil
+}
+
+func createBackupCommand(dir string) error {
+	settings, err := backupSettings(dir)
+	if err != nil {
+		return err
+	}
+
+	sources, err := backup.DefaultSources()
+	if err != nil {
+		return err
+	}
+
+	f, err := backup.Create(settings.Dir, sources, time.Now())
+	if err != nil {
+		return err
+	}
+
+	removed, pruneErr := backup.Prune(settings.Dir, settings.Retention)
+
+	if outputJSON() {
+		if removed == nil {
+			removed = []string{}
+		}
+		if err := printJSON(struct {
+			File    string   `json:"file"`
+			Removed []string `json:"removed"`
+		}{f, removed}); err != nil {
+			return err
+		}
+		return pruneErr
+	}
+
+	fmt.Printf("Wrote %s\n", f)
+	for _, old := range removed {
+		fmt.Printf("Removed %s\n", old)
+	}
+	return pruneErr
+}
+
+func listBackupsCommand(dir string) error {
+	settings, err := backupSettings(dir)
+	if err != nil {
+		return err
+	}
+
+	files, err := backup.List(settings.Dir)
+	if err != nil {
+		return err
+	}
+
+	if outputJSON() {
+		if files == nil {
+			files = []string{}
+		}
+		return printJSON(files)
+	}
+
+	for _, f := range files {
+		fmt.Println(f)
+	}
+
+	return nil
+}
+
+func restoreBackupCommand(archive string) error {
+	sources, err := backup.DefaultSources()
+	if err != nil {
+		return err
+	}
+
+	restored, err := backup.Restore(archive, sources)
+
+	if outputJSON() {
+		if restored == nil {
+			restored = []string{}
+		}
+		if jsonErr := printJSON(restored); jsonErr != nil {
+			return jsonErr
+		}
+		return err
+	}
+
+	for _, f := range restored {
+		fmt.Printf("Restored %s\n", f)
+	}
+	return err
+}
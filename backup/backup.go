@@ -0,0 +1,325 @@
+// Package backup writes and restores archives of cardigann's config, user definitions and
+// data store, so that a corrupted config.json isn't the end of a setup.
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cardigann/cardigann/config"
+)
+
+const (
+	filePrefix = "cardigann-backup-"
+	fileSuffix = ".tar.gz"
+	timeFormat = "20060102-150405"
+
+	// DefaultRetention is how many backups are kept when the retention isn't configured
+	DefaultRetention = 7
+
+	// DefaultInterval is how often the server makes a backup when the interval isn't configured
+	DefaultInterval = 24 * time.Hour
+)
+
+// Settings are the backup options from the global section of the config
+type Settings struct {
+	// Dir is where backups are written, scheduled backups are off if it's empty
+	Dir       string
+	Interval  time.Duration
+	Retention int
+}
+
+// LoadSettings reads the backupdir, backupinterval and backupretention config
+func LoadSettings(conf config.Config) (Settings, error) {
+	s := Settings{Interval: DefaultInterval, Retention: DefaultRetention}
+
+	dir, err := config.GetGlobalConfig("backupdir", "", conf)
+	if err != nil {
+		return s, err
+	}
+	s.Dir = dir
+
+	if val, err := config.GetGlobalConfig("backupinterval", "", conf); err == nil && val != "" {
+		if s.Interval, err = time.ParseDuration(val); err != nil || s.Interval <= 0 {
+			return s, fmt.Errorf("Invalid backupinterval %q", val)
+		}
+	}
+
+	if val, err := config.GetGlobalConfig("backupretention", "", conf); err == nil && val != "" {
+		if s.Retention, err = strconv.Atoi(val); err != nil || s.Retention < 1 {
+			return s, fmt.Errorf("Invalid backupretention %q", val)
+		}
+	}
+
+	return s, nil
+}
+
+// Source is a file or directory that is backed up under Name in the archive, apart from the
+// paths within it that are in Exclude
+type Source struct {
+	Name    string
+	Path    string
+	Exclude []string
+}
+
+// DefaultSources returns the config file, the user definitions dir next to it and the data dir.
+// The archived torrent files in the data dir are left out, as they can be large and are only
+// copies of what was downloaded
+func DefaultSources() ([]Source, error) {
+	configPath, err := config.GetConfigPath()
+	if err != nil {
+		return nil, err
+	}
+
+	return []Source{
+		{Name: filepath.Base(configPath), Path: configPath},
+		{Name: "definitions", Path: filepath.Join(filepath.Dir(configPath), "definitions")},
+		{Name: "data", Path: config.GetDataPath(""), Exclude: []string{"grabs"}},
+	}, nil
+}
+
+// Create writes an archive of the sources to a new file in dir and returns its path. Sources
+// that don't exist are skipped, as is dir itself if it's inside one of them
+func Create(dir string, sources []Source, now time.Time) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+
+	tmp, err := ioutil.TempFile(dir, ".backup")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	gz := gzip.NewWriter(tmp)
+	tw := tar.NewWriter(gz)
+
+	for _, src := range sources {
+		if err = addSource(tw, src, dir); err != nil {
+			tmp.Close()
+			return "", fmt.Errorf("Failed to back up %s: %v", src.Path, err)
+		}
+	}
+
+	if err = tw.Close(); err != nil {
+		tmp.Close()
+		return "", err
+	}
+
+	if err = gz.Close(); err != nil {
+		tmp.Close()
+		return "", err
+	}
+
+	if err = tmp.Close(); err != nil {
+		return "", err
+	}
+
+	f := filepath.Join(dir, filePrefix+now.Format(timeFormat)+fileSuffix)
+	return f, os.Rename(tmp.Name(), f)
+}
+
+func addSource(tw *tar.Writer, src Source, skipDir string) error {
+	skipDir, _ = filepath.Abs(skipDir)
+
+	return filepath.Walk(src.Path, func(path string, fi os.FileInfo, err error) error {
+		if os.IsNotExist(err) && path == src.Path {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src.Path, path)
+		if err != nil {
+			return err
+		}
+
+		for _, exclude := range src.Exclude {
+			if rel == filepath.Clean(exclude) {
+				if fi.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+
+		if fi.IsDir() {
+			if abs, _ := filepath.Abs(path); abs == skipDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// leftovers from interrupted writes aren't worth restoring
+		if !fi.Mode().IsRegular() || strings.HasSuffix(path, ".tmp") {
+			return nil
+		}
+
+		return addFile(tw, filepath.ToSlash(filepath.Join(src.Name, rel)), path, fi)
+	})
+}
+
+func addFile(tw *tar.Writer, name, path string, fi os.FileInfo) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err = tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    int64(fi.Mode().Perm()),
+		Size:    fi.Size(),
+		ModTime: fi.ModTime(),
+	}); err != nil {
+		return err
+	}
+
+	_, err = io.CopyN(tw, f, fi.Size())
+	return err
+}
+
+// List returns the backups in dir, oldest first
+func List(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, filePrefix+"*"+fileSuffix))
+	if err != nil {
+		return nil, err
+	}
+
+	// the timestamps in the names sort in the order they were made
+	sort.Strings(files)
+	return files, nil
+}
+
+// Latest returns when the newest backup in dir was made, or the zero time if there isn't one
+func Latest(dir string) time.Time {
+	files, err := List(dir)
+	if err != nil || len(files) == 0 {
+		return time.Time{}
+	}
+
+	name := filepath.Base(files[len(files)-1])
+	t, err := time.ParseInLocation(timeFormat,
+		strings.TrimSuffix(strings.TrimPrefix(name, filePrefix), fileSuffix), time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// Prune removes all but the newest keep backups in dir, returning the ones it removed
+func Prune(dir string, keep int) ([]string, error) {
+	files, err := List(dir)
+	if err != nil || len(files) <= keep {
+		return nil, err
+	}
+
+	removed := []string{}
+	for _, f := range files[:len(files)-keep] {
+		if err = os.Remove(f); err != nil {
+			return removed, err
+		}
+		removed = append(removed, f)
+	}
+
+	return removed, nil
+}
+
+// Restore extracts a backup over the sources, replacing files that are in it and leaving
+// any others alone. It returns the paths of the files that were restored
+func Restore(archive string, sources []Source) ([]string, error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s isn't a backup: %v", archive, err)
+	}
+
+	restored := []string{}
+	tr := tar.NewReader(gz)
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return restored, nil
+		} else if err != nil {
+			return restored, err
+		}
+
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+
+		path, err := targetPath(hdr.Name, sources)
+		if err != nil {
+			return restored, err
+		}
+
+		if err = restoreFile(tr, path, os.FileMode(hdr.Mode).Perm()); err != nil {
+			return restored, err
+		}
+		restored = append(restored, path)
+	}
+}
+
+// targetPath returns where a file in an archive is restored to
+func targetPath(name string, sources []Source) (string, error) {
+	name = filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("Backup contains an unsafe path %q", name)
+	}
+
+	for _, src := range sources {
+		if name == src.Name {
+			return src.Path, nil
+		}
+		if strings.HasPrefix(name, src.Name+string(filepath.Separator)) {
+			return filepath.Join(src.Path, strings.TrimPrefix(name, src.Name)), nil
+		}
+	}
+
+	return "", fmt.Errorf("Backup contains %q, which isn't somewhere cardigann keeps files", name)
+}
+
+// restoreFile writes a file via a temp file, so a failed restore never leaves half of one
+func restoreFile(r io.Reader, path string, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".restore")
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err = os.Chmod(tmp.Name(), mode|0600); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
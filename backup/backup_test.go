@@ -0,0 +1,124 @@
+package backup
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		f := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(f), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(f, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCreateAndRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cardigann-backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeFiles(t, dir, map[string]string{
+		"config/config.json":                 `{"global": {}}`,
+		"config/definitions/llamas.yml":      "site: llamas",
+		"config/data/audit.jsonl":            "{}\n",
+		"config/data/grabs/abcdef":           "d8:announce",
+		"config/data/seen.json.tmp":          "half written",
+		"config/data/backups/old.tar.gz":     "not included",
+		"config/definitions/alpacas/old.yml": "site: alpacas",
+	})
+
+	sources := []Source{
+		{Name: "config.json", Path: filepath.Join(dir, "config/config.json")},
+		{Name: "definitions", Path: filepath.Join(dir, "config/definitions")},
+		{Name: "data", Path: filepath.Join(dir, "config/data"), Exclude: []string{"grabs"}},
+		{Name: "missing", Path: filepath.Join(dir, "missing")},
+	}
+
+	backupDir := filepath.Join(dir, "config/data/backups")
+	archive, err := Create(backupDir, sources, time.Date(2016, time.August, 25, 13, 14, 15, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := filepath.Join(backupDir, "cardigann-backup-20160825-131415.tar.gz"); archive != expected {
+		t.Fatalf("Expected backup %s, got %s", expected, archive)
+	}
+
+	writeFiles(t, dir, map[string]string{"config/config.json": "corrupt"})
+
+	restored, err := Restore(archive, sources)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(restored) != 4 {
+		t.Fatalf("Expected 4 files to be restored, got %q", restored)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "config/config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != `{"global": {}}` {
+		t.Fatalf("Expected the config to be restored, got %q", b)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cardigann-backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	start := time.Date(2016, time.August, 25, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		if _, err = Create(dir, nil, start.Add(time.Duration(i)*24*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := Prune(dir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		filepath.Join(dir, "cardigann-backup-20160825-000000.tar.gz"),
+		filepath.Join(dir, "cardigann-backup-20160826-000000.tar.gz"),
+	}
+
+	if !reflect.DeepEqual(removed, expected) {
+		t.Fatalf("Expected %q to be removed, got %q", expected, removed)
+	}
+
+	if files, _ := List(dir); len(files) != 2 {
+		t.Fatalf("Expected 2 backups to be left, got %q", files)
+	}
+}
+
+func TestRestoreUnsafePaths(t *testing.T) {
+	sources := []Source{{Name: "data", Path: "/var/lib/cardigann"}}
+
+	for _, name := range []string{"../etc/passwd", "/etc/passwd", "other/file"} {
+		if _, err := targetPath(name, sources); err == nil {
+			t.Errorf("Expected %q to be refused", name)
+		}
+	}
+
+	if path, err := targetPath("data/seen.json", sources); err != nil || path != "/var/lib/cardigann/seen.json" {
+		t.Errorf("Expected data/seen.json to restore to the data dir, got %q, %v", path, err)
+	}
+}
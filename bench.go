@@ -0,0 +1,292 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cardigann/cardigann/indexer"
+	"github.com/cardigann/cardigann/torznab"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+func configureBenchCommand(app *kingpin.Application) {
+	var key, format string
+	var args []string
+	var iterations int
+	var interval time.Duration
+
+	cmd := app.Command("bench", "Measure how long an indexer takes to log in and search, and how many results it returns")
+	cmd.Arg("key", "The indexer key").
+		Required().
+		HintAction(completeIndexerKeys).
+		StringVar(&key)
+
+	cmd.Arg("args", "Torznab format args for the searches, e.g q=llamas").
+		StringsVar(&args)
+
+	cmd.Flag("iterations", "How many times to search").
+		Short('n').
+		Default("5").
+		IntVar(&iterations)
+
+	cmd.Flag("interval", "How long to wait between searches, to go easy on the tracker").
+		Default("1s").
+		DurationVar(&interval)
+
+	cmd.Flag("format", "Either text or json").
+		Default("text").
+		Short('f').
+		EnumVar(&format, "text", "json")
+
+	configureGlobalFlags(cmd)
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		applyGlobalFlags()
+
+		if iterations < 1 {
+			return fmt.Errorf("At least one iteration is needed, got %d", iterations)
+		}
+
+		return benchCommand(key, args, iterations, interval, outputFormat(format))
+	})
+}
+
+// benchDurations sorts durations for finding their percentiles
+type benchDurations []time.Duration
+
+func (slice benchDurations) Len() int {
+	return len(slice)
+}
+
+func (slice benchDurations) Less(i, j int) bool {
+	return slice[i] < slice[j]
+}
+
+func (slice benchDurations) Swap(i, j int) {
+	slice[i], slice[j] = slice[j], slice[i]
+}
+
+// benchSummary is the distribution of a measurement across the iterations, in milliseconds for
+// durations
+type benchSummary struct {
+	Min    float64 `json:"min"`
+	Median float64 `json:"median"`
+	P90    float64 `json:"p90"`
+	Max    float64 `json:"max"`
+	Mean   float64 `json:"mean"`
+}
+
+// summarize returns the distribution of some values, which mustn't be empty
+func summarize(vals []float64) benchSummary {
+	sorted := append([]float64(nil), vals...)
+	sort.Float64s(sorted)
+
+	var total float64
+	for _, v := range sorted {
+		total += v
+	}
+
+	percentile := func(p float64) float64 {
+		return sorted[int(p*float64(len(sorted)-1)+0.5)]
+	}
+
+	return benchSummary{
+		Min:    sorted[0],
+		Median: percentile(0.5),
+		P90:    percentile(0.9),
+		Max:    sorted[len(sorted)-1],
+		Mean:   total / float64(len(sorted)),
+	}
+}
+
+func summarizeDurations(ds []time.Duration) benchSummary {
+	vals := []float64{}
+	for _, d := range ds {
+		vals = append(vals, float64(d)/float64(time.Millisecond))
+	}
+	return summarize(vals)
+}
+
+// benchReport is what the bench command found. Network is the time spent on requests during
+// each search, and parsing is the rest of it
+type benchReport struct {
+	Indexer    string `json:"indexer"`
+	Query      string `json:"query"`
+	Iterations int    `json:"iterations"`
+
+	// Login is how long logging in took, in milliseconds
+	Login      float64 `json:"login"`
+	LoginError string  `json:"loginError,omitempty"`
+
+	Search   *benchSummary `json:"search,omitempty"`
+	Network  *benchSummary `json:"network,omitempty"`
+	Parsing  *benchSummary `json:"parsing,omitempty"`
+	Requests *benchSummary `json:"requests,omitempty"`
+	Results  *benchSummary `json:"results,omitempty"`
+
+	Failures  int    `json:"failures"`
+	LastError string `json:"lastError,omitempty"`
+}
+
+func benchCommand(key string, args []string, iterations int, interval time.Duration, format string) error {
+	conf, err := newConfig()
+	if err != nil {
+		return err
+	}
+
+	def, err := indexer.DefaultDefinitionLoader.Load(key)
+	if err != nil {
+		return err
+	}
+
+	vals := url.Values{"t": []string{"search"}}
+	for _, arg := range args {
+		parsed, err := url.ParseQuery(arg)
+		if err != nil {
+			return err
+		}
+		for k, v := range parsed {
+			vals[k] = v
+		}
+	}
+
+	query, err := torznab.ParseQuery(vals)
+	if err != nil {
+		return fmt.Errorf("Parsing query failed: %s", err.Error())
+	}
+
+	// every search goes to the site, rather than being answered from the cache
+	capture := &indexer.Capture{}
+	runner := indexer.NewRunner(def, indexer.RunnerOpts{
+		Config:     conf,
+		Capture:    capture,
+		CacheTTL:   -1,
+		SessionDir: sessionDir(),
+	})
+
+	report := benchReport{Indexer: key, Query: query.Encode(), Iterations: iterations}
+
+	fmt.Fprintf(os.Stderr, "→ Logging in to %s\n", key)
+	start := time.Now()
+	if err := runner.Login(); err != nil {
+		report.LoginError = err.Error()
+		fmt.Fprintf(os.Stderr, "→ Login failed: %v\n", err)
+	}
+	report.Login = float64(time.Since(start)) / float64(time.Millisecond)
+
+	var searches, network, parsing []time.Duration
+	var requests, results []float64
+
+	for idx := 0; idx < iterations; idx++ {
+		if idx > 0 {
+			time.Sleep(interval)
+		}
+
+		fmt.Fprintf(os.Stderr, "→ Searching %s (%d of %d)\n", key, idx+1, iterations)
+
+		before := len(capture.Exchanges(nil))
+		start := time.Now()
+		items, err := runner.Search(query)
+		elapsed := time.Since(start)
+
+		if err != nil {
+			report.Failures++
+			report.LastError = err.Error()
+			fmt.Fprintf(os.Stderr, "→ Search failed: %v\n", err)
+			continue
+		}
+
+		exchanges := capture.Exchanges(nil)[before:]
+		var spent time.Duration
+		for _, ex := range exchanges {
+			spent += ex.Duration
+		}
+
+		// concurrent requests can add up to longer than the search took
+		parsed := elapsed - spent
+		if parsed < 0 {
+			parsed = 0
+		}
+
+		searches = append(searches, elapsed)
+		network = append(network, spent)
+		parsing = append(parsing, parsed)
+		requests = append(requests, float64(len(exchanges)))
+		results = append(results, float64(len(items)))
+	}
+
+	if len(searches) > 0 {
+		search, net, parse := summarizeDurations(searches), summarizeDurations(network), summarizeDurations(parsing)
+		reqs, res := summarize(requests), summarize(results)
+		report.Search, report.Network, report.Parsing = &search, &net, &parse
+		report.Requests, report.Results = &reqs, &res
+	}
+
+	if format == "json" {
+		b, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\n", b)
+	} else {
+		printBenchReport(report)
+	}
+
+	if report.Failures == iterations {
+		return fmt.Errorf("All %d searches failed", iterations)
+	}
+
+	return nil
+}
+
+func printBenchReport(report benchReport) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintf(w, "Indexer:\t%s\n", report.Indexer)
+	fmt.Fprintf(w, "Query:\t%s\n", report.Query)
+	if report.LoginError != "" {
+		fmt.Fprintf(w, "Login:\tfailed after %s: %s\n", formatMillis(report.Login), report.LoginError)
+	} else {
+		fmt.Fprintf(w, "Login:\t%s\n", formatMillis(report.Login))
+	}
+	fmt.Fprintf(w, "Searches:\t%d of %d succeeded\n", report.Iterations-report.Failures, report.Iterations)
+	if report.LastError != "" {
+		fmt.Fprintf(w, "Last error:\t%s\n", report.LastError)
+	}
+
+	if report.Search != nil {
+		fmt.Fprintf(w, "\n\tmin\tmedian\tp90\tmax\tmean\n")
+		for _, row := range []struct {
+			name    string
+			summary *benchSummary
+			format  func(float64) string
+		}{
+			{"Search", report.Search, formatMillis},
+			{"Network", report.Network, formatMillis},
+			{"Parsing", report.Parsing, formatMillis},
+			{"Requests", report.Requests, formatCount},
+			{"Results", report.Results, formatCount},
+		} {
+			s := row.summary
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", row.name,
+				row.format(s.Min), row.format(s.Median), row.format(s.P90), row.format(s.Max), row.format(s.Mean))
+		}
+	}
+
+	w.Flush()
+}
+
+func formatMillis(ms float64) string {
+	return (time.Duration(ms+0.5) * time.Millisecond).String()
+}
+
+func formatCount(n float64) string {
+	if n == float64(int(n)) {
+		return fmt.Sprintf("%d", int(n))
+	}
+	return fmt.Sprintf("%.1f", n)
+}
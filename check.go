@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cardigann/cardigann/config"
+	"github.com/cardigann/cardigann/indexer"
+	"github.com/cardigann/cardigann/logger"
+	"github.com/cardigann/cardigann/store"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// checkResult is the outcome of one of the checks run by the check command
+type checkResult struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+type checkReport struct {
+	OK     bool          `json:"ok"`
+	Checks []checkResult `json:"checks"`
+}
+
+func (r *checkReport) add(name string, err error) {
+	result := checkResult{Name: name, OK: err == nil}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	r.Checks = append(r.Checks, result)
+}
+
+func (r *checkReport) failures() int {
+	n := 0
+	for _, c := range r.Checks {
+		if !c.OK {
+			n++
+		}
+	}
+	return n
+}
+
+func configureCheckCommand(app *kingpin.Application) {
+	var login bool
+	var format string
+
+	cmd := app.Command("check", "Check that the config, definitions and data dir are usable before starting the server")
+	cmd.Flag("login", "Also log in to each enabled indexer").
+		BoolVar(&login)
+
+	cmd.Flag("format", "Either json or text").
+		Default("json").
+		Short('f').
+		EnumVar(&format, "json", "text")
+
+	configureGlobalFlags(cmd)
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		applyGlobalFlags()
+		return checkCommand(login, outputFormat(format))
+	})
+}
+
+func checkCommand(login bool, format string) error {
+	// the report is the output, so only show problems logged along the way
+	if !globals.Debug {
+		logger.SetLevel(logrus.ErrorLevel)
+	}
+
+	report := runChecks(login)
+
+	switch format {
+	case "json":
+		j, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\n", j)
+	case "text":
+		for _, c := range report.Checks {
+			if c.OK {
+				fmt.Printf("ok    %s\n", c.Name)
+			} else {
+				fmt.Printf("FAIL  %s: %s\n", c.Name, c.Error)
+			}
+		}
+	}
+
+	if n := report.failures(); n > 0 {
+		return fmt.Errorf("%d of %d checks failed", n, len(report.Checks))
+	}
+
+	return nil
+}
+
+func runChecks(login bool) *checkReport {
+	report := &checkReport{}
+
+	conf, err := newConfig()
+	report.add("config", err)
+	if err != nil {
+		report.OK = false
+		return report
+	}
+
+	if f, err := config.GetConfigPath(); err == nil {
+		problems, err := config.ValidateFile(f, configSchema)
+		report.add("config:schema", err)
+		for _, p := range problems {
+			report.add(fmt.Sprintf("config:line%d", p.Line), p)
+		}
+	}
+
+	report.add("datadir", checkWritable(config.GetDataPath("")))
+
+	keys, err := indexer.DefaultDefinitionLoader.List()
+	report.add("definitions", err)
+
+	for _, key := range keys {
+		if !config.IsSectionEnabled(key, conf) {
+			continue
+		}
+
+		def, err := indexer.DefaultDefinitionLoader.Load(key)
+		report.add("definition:"+key, err)
+
+		if err == nil && login {
+			runner := indexer.NewRunner(def, indexer.RunnerOpts{Config: conf, SessionDir: sessionDir()})
+			report.add("login:"+key, runner.Login())
+		}
+	}
+
+	report.OK = report.failures() == 0
+	return report
+}
+
+// checkWritable checks that files can be created in a directory, creating it if needed
+func checkWritable(dir string) error {
+	st, err := store.Open(dir)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(st.Dir(), ".check")
+	if err != nil {
+		return err
+	}
+
+	f.Close()
+	return os.Remove(f.Name())
+}
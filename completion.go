@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// The completion scripts ask cardigann for completions with kingpin's hidden --completion-bash
+// flag. Unlike the scripts built into kingpin they leave out the word being completed unless
+// it's a flag, as kingpin counts a half typed argument as given and would complete the one
+// after it instead, and leave filtering by what's been typed to the shell
+
+const bashCompletionTemplate = `_%[1]s_complete() {
+    local cur="${COMP_WORDS[COMP_CWORD]}" words opts
+    if [[ "$cur" == -* ]]; then
+        words=("${COMP_WORDS[@]:1:$COMP_CWORD}")
+    else
+        words=("${COMP_WORDS[@]:1:$((COMP_CWORD-1))}")
+    fi
+    opts=$("${COMP_WORDS[0]}" --completion-bash "${words[@]}" 2>/dev/null)
+    COMPREPLY=($(compgen -W "$opts" -- "$cur"))
+}
+complete -o default -F _%[1]s_complete %[1]s
+`
+
+const zshCompletionTemplate = `#compdef %[1]s
+autoload -U compinit && compinit
+autoload -U bashcompinit && bashcompinit
+
+` + bashCompletionTemplate
+
+const fishCompletionTemplate = `function __%[1]s_complete
+    set -l words (commandline -opc)
+    set -e words[1]
+    set -l cur (commandline -ct)
+    if string match -q -- '-*' $cur
+        set words $words $cur
+    end
+    %[1]s --completion-bash $words 2>/dev/null
+end
+complete -c %[1]s -f -a '(__%[1]s_complete)'
+`
+
+func configureCompletionCommand(app *kingpin.Application) {
+	var shell string
+
+	cmd := app.Command("completion", "Print a script that completes commands, flags and indexer keys in your shell")
+	cmd.Arg("shell", "One of bash, zsh or fish").
+		Required().
+		EnumVar(&shell, "bash", "zsh", "fish")
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		tmpl := map[string]string{
+			"bash": bashCompletionTemplate,
+			"zsh":  zshCompletionTemplate,
+			"fish": fishCompletionTemplate,
+		}[shell]
+
+		fmt.Printf(tmpl, app.Name)
+		return nil
+	})
+}
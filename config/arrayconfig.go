@@ -26,3 +26,8 @@ func (a ArrayConfig) Sections() ([]string, error) {
 func (a ArrayConfig) Section(section string) (map[string]string, error) {
 	return a[section], nil
 }
+
+func (a ArrayConfig) DeleteSection(section string) error {
+	delete(a, section)
+	return nil
+}
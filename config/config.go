@@ -10,6 +10,7 @@ type Config interface {
 	Set(section, key, value string) error
 	Sections() ([]string, error)
 	Section(section string) (map[string]string, error)
+	DeleteSection(section string) error
 }
 
 // IsSectionEnabled returns true if a section has an enabled=true
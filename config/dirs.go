@@ -16,6 +16,11 @@ var (
 )
 
 func GetConfigPath() (string, error) {
+	// an explicit config file, which services are installed with
+	if configFile := os.Getenv("CONFIG_FILE"); configFile != "" {
+		return configFile, nil
+	}
+
 	cwd, err := os.Getwd()
 	if err != nil {
 		return "", err
@@ -52,6 +57,19 @@ func GetCachePath(file string) string {
 	return app.CachePath(file)
 }
 
+// GetDataPath returns the path to a file in the data dir, which holds state that isn't configuration
+func GetDataPath(file string) string {
+	if dataDir := os.Getenv("DATA_DIR"); dataDir != "" {
+		return filepath.Join(dataDir, file)
+	}
+
+	if configDir := os.Getenv("CONFIG_DIR"); configDir != "" {
+		return filepath.Join(configDir, "data", file)
+	}
+
+	return app.DataPath(file)
+}
+
 func fileExists(f ...string) (string, bool) {
 	full := filepath.Join(f...)
 	if _, err := os.Stat(full); os.IsNotExist(err) {
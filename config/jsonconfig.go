@@ -49,7 +49,7 @@ func (jc *jsonConfig) load() (jsonConfigMap, error) {
 	}
 
 	if err := json.Unmarshal(data, &config); err != nil {
-		return nil, err
+		return nil, jsonError(jc.path, data, err)
 	}
 
 	return config, nil
@@ -127,3 +127,13 @@ func (jc *jsonConfig) Section(section string) (map[string]string, error) {
 
 	return result, nil
 }
+
+func (jc *jsonConfig) DeleteSection(section string) error {
+	c, err := jc.load()
+	if err != nil {
+		return err
+	}
+
+	delete(c, section)
+	return jc.save(c)
+}
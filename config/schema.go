@@ -0,0 +1,389 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Key describes a key that can be set in a section of the config
+type Key struct {
+	Required bool
+
+	// Check returns an error if a value isn't valid for the key, it can be nil if any value is.
+	// Empty values aren't checked, as they mean the default
+	Check func(string) error
+}
+
+// SectionSchema describes the keys that can be set in a section of the config
+type SectionSchema struct {
+	Keys map[string]Key
+
+	// AllowUnknown allows keys that aren't in Keys, they are still type checked
+	AllowUnknown bool
+}
+
+// Schema returns the schema for a section given its values, or an error if there shouldn't be a
+// section with that name
+type Schema func(section string, vals map[string]string) (SectionSchema, error)
+
+// Problem is something wrong with a config file, along with where it was found
+type Problem struct {
+	Line    int
+	Column  int
+	Section string
+	Key     string
+	Message string
+}
+
+func (p Problem) Error() string {
+	var where string
+	switch {
+	case p.Key != "":
+		where = fmt.Sprintf(" (%s.%s)", p.Section, p.Key)
+	case p.Section != "":
+		where = fmt.Sprintf(" (%s)", p.Section)
+	}
+	return fmt.Sprintf("line %d, column %d: %s%s", p.Line, p.Column, p.Message, where)
+}
+
+// CheckBool checks that a value is true or false
+func CheckBool(val string) error {
+	if val == "ok" {
+		return nil
+	}
+	if _, err := strconv.ParseBool(val); err != nil {
+		return fmt.Errorf("%q isn't true or false", val)
+	}
+	return nil
+}
+
+// CheckInt checks that a value is a whole number that isn't negative
+func CheckInt(val string) error {
+	if n, err := strconv.Atoi(val); err != nil || n < 0 {
+		return fmt.Errorf("%q isn't a whole number", val)
+	}
+	return nil
+}
+
+// CheckDuration checks that a value is a duration like 90s or 1h30m
+func CheckDuration(val string) error {
+	if d, err := time.ParseDuration(val); err != nil || d < 0 {
+		return fmt.Errorf("%q isn't a duration like 90s or 1h30m", val)
+	}
+	return nil
+}
+
+// CheckOneOf returns a check that a value is one of the given choices
+func CheckOneOf(choices ...string) func(string) error {
+	return func(val string) error {
+		for _, c := range choices {
+			if val == c {
+				return nil
+			}
+		}
+		return fmt.Errorf("%q must be one of %s", val, strings.Join(choices, ", "))
+	}
+}
+
+// ValidateFile validates a json config file against a schema, a file that doesn't exist is valid
+func ValidateFile(path string, schema Schema) ([]Problem, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return Validate(data, schema), nil
+}
+
+// Validate checks a json config against a schema, returning the problems found in the order
+// they appear in the file
+func Validate(data []byte, schema Schema) []Problem {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		line, col := position(data, errorOffset(err))
+		return []Problem{{Line: line, Column: col, Message: err.Error()}}
+	}
+
+	if _, ok := v.(map[string]interface{}); !ok {
+		return []Problem{{Line: 1, Column: 1, Message: "The config must be an object of sections"}}
+	}
+
+	problems := []Problem{}
+	add := func(offset int, section, key, msg string) {
+		line, col := position(data, offset)
+		problems = append(problems, Problem{line, col, section, key, msg})
+	}
+
+	for _, s := range scanSections(data) {
+		if s.kind != '{' {
+			add(s.offset, s.name, "", "A section must be an object of keys and values")
+			continue
+		}
+
+		vals := map[string]string{}
+		for _, k := range s.keys {
+			vals[k.name] = k.value
+		}
+
+		ss, err := schema(s.name, vals)
+		if err != nil {
+			add(s.offset, s.name, "", err.Error())
+			continue
+		}
+
+		for _, k := range s.keys {
+			key, known := ss.Keys[k.name]
+			switch {
+			case !known && !ss.AllowUnknown:
+				add(k.offset, s.name, k.name, "Unknown key"+suggest(k.name, ss.Keys))
+			case k.kind != '"' && k.kind != 't' && k.kind != 'f':
+				add(k.offset, s.name, k.name, "Values must be strings, true or false")
+			case known && key.Check != nil && k.value != "":
+				if err := key.Check(k.value); err != nil {
+					add(k.offset, s.name, k.name, err.Error())
+				}
+			}
+		}
+
+		missing := []string{}
+		for name, key := range ss.Keys {
+			if _, ok := vals[name]; key.Required && !ok {
+				missing = append(missing, name)
+			}
+		}
+		sort.Strings(missing)
+
+		for _, name := range missing {
+			add(s.offset, s.name, name, "Missing required key")
+		}
+	}
+
+	return problems
+}
+
+// suggest returns a hint naming the known key closest to an unknown one, if there is one that
+// looks like a typo of it
+func suggest(name string, keys map[string]Key) string {
+	best, bestDist := "", 3
+	for k := range keys {
+		if d := editDistance(strings.ToLower(name), k); d < bestDist || (d == bestDist && k < best) {
+			best, bestDist = k, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(", did you mean %q?", best)
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// errorOffset returns the offset in the input at which a json error occurred
+func errorOffset(err error) int {
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		// the offset is after the character that couldn't be parsed
+		if e.Offset > 0 {
+			return int(e.Offset) - 1
+		}
+	case *json.UnmarshalTypeError:
+		return int(e.Offset)
+	}
+	return 0
+}
+
+// position converts an offset into data into a line and column, both starting at 1
+func position(data []byte, offset int) (line, col int) {
+	if offset > len(data) {
+		offset = len(data)
+	}
+	before := data[:offset]
+	line = bytes.Count(before, []byte("\n")) + 1
+	col = offset - bytes.LastIndexByte(before, '\n')
+	return line, col
+}
+
+// jsonError wraps an error from parsing a config file with where in the file it happened
+func jsonError(path string, data []byte, err error) error {
+	switch err.(type) {
+	case *json.SyntaxError, *json.UnmarshalTypeError:
+		line, col := position(data, errorOffset(err))
+		return fmt.Errorf("%s:%d:%d: %v", path, line, col, err)
+	}
+	return err
+}
+
+type scannedKey struct {
+	name   string
+	offset int
+	kind   byte
+	value  string
+}
+
+type scannedSection struct {
+	scannedKey
+	keys []scannedKey
+}
+
+// scanSections finds the sections of a json config and the keys in them, along with their
+// offsets, which encoding/json doesn't keep. The data must already be known to be valid json
+func scanSections(data []byte) []scannedSection {
+	s := &jsonScanner{data: data}
+	sections := []scannedSection{}
+
+	s.skipSpace()
+	s.pos++ // {
+
+	for s.next() {
+		section := scannedSection{scannedKey: s.key()}
+		if section.kind == '{' {
+			s.pos++
+			for s.next() {
+				k := s.key()
+				start := s.pos
+				s.skipValue()
+				if k.kind == '"' {
+					json.Unmarshal(data[start:s.pos], &k.value)
+				} else {
+					k.value = string(data[start:s.pos])
+				}
+				section.keys = append(section.keys, k)
+			}
+		} else {
+			s.skipValue()
+		}
+		sections = append(sections, section)
+	}
+
+	return sections
+}
+
+type jsonScanner struct {
+	data []byte
+	pos  int
+}
+
+func (s *jsonScanner) skipSpace() {
+	for s.pos < len(s.data) && strings.IndexByte(" \t\r\n", s.data[s.pos]) >= 0 {
+		s.pos++
+	}
+}
+
+// next moves on to the next key of an object, returning false and moving past the end of the
+// object if there isn't one
+func (s *jsonScanner) next() bool {
+	s.skipSpace()
+	if s.pos < len(s.data) && s.data[s.pos] == ',' {
+		s.pos++
+		s.skipSpace()
+	}
+	if s.pos >= len(s.data) || s.data[s.pos] == '}' {
+		s.pos++
+		return false
+	}
+	return true
+}
+
+// key reads a key and the colon after it, leaving the scanner at the start of its value
+func (s *jsonScanner) key() scannedKey {
+	k := scannedKey{offset: s.pos}
+	start := s.pos
+	s.skipString()
+	json.Unmarshal(s.data[start:s.pos], &k.name)
+
+	s.skipSpace()
+	s.pos++ // :
+	s.skipSpace()
+
+	if s.pos < len(s.data) {
+		k.kind = s.data[s.pos]
+	}
+	return k
+}
+
+func (s *jsonScanner) skipString() {
+	s.pos++ // opening quote
+	for s.pos < len(s.data) {
+		switch s.data[s.pos] {
+		case '\\':
+			s.pos += 2
+			continue
+		case '"':
+			s.pos++
+			return
+		}
+		s.pos++
+	}
+}
+
+func (s *jsonScanner) skipValue() {
+	s.skipSpace()
+	if s.pos >= len(s.data) {
+		return
+	}
+
+	switch s.data[s.pos] {
+	case '"':
+		s.skipString()
+	case '{', '[':
+		depth := 0
+		for s.pos < len(s.data) {
+			switch s.data[s.pos] {
+			case '"':
+				s.skipString()
+				continue
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+			}
+			s.pos++
+			if depth == 0 {
+				return
+			}
+		}
+	default:
+		for s.pos < len(s.data) && strings.IndexByte(",}] \t\r\n", s.data[s.pos]) < 0 {
+			s.pos++
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testSchema(section string, vals map[string]string) (SectionSchema, error) {
+	switch section {
+	case "global":
+		return SectionSchema{Keys: map[string]Key{
+			"readonly": {Check: CheckBool},
+			"maxrows":  {Check: CheckInt},
+		}}, nil
+	case "llamas":
+		return SectionSchema{Keys: map[string]Key{
+			"enabled":  {Check: CheckBool},
+			"username": {Required: vals["enabled"] == "true"},
+		}}, nil
+	}
+	return SectionSchema{}, errors.New("Unknown indexer")
+}
+
+func TestValidate(t *testing.T) {
+	data := []byte(`{
+  "global": {
+    "readonly": "maybe",
+    "maxrow": "10"
+  },
+  "llamas": {
+    "enabled": true,
+    "password": ["x"]
+  },
+  "alpacas": {}
+}`)
+
+	problems := Validate(data, testSchema)
+
+	expected := []string{
+		`line 3, column 5: "maybe" isn't true or false (global.readonly)`,
+		`line 4, column 5: Unknown key, did you mean "maxrows"? (global.maxrow)`,
+		`line 8, column 5: Unknown key (llamas.password)`,
+		`line 6, column 3: Missing required key (llamas.username)`,
+		`line 10, column 3: Unknown indexer (alpacas)`,
+	}
+
+	actual := []string{}
+	for _, p := range problems {
+		actual = append(actual, p.Error())
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("Expected problems:\n%s\n\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(actual, "\n"))
+	}
+}
+
+func TestValidateSyntaxError(t *testing.T) {
+	problems := Validate([]byte("{\n  \"global\": {\n    \"readonly\": true,\n  }\n}"), testSchema)
+
+	if len(problems) != 1 || problems[0].Line != 4 || problems[0].Column != 3 {
+		t.Fatalf("Expected a single problem on line 4, column 3, got %#v", problems)
+	}
+}
+
+func TestValidateTypes(t *testing.T) {
+	problems := Validate([]byte(`{"llamas": {"enabled": false, "username": 10, "x\"y": null}, "global": "z"}`), func(string, map[string]string) (SectionSchema, error) {
+		return SectionSchema{AllowUnknown: true}, nil
+	})
+
+	if len(problems) != 3 {
+		t.Fatalf("Expected 3 problems, got %#v", problems)
+	}
+
+	for idx, key := range []string{"username", `x"y`, ""} {
+		if problems[idx].Key != key {
+			t.Fatalf("Expected problem %d to be for %q, got %#v", idx, key, problems[idx])
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/cardigann/cardigann/config"
+	"github.com/cardigann/cardigann/indexer"
+	"github.com/cardigann/cardigann/scheduler"
+	"github.com/cardigann/cardigann/server"
+	"github.com/cardigann/cardigann/torznab"
+)
+
+// globalKeys are the keys that can be set in the global section of the config
+var globalKeys = map[string]config.Key{
+	"passphrase":           {},
+	"apikey":               {Check: checkHex},
+	"readonly":             {Check: config.CheckBool},
+	"lowmemory":            {Check: config.CheckBool},
+	"offline":              {Check: config.CheckBool},
+	"offlinecache":         {Check: config.CheckBool},
+	"seasonsearch":         {Check: config.CheckBool},
+	"sessions":             {Check: config.CheckOneOf("lazy", "eager")},
+	"warmupconcurrency":    {Check: config.CheckInt},
+	"aggregatetimeout":     {Check: config.CheckDuration},
+	"aggregatemaxlatency":  {Check: config.CheckDuration},
+	"searchcachettl":       {Check: config.CheckDuration},
+	"prefetch":             {Check: config.CheckBool},
+	"maxbodysize":          {Check: checkSize},
+	"postercachesize":      {Check: checkSize},
+	"maxrows":              {Check: config.CheckInt},
+	"backupdir":            {},
+	"backupinterval":       {Check: config.CheckDuration},
+	"backupretention":      {Check: config.CheckInt},
+	"verifyinterval":       {Check: config.CheckDuration},
+	"errorfeedsize":        {Check: config.CheckInt},
+	"auditlogsize":         {Check: config.CheckInt},
+	"archivegrabs":         {Check: config.CheckBool},
+	"grabarchivesize":      {Check: config.CheckInt},
+	"downloadlinklifetime": {Check: config.CheckDuration},
+	"updatecheck":          {Check: config.CheckBool},
+	"bind":                 {},
+	"port":                 {Check: config.CheckInt},
+	"grpcport":             {Check: config.CheckInt},
+	"pathprefix":           {},
+	"webdir":               {},
+	"concurrency":          {Check: config.CheckInt},
+	"ratelimit":            {Check: config.CheckDuration},
+	"requestbudget":        {Check: checkBudget},
+	"languages":            {Check: checkLanguages},
+	"quiethours":           {Check: checkQuietHours},
+	"quiethoursstrict":     {Check: config.CheckBool},
+	"scoreweights":         {Check: checkScoreWeights},
+}
+
+// indexerKeys are the keys that can be set for any indexer, as well as its settings
+var indexerKeys = map[string]config.Key{
+	"enabled":          {Check: config.CheckBool},
+	"url":              {Check: checkURL},
+	"concurrency":      {Check: config.CheckInt},
+	"ratelimit":        {Check: config.CheckDuration},
+	"requestbudget":    {Check: checkBudget},
+	"timezone":         {Check: checkTimezone},
+	"clockskew":        {Check: checkClockSkew},
+	"sanitize":         {},
+	"quiethours":       {Check: checkQuietHours},
+	"offlinecache":     {Check: config.CheckBool},
+	"seasonsearch":     {Check: config.CheckBool},
+	"quiethoursstrict": {Check: config.CheckBool},
+	"priority":         {Check: checkFloat},
+}
+
+// prefixedSections are the schemas for sections named like prefix:name
+var prefixedSections = map[string]config.SectionSchema{
+	"user:": {Keys: map[string]config.Key{
+		"role":       {Required: true, Check: config.CheckOneOf(server.RoleAdmin, server.RoleReadOnly)},
+		"apikey":     {Required: true, Check: checkHex},
+		"passphrase": {},
+		"languages":  {Check: checkLanguages},
+	}},
+	"job:": {Keys: map[string]config.Key{
+		"schedule":  {Required: true, Check: checkSchedule},
+		"query":     {Check: checkQuery},
+		"indexers":  {Required: true},
+		"target":    {Required: true, Check: checkTarget},
+		"retention": {Check: checkRetention},
+		"enabled":   {Check: config.CheckBool},
+		"dryrun":    {Check: config.CheckBool},
+	}},
+	"search:": {Keys: map[string]config.Key{
+		"query":      {Check: checkQuery},
+		"indexers":   {Required: true},
+		"minseeders": {Check: config.CheckInt},
+		"maxsize":    {Check: checkSize},
+		"include":    {Check: checkRegexp},
+		"exclude":    {Check: checkRegexp},
+	}},
+}
+
+// configSchema describes the sections of config.json, the settings of an indexer are required
+// once it's enabled
+func configSchema(section string, vals map[string]string) (config.SectionSchema, error) {
+	if section == config.GlobalConfigSection {
+		return config.SectionSchema{Keys: globalKeys}, nil
+	}
+
+	for prefix, schema := range prefixedSections {
+		if strings.HasPrefix(section, prefix) {
+			return schema, nil
+		}
+	}
+
+	def, err := indexer.DefaultDefinitionLoader.Load(section)
+	if err != nil {
+		if alias, err := indexer.ResolveAlias(indexer.DefaultDefinitionLoader, section); err == nil && alias.Deprecated {
+			return config.SectionSchema{}, fmt.Errorf("%q has been replaced by %q, its config is moved there when the server starts", section, alias.Target)
+		}
+		return config.SectionSchema{}, fmt.Errorf("Unknown indexer %q", section)
+	}
+
+	enabled := vals["enabled"] == "ok" || vals["enabled"] == "true"
+
+	keys := map[string]config.Key{}
+	for k, v := range indexerKeys {
+		keys[k] = v
+	}
+	for _, setting := range def.Settings {
+		keys[setting.Name] = config.Key{Required: enabled}
+	}
+
+	return config.SectionSchema{Keys: keys}, nil
+}
+
+func checkHex(val string) error {
+	if _, err := hex.DecodeString(val); err != nil {
+		return fmt.Errorf("%q isn't hexadecimal", val)
+	}
+	return nil
+}
+
+func checkSize(val string) error {
+	_, err := indexer.ParseSize(val)
+	return err
+}
+
+func checkURL(val string) error {
+	if u, err := url.Parse(val); err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("%q isn't a url like https://example.org/", val)
+	}
+	return nil
+}
+
+func checkTimezone(val string) error {
+	_, err := indexer.ParseTimezone(val)
+	return err
+}
+
+// checkClockSkew allows negative durations, for sites with clocks that are behind
+func checkClockSkew(val string) error {
+	return config.CheckDuration(strings.TrimPrefix(val, "-"))
+}
+
+func checkSchedule(val string) error {
+	_, err := scheduler.ParseSchedule(val)
+	return err
+}
+
+func checkTarget(val string) error {
+	_, err := scheduler.ParseTarget(val)
+	return err
+}
+
+func checkRetention(val string) error {
+	_, err := scheduler.ParseRetention(val)
+	return err
+}
+
+func checkQuery(val string) error {
+	vals, err := url.ParseQuery(val)
+	if err != nil {
+		return fmt.Errorf("Invalid query %q: %v", val, err)
+	}
+	_, err = torznab.ParseQuery(vals)
+	return err
+}
+
+func checkRegexp(val string) error {
+	if _, err := regexp.Compile(val); err != nil {
+		return fmt.Errorf("Invalid pattern %q: %v", val, err)
+	}
+	return nil
+}
+
+func checkLanguages(val string) error {
+	_, err := torznab.ParseLanguages(val)
+	return err
+}
+
+func checkBudget(val string) error {
+	_, err := indexer.ParseBudget(val)
+	return err
+}
+
+func checkScoreWeights(val string) error {
+	_, err := indexer.ParseScoreWeights(val)
+	return err
+}
+
+func checkFloat(val string) error {
+	if _, err := strconv.ParseFloat(val, 64); err != nil {
+		return fmt.Errorf("%q isn't a number", val)
+	}
+	return nil
+}
+
+func checkQuietHours(val string) error {
+	_, err := indexer.ParseQuietHours(val)
+	return err
+}
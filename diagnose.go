@@ -0,0 +1,210 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cardigann/cardigann/indexer"
+	"github.com/cardigann/cardigann/logger"
+	"github.com/cardigann/cardigann/torznab"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// config keys that aren't secret and are useful to see in a bug report
+var unredactedConfigKeys = map[string]bool{
+	"url":     true,
+	"enabled": true,
+}
+
+func configureDiagnoseCommand(app *kingpin.Application) {
+	var key, file string
+	var args []string
+
+	cmd := app.Command("diagnose", "Run a test search and bundle everything needed for a bug report into a tarball")
+	cmd.Arg("key", "The indexer key").
+		Required().
+		HintAction(completeIndexerKeys).
+		StringVar(&key)
+
+	cmd.Arg("args", "Torznab format args for the test search, e.g q=llamas").
+		StringsVar(&args)
+
+	cmd.Flag("file", "The file to write the bundle to").
+		StringVar(&file)
+
+	configureGlobalFlags(cmd)
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		applyGlobalFlags()
+
+		if file == "" {
+			file = fmt.Sprintf("cardigann-diagnose-%s-%s.tar.gz", key, time.Now().Format("20060102-150405"))
+		}
+
+		return diagnoseCommand(key, file, args)
+	})
+}
+
+func diagnoseCommand(key, output string, args []string) error {
+	conf, err := newConfig()
+	if err != nil {
+		return err
+	}
+
+	def, err := indexer.DefaultDefinitionLoader.Load(key)
+	if err != nil {
+		return err
+	}
+
+	vals := url.Values{"t": []string{"search"}}
+	for _, arg := range args {
+		parsed, err := url.ParseQuery(arg)
+		if err != nil {
+			return err
+		}
+		for k, v := range parsed {
+			vals[k] = v
+		}
+	}
+
+	query, err := torznab.ParseQuery(vals)
+	if err != nil {
+		return fmt.Errorf("Parsing query failed: %s", err.Error())
+	}
+
+	section, err := conf.Section(key)
+	if err != nil {
+		return err
+	}
+
+	redacted := map[string]string{}
+	secrets := []string{}
+	for k, v := range section {
+		if unredactedConfigKeys[k] {
+			redacted[k] = v
+		} else {
+			redacted[k] = "<redacted>"
+			secrets = append(secrets, v)
+		}
+	}
+
+	// capture everything that is logged during the search, not just what would normally be shown
+	logOutput := &bytes.Buffer{}
+	logger.SetOutput(logOutput)
+	logger.SetLevel(logrus.DebugLevel)
+
+	capture := &indexer.Capture{}
+	runner := indexer.NewRunner(def, indexer.RunnerOpts{
+		Config:     conf,
+		Capture:    capture,
+		SessionDir: sessionDir(),
+	})
+
+	fmt.Fprintf(os.Stderr, "→ Searching %s for %s\n", key, query.Encode())
+
+	results, searchErr := runner.Search(query)
+	logger.SetOutput(os.Stderr)
+
+	if searchErr != nil {
+		fmt.Fprintf(os.Stderr, "→ Search failed: %v\n", searchErr)
+	} else {
+		fmt.Fprintf(os.Stderr, "→ Search returned %d results\n", len(results))
+	}
+
+	if results == nil {
+		results = []torznab.ResultItem{}
+	}
+
+	stats := def.Stats()
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"version.json", map[string]string{
+			"version": version(),
+			"go":      runtime.Version(),
+			"os":      runtime.GOOS,
+			"arch":    runtime.GOARCH,
+			"time":    time.Now().Format(time.RFC3339),
+		}},
+		{"definition.yml", def.Raw()},
+		{"definition.json", stats},
+		{"config.json", redacted},
+		{"query.json", vals},
+		{"http.json", capture.Exchanges(secrets)},
+		{"results.json", results},
+		{"log.txt", logOutput.Bytes()},
+	}
+
+	if searchErr != nil {
+		files = append(files, struct {
+			name string
+			data interface{}
+		}{"error.txt", []byte(searchErr.Error())})
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	prefix := fmt.Sprintf("cardigann-diagnose-%s/", key)
+
+	for _, file := range files {
+		b, ok := file.data.([]byte)
+		if !ok {
+			if b, err = json.MarshalIndent(file.data, "", "  "); err != nil {
+				return err
+			}
+		}
+
+		// result links and logged templates can contain passkeys and the like too
+		b = []byte(indexer.Redact(string(b), secrets))
+
+		if err = tw.WriteHeader(&tar.Header{
+			Name:    prefix + file.name,
+			Mode:    0644,
+			Size:    int64(len(b)),
+			ModTime: time.Now(),
+		}); err != nil {
+			return err
+		}
+
+		if _, err = tw.Write(b); err != nil {
+			return err
+		}
+	}
+
+	if err = tw.Close(); err != nil {
+		return err
+	}
+
+	if err = gz.Close(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "→ Wrote %s, check it over before attaching it to a bug report\n", output)
+
+	if outputJSON() {
+		result := struct {
+			File    string `json:"file"`
+			Results int    `json:"results"`
+			Error   string `json:"error,omitempty"`
+		}{File: output, Results: len(results)}
+		if searchErr != nil {
+			result.Error = searchErr.Error()
+		}
+		return printJSON(result)
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cardigann/cardigann/indexer"
+	"github.com/cardigann/cardigann/logger"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// fuzzStackLines is how much of the stack of a panic is printed without --debug
+const fuzzStackLines = 12
+
+func configureFuzzDefinitionCommand(app *kingpin.Application) {
+	var defFile, pageFile, saveDir, baseURL string
+	var iterations int
+	var seed int64
+
+	cmd := app.Command("fuzz-definition", "Look for inputs that crash a definition, by extracting results from mutated copies of it and a saved search results page")
+	cmd.Arg("definition", "The definition yaml file").
+		Required().
+		ExistingFileVar(&defFile)
+
+	cmd.Arg("page", "The saved html page").
+		Required().
+		ExistingFileVar(&pageFile)
+
+	cmd.Flag("iterations", "How many mutations to try").
+		Short('n').
+		Default("1000").
+		IntVar(&iterations)
+
+	cmd.Flag("seed", "The seed for the mutations, to repeat an earlier run").
+		Int64Var(&seed)
+
+	cmd.Flag("save-dir", "A directory to save the definition and page of each crash to").
+		StringVar(&saveDir)
+
+	cmd.Flag("base", "The url to resolve relative links against, defaults to the definition's first link").
+		StringVar(&baseURL)
+
+	configureGlobalFlags(cmd)
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		// the mutations make for a lot of warnings, --debug prints the whole stack of panics instead
+		applyGlobalFlags()
+		logger.SetLevel(logrus.FatalLevel)
+		return fuzzDefinitionCommand(defFile, pageFile, saveDir, baseURL, iterations, seed)
+	})
+}
+
+func fuzzDefinitionCommand(defFile, pageFile, saveDir, baseURL string, iterations int, seed int64) error {
+	src, err := ioutil.ReadFile(defFile)
+	if err != nil {
+		return err
+	}
+
+	page, err := ioutil.ReadFile(pageFile)
+	if err != nil {
+		return err
+	}
+
+	var base *url.URL
+	if baseURL != "" {
+		if base, err = url.Parse(baseURL); err != nil {
+			return err
+		}
+	}
+
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	fmt.Fprintf(os.Stderr, "→ Trying %d mutations of %s and %s with seed %d\n",
+		iterations, defFile, pageFile, seed)
+
+	f := indexer.Fuzzer{
+		Definition: src,
+		Page:       page,
+		Base:       base,
+		Rand:       rand.New(rand.NewSource(seed)),
+	}
+
+	failures, err := f.Run(iterations)
+	if err != nil {
+		return err
+	}
+
+	if outputJSON() {
+		return printFuzzFailures(failures, saveDir, seed)
+	}
+
+	for _, failure := range failures {
+		if failure.Iteration == 0 {
+			fmt.Printf("The unchanged definition and page panicked: %s\n", failure.Panic)
+		} else {
+			fmt.Printf("Mutation #%d panicked: %s\n", failure.Iteration, failure.Panic)
+		}
+
+		for _, m := range failure.Mutations {
+			fmt.Printf("  - %s\n", m)
+		}
+
+		stack := strings.Split(strings.TrimSpace(failure.Stack), "\n")
+		if !globals.Debug && len(stack) > fuzzStackLines {
+			stack = append(stack[:fuzzStackLines], "...")
+		}
+		fmt.Printf("\n  %s\n\n", strings.Join(stack, "\n  "))
+
+		if saveDir != "" {
+			name, err := saveFuzzFailure(saveDir, failure)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("  Saved to %s.yml and %s.html, run them with cardigann extract\n\n", name, name)
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("Found %d inputs that panicked, the same ones are tried again with --seed %d",
+			len(failures), seed)
+	}
+
+	fmt.Printf("No panics in %d mutations\n", iterations)
+	return nil
+}
+
+// fuzzFailureView is an input that panicked, for --output json
+type fuzzFailureView struct {
+	Iteration int      `json:"iteration"`
+	Mutations []string `json:"mutations"`
+	Panic     string   `json:"panic"`
+	Stack     string   `json:"stack"`
+	Saved     string   `json:"saved,omitempty"`
+}
+
+func printFuzzFailures(failures []indexer.FuzzFailure, saveDir string, seed int64) error {
+	views := []fuzzFailureView{}
+
+	for _, failure := range failures {
+		view := fuzzFailureView{
+			Iteration: failure.Iteration,
+			Mutations: failure.Mutations,
+			Panic:     failure.Panic,
+			Stack:     failure.Stack,
+		}
+
+		if saveDir != "" {
+			name, err := saveFuzzFailure(saveDir, failure)
+			if err != nil {
+				return err
+			}
+			view.Saved = name
+		}
+
+		views = append(views, view)
+	}
+
+	if err := printJSON(struct {
+		Seed     int64             `json:"seed"`
+		Failures []fuzzFailureView `json:"failures"`
+	}{seed, views}); err != nil {
+		return err
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("Found %d inputs that panicked", len(failures))
+	}
+	return nil
+}
+
+// saveFuzzFailure writes out the inputs that panicked, so that they can be run again with
+// cardigann extract, and returns the name of the files without their extension
+func saveFuzzFailure(dir string, failure indexer.FuzzFailure) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+
+	name := filepath.Join(dir, fmt.Sprintf("fuzz-%d", failure.Iteration))
+	if err := ioutil.WriteFile(name+".yml", failure.Definition, 0600); err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(name+".html", failure.Page, 0600); err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
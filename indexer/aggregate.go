@@ -2,41 +2,155 @@ package indexer
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/Sirupsen/logrus"
+	"github.com/cardigann/cardigann/config"
 	"github.com/cardigann/cardigann/logger"
 	"github.com/cardigann/cardigann/torznab"
-	"golang.org/x/sync/errgroup"
 )
 
-type Aggregate []torznab.Indexer
+// Aggregate searches several indexers at once, interleaving their results
+type Aggregate struct {
+	Indexers []torznab.Indexer
 
+	// Timeout is how long to wait for the indexers to respond, after which the results from
+	// those that have are returned with a PartialResultsError. Zero waits for all of them
+	Timeout time.Duration
+
+	// MaxLatency leaves indexers whose searches have recently averaged longer than it out of
+	// the search, unless it's zero. They can still be searched directly
+	MaxLatency time.Duration
+
+	// Concurrency is how many indexers are searched at once. Zero searches all of them at once
+	Concurrency int
+
+	// Scorer orders the results by their scores when it's set, otherwise the results of the
+	// indexers are interleaved
+	Scorer Scorer
+}
+
+// AggregateTimeout returns the aggregatetimeout from the global config, or zero if it isn't set
+func AggregateTimeout(conf config.Config) time.Duration {
+	val, err := config.GetGlobalConfig("aggregatetimeout", "", conf)
+	if err != nil || val == "" {
+		return 0
+	}
+
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		logger.Logger.WithError(err).Warnf("Ignoring invalid aggregatetimeout %q", val)
+		return 0
+	}
+
+	return d
+}
+
+// PartialResultsError is returned along with the results of an aggregate search when some
+// of the indexers didn't respond in time
+type PartialResultsError struct {
+	Stragglers []string
+	Timeout    time.Duration
+}
+
+func (e *PartialResultsError) Error() string {
+	return fmt.Sprintf("No response within %s from %s", e.Timeout, strings.Join(e.Stragglers, ", "))
+}
+
+// IsPartialResults returns whether an error is because some indexers didn't respond in time
+func IsPartialResults(err error) bool {
+	_, ok := err.(*PartialResultsError)
+	return ok
+}
+
+type aggregateResult struct {
+	idx   int
+	items []torznab.ResultItem
+}
+
+// searchIndexer searches one of the indexers, so that a panic in it fails its search rather
+// than ending the process
+func searchIndexer(indexer torznab.Indexer, query torznab.Query) (items []torznab.ResultItem, err error) {
+	defer recoverPanic(logrus.Fields{"request": query.RequestID}, &err)
+	return indexer.Search(query)
+}
+
+// Search searches all of the indexers. If some of them don't respond within the timeout, the
+// results of the others are returned along with a PartialResultsError
 func (ag Aggregate) Search(query torznab.Query) ([]torznab.ResultItem, error) {
-	g := errgroup.Group{}
-	allResults := make([][]torznab.ResultItem, len(ag))
-	maxLength := 0
+	if ag.MaxLatency > 0 {
+		ag.Indexers = ag.shedSlow(query)
+	}
+
+	// buffered so that indexers that respond after the timeout don't block
+	resultCh := make(chan aggregateResult, len(ag.Indexers))
+
+	concurrency := ag.Concurrency
+	if concurrency <= 0 || concurrency > len(ag.Indexers) {
+		concurrency = len(ag.Indexers)
+	}
+
+	// the indexers are handed out to a goroutine per slot, which stop taking more of them once
+	// the search has returned, so that indexers that hadn't been started by the timeout aren't
+	pending := make(chan int, len(ag.Indexers))
+	for idx := range ag.Indexers {
+		pending <- idx
+	}
+	close(pending)
+
+	done := make(chan struct{})
+	defer close(done)
 
 	// fetch all results
-	for idx, indexer := range ag {
-		indexerID := indexer.Info().ID
-		idx, indexer := idx, indexer
-		g.Go(func() error {
-			result, err := indexer.Search(query)
-			if err != nil {
-				logger.Logger.Warnf("Indexer %q failed: %s", indexerID, err)
-				return nil
+	for worker := 0; worker < concurrency; worker++ {
+		go func() {
+			for idx := range pending {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				indexer := ag.Indexers[idx]
+				result, err := searchIndexer(indexer, query)
+				if err != nil {
+					indexerID := indexer.Info().ID
+					logger.Logger.
+						WithFields(logrus.Fields{"site": indexerID, "request": query.RequestID}).
+						Warnf("Indexer %q failed: %s", indexerID, err)
+				}
+				resultCh <- aggregateResult{idx, result}
 			}
-			allResults[idx] = result
-			if l := len(result); l > maxLength {
+		}()
+	}
+
+	var timeout <-chan time.Time
+	if ag.Timeout > 0 {
+		timer := time.NewTimer(ag.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	allResults := make([][]torznab.ResultItem, len(ag.Indexers))
+	answered := make([]bool, len(ag.Indexers))
+	maxLength := 0
+
+wait:
+	for remaining := len(ag.Indexers); remaining > 0; remaining-- {
+		select {
+		case res := <-resultCh:
+			allResults[res.idx] = res.items
+			answered[res.idx] = true
+			if l := len(res.items); l > maxLength {
 				maxLength = l
 			}
-			return nil
-		})
-	}
-	if err := g.Wait(); err != nil {
-		logger.Logger.Warn(err)
-		return nil, err
+		case <-timeout:
+			break wait
+		}
 	}
 
 	results := []torznab.ResultItem{}
@@ -50,13 +164,55 @@ func (ag Aggregate) Search(query torznab.Query) ([]torznab.ResultItem, error) {
 		}
 	}
 
+	if ag.Scorer != nil {
+		results = rankResults(ag.Scorer, query, results)
+	}
+
 	if query.Limit > 0 && len(results) > query.Limit {
 		results = results[:query.Limit]
 	}
 
+	stragglers := []string{}
+	for idx, ok := range answered {
+		if !ok {
+			stragglers = append(stragglers, ag.Indexers[idx].Info().ID)
+		}
+	}
+
+	if len(stragglers) > 0 {
+		err := &PartialResultsError{Stragglers: stragglers, Timeout: ag.Timeout}
+		logger.Logger.
+			WithFields(logrus.Fields{"stragglers": stragglers, "request": query.RequestID}).
+			Warn(err)
+		return results, err
+	}
+
 	return results, nil
 }
 
+// shedSlow returns the indexers that aren't too slow to be searched, or all of them if they
+// all are, since slow results are better than none
+func (ag Aggregate) shedSlow(query torznab.Query) []torznab.Indexer {
+	now := time.Now()
+	indexers := []torznab.Indexer{}
+
+	for _, ixr := range ag.Indexers {
+		if isSlow(ixr, ag.MaxLatency, now) {
+			logger.Logger.
+				WithFields(logrus.Fields{"site": ixr.Info().ID, "request": query.RequestID}).
+				Infof("Leaving indexer out of aggregate search, it's slower than %s", ag.MaxLatency)
+			continue
+		}
+		indexers = append(indexers, ixr)
+	}
+
+	if len(indexers) == 0 {
+		return ag.Indexers
+	}
+
+	return indexers
+}
+
 func (ag Aggregate) Info() torznab.Info {
 	return torznab.Info{
 		ID:       "aggregate",
@@ -0,0 +1,213 @@
+package indexer
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cardigann/cardigann/torznab"
+)
+
+type testIndexer struct {
+	id      string
+	delay   time.Duration
+	items   []torznab.ResultItem
+	err     error
+	latency time.Duration
+	panic   string
+
+	// searches counts the searches of the indexer, if it's set
+	searches *int32
+}
+
+func (ti testIndexer) Latency() (time.Duration, time.Time) {
+	if ti.latency == 0 {
+		return 0, time.Time{}
+	}
+	return ti.latency, time.Now()
+}
+
+func (ti testIndexer) Info() torznab.Info {
+	return torznab.Info{ID: ti.id}
+}
+
+func (ti testIndexer) Search(query torznab.Query) ([]torznab.ResultItem, error) {
+	if ti.searches != nil {
+		atomic.AddInt32(ti.searches, 1)
+	}
+	time.Sleep(ti.delay)
+	if ti.panic != "" {
+		panic(ti.panic)
+	}
+	return ti.items, ti.err
+}
+
+func (ti testIndexer) Download(u string) (io.ReadCloser, http.Header, error) {
+	return nil, nil, errors.New("Not implemented")
+}
+
+func (ti testIndexer) Capabilities() torznab.Capabilities {
+	return torznab.Capabilities{}
+}
+
+func TestAggregateSearch(t *testing.T) {
+	agg := Aggregate{Indexers: []torznab.Indexer{
+		testIndexer{id: "a", items: []torznab.ResultItem{{Title: "a1"}, {Title: "a2"}}},
+		testIndexer{id: "b", items: []torznab.ResultItem{{Title: "b1"}}},
+		testIndexer{id: "c", err: errors.New("Broken")},
+	}}
+
+	results, err := agg.Search(torznab.Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	titles := []string{}
+	for _, item := range results {
+		titles = append(titles, item.Title)
+	}
+
+	if expected := []string{"a1", "b1", "a2"}; !reflect.DeepEqual(titles, expected) {
+		t.Fatalf("Expected interleaved results %q, got %q", expected, titles)
+	}
+}
+
+func TestAggregateSearchTimeout(t *testing.T) {
+	agg := Aggregate{
+		Indexers: []torznab.Indexer{
+			testIndexer{id: "fast", items: []torznab.ResultItem{{Title: "fast"}}},
+			testIndexer{id: "slow", delay: time.Second, items: []torznab.ResultItem{{Title: "slow"}}},
+		},
+		Timeout: 50 * time.Millisecond,
+	}
+
+	start := time.Now()
+	results, err := agg.Search(torznab.Query{})
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("Expected search to return after the timeout, took %s", elapsed)
+	}
+
+	if !IsPartialResults(err) {
+		t.Fatalf("Expected a PartialResultsError, got %v", err)
+	}
+
+	if stragglers := err.(*PartialResultsError).Stragglers; !reflect.DeepEqual(stragglers, []string{"slow"}) {
+		t.Fatalf("Expected slow to be a straggler, got %q", stragglers)
+	}
+
+	if len(results) != 1 || results[0].Title != "fast" {
+		t.Fatalf("Expected the results from fast, got %#v", results)
+	}
+}
+
+func TestAggregateSearchConcurrency(t *testing.T) {
+	agg := Aggregate{
+		Indexers: []torznab.Indexer{
+			testIndexer{id: "a", delay: 30 * time.Millisecond, items: []torznab.ResultItem{{Title: "a"}}},
+			testIndexer{id: "b", delay: 30 * time.Millisecond, items: []torznab.ResultItem{{Title: "b"}}},
+			testIndexer{id: "c", delay: 30 * time.Millisecond, items: []torznab.ResultItem{{Title: "c"}}},
+		},
+		Concurrency: 1,
+	}
+
+	start := time.Now()
+	results, err := agg.Search(torznab.Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Fatalf("Expected the indexers to be searched one at a time, took %s", elapsed)
+	}
+
+	if len(results) != 3 {
+		t.Fatalf("Expected results from all of the indexers, got %#v", results)
+	}
+}
+
+func TestAggregateSearchConcurrencyTimeout(t *testing.T) {
+	var searches int32
+	indexers := []torznab.Indexer{}
+	for _, id := range []string{"a", "b", "c", "d"} {
+		indexers = append(indexers, testIndexer{id: id, delay: 50 * time.Millisecond, searches: &searches})
+	}
+
+	agg := Aggregate{Indexers: indexers, Concurrency: 1, Timeout: 20 * time.Millisecond}
+	if _, err := agg.Search(torznab.Query{}); !IsPartialResults(err) {
+		t.Fatalf("Expected a PartialResultsError, got %v", err)
+	}
+
+	// the indexer that was being searched finishes, but the rest aren't started
+	time.Sleep(150 * time.Millisecond)
+	if n := atomic.LoadInt32(&searches); n != 1 {
+		t.Fatalf("Expected only one indexer to be searched after the timeout, got %d", n)
+	}
+}
+
+func TestAggregateSearchMaxLatency(t *testing.T) {
+	agg := Aggregate{
+		Indexers: []torznab.Indexer{
+			testIndexer{id: "fast", latency: time.Second, items: []torznab.ResultItem{{Title: "fast"}}},
+			testIndexer{id: "slow", latency: time.Minute, items: []torznab.ResultItem{{Title: "slow"}}},
+			testIndexer{id: "new", items: []torznab.ResultItem{{Title: "new"}}},
+		},
+		MaxLatency: 10 * time.Second,
+	}
+
+	results, err := agg.Search(torznab.Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	titles := []string{}
+	for _, item := range results {
+		titles = append(titles, item.Title)
+	}
+
+	if expected := []string{"fast", "new"}; !reflect.DeepEqual(titles, expected) {
+		t.Fatalf("Expected the slow indexer to be left out with %q, got %q", expected, titles)
+	}
+}
+
+func TestLatencyTracker(t *testing.T) {
+	l := latencyTracker{}
+	l.observe(10 * time.Second)
+	l.observe(0)
+
+	if avg, _ := l.get(); avg != 7*time.Second {
+		t.Fatalf("Expected an average of 7s, got %s", avg)
+	}
+
+	ixr := testIndexer{latency: time.Minute}
+	if !isSlow(ixr, time.Second, time.Now()) {
+		t.Fatal("Expected an indexer over the max latency to be slow")
+	}
+
+	if isSlow(ixr, time.Second, time.Now().Add(latencyRetryAfter+time.Minute)) {
+		t.Fatal("Expected a slow indexer to be retried after a while")
+	}
+}
+
+func TestAggregateSearchRecoversFromCrash(t *testing.T) {
+	agg := Aggregate{
+		Indexers: []torznab.Indexer{
+			testIndexer{id: "a", items: []torznab.ResultItem{{Title: "a1"}}},
+			testIndexer{id: "b", panic: "llamas"},
+		},
+		Timeout: time.Second,
+	}
+
+	results, err := agg.Search(torznab.Query{})
+	if err != nil {
+		t.Fatalf("Expected the crash to be treated like a failed indexer, got %v", err)
+	}
+
+	if len(results) != 1 || results[0].Title != "a1" {
+		t.Fatalf("Expected the results of the other indexer, got %#v", results)
+	}
+}
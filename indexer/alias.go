@@ -0,0 +1,127 @@
+package indexer
+
+import (
+	"fmt"
+
+	"github.com/cardigann/cardigann/config"
+)
+
+// Alias is a key that isn't a definition's own, but which a definition still answers to. Keys
+// from a definition's replaces are deprecated, as they belonged to definitions that were renamed
+// or merged into it, the ones from its aliases aren't
+type Alias struct {
+	Key        string
+	Target     string
+	Deprecated bool
+}
+
+// Warning returns the warning sent to clients that search a deprecated key
+func (a Alias) Warning() string {
+	return fmt.Sprintf("Indexer %q has been replaced by %q, update your indexer url", a.Key, a.Target)
+}
+
+// ResolveAlias returns the definition key that a key refers to. A key that is a definition's
+// own is returned as it is, otherwise the definitions are searched for one that answers to it
+func ResolveAlias(loader DefinitionLoader, key string) (Alias, error) {
+	if _, err := loader.Load(key); err == nil {
+		return Alias{Key: key, Target: key}, nil
+	} else if err != ErrUnknownIndexer {
+		return Alias{}, err
+	}
+
+	keys, err := loader.List()
+	if err != nil {
+		return Alias{}, err
+	}
+
+	for _, k := range keys {
+		def, err := loader.Load(k)
+		if err != nil {
+			continue
+		}
+		for _, old := range def.Replaces {
+			if old == key {
+				return Alias{Key: key, Target: k, Deprecated: true}, nil
+			}
+		}
+		for _, alias := range def.Aliases {
+			if alias == key {
+				return Alias{Key: key, Target: k}, nil
+			}
+		}
+	}
+
+	return Alias{}, ErrUnknownIndexer
+}
+
+// ReplacedConfig returns the indexers with config that MoveReplacedConfig would move to the
+// definitions that replace them, without changing anything
+func ReplacedConfig(conf config.Config, loader DefinitionLoader) ([]Alias, error) {
+	sections, err := conf.Sections()
+	if err != nil {
+		return nil, err
+	}
+
+	existing := map[string]bool{}
+	for _, section := range sections {
+		existing[section] = true
+	}
+
+	keys, err := loader.List()
+	if err != nil {
+		return nil, err
+	}
+
+	replaced := []Alias{}
+	for _, key := range keys {
+		def, err := loader.Load(key)
+		if err != nil || existing[key] {
+			continue
+		}
+
+		for _, old := range def.Replaces {
+			if !existing[old] {
+				continue
+			}
+			if _, err := loader.Load(old); err == nil {
+				continue
+			}
+
+			replaced = append(replaced, Alias{Key: old, Target: key, Deprecated: true})
+			existing[key], existing[old] = true, false
+			break
+		}
+	}
+
+	return replaced, nil
+}
+
+// MoveReplacedConfig moves the config of indexers that have been replaced by another definition
+// to that definition's section, so that they stay configured and enabled under their new key.
+// Config isn't moved over a section that already exists. It returns the keys that were moved
+func MoveReplacedConfig(conf config.Config, loader DefinitionLoader) ([]Alias, error) {
+	replaced, err := ReplacedConfig(conf, loader)
+	if err != nil {
+		return nil, err
+	}
+
+	moved := []Alias{}
+	for _, alias := range replaced {
+		vals, err := conf.Section(alias.Key)
+		if err != nil {
+			return moved, err
+		}
+		for k, v := range vals {
+			if err := conf.Set(alias.Target, k, v); err != nil {
+				return moved, err
+			}
+		}
+		if err := conf.DeleteSection(alias.Key); err != nil {
+			return moved, err
+		}
+
+		moved = append(moved, alias)
+	}
+
+	return moved, nil
+}
@@ -0,0 +1,93 @@
+package indexer
+
+import (
+	"testing"
+
+	"github.com/cardigann/cardigann/config"
+)
+
+// mapLoader loads definitions from yaml sources keyed by indexer key
+type mapLoader map[string]string
+
+func (ml mapLoader) List() ([]string, error) {
+	keys := []string{}
+	for k := range ml {
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+func (ml mapLoader) Load(key string) (*IndexerDefinition, error) {
+	src, ok := ml[key]
+	if !ok {
+		return nil, ErrUnknownIndexer
+	}
+	return ParseDefinition([]byte(src))
+}
+
+var aliasTestLoader = mapLoader{
+	"llamas":  "site: llamas\nname: Llamas\nreplaces: [oldllamas, llamatracker]\naliases: ll\n",
+	"alpacas": "site: alpacas\nname: Alpacas\n",
+}
+
+func TestResolveAlias(t *testing.T) {
+	for _, tc := range []struct {
+		key        string
+		target     string
+		deprecated bool
+	}{
+		{"llamas", "llamas", false},
+		{"ll", "llamas", false},
+		{"llamatracker", "llamas", true},
+		{"alpacas", "alpacas", false},
+	} {
+		alias, err := ResolveAlias(aliasTestLoader, tc.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if alias.Target != tc.target || alias.Deprecated != tc.deprecated {
+			t.Fatalf("Expected %q to resolve to %q (deprecated %v), got %#v", tc.key, tc.target, tc.deprecated, alias)
+		}
+	}
+
+	if _, err := ResolveAlias(aliasTestLoader, "vicunas"); err != ErrUnknownIndexer {
+		t.Fatalf("Expected an unknown key to be an error, got %v", err)
+	}
+}
+
+func TestMoveReplacedConfig(t *testing.T) {
+	conf := config.ArrayConfig{
+		"oldllamas": {"enabled": "true", "username": "bob"},
+		"alpacas":   {"enabled": "true"},
+	}
+
+	// the migration backs up first when there's something to move
+	replaced, err := ReplacedConfig(conf, aliasTestLoader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replaced) != 1 || conf["oldllamas"] == nil || conf["llamas"] != nil {
+		t.Fatalf("Expected oldllamas to be found without moving it, got %#v", replaced)
+	}
+
+	moved, err := MoveReplacedConfig(conf, aliasTestLoader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(moved) != 1 || moved[0].Key != "oldllamas" || moved[0].Target != "llamas" {
+		t.Fatalf("Expected oldllamas to be moved to llamas, got %#v", moved)
+	}
+
+	if conf["llamas"]["username"] != "bob" || !config.IsSectionEnabled("llamas", conf) {
+		t.Fatalf("Expected the config to be moved, got %#v", conf["llamas"])
+	}
+
+	if _, ok := conf["oldllamas"]; ok {
+		t.Fatal("Expected the old section to be removed")
+	}
+
+	if moved, _ = MoveReplacedConfig(conf, aliasTestLoader); len(moved) != 0 {
+		t.Fatalf("Expected nothing more to move, got %#v", moved)
+	}
+}
@@ -0,0 +1,321 @@
+package indexer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// budgetCacheTTL is how long search results are cached for indexers with a request budget when
+// searchcachettl isn't set, so that there's something to serve once the budget runs out
+const budgetCacheTTL = 15 * time.Minute
+
+// BudgetLimit is how many requests can be made to a site within a window of time
+type BudgetLimit struct {
+	Requests int
+	Window   time.Duration
+}
+
+func (l BudgetLimit) String() string {
+	switch l.Window {
+	case time.Hour:
+		return fmt.Sprintf("%d/hour", l.Requests)
+	case 24 * time.Hour:
+		return fmt.Sprintf("%d/day", l.Requests)
+	}
+	return fmt.Sprintf("%d/%s", l.Requests, l.Window)
+}
+
+// ParseBudget parses a comma separated list of request limits, like 100/hour,500/day. Windows
+// can also be given as durations, like 50/15m
+func ParseBudget(s string) ([]BudgetLimit, error) {
+	limits := []BudgetLimit{}
+
+	for _, val := range strings.Split(s, ",") {
+		if val = strings.TrimSpace(val); val == "" {
+			continue
+		}
+
+		tokens := strings.SplitN(val, "/", 2)
+		if len(tokens) != 2 {
+			return nil, fmt.Errorf("Invalid request budget %q, expected requests/window", val)
+		}
+
+		n, err := strconv.Atoi(strings.TrimSpace(tokens[0]))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("Invalid number of requests in budget %q", val)
+		}
+
+		var window time.Duration
+		switch w := strings.ToLower(strings.TrimSpace(tokens[1])); w {
+		case "hour", "h":
+			window = time.Hour
+		case "day", "d":
+			window = 24 * time.Hour
+		default:
+			if window, err = time.ParseDuration(w); err != nil || window <= 0 {
+				return nil, fmt.Errorf("Invalid window in budget %q", val)
+			}
+		}
+
+		limits = append(limits, BudgetLimit{Requests: n, Window: window})
+	}
+
+	return limits, nil
+}
+
+// BudgetExhaustedError is returned when the requests a site allows in a window have been used
+// up, and no more will be made to it until then
+type BudgetExhaustedError struct {
+	Site  string
+	Limit BudgetLimit
+	Until time.Time
+}
+
+func (e *BudgetExhaustedError) Error() string {
+	return fmt.Sprintf("%s has used its request budget of %s, more requests can be made after %s",
+		e.Site, e.Limit, e.Until.Format(time.Kitchen))
+}
+
+// IsBudgetExhausted returns whether an error is because an indexer used up its request budget
+func IsBudgetExhausted(err error) bool {
+	_, ok := err.(*BudgetExhaustedError)
+	return ok
+}
+
+// BudgetUsage is how many requests have been made to a site in the window of one of its limits
+type BudgetUsage struct {
+	BudgetLimit
+	Used int
+}
+
+// requestBudget counts the requests made to a site in the windows of its limits. When it has a
+// file the requests are kept in it, so that they survive restarts and are shared by the processes
+// using the same data dir, otherwise they're only kept in memory
+type requestBudget struct {
+	site   string
+	limits []BudgetLimit
+	file   string
+	logger logrus.FieldLogger
+
+	mu sync.Mutex
+
+	// requests are when each request within the longest window was made, oldest first
+	requests []time.Time
+}
+
+func newRequestBudget(site string, limits []BudgetLimit) *requestBudget {
+	return &requestBudget{site: site, limits: limits}
+}
+
+// savedBudget is the requests made to a site, as saved in a budget file
+type savedBudget struct {
+	Requests []time.Time `json:"requests"`
+}
+
+// load reads the requests from the budget file, keeping the ones in memory if there isn't one
+// or it can't be read. It must be called whilst holding the lock
+func (b *requestBudget) load() {
+	if b.file == "" {
+		return
+	}
+
+	data, err := ioutil.ReadFile(b.file)
+	if os.IsNotExist(err) {
+		return
+	}
+
+	var saved savedBudget
+	if err == nil {
+		err = json.Unmarshal(data, &saved)
+	}
+	if err != nil {
+		b.logger.WithError(err).Warn("Failed to read request budget")
+		return
+	}
+
+	b.requests = saved.Requests
+}
+
+// save writes the requests to the budget file. It must be called whilst holding the lock
+func (b *requestBudget) save() {
+	data, err := json.Marshal(savedBudget{Requests: b.requests})
+	if err == nil {
+		tmp := b.file + ".tmp"
+		if err = ioutil.WriteFile(tmp, data, 0600); err == nil {
+			err = os.Rename(tmp, b.file)
+		}
+	}
+	if err != nil {
+		b.logger.WithError(err).Warn("Failed to save request budget")
+	}
+}
+
+// prune drops the requests that are older than the longest window. It must be called whilst
+// holding the lock
+func (b *requestBudget) prune(now time.Time) {
+	var longest time.Duration
+	for _, l := range b.limits {
+		if l.Window > longest {
+			longest = l.Window
+		}
+	}
+
+	idx := 0
+	for idx < len(b.requests) && now.Sub(b.requests[idx]) >= longest {
+		idx++
+	}
+	b.requests = b.requests[idx:]
+}
+
+// used returns how many requests have been made within a window. It must be called whilst
+// holding the lock
+func (b *requestBudget) used(window time.Duration, now time.Time) int {
+	for idx, t := range b.requests {
+		if now.Sub(t) < window {
+			return len(b.requests) - idx
+		}
+	}
+	return 0
+}
+
+// exhausted returns a BudgetExhaustedError if one of the limits has been reached
+func (b *requestBudget) exhausted(now time.Time) *BudgetExhaustedError {
+	if b == nil || len(b.limits) == 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.load()
+	return b.check(now)
+}
+
+// check returns a BudgetExhaustedError for the limit that frees up last, if any have been
+// reached. It must be called whilst holding the lock
+func (b *requestBudget) check(now time.Time) *BudgetExhaustedError {
+	b.prune(now)
+
+	var err *BudgetExhaustedError
+	for _, l := range b.limits {
+		if b.used(l.Window, now) < l.Requests {
+			continue
+		}
+		// another request can be made once the one that reached the limit leaves the window
+		until := b.requests[len(b.requests)-l.Requests].Add(l.Window)
+		if err == nil || until.After(err.Until) {
+			err = &BudgetExhaustedError{Site: b.site, Limit: l, Until: until}
+		}
+	}
+	return err
+}
+
+// spend counts a request, or returns a BudgetExhaustedError if it would go over a limit
+func (b *requestBudget) spend(now time.Time) error {
+	if b == nil || len(b.limits) == 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// other processes spend the same budget, so it's read and written under a lock file
+	if b.file != "" {
+		unlock, err := lockFile(b.file+".lock", "Waiting for another process to count a request", b.logger)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		b.load()
+	}
+
+	if err := b.check(now); err != nil {
+		return err
+	}
+
+	b.requests = append(b.requests, now)
+
+	if b.file != "" {
+		b.save()
+	}
+	return nil
+}
+
+// usage returns how much of each limit has been used
+func (b *requestBudget) usage(now time.Time) []BudgetUsage {
+	if b == nil || len(b.limits) == 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.load()
+	b.prune(now)
+
+	usage := []BudgetUsage{}
+	for _, l := range b.limits {
+		usage = append(usage, BudgetUsage{BudgetLimit: l, Used: b.used(l.Window, now)})
+	}
+	return usage
+}
+
+// budgetTransport refuses requests once the site's request budget has been used up
+type budgetTransport struct {
+	transport http.RoundTripper
+	budget    *requestBudget
+}
+
+func (t *budgetTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.budget.spend(time.Now()); err != nil {
+		return nil, err
+	}
+	return t.transport.RoundTrip(req)
+}
+
+// newRequestBudget creates the request budget from the requestbudget key of the config, which is
+// kept in the session dir when there is one
+func (r *Runner) newRequestBudget() *requestBudget {
+	val := r.siteConfig("requestbudget")
+	if val == "" {
+		return newRequestBudget(r.definition.Site, nil)
+	}
+
+	limits, err := ParseBudget(val)
+	if err != nil {
+		r.logger.WithError(err).Warn("Ignoring invalid requestbudget")
+		return newRequestBudget(r.definition.Site, nil)
+	}
+
+	b := newRequestBudget(r.definition.Site, limits)
+	if r.opts.SessionDir != "" {
+		if err := os.MkdirAll(r.opts.SessionDir, 0700); err != nil {
+			r.logger.WithError(err).Warn("Keeping the request budget in memory")
+			return b
+		}
+		b.file = filepath.Join(r.opts.SessionDir, r.definition.Site+".budget.json")
+		b.logger = r.baseLogger
+	}
+	return b
+}
+
+// BudgetExhausted returns why requests to the site are being held off for having used up its
+// request budget, or nil if they aren't
+func (r *Runner) BudgetExhausted() *BudgetExhaustedError {
+	return r.budget.exhausted(time.Now())
+}
+
+// BudgetUsage returns how much of the site's request budget has been used, if it has one
+func (r *Runner) BudgetUsage() []BudgetUsage {
+	return r.budget.usage(time.Now())
+}
@@ -0,0 +1,165 @@
+package indexer
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cardigann/cardigann/config"
+	"github.com/cardigann/cardigann/logger"
+	"github.com/cardigann/cardigann/torznab"
+	"github.com/jarcoal/httpmock"
+)
+
+func TestParseBudget(t *testing.T) {
+	limits, err := ParseBudget("100/hour, 500/day,20/15m")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []BudgetLimit{
+		{Requests: 100, Window: time.Hour},
+		{Requests: 500, Window: 24 * time.Hour},
+		{Requests: 20, Window: 15 * time.Minute},
+	}
+
+	if len(limits) != len(expected) {
+		t.Fatalf("Expected %d limits, got %#v", len(expected), limits)
+	}
+	for idx := range expected {
+		if limits[idx] != expected[idx] {
+			t.Errorf("Expected %s, got %s", expected[idx], limits[idx])
+		}
+	}
+
+	for _, val := range []string{"100", "0/hour", "lots/day", "10/fortnight"} {
+		if _, err := ParseBudget(val); err == nil {
+			t.Errorf("Expected %q to be invalid", val)
+		}
+	}
+}
+
+func TestRequestBudget(t *testing.T) {
+	b := newRequestBudget("example", []BudgetLimit{
+		{Requests: 2, Window: time.Minute},
+		{Requests: 3, Window: time.Hour},
+	})
+	start := time.Date(2017, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for idx, offset := range []time.Duration{0, 10 * time.Second} {
+		if err := b.spend(start.Add(offset)); err != nil {
+			t.Fatalf("Request #%d: unexpected error %v", idx+1, err)
+		}
+	}
+
+	err := b.spend(start.Add(20 * time.Second))
+	be, ok := err.(*BudgetExhaustedError)
+	if !ok || be.Until != start.Add(time.Minute) {
+		t.Fatalf("Expected the minute budget to be used up until 12:01, got %v", err)
+	}
+
+	if err := b.spend(start.Add(time.Minute)); err != nil {
+		t.Fatalf("Expected a request once the first left the window, got %v", err)
+	}
+
+	be = b.exhausted(start.Add(2 * time.Minute))
+	if be == nil || be.Limit.Window != time.Hour || be.Until != start.Add(time.Hour) {
+		t.Fatalf("Expected the hour budget to be used up until 13:00, got %v", be)
+	}
+
+	usage := b.usage(start.Add(2 * time.Minute))
+	if len(usage) != 2 || usage[0].Used != 0 || usage[1].Used != 3 {
+		t.Fatalf("Unexpected usage %#v", usage)
+	}
+}
+
+func TestRunnerBudgetServesCachedResults(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	def, err := ParseDefinition([]byte(exampleMaintenanceDefinition))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := &config.ArrayConfig{
+		"example": map[string]string{"url": "https://example.org/", "requestbudget": "2/hour"},
+		"global":  map[string]string{"searchcachettl": "1ns"},
+	}
+
+	// checking the url counts as a request too
+	registerResponder("GET", "https://example.org/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, ""), nil
+	})
+
+	var requests int
+	registerResponder("GET", "https://example.org/torrents.php", func(req *http.Request) (*http.Response, error) {
+		requests++
+		return httpmock.NewStringResponse(http.StatusOK,
+			"<html><body><table><tr><td>llamas</td></tr></table></body></html>"), nil
+	})
+
+	r := NewRunner(def, RunnerOpts{Config: conf})
+
+	items, err := r.Search(torznab.Query{Q: "llamas"})
+	if err != nil || len(items) != 1 {
+		t.Fatalf("Expected 1 result, got %d, %v", len(items), err)
+	}
+
+	time.Sleep(time.Millisecond)
+
+	items, err = r.Search(torznab.Query{Q: "llamas"})
+	if !IsBudgetExhausted(err) {
+		t.Fatalf("Expected the budget to be used up, got %v", err)
+	}
+
+	if len(items) != 1 || items[0].Title != "llamas" {
+		t.Fatalf("Expected the cached result along with the error, got %#v", items)
+	}
+
+	if _, err = r.Search(torznab.Query{Q: "alpacas"}); !IsBudgetExhausted(err) {
+		t.Fatalf("Expected the budget to be used up for other queries, got %v", err)
+	}
+
+	if requests != 1 {
+		t.Fatalf("Expected 1 request, got %d", requests)
+	}
+}
+
+func TestRequestBudget_SharedFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "budget")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	limits := []BudgetLimit{{Requests: 2, Window: 24 * time.Hour}}
+	file := filepath.Join(dir, "example.budget.json")
+	now := time.Now()
+
+	// a server and a command line process, or the same server before and after a restart
+	first := &requestBudget{site: "example", limits: limits, file: file, logger: logger.Logger}
+	second := &requestBudget{site: "example", limits: limits, file: file, logger: logger.Logger}
+
+	if err := first.spend(now); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.spend(now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	if usage := first.usage(now.Add(2 * time.Minute)); len(usage) != 1 || usage[0].Used != 2 {
+		t.Fatalf("Expected both requests to be counted, got %#v", usage)
+	}
+
+	if err := first.spend(now.Add(2 * time.Minute)); !IsBudgetExhausted(err) {
+		t.Fatalf("Expected the shared budget to be used up, got %v", err)
+	}
+
+	if _, err := os.Stat(file + ".lock"); !os.IsNotExist(err) {
+		t.Fatalf("Expected the budget lock to be released, got %v", err)
+	}
+}
@@ -0,0 +1,293 @@
+package indexer
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cardigann/cardigann/config"
+	"github.com/cardigann/cardigann/torznab"
+)
+
+const (
+	// prefetchMinRequests is how many times a query has to be searched for before its results
+	// are refreshed ahead of them expiring from the cache
+	prefetchMinRequests = 2
+
+	// prefetchLead is the fraction of the cache ttl before results expire that they are refreshed
+	prefetchLead = 0.1
+)
+
+type cacheEntry struct {
+	query   torznab.Query
+	items   []torznab.ResultItem
+	fetched time.Time
+
+	// requests is how many times the query has been searched for, and requested the last time
+	requests  int
+	requested time.Time
+
+	// prefetch is the timer that refreshes the results before they expire, if it's scheduled
+	prefetch *time.Timer
+}
+
+// searchCache keeps the results of searches for a while, keyed by the encoded query
+type searchCache struct {
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+
+	// maxEntries is how many queries are kept, dropping the least recently requested ones
+	// first. Zero keeps them all
+	maxEntries int
+}
+
+// cacheKey returns the key that a query is cached under, which ignores what identifies the client
+// and the languages, which results are filtered by after they're cached
+func cacheKey(query torznab.Query) string {
+	query.APIKey = ""
+	query.RequestID = ""
+	query.Languages = nil
+	query.Flags = nil
+	return query.Encode()
+}
+
+// request counts a search for a query and returns its results if they were cached less than
+// ttl ago
+func (c *searchCache) request(key string, query torznab.Query, ttl time.Duration, now time.Time) ([]torznab.ResultItem, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = map[string]*cacheEntry{}
+	}
+
+	e, ok := c.entries[key]
+	if !ok {
+		e = &cacheEntry{query: query}
+		c.entries[key] = e
+	}
+
+	e.requests++
+	e.requested = now
+
+	if e.fetched.IsZero() || now.Sub(e.fetched) >= ttl {
+		return nil, false
+	}
+
+	return copyItems(e.items), true
+}
+
+// stale returns the results for a query that were last cached, even if they've expired
+func (c *searchCache) stale(key string) ([]torznab.ResultItem, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok || e.fetched.IsZero() {
+		return nil, false
+	}
+	return copyItems(e.items), true
+}
+
+// put stores the results for a query, dropping any other results that have expired
+func (c *searchCache) put(key string, items []torznab.ResultItem, ttl time.Duration, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k, e := range c.entries {
+		if k != key && e.prefetch == nil && now.Sub(e.requested) >= ttl && now.Sub(e.fetched) >= ttl {
+			delete(c.entries, k)
+		}
+	}
+
+	if e, ok := c.entries[key]; ok {
+		e.items = copyItems(items)
+		e.fetched = now
+	}
+
+	for c.maxEntries > 0 && len(c.entries) > c.maxEntries {
+		if !c.evict(key) {
+			break
+		}
+	}
+}
+
+// evict drops the least recently requested entry other than key, returning false if there
+// isn't one. It must be called whilst holding the lock
+func (c *searchCache) evict(key string) bool {
+	var oldest *cacheEntry
+	var oldestKey string
+	for k, e := range c.entries {
+		if k != key && (oldest == nil || e.requested.Before(oldest.requested)) {
+			oldest, oldestKey = e, k
+		}
+	}
+
+	if oldest == nil {
+		return false
+	}
+	if oldest.prefetch != nil {
+		oldest.prefetch.Stop()
+	}
+	delete(c.entries, oldestKey)
+	return true
+}
+
+// schedule calls refresh shortly before the results of a recurring query expire, unless it's
+// already scheduled to
+func (c *searchCache) schedule(key string, ttl time.Duration, refresh func(key string)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok || e.prefetch != nil || e.fetched.IsZero() || e.requests < prefetchMinRequests {
+		return
+	}
+
+	lead := time.Duration(float64(ttl) * prefetchLead)
+	delay := e.fetched.Add(ttl - lead).Sub(time.Now())
+	if delay < 0 {
+		delay = 0
+	}
+
+	e.prefetch = time.AfterFunc(delay, func() { refresh(key) })
+}
+
+// due returns the query to refresh once the prefetch timer has fired, as long as it has been
+// searched for since it was last fetched. Queries that have stopped recurring are left to expire
+func (c *searchCache) due(key string) (torznab.Query, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return torznab.Query{}, false
+	}
+
+	e.prefetch = nil
+	if !e.requested.After(e.fetched) {
+		return torznab.Query{}, false
+	}
+
+	return e.query, true
+}
+
+// copyItems copies results so that callers can rewrite them without changing the cache
+func copyItems(items []torznab.ResultItem) []torznab.ResultItem {
+	if items == nil {
+		return nil
+	}
+	return append([]torznab.ResultItem(nil), items...)
+}
+
+// cacheTTL returns how long search results are cached for, from the runner options then the
+// searchcachettl global config. Zero turns the cache off. Indexers with a request budget cache
+// results unless it's turned off
+func (r *Runner) cacheTTL() time.Duration {
+	if r.opts.CacheTTL != 0 {
+		return r.opts.CacheTTL
+	}
+
+	if r.opts.Config != nil {
+		val, err := config.GetGlobalConfig("searchcachettl", "", r.opts.Config)
+		if err == nil && val != "" {
+			if d, err := time.ParseDuration(val); err == nil && d >= 0 {
+				return d
+			}
+			r.baseLogger.WithField("searchcachettl", val).Warn("Ignoring invalid searchcachettl")
+		}
+	}
+
+	if r.budget != nil && len(r.budget.limits) > 0 {
+		return budgetCacheTTL
+	}
+
+	return 0
+}
+
+// prefetchEnabled returns whether recurring queries are refreshed before they expire from the
+// cache, which they are unless the prefetch global config is false
+func (r *Runner) prefetchEnabled() bool {
+	if r.opts.Config == nil {
+		return true
+	}
+
+	val, err := config.GetGlobalConfig("prefetch", "", r.opts.Config)
+	if err != nil || val == "" {
+		return true
+	}
+
+	enabled, err := strconv.ParseBool(val)
+	if err != nil {
+		r.baseLogger.WithField("prefetch", val).Warn("Ignoring invalid prefetch")
+		return true
+	}
+
+	return enabled
+}
+
+// cachedSearch serves a search from the cache if it can, otherwise searches and caches the results
+func (r *Runner) cachedSearch(query torznab.Query, ttl time.Duration) ([]torznab.ResultItem, error) {
+	key := cacheKey(query)
+
+	if items, ok := r.cache.request(key, query, ttl, time.Now()); ok {
+		logger := r.baseLogger.WithFields(logrus.Fields{"query": key})
+		if query.RequestID != "" {
+			logger = logger.WithField("request", query.RequestID)
+		}
+		logger.Debug("Serving cached search results")
+		r.schedulePrefetch(key, ttl)
+		return items, nil
+	}
+
+	items, err := r.timedSearch(query)
+	if IsBudgetExhausted(err) || IsQuietHours(err) {
+		// stale results are better than none until the budget or quiet hours allow another search
+		if stale, ok := r.cache.stale(key); ok {
+			r.baseLogger.WithFields(logrus.Fields{"query": key}).WithError(err).Debug("Serving stale search results")
+			return stale, err
+		}
+	}
+	if err != nil {
+		return items, err
+	}
+
+	r.cache.put(key, items, ttl, time.Now())
+	r.schedulePrefetch(key, ttl)
+	return items, nil
+}
+
+func (r *Runner) schedulePrefetch(key string, ttl time.Duration) {
+	if !r.prefetchEnabled() {
+		return
+	}
+
+	r.cache.schedule(key, ttl, func(key string) {
+		r.prefetch(key, ttl)
+	})
+}
+
+// prefetch refreshes the cached results of a recurring query before they expire
+func (r *Runner) prefetch(key string, ttl time.Duration) {
+	query, ok := r.cache.due(key)
+	if !ok {
+		r.baseLogger.WithFields(logrus.Fields{"query": key}).Debug("Query stopped recurring, not prefetching")
+		return
+	}
+
+	query.RequestID = ""
+	query.Automatic = true
+	items, err := r.timedSearch(query)
+	if IsQuietHours(err) {
+		r.baseLogger.WithFields(logrus.Fields{"query": key}).Debug("Not prefetching search results in quiet hours")
+		return
+	} else if err != nil {
+		r.baseLogger.WithFields(logrus.Fields{"query": key}).WithError(err).Warn("Prefetching search results failed")
+		return
+	}
+
+	r.baseLogger.WithFields(logrus.Fields{"query": key, "results": len(items)}).Debug("Prefetched search results")
+	r.cache.put(key, items, ttl, time.Now())
+	r.schedulePrefetch(key, ttl)
+}
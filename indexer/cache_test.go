@@ -0,0 +1,93 @@
+package indexer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cardigann/cardigann/torznab"
+)
+
+func TestSearchCache(t *testing.T) {
+	c := searchCache{}
+	query := torznab.Query{Q: "llamas", APIKey: "secret", RequestID: "abc123"}
+	key := cacheKey(query)
+	now := time.Now()
+
+	if key != cacheKey(torznab.Query{Q: "llamas"}) {
+		t.Fatalf("Expected the cache key to ignore the apikey and request id, got %q", key)
+	}
+
+	if _, ok := c.request(key, query, time.Minute, now); ok {
+		t.Fatal("Expected a miss before anything is cached")
+	}
+
+	c.put(key, []torznab.ResultItem{{Title: "llamas"}}, time.Minute, now)
+
+	items, ok := c.request(key, query, time.Minute, now.Add(30*time.Second))
+	if !ok || len(items) != 1 {
+		t.Fatalf("Expected a hit, got %#v", items)
+	}
+
+	items[0].Title = "rewritten"
+	if items, _ = c.request(key, query, time.Minute, now.Add(30*time.Second)); items[0].Title != "llamas" {
+		t.Fatalf("Expected changes to results not to change the cache, got %q", items[0].Title)
+	}
+
+	if _, ok := c.request(key, query, time.Minute, now.Add(time.Minute)); ok {
+		t.Fatal("Expected a miss once the results expire")
+	}
+}
+
+func TestSearchCacheMaxEntries(t *testing.T) {
+	c := searchCache{maxEntries: 2}
+	now := time.Now()
+
+	for idx, q := range []string{"llamas", "alpacas", "vicunas"} {
+		query := torznab.Query{Q: q}
+		key := cacheKey(query)
+		c.request(key, query, time.Hour, now.Add(time.Duration(idx)*time.Second))
+		c.put(key, []torznab.ResultItem{{Title: q}}, time.Hour, now)
+	}
+
+	if len(c.entries) != 2 {
+		t.Fatalf("Expected 2 cached queries, got %d", len(c.entries))
+	}
+
+	if _, ok := c.entries[cacheKey(torznab.Query{Q: "llamas"})]; ok {
+		t.Fatal("Expected the least recently requested query to be dropped")
+	}
+}
+
+func TestSearchCachePrefetch(t *testing.T) {
+	c := searchCache{}
+	query := torznab.Query{Q: "llamas"}
+	key := cacheKey(query)
+	refreshed := make(chan string, 1)
+	refresh := func(key string) { refreshed <- key }
+
+	c.request(key, query, time.Second, time.Now())
+	c.put(key, nil, time.Second, time.Now())
+	c.schedule(key, time.Second, refresh)
+
+	if c.entries[key].prefetch != nil {
+		t.Fatal("Expected a query searched for once not to be prefetched")
+	}
+
+	c.request(key, query, time.Second, time.Now())
+	c.schedule(key, time.Second, refresh)
+
+	select {
+	case <-refreshed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected a recurring query to be prefetched before it expired")
+	}
+
+	if q, ok := c.due(key); !ok || q.Q != "llamas" {
+		t.Fatalf("Expected a query searched for since it was fetched to be due, got %#v", q)
+	}
+
+	c.put(key, nil, time.Second, time.Now())
+	if _, ok := c.due(key); ok {
+		t.Fatal("Expected a query not searched for since it was fetched to stop being prefetched")
+	}
+}
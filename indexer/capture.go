@@ -0,0 +1,204 @@
+package indexer
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cardigann/cardigann/logger"
+)
+
+const (
+	maxCapturedBody = 1024 * 1024
+	redactedValue   = "<redacted>"
+)
+
+var sensitiveHeaders = []string{
+	"Authorization",
+	"Cookie",
+	"Proxy-Authorization",
+	"Set-Cookie",
+}
+
+// CapturedExchange is a single http request and the response to it
+type CapturedExchange struct {
+	Time            time.Time     `json:"time"`
+	RequestID       string        `json:"requestId,omitempty"`
+	Duration        time.Duration `json:"duration"`
+	Method          string        `json:"method"`
+	URL             string        `json:"url"`
+	RequestHeaders  http.Header   `json:"requestHeaders"`
+	RequestBody     string        `json:"requestBody,omitempty"`
+	Status          int           `json:"status,omitempty"`
+	ResponseHeaders http.Header   `json:"responseHeaders,omitempty"`
+	ResponseBody    string        `json:"responseBody,omitempty"`
+	Error           string        `json:"error,omitempty"`
+}
+
+// Capture records the http requests made by a runner, for attaching to bug reports
+type Capture struct {
+	mu        sync.Mutex
+	exchanges []CapturedExchange
+}
+
+// Exchanges returns the requests captured so far, with cookies and the given secrets removed
+func (c *Capture) Exchanges(secrets []string) []CapturedExchange {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result := []CapturedExchange{}
+	for _, ex := range c.exchanges {
+		result = append(result, sanitizeExchange(ex, secrets))
+	}
+
+	return result
+}
+
+func (c *Capture) add(ex CapturedExchange) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.exchanges = append(c.exchanges, ex)
+}
+
+// Transport wraps a transport so that requests made through it are captured
+func (c *Capture) Transport(t http.RoundTripper) http.RoundTripper {
+	return c.transport(t, nil)
+}
+
+// transport wraps a transport, tagging requests with the id returned by requestID
+func (c *Capture) transport(t http.RoundTripper, requestID func() string) http.RoundTripper {
+	return &captureTransport{capture: c, transport: t, requestID: requestID}
+}
+
+type captureTransport struct {
+	capture   *Capture
+	transport http.RoundTripper
+	requestID func() string
+}
+
+func (ct *captureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ex := CapturedExchange{
+		Time:           time.Now(),
+		Method:         req.Method,
+		URL:            req.URL.String(),
+		RequestHeaders: cloneHeader(req.Header),
+	}
+
+	if ct.requestID != nil {
+		ex.RequestID = ct.requestID()
+	}
+
+	if req.Body != nil {
+		b, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		ex.RequestBody = truncateBody(b)
+		req.Body = ioutil.NopCloser(bytes.NewReader(b))
+	}
+
+	resp, err := ct.transport.RoundTrip(req)
+	ex.Duration = time.Now().Sub(ex.Time)
+	if err != nil {
+		ex.Error = err.Error()
+		ct.capture.add(ex)
+		return resp, err
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		ex.Error = err.Error()
+	}
+
+	ex.Status = resp.StatusCode
+	ex.ResponseHeaders = cloneHeader(resp.Header)
+	ex.ResponseBody = truncateBody(b)
+	resp.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(b), errReader{err}))
+
+	ct.capture.add(ex)
+	return resp, nil
+}
+
+type errReader struct {
+	err error
+}
+
+func (e errReader) Read(p []byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	return 0, io.EOF
+}
+
+func cloneHeader(h http.Header) http.Header {
+	h2 := http.Header{}
+	for k, v := range h {
+		h2[k] = append([]string{}, v...)
+	}
+	return h2
+}
+
+func truncateBody(b []byte) string {
+	if len(b) > maxCapturedBody {
+		return string(b[:maxCapturedBody]) + "\n[truncated]"
+	}
+	return string(b)
+}
+
+// Redact replaces any of the secrets found in s, along with anything the logger would redact
+// like passkeys in urls
+func Redact(s string, secrets []string) string {
+	for _, secret := range secrets {
+		// very short values would redact far more than intended
+		if len(secret) < 3 {
+			continue
+		}
+		s = strings.Replace(s, secret, redactedValue, -1)
+	}
+	return logger.Redact(s)
+}
+
+func redactHeader(h http.Header, secrets []string) http.Header {
+	if h == nil {
+		return nil
+	}
+
+	h2 := http.Header{}
+	for k, vals := range h {
+		for _, v := range vals {
+			h2.Add(k, Redact(v, secrets))
+		}
+	}
+
+	for _, k := range sensitiveHeaders {
+		if _, ok := h2[k]; ok {
+			h2.Set(k, redactedValue)
+		}
+	}
+
+	return h2
+}
+
+func sanitizeExchange(ex CapturedExchange, secrets []string) CapturedExchange {
+	// secrets are usually sent url encoded in query strings and form bodies
+	all := append([]string{}, secrets...)
+	for _, secret := range secrets {
+		all = append(all, url.QueryEscape(secret))
+	}
+
+	ex.URL = Redact(ex.URL, all)
+	ex.RequestHeaders = redactHeader(ex.RequestHeaders, all)
+	ex.RequestBody = Redact(ex.RequestBody, all)
+	ex.ResponseHeaders = redactHeader(ex.ResponseHeaders, all)
+	ex.ResponseBody = Redact(ex.ResponseBody, all)
+
+	return ex
+}
@@ -0,0 +1,48 @@
+package indexer
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCaptureRedactsSecrets(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc123"})
+		w.Write([]byte("welcome llama@example.org"))
+	}))
+	defer ts.Close()
+
+	capture := &Capture{}
+	client := &http.Client{Transport: capture.Transport(http.DefaultTransport)}
+
+	vals := url.Values{"username": {"llama@example.org"}, "password": {"s3cret pass"}}
+	resp, err := client.PostForm(ts.URL+"/login?user=llama@example.org", vals)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "welcome llama@example.org" {
+		t.Fatalf("Expected the response body to be passed through, got %q", body)
+	}
+
+	exchanges := capture.Exchanges([]string{"llama@example.org", "s3cret pass"})
+	if len(exchanges) != 1 {
+		t.Fatalf("Expected 1 exchange, got %d", len(exchanges))
+	}
+
+	ex := exchanges[0]
+	for idx, s := range []string{ex.URL, ex.RequestBody, ex.ResponseBody, ex.ResponseHeaders.Get("Set-Cookie")} {
+		if strings.Contains(s, "llama") || strings.Contains(s, "s3cret") || strings.Contains(s, "abc123") {
+			t.Errorf("Row #%d wasn't redacted: %q", idx+1, s)
+		}
+	}
+}
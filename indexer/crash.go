@@ -0,0 +1,129 @@
+package indexer
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cardigann/cardigann/logger"
+)
+
+const (
+	// crashMinBackoff is how long to leave an indexer alone after it panics, this doubles each
+	// time it panics again without a search succeeding in between, up to crashMaxBackoff
+	crashMinBackoff = time.Minute
+	crashMaxBackoff = time.Hour
+)
+
+// CrashError is returned when using an indexer panicked, which is a bug in its definition or in
+// cardigann, or when one did recently and the indexer is being left alone
+type CrashError struct {
+	Site  string
+	Panic string
+	Until time.Time
+}
+
+func (e *CrashError) Error() string {
+	return fmt.Sprintf("%s crashed: %s, retrying after %s", e.Site, e.Panic, e.Until.Format(time.Kitchen))
+}
+
+// IsCrash returns whether an error is because an indexer panicked
+func IsCrash(err error) bool {
+	_, ok := err.(*CrashError)
+	return ok
+}
+
+// crashState tracks when the indexer last panicked. It's shared by clones, which can panic in
+// their own goroutines, so it has its own lock rather than relying on the browser lock
+type crashState struct {
+	mu      sync.Mutex
+	panic   string
+	until   time.Time
+	backoff time.Duration
+}
+
+// enter holds off the indexer after a panic, for longer each time it happens in a row
+func (c *crashState) enter(msg string, now time.Time) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.backoff *= 2
+	if c.backoff < crashMinBackoff {
+		c.backoff = crashMinBackoff
+	} else if c.backoff > crashMaxBackoff {
+		c.backoff = crashMaxBackoff
+	}
+
+	c.panic = msg
+	c.until = now.Add(c.backoff)
+	return c.until
+}
+
+// crashed returns the last panic and when the indexer can be used again, if it's being held off
+func (c *crashState) crashed(now time.Time) (string, time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.panic, c.until, now.Before(c.until)
+}
+
+func (c *crashState) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.panic, c.until, c.backoff = "", time.Time{}, 0
+}
+
+// recoverCrash turns a panic into a CrashError in err and holds off the indexer, it must be
+// deferred directly by each method that can panic, including in the goroutines they start
+func (r *Runner) recoverCrash(op string, err *error) {
+	rec := recover()
+	if rec == nil {
+		return
+	}
+
+	msg := fmt.Sprintf("%v", rec)
+	until := r.crash.enter(msg, time.Now())
+
+	r.baseLogger.
+		WithFields(logrus.Fields{"op": op, "panic": msg, "until": until, "stack": string(debug.Stack())}).
+		Error("Recovered from a crash, holding off the indexer")
+
+	*err = &CrashError{Site: r.definition.Site, Panic: msg, Until: until}
+}
+
+// Crashed returns an error if the indexer panicked recently and is being held off
+func (r *Runner) Crashed() *CrashError {
+	msg, until, ok := r.crash.crashed(time.Now())
+	if !ok {
+		return nil
+	}
+	return &CrashError{Site: r.definition.Site, Panic: msg, Until: until}
+}
+
+// checkCrash returns an error without making any requests if the indexer panicked recently
+func (r *Runner) checkCrash() error {
+	if err := r.Crashed(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// recoverPanic turns a panic into an error, logging it along with its stack trace. It's for
+// indexers other than Runners, which recover from their own, and must be deferred directly
+func recoverPanic(fields logrus.Fields, err *error) {
+	rec := recover()
+	if rec == nil {
+		return
+	}
+
+	msg := fmt.Sprintf("%v", rec)
+	logger.Logger.
+		WithFields(fields).
+		WithFields(logrus.Fields{"panic": msg, "stack": string(debug.Stack())}).
+		Error("Recovered from a crash")
+
+	*err = fmt.Errorf("Crashed: %s", msg)
+}
@@ -0,0 +1,91 @@
+package indexer
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cardigann/cardigann/config"
+	"github.com/cardigann/cardigann/torznab"
+	"github.com/jarcoal/httpmock"
+)
+
+func TestCrashStateBackoff(t *testing.T) {
+	now := time.Now()
+	c := &crashState{}
+
+	for idx, expected := range []time.Duration{
+		crashMinBackoff, 2 * crashMinBackoff, 4 * crashMinBackoff,
+	} {
+		if until := c.enter("boom", now); until.Sub(now) != expected {
+			t.Fatalf("Row #%d: expected a backoff of %s, got %s", idx+1, expected, until.Sub(now))
+		}
+	}
+
+	if msg, _, ok := c.crashed(now); !ok || msg != "boom" {
+		t.Fatalf("Expected to be held off after a crash, got %v, %q", ok, msg)
+	}
+
+	c.reset()
+
+	if _, _, ok := c.crashed(now); ok {
+		t.Fatal("Expected not to be held off after a reset")
+	}
+}
+
+func TestRunnerRecoversFromCrash(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	def, err := ParseDefinition([]byte(exampleMaintenanceDefinition))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := &config.ArrayConfig{
+		"example": map[string]string{"url": "https://example.org/"},
+	}
+
+	registerResponder("GET", "https://example.org/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, ""), nil
+	})
+
+	var requests int
+	registerResponder("GET", "https://example.org/torrents.php", func(req *http.Request) (*http.Response, error) {
+		requests++
+		panic("llamas")
+	})
+
+	var failures []Failure
+	r := NewRunner(def, RunnerOpts{Config: conf, OnError: func(f Failure) {
+		failures = append(failures, f)
+	}})
+
+	for idx := 0; idx < 2; idx++ {
+		_, err = r.Search(torznab.Query{Q: "llamas"})
+		if !IsCrash(err) {
+			t.Fatalf("Row #%d: expected a crash error, got %#v", idx+1, err)
+		}
+	}
+
+	if requests != 1 {
+		t.Fatalf("Expected 1 request whilst holding off, got %d", requests)
+	}
+
+	if len(failures) != 2 {
+		t.Fatalf("Expected both searches to be reported as failures, got %d", len(failures))
+	}
+
+	ce := r.Crashed()
+	if ce == nil || ce.Panic != "llamas" {
+		t.Fatalf("Expected the runner to be held off after crashing, got %#v", ce)
+	}
+
+	// the browser lock must have been released for these not to block
+	if _, _, err := r.Download("https://example.org/download.php?id=1"); !IsCrash(err) {
+		t.Fatalf("Expected downloads to be held off too, got %#v", err)
+	}
+	if err := r.Login(); !IsCrash(err) {
+		t.Fatalf("Expected logins to be held off too, got %#v", err)
+	}
+}
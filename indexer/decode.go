@@ -0,0 +1,102 @@
+package indexer
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// filterBase64 decodes standard or url-safe base64, with or without padding
+func filterBase64(value string) (string, error) {
+	value = strings.TrimRight(strings.TrimSpace(value), "=")
+	if strings.ContainsAny(value, "-_") {
+		value = strings.NewReplacer("-", "+", "_", "/").Replace(value)
+	}
+
+	b, err := base64.RawStdEncoding.DecodeString(value)
+	if err != nil {
+		return "", fmt.Errorf("Failed to decode base64: %v", err)
+	}
+	return string(b), nil
+}
+
+func filterRot13(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return 'a' + (r-'a'+13)%26
+		case r >= 'A' && r <= 'Z':
+			return 'A' + (r-'A'+13)%26
+		}
+		return r
+	}, value)
+}
+
+func filterHexDecode(value string) (string, error) {
+	b, err := hex.DecodeString(strings.TrimSpace(value))
+	if err != nil {
+		return "", fmt.Errorf("Failed to decode hex: %v", err)
+	}
+	return string(b), nil
+}
+
+func filterURLDecode(value string) (string, error) {
+	return url.QueryUnescape(value)
+}
+
+func filterReverse(value string) string {
+	runes := []rune(value)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+
+// filterJSVar finds the string or number assigned to a javascript variable or object key in
+// a script, e.g var dl = "..."; or {"dl": '...'} for name dl
+func filterJSVar(name string, value string) (string, error) {
+	re, err := regexp.Compile(`(?:^|[^\w$.])["']?` + regexp.QuoteMeta(name) +
+		`["']?\s*[:=]\s*(?:"((?:[^"\\]|\\.)*)"|'((?:[^'\\]|\\.)*)'|(-?[\d.]+))`)
+	if err != nil {
+		return "", err
+	}
+
+	m := re.FindStringSubmatch(value)
+	if m == nil {
+		return "", fmt.Errorf("No javascript variable %q found", name)
+	}
+
+	if m[3] != "" {
+		return m[3], nil
+	}
+
+	return unescapeJSString(m[1] + m[2]), nil
+}
+
+var jsEscapeRegexp = regexp.MustCompile(`\\(x[0-9a-fA-F]{2}|u[0-9a-fA-F]{4}|.)`)
+
+// unescapeJSString decodes the escapes in the body of a javascript string literal
+func unescapeJSString(s string) string {
+	return jsEscapeRegexp.ReplaceAllStringFunc(s, func(esc string) string {
+		switch c := esc[1:]; {
+		case c[0] == 'x' || c[0] == 'u':
+			n, err := strconv.ParseUint(c[1:], 16, 32)
+			if err != nil {
+				return esc
+			}
+			return string(rune(n))
+		case c == "n":
+			return "\n"
+		case c == "t":
+			return "\t"
+		case c == "r":
+			return "\r"
+		default:
+			return c
+		}
+	})
+}
@@ -0,0 +1,52 @@
+package indexer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDecodeFilters(t *testing.T) {
+	for idx, test := range []struct {
+		filter   string
+		args     interface{}
+		input    string
+		expected string
+	}{
+		{"base64", nil, "L2Rvd25sb2FkLnBocD9pZD0xMjM0", "/download.php?id=1234"},
+		{"base64", nil, "L2Rvd25sb2FkLnBocD9pZD0xMjM0NQ==", "/download.php?id=12345"},
+		{"base64", nil, "L2Rvd25sb2FkLnBocD9pZD0xMjM0NQ", "/download.php?id=12345"},
+		{"base64", nil, "Pz8_Pz8-", "?????>"},
+		{"rot13", nil, "qbjaybnq.cuc?vq=1234", "download.php?id=1234"},
+		{"hexdecode", nil, "2f646c2f31", "/dl/1"},
+		{"urldecode", nil, "%2Fdl%2F1%3Fkey%3Da+b", "/dl/1?key=a b"},
+		{"reverse", nil, "4321=di?php.daolnwod", "download.php?id=1234"},
+		{"jsvar", "dl", `var x = 1; var dl = "\/download.php?id=1234";`, "/download.php?id=1234"},
+		{"jsvar", "dl", `var dl='\x2fdl/1';`, "/dl/1"},
+		{"jsvar", "id", `{"hash": "abc", "id": 1234}`, "1234"},
+		{"jsvar", "id", `var tid = 99; var id = 1234;`, "1234"},
+	} {
+		got, err := invokeFilter(test.filter, test.args, test.input, time.UTC)
+		if err != nil {
+			t.Errorf("Row #%d: %v", idx+1, err)
+			continue
+		}
+		if got != test.expected {
+			t.Errorf("Row #%d: expected %q, got %q", idx+1, test.expected, got)
+		}
+	}
+
+	for idx, test := range []struct {
+		filter string
+		args   interface{}
+		input  string
+	}{
+		{"base64", nil, "not base64!"},
+		{"hexdecode", nil, "xyz"},
+		{"jsvar", "dl", "var other = 1;"},
+		{"jsvar", nil, "var dl = 1;"},
+	} {
+		if _, err := invokeFilter(test.filter, test.args, test.input, time.UTC); err == nil {
+			t.Errorf("Row #%d: expected an error from %s", idx+1, test.filter)
+		}
+	}
+}
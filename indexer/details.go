@@ -0,0 +1,63 @@
+package indexer
+
+import "github.com/Sirupsen/logrus"
+
+// defaultDetailsLimit is how many details pages are opened per search, as each is a request
+const defaultDetailsLimit = 20
+
+// extractDetails opens the details pages of items and extracts the definition's details fields
+// from them, overriding what was extracted from the search results. Failures are logged and the
+// item is left as it was. It must only be called once the items have all been extracted, as it
+// navigates the browser away from the search results. Details pages aren't opened in low memory
+// mode
+func (r *Runner) extractDetails(items []extractedItem) {
+	details := r.definition.Search.Details
+	if len(details.Fields) == 0 {
+		return
+	}
+
+	if r.opts.LowMemory {
+		r.logger.Debug("Not opening details pages in low memory mode")
+		return
+	}
+
+	limit := details.Limit
+	if limit <= 0 {
+		limit = defaultDetailsLimit
+	}
+
+	for idx := range items {
+		if idx >= limit {
+			r.logger.Debugf("Not opening details pages for more than %d results", limit)
+			return
+		}
+
+		u := items[idx].detailsURL
+		if u == "" {
+			continue
+		}
+
+		if err := r.openPage(u); err != nil {
+			r.logger.WithFields(logrus.Fields{"url": u}).WithError(err).Warn("Failed to open details page")
+			if IsMaintenance(err) {
+				return
+			}
+			continue
+		}
+
+		dom := r.browser.Dom()
+		for _, f := range details.Fields {
+			val, err := r.matchField(f, dom)
+			if err != nil {
+				r.logger.
+					WithFields(logrus.Fields{"url": u, "block": f.Block.String()}).
+					WithError(err).Debugf("Details page has no %s", f.Field)
+				continue
+			}
+			r.setField(&items[idx], idx+1, f.Field, val)
+		}
+
+		// the site's id might only be on the details page
+		items[idx].GUID = r.guid(items[idx])
+	}
+}
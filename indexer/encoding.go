@@ -0,0 +1,196 @@
+package indexer
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// charmap maps the upper half of a single byte encoding to unicode, the lower half is ascii
+type charmap [128]rune
+
+func (c *charmap) decode(b []byte) []byte {
+	buf := bytes.Buffer{}
+	buf.Grow(len(b))
+
+	for _, ch := range b {
+		if ch < 0x80 {
+			buf.WriteByte(ch)
+		} else {
+			buf.WriteRune(c[ch-0x80])
+		}
+	}
+
+	return buf.Bytes()
+}
+
+func (c *charmap) encode(s string) string {
+	buf := bytes.Buffer{}
+
+	for _, r := range s {
+		if r < 0x80 {
+			buf.WriteRune(r)
+			continue
+		}
+		ch := byte('?')
+		for idx, mapped := range c {
+			if mapped == r {
+				ch = byte(idx + 0x80)
+				break
+			}
+		}
+		buf.WriteByte(ch)
+	}
+
+	return buf.String()
+}
+
+// charmaps are keyed by the labels that encodings go by in the wild. Following browsers,
+// pages that claim to be latin1 are decoded as windows-1252, which is a superset of it
+var charmaps = map[string]*charmap{
+	"windows-1250": windows1250,
+	"cp1250":       windows1250,
+	"x-cp1250":     windows1250,
+	"windows-1251": windows1251,
+	"cp1251":       windows1251,
+	"x-cp1251":     windows1251,
+	"windows-1252": windows1252,
+	"cp1252":       windows1252,
+	"x-cp1252":     windows1252,
+	"iso-8859-1":   windows1252,
+	"iso8859-1":    windows1252,
+	"latin1":       windows1252,
+	"us-ascii":     windows1252,
+	"iso-8859-2":   iso88592,
+	"iso8859-2":    iso88592,
+	"latin2":       iso88592,
+	"iso-8859-5":   iso88595,
+	"iso8859-5":    iso88595,
+	"iso-8859-15":  iso885915,
+	"iso8859-15":   iso885915,
+	"latin9":       iso885915,
+	"koi8-r":       koi8r,
+	"koi8r":        koi8r,
+}
+
+// lookupCharmap returns the charmap for an encoding label, or nil for utf-8. The bool is
+// false if the encoding isn't supported
+func lookupCharmap(label string) (*charmap, bool) {
+	label = strings.ToLower(strings.TrimSpace(label))
+	switch label {
+	case "utf-8", "utf8":
+		return nil, true
+	}
+	c, ok := charmaps[label]
+	return c, ok
+}
+
+var metaCharsetRegexp = regexp.MustCompile(`(?i)<meta[^>]+charset\s*=\s*["']?\s*([a-zA-Z0-9_:.-]+)`)
+
+// detectCharset finds the charset of an html page from the Content-Type header, or a meta
+// tag near the start of the page
+func detectCharset(contentType string, body []byte) string {
+	if _, params, err := mime.ParseMediaType(contentType); err == nil && params["charset"] != "" {
+		return params["charset"]
+	}
+
+	if len(body) > 1024 {
+		body = body[:1024]
+	}
+
+	if m := metaCharsetRegexp.FindSubmatch(body); m != nil {
+		return string(m[1])
+	}
+
+	return ""
+}
+
+// isTextResponse returns whether a response should be decoded, which excludes things like torrent files
+func isTextResponse(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "text/") || strings.HasSuffix(mediaType, "xml") ||
+		strings.HasSuffix(mediaType, "json")
+}
+
+// decodeTransport converts pages in single byte encodings to utf-8, which is all that the html
+// parser understands. The encoding is taken from the hint in the definition if there is one,
+// otherwise from the response
+type decodeTransport struct {
+	transport http.RoundTripper
+	hint      string
+	logger    logrus.FieldLogger
+}
+
+func (dt *decodeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := dt.transport.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if !isTextResponse(contentType) {
+		return resp, nil
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body = ioutil.NopCloser(bytes.NewReader(b))
+
+	charset := dt.hint
+	if charset == "" {
+		charset = detectCharset(contentType, b)
+	}
+	if charset == "" {
+		return resp, nil
+	}
+
+	c, ok := lookupCharmap(charset)
+	if !ok {
+		dt.logger.
+			WithFields(logrus.Fields{"charset": charset, "url": req.URL.String()}).
+			Warn("Unsupported charset, page may be garbled")
+		return resp, nil
+	} else if c == nil || !hasHighBytes(b) {
+		return resp, nil
+	}
+
+	dt.logger.
+		WithFields(logrus.Fields{"charset": charset, "url": req.URL.String()}).
+		Debug("Decoding page to utf-8")
+
+	decoded := c.decode(b)
+	resp.Body = ioutil.NopCloser(bytes.NewReader(decoded))
+	resp.ContentLength = int64(len(decoded))
+	resp.Header.Del("Content-Length")
+
+	if mediaType, params, err := mime.ParseMediaType(contentType); err == nil {
+		params["charset"] = "utf-8"
+		resp.Header.Set("Content-Type", mime.FormatMediaType(mediaType, params))
+	}
+
+	return resp, nil
+}
+
+func hasHighBytes(b []byte) bool {
+	for _, ch := range b {
+		if ch >= 0x80 {
+			return true
+		}
+	}
+	return false
+}
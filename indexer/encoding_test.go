@@ -0,0 +1,96 @@
+package indexer
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cardigann/cardigann/logger"
+)
+
+func TestDetectCharset(t *testing.T) {
+	for idx, test := range []struct {
+		contentType string
+		body        string
+		expected    string
+	}{
+		{"text/html; charset=windows-1251", "", "windows-1251"},
+		{"text/html", `<html><head><meta charset="koi8-r"></head>`, "koi8-r"},
+		{"text/html", `<meta http-equiv="Content-Type" content="text/html; charset=ISO-8859-1">`, "ISO-8859-1"},
+		{"text/html; charset=utf-8", `<meta charset="windows-1252">`, "utf-8"},
+		{"text/html", `<html><body>nothing here</body></html>`, ""},
+	} {
+		if got := detectCharset(test.contentType, []byte(test.body)); got != test.expected {
+			t.Errorf("Row #%d: expected %q, got %q", idx+1, test.expected, got)
+		}
+	}
+}
+
+func TestCharmapRoundTrip(t *testing.T) {
+	for idx, test := range []struct {
+		charset string
+		encoded []byte
+		decoded string
+	}{
+		{"windows-1251", []byte{0xcf, 0xf0, 0xe8, 0xe2, 0xe5, 0xf2}, "Привет"},
+		{"koi8-r", []byte{0xf0, 0xd2, 0xc9, 0xd7, 0xc5, 0xd4}, "Привет"},
+		{"iso-8859-1", []byte{0x43, 0x61, 0x66, 0xe9}, "Café"},
+		{"windows-1252", []byte{0x80, 0x35}, "€5"},
+		{"iso-8859-2", []byte{0x50, 0xf8, 0xed, 0x6c, 0x69, 0xb9}, "Příliš"},
+	} {
+		c, ok := lookupCharmap(test.charset)
+		if !ok || c == nil {
+			t.Fatalf("Row #%d: no charmap for %s", idx+1, test.charset)
+		}
+		if got := string(c.decode(test.encoded)); got != test.decoded {
+			t.Errorf("Row #%d: expected %q, got %q", idx+1, test.decoded, got)
+		}
+		if got := c.encode(test.decoded); got != string(test.encoded) {
+			t.Errorf("Row #%d: expected to encode to %x, got %x", idx+1, test.encoded, got)
+		}
+	}
+}
+
+func TestDecodeTransport(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("Content-Type", "text/html; charset=windows-1251")
+		case "/torrent":
+			w.Header().Set("Content-Type", "application/x-bittorrent")
+		}
+		w.Write([]byte{0xcf, 0xf0, 0xe8, 0xe2, 0xe5, 0xf2})
+	}))
+	defer ts.Close()
+
+	for idx, test := range []struct {
+		path, hint, expected string
+	}{
+		{"/page", "", "Привет"},
+		{"/torrent", "", "\xcf\xf0\xe8\xe2\xe5\xf2"},
+		{"/page", "koi8-r", "оПХБЕР"},
+		{"/page", "UTF-8", "\xcf\xf0\xe8\xe2\xe5\xf2"},
+	} {
+		client := &http.Client{Transport: &decodeTransport{
+			transport: http.DefaultTransport,
+			hint:      test.hint,
+			logger:    logger.Logger,
+		}}
+
+		resp, err := client.Get(ts.URL + test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(b) != test.expected {
+			t.Errorf("Row #%d: expected %q, got %q", idx+1, test.expected, b)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package indexer
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cardigann/cardigann/torznab"
+	"golang.org/x/sync/errgroup"
+)
+
+// expandKeywords returns the keywords to search for a query. Sites name season packs
+// inconsistently, so with seasons a search for a whole season looks for both "S01" and "Season 1"
+func expandKeywords(query torznab.Query, seasons bool) []string {
+	terms := []string{query.Keywords()}
+
+	if seasons && query.Season != "" && query.Ep == "" {
+		if season, err := strconv.Atoi(query.Season); err == nil {
+			withoutSeason := query
+			withoutSeason.Season = ""
+			terms = append(terms, strings.TrimSpace(
+				withoutSeason.Keywords()+" Season "+strconv.Itoa(season)))
+		}
+	}
+
+	return terms
+}
+
+// searchTerms returns the distinct, sanitized keywords to search the site for
+func (r *Runner) searchTerms(query torznab.Query, s sanitizer) []string {
+	terms := []string{}
+	seen := map[string]bool{}
+
+	for _, keywords := range expandKeywords(query, r.seasonSearch()) {
+		keywords = s.apply(keywords)
+
+		// raw search syntax is added to the keywords, unless the definition puts it somewhere itself
+		if query.Raw != "" && !r.definition.Search.usesRaw() {
+			keywords = strings.TrimSpace(keywords + " " + query.Raw)
+		}
+
+		if !seen[keywords] {
+			seen[keywords] = true
+			terms = append(terms, keywords)
+		}
+	}
+
+	return terms
+}
+
+// seasonSearch returns whether searches for a whole season also look for "Season 1", which they
+// do if seasonsearch is true. It's an extra request to the site for every season search
+func (r *Runner) seasonSearch() bool {
+	val := r.siteConfig("seasonsearch")
+	if val == "" {
+		return false
+	}
+
+	seasons, err := strconv.ParseBool(val)
+	if err != nil {
+		r.baseLogger.WithField("seasonsearch", val).Warn("Ignoring invalid seasonsearch")
+		return false
+	}
+
+	return seasons
+}
+
+// clone returns a runner that shares the site's cookies and rate limiter, so that it can make
+// requests alongside this one. It must only be called whilst holding the browser lock
+func (r *Runner) clone(siteURL *url.URL, fields logrus.Fields) *Runner {
+	l := r.logger.WithFields(fields)
+
+	return &Runner{
+		definition: r.definition,
+		cookies:    r.cookies,
+		opts:       r.opts,
+		baseLogger: l,
+		logger:     l,
+		caps:       r.caps,
+		requestID:  r.requestID,
+		siteURL:    siteURL,
+		limiter:    r.limiter,
+		budget:     r.budget,
+		crash:      r.crash,
+		layout:     r.layout,
+		session:    r.session,
+		metadata:   r.metadata,
+	}
+}
+
+// searchConcurrently searches for each of the terms at once, bounded by the site's rate limiter,
+// and merges the results, dropping any that were found by more than one term
+func (r *Runner) searchConcurrently(query torznab.Query, localCats []string, terms []string) ([]extractedItem, error) {
+	siteURL, err := r.currentURL()
+	if err != nil {
+		return nil, err
+	}
+
+	g := errgroup.Group{}
+	allResults := make([][]extractedItem, len(terms))
+
+	for idx, term := range terms {
+		idx, c := idx, r.clone(siteURL, logrus.Fields{"term": term})
+		term := term
+		g.Go(func() (err error) {
+			defer c.recoverCrash("search", &err)
+
+			c.createBrowser()
+			defer c.releaseBrowser()
+
+			items, err := c.searchKeywords(query, localCats, term)
+			if err != nil {
+				return err
+			}
+			allResults[idx] = items
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		if me, ok := err.(*MaintenanceError); ok {
+			return nil, r.enterMaintenance(me.Message)
+		}
+		return nil, err
+	}
+
+	results := []extractedItem{}
+	seen := map[string]bool{}
+
+	for _, items := range allResults {
+		for _, item := range items {
+			key := item.GUID
+			if key == "" {
+				key = item.Link
+			}
+			if key != "" && seen[key] {
+				continue
+			}
+			seen[key] = true
+			results = append(results, item)
+		}
+	}
+
+	if query.Limit > 0 && len(results) > query.Limit {
+		results = results[:query.Limit]
+	}
+
+	return results, nil
+}
@@ -0,0 +1,79 @@
+package indexer
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/cardigann/cardigann/config"
+	"github.com/cardigann/cardigann/torznab"
+	"github.com/jarcoal/httpmock"
+)
+
+func TestExpandKeywords(t *testing.T) {
+	for idx, test := range []struct {
+		query    torznab.Query
+		seasons  bool
+		expected []string
+	}{
+		{torznab.Query{Q: "llamas"}, true, []string{"llamas"}},
+		{torznab.Query{Series: "Llamas", Season: "1", Ep: "2"}, true, []string{"Llamas S01E02"}},
+		{torznab.Query{Series: "Llamas", Season: "1"}, true, []string{"Llamas S01", "Llamas Season 1"}},
+		{torznab.Query{Series: "Llamas", Season: "02"}, true, []string{"Llamas S02", "Llamas Season 2"}},
+		{torznab.Query{Series: "Llamas", Season: "2016"}, true, []string{"Llamas S2016", "Llamas Season 2016"}},
+		{torznab.Query{Series: "Llamas", Season: "1"}, false, []string{"Llamas S01"}},
+	} {
+		if got := expandKeywords(test.query, test.seasons); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("Row #%d: expected %q, got %q", idx+1, test.expected, got)
+		}
+	}
+}
+
+func TestIndexerDefinitionRunner_ExpandedSearch(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	def, err := ParseDefinition([]byte(exampleDefinitionWithMultiRow))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := &config.ArrayConfig{
+		"example": map[string]string{"url": "https://example.org/", "seasonsearch": "true"},
+	}
+
+	registerResponder("GET", "https://example.org/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, ""), nil
+	})
+
+	registerResponder("GET", "https://example.org/profile.php", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, ""), nil
+	})
+
+	var mu sync.Mutex
+	searches := []string{}
+	registerResponder("GET", "https://example.org/torrents.php", func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		searches = append(searches, req.URL.Query().Get("search"))
+		mu.Unlock()
+		return httpmock.NewStringResponse(http.StatusOK, exampleSearchPageWithDateHeadersAndMultiRow), nil
+	})
+
+	r := NewRunner(def, RunnerOpts{Config: conf})
+	results, err := r.Search(torznab.Query{Type: "tv-search", Q: "llamas", Season: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(searches)
+	if expected := []string{"llamas S01", "llamas Season 1"}; !reflect.DeepEqual(searches, expected) {
+		t.Fatalf("Expected searches for %q, got %q", expected, searches)
+	}
+
+	// both searches return the same page, so the results should be deduplicated
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+}
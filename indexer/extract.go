@@ -0,0 +1,74 @@
+package indexer
+
+import (
+	"errors"
+	"io"
+	"net/url"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/cardigann/cardigann/torznab"
+)
+
+// ExtractedField is the value a field's selector extracted from a row
+type ExtractedField struct {
+	Field string
+	Value string
+	Error error
+}
+
+// ExtractedRow is what a definition extracted from a single result row
+type ExtractedRow struct {
+	Fields          []ExtractedField
+	Item            torznab.ResultItem
+	LocalCategoryID string
+	Error           error
+}
+
+// Extract runs the rows and fields selectors of a definition against a saved search results page,
+// without making any requests. Relative links are resolved against base, or the definition's first
+// link if base is nil
+func Extract(def *IndexerDefinition, page io.Reader, base *url.URL) ([]ExtractedRow, error) {
+	doc, err := goquery.NewDocumentFromReader(page)
+	if err != nil {
+		return nil, err
+	}
+
+	if base == nil && len(def.Links) > 0 {
+		if base, err = url.Parse(def.Links[0]); err != nil {
+			return nil, err
+		}
+	}
+
+	// links are resolved against base rather than a page that's been loaded
+	if base == nil {
+		return nil, errors.New("The definition has no links to resolve urls against, a base url is needed")
+	}
+
+	r := NewRunner(def, RunnerOpts{})
+	r.pageURL = base
+
+	rows := r.selectRows(doc.Selection)
+	results := []ExtractedRow{}
+
+	for i := 0; i < rows.Length(); i++ {
+		row := ExtractedRow{}
+
+		for _, field := range def.Search.Fields {
+			val, err := field.Block.MatchText(rows.Eq(i), r.logger, r.location())
+			row.Fields = append(row.Fields, ExtractedField{Field: field.Field, Value: val, Error: err})
+		}
+
+		item, err := r.extractItem(i+1, rows.Eq(i))
+		if err != nil {
+			row.Error = err
+		} else {
+			r.mapCategory(&item)
+			row.Item = item.ResultItem
+			row.LocalCategoryID = item.LocalCategoryID
+		}
+
+		results = append(results, row)
+	}
+
+	return results, nil
+}
@@ -11,20 +11,15 @@ import (
 	"time"
 	"unicode"
 
-	"github.com/Sirupsen/logrus"
 	"github.com/bcampbell/fuzzytime"
-	"github.com/cardigann/cardigann/logger"
 )
 
 const (
 	filterTimeFormat = time.RFC1123Z
 )
 
-var (
-	filterLogger = logger.Logger
-)
-
-func invokeFilter(name string, args interface{}, value string) (string, error) {
+// invokeFilter applies a filter to a value, with dates without a timezone taken to be in loc
+func invokeFilter(name string, args interface{}, value string, loc *time.Location) (string, error) {
 	switch name {
 	case "querystring":
 		param, ok := args.(string)
@@ -35,10 +30,10 @@ func invokeFilter(name string, args interface{}, value string) (string, error) {
 
 	case "timeparse", "dateparse":
 		if args == nil {
-			return filterDateParse(nil, value)
+			return filterDateParse(nil, value, loc)
 		}
 		if layout, ok := args.(string); ok {
-			return filterDateParse([]string{layout}, value)
+			return filterDateParse([]string{layout}, value, loc)
 		}
 		return "", fmt.Errorf("Filter argument type %T was invalid", args)
 
@@ -50,22 +45,30 @@ func invokeFilter(name string, args interface{}, value string) (string, error) {
 		return filterRegexp(pattern, value)
 
 	case "split":
-		sep, ok := (args.([]interface{}))[0].(string)
+		list, err := filterArgs(name, args, 2)
+		if err != nil {
+			return "", err
+		}
+		sep, ok := list[0].(string)
 		if !ok {
 			return "", fmt.Errorf("Filter %q requires a string argument at idx 0", name)
 		}
-		pos, ok := (args.([]interface{}))[1].(int)
+		pos, ok := list[1].(int)
 		if !ok {
 			return "", fmt.Errorf("Filter %q requires an int argument at idx 1", name)
 		}
 		return filterSplit(sep, pos, value)
 
 	case "replace":
-		from, ok := (args.([]interface{}))[0].(string)
+		list, err := filterArgs(name, args, 2)
+		if err != nil {
+			return "", err
+		}
+		from, ok := list[0].(string)
 		if !ok {
 			return "", fmt.Errorf("Filter %q requires a string argument at idx 0", name)
 		}
-		to, ok := (args.([]interface{}))[1].(string)
+		to, ok := list[1].(string)
 		if !ok {
 			return "", fmt.Errorf("Filter %q requires a string argument at idx 1", name)
 		}
@@ -93,12 +96,43 @@ func invokeFilter(name string, args interface{}, value string) (string, error) {
 		return str + value, nil
 
 	case "timeago", "fuzzytime", "reltime":
-		return filterFuzzyTime(value, time.Now())
+		return filterFuzzyTime(value, time.Now(), loc)
+
+	case "base64":
+		return filterBase64(value)
+
+	case "rot13":
+		return filterRot13(value), nil
+
+	case "hexdecode":
+		return filterHexDecode(value)
+
+	case "urldecode":
+		return filterURLDecode(value)
+
+	case "reverse":
+		return filterReverse(value), nil
+
+	case "jsvar":
+		variable, ok := args.(string)
+		if !ok {
+			return "", fmt.Errorf("Filter %q requires a variable name", name)
+		}
+		return filterJSVar(variable, value)
 	}
 
 	return "", errors.New("Unknown filter " + name)
 }
 
+// filterArgs returns the arguments of a filter that takes a list of n of them
+func filterArgs(name string, args interface{}, n int) ([]interface{}, error) {
+	list, ok := args.([]interface{})
+	if !ok || len(list) != n {
+		return nil, fmt.Errorf("Filter %q requires a list of %d arguments", name, n)
+	}
+	return list, nil
+}
+
 func filterQueryString(param string, value string) (string, error) {
 	u, err := url.Parse(value)
 	if err != nil {
@@ -107,9 +141,9 @@ func filterQueryString(param string, value string) (string, error) {
 	return u.Query().Get(param), nil
 }
 
-func filterDateParse(layouts []string, value string) (string, error) {
+func filterDateParse(layouts []string, value string, loc *time.Location) (string, error) {
 	for _, layout := range layouts {
-		if t, err := time.Parse(layout, value); err == nil {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
 			return t.Format(filterTimeFormat), nil
 		}
 	}
@@ -121,6 +155,9 @@ func filterSplit(sep string, pos int, value string) (string, error) {
 	if pos < 0 {
 		pos = len(frags) + pos
 	}
+	if pos < 0 || pos >= len(frags) {
+		return "", fmt.Errorf("Split of %q by %q has no fragment %d", value, sep, pos)
+	}
 	return frags[pos], nil
 }
 
@@ -136,8 +173,6 @@ func filterRegexp(pattern string, value string) (string, error) {
 		return "", errors.New("No matches found for pattern")
 	}
 
-	filterLogger.WithFields(logrus.Fields{"matches": matches}).Debug("Regex matched")
-
 	if len(matches) > 1 {
 		return matches[1], nil
 	}
@@ -266,7 +301,9 @@ func parseTimeAgo(src string, now time.Time) (time.Time, error) {
 	return now, nil
 }
 
-func parseFuzzyTime(src string, now time.Time) (time.Time, error) {
+func parseFuzzyTime(src string, now time.Time, loc *time.Location) (time.Time, error) {
+	now = now.In(loc)
+
 	if timeAgoRegexp.MatchString(src) {
 		t, err := parseTimeAgo(src, now)
 		if err != nil {
@@ -303,15 +340,16 @@ func parseFuzzyTime(src string, now time.Time) (time.Time, error) {
 		dt.Time.SetSecond(0)
 	}
 
-	if !dt.HasTZOffset() {
-		dt.Time.SetTZOffset(0)
+	if dt.HasTZOffset() {
+		return time.Parse("2006-01-02T15:04:05Z07:00", dt.ISOFormat())
 	}
 
-	return time.Parse("2006-01-02T15:04:05Z07:00", dt.ISOFormat())
+	// without an offset, the date is in the site's local time
+	return time.ParseInLocation("2006-01-02T15:04:05", dt.ISOFormat(), loc)
 }
 
-func filterFuzzyTime(src string, now time.Time) (string, error) {
-	t, err := parseFuzzyTime(src, now)
+func filterFuzzyTime(src string, now time.Time, loc *time.Location) (string, error) {
+	t, err := parseFuzzyTime(src, now, loc)
 	if err != nil {
 		return "", fmt.Errorf("error parsing fuzzy time %q: %v", src, err)
 	}
@@ -28,7 +28,7 @@ func TestDateParseFilter(t *testing.T) {
 	for idx, example := range []struct{ strTime, format, expected string }{
 		{now.Format("Mon Jan 2 15:04:05 MST 2006"), "Mon Jan 2 15:04:05 MST 2006", now.Format(filterTimeFormat)},
 	} {
-		result, err := filterDateParse([]string{example.format}, example.strTime)
+		result, err := filterDateParse([]string{example.format}, example.strTime, time.UTC)
 		if err != nil {
 			t.Fatalf("Row %#d had an unexpected error: %s", idx+1, err.Error())
 		}
@@ -56,7 +56,7 @@ func TestFuzzyTimeFilter(t *testing.T) {
 		{"06-01-2009 19:39", time.Date(2009, time.June, 01, 19, 39, 0, 0, time.UTC)},
 		{"06-01-09 19:39", time.Date(2009, time.June, 01, 19, 39, 0, 0, time.UTC)},
 	} {
-		result, err := filterFuzzyTime(example.pattern, now)
+		result, err := filterFuzzyTime(example.pattern, now, time.UTC)
 		if err != nil {
 			t.Fatalf("Row %#d had an unexpected error: %s", idx+1, err.Error())
 		}
@@ -90,3 +90,27 @@ func TestParseTimeAgo(t *testing.T) {
 		}
 	}
 }
+
+func TestFilterArgs(t *testing.T) {
+	for idx, example := range []struct {
+		name string
+		args interface{}
+		ok   bool
+	}{
+		{"split", []interface{}{"/", 1}, true},
+		{"split", []interface{}{"/", -1}, true},
+		{"split", []interface{}{"/", 5}, false},
+		{"split", []interface{}{"/", -5}, false},
+		{"split", []interface{}{"/"}, false},
+		{"split", "/", false},
+		{"split", nil, false},
+		{"replace", []interface{}{"/", "-"}, true},
+		{"replace", []interface{}{"/"}, false},
+		{"replace", map[interface{}]interface{}{"/": "-"}, false},
+	} {
+		_, err := invokeFilter(example.name, example.args, "10/2", time.UTC)
+		if (err == nil) != example.ok {
+			t.Fatalf("Row #%d expected ok to be %v, got error %v", idx+1, example.ok, err)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package indexer
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// fuzzTokens are inserted into the strings of a definition, they're the pieces of selectors,
+// templates and patterns that are easiest to get wrong
+var fuzzTokens = []string{
+	"[", "]", "(", ")", "{", "}", "\"", "'", ">", "+", "~", ",", "*", "\\", ":", "|",
+	":nth-child(", ":contains(", ":not(", ":has(", "[href=", "{{", "}}", "{{ .Query.Keywords",
+	"%", "%zz", "\x00", "&#", "-1", "0",
+}
+
+// fuzzValues replace values in a definition, with a different type to the one expected
+var fuzzValues = []interface{}{
+	"", 0, -1, 1 << 31, 3.5, true, nil,
+	[]interface{}{}, []interface{}{"x"}, []interface{}{"x", "y", "z"}, []interface{}{1, "x"},
+	yaml.MapSlice{}, yaml.MapSlice{{Key: 1, Value: "x"}},
+}
+
+// fuzzMarkup is inserted into the page, it's the broken markup and odd values that sites have
+var fuzzMarkup = []string{
+	"<tr>", "</tr>", "<td>", "</td>", "<table>", "</table>", "<tbody>", "<div>", "</div>",
+	"<a href=\"\">", "<a href=\"%zz\">", "<a href=\"javascript:\">", "<img src=", "<!--", "-->",
+	"<script>", "</script>", "&#x;", "&#99999999;", "&", "\x00", "\xff\xfe", "1,2.3 GB", "-1",
+	"99999999999999999999", "1.#INF", "yesterday", "32/13/2017",
+}
+
+// Fuzzer probes a definition and the filters and row extraction that it drives with randomly
+// mutated copies of the definition and a saved search results page, looking for inputs that
+// panic rather than fail with an error
+type Fuzzer struct {
+	Definition []byte
+	Page       []byte
+
+	// Base is the url to resolve relative links against, as with Extract
+	Base *url.URL
+
+	// Rand is the source of the mutations, a fixed seed repeats a run
+	Rand *rand.Rand
+}
+
+// FuzzFailure is a mutated definition and page that made extracting results panic
+type FuzzFailure struct {
+	Iteration  int
+	Mutations  []string
+	Panic      string
+	Stack      string
+	Definition []byte
+	Page       []byte
+}
+
+// Run tries the definition and page, then iterations mutations of them. Inputs that fail with an
+// error are fine, it's only panics that are returned, and only the first input for each panic
+func (f *Fuzzer) Run(iterations int) ([]FuzzFailure, error) {
+	if _, err := ParseDefinition(f.Definition); err != nil {
+		return nil, fmt.Errorf("The definition must parse before fuzzing it: %v", err)
+	}
+
+	var tree yaml.MapSlice
+	if err := yaml.Unmarshal(f.Definition, &tree); err != nil {
+		return nil, err
+	}
+
+	rnd := f.Rand
+	if rnd == nil {
+		rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+
+	failures := []FuzzFailure{}
+	seen := map[string]bool{}
+
+	for i := 0; i <= iterations; i++ {
+		src, page, mutations := f.Definition, f.Page, []string{}
+
+		if i > 0 {
+			src, page, mutations = f.mutate(rnd, tree)
+		}
+
+		msg, stack := f.try(src, page)
+		if msg == "" || seen[msg] {
+			continue
+		}
+
+		seen[msg] = true
+		failures = append(failures, FuzzFailure{
+			Iteration:  i,
+			Mutations:  mutations,
+			Panic:      msg,
+			Stack:      stack,
+			Definition: src,
+			Page:       page,
+		})
+	}
+
+	return failures, nil
+}
+
+// mutate makes between one and three changes to the definition, the page or both
+func (f *Fuzzer) mutate(rnd *rand.Rand, tree yaml.MapSlice) ([]byte, []byte, []string) {
+	src, page := f.Definition, f.Page
+	mutations := []string{}
+	mutated := tree
+
+	for n := 1 + rnd.Intn(3); n > 0; n-- {
+		if rnd.Intn(2) == 0 {
+			var desc string
+			mutated, desc = mutateDefinition(rnd, mutated)
+			mutations = append(mutations, desc)
+
+			b, err := yaml.Marshal(mutated)
+			if err != nil {
+				mutations = append(mutations, "definition failed to marshal: "+err.Error())
+				continue
+			}
+			src = b
+		} else {
+			var desc string
+			page, desc = mutatePage(rnd, page)
+			mutations = append(mutations, desc)
+		}
+	}
+
+	return src, page, mutations
+}
+
+// try parses a definition and extracts the results from a page with it, returning the panic and
+// stack trace if that panics
+func (f *Fuzzer) try(src, page []byte) (msg string, stack string) {
+	defer func() {
+		if r := recover(); r != nil {
+			msg = fmt.Sprintf("%v", r)
+			stack = string(debug.Stack())
+		}
+	}()
+
+	def, err := ParseDefinition(src)
+	if err != nil {
+		return "", ""
+	}
+
+	Extract(def, bytes.NewReader(page), f.Base)
+	return "", ""
+}
+
+// mutateDefinition returns a copy of a definition with one of its values changed, along with a
+// description of the change
+func mutateDefinition(rnd *rand.Rand, tree yaml.MapSlice) (yaml.MapSlice, string) {
+	count := countNodes(tree) - 1
+	if count < 1 {
+		return tree, "definition is empty"
+	}
+
+	n := 1 + rnd.Intn(count)
+	var desc string
+
+	mutated := replaceNode(tree, "", &n, func(path string, val interface{}) interface{} {
+		next := mutateValue(rnd, val)
+		desc = fmt.Sprintf("definition %s: %s → %s", strings.TrimPrefix(path, "."), describeValue(val), describeValue(next))
+		return next
+	})
+
+	return mutated.(yaml.MapSlice), desc
+}
+
+// countNodes returns how many values there are in a yaml tree, including the tree itself
+func countNodes(node interface{}) int {
+	count := 1
+	switch v := node.(type) {
+	case yaml.MapSlice:
+		for _, item := range v {
+			count += countNodes(item.Value)
+		}
+	case []interface{}:
+		for _, item := range v {
+			count += countNodes(item)
+		}
+	}
+	return count
+}
+
+// replaceNode returns a copy of a yaml tree with the nth value in it, counting from the tree
+// itself as 0, replaced with what replace returns for it
+func replaceNode(node interface{}, path string, n *int, replace func(string, interface{}) interface{}) interface{} {
+	if *n == 0 {
+		*n = -1
+		return replace(path, node)
+	}
+	if *n < 0 {
+		return node
+	}
+	*n--
+
+	switch v := node.(type) {
+	case yaml.MapSlice:
+		copied := make(yaml.MapSlice, len(v))
+		for idx, item := range v {
+			copied[idx] = yaml.MapItem{
+				Key:   item.Key,
+				Value: replaceNode(item.Value, fmt.Sprintf("%s.%v", path, item.Key), n, replace),
+			}
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for idx, item := range v {
+			copied[idx] = replaceNode(item, fmt.Sprintf("%s[%d]", path, idx), n, replace)
+		}
+		return copied
+	}
+
+	return node
+}
+
+// mutateValue changes a string a little, or replaces a value with one of another type
+func mutateValue(rnd *rand.Rand, val interface{}) interface{} {
+	s, ok := val.(string)
+	if !ok || rnd.Intn(4) == 0 {
+		return fuzzValues[rnd.Intn(len(fuzzValues))]
+	}
+
+	switch rnd.Intn(4) {
+	case 0:
+		return s[:rnd.Intn(len(s)+1)]
+	case 1:
+		return s + s
+	default:
+		pos := rnd.Intn(len(s) + 1)
+		return s[:pos] + fuzzTokens[rnd.Intn(len(fuzzTokens))] + s[pos:]
+	}
+}
+
+func describeValue(val interface{}) string {
+	switch val.(type) {
+	case yaml.MapSlice, []interface{}:
+		b, err := yaml.Marshal(val)
+		if err != nil {
+			return fmt.Sprintf("%T", val)
+		}
+		return fmt.Sprintf("%q", strings.TrimSpace(string(b)))
+	case string:
+		return fmt.Sprintf("%q", val)
+	}
+	return fmt.Sprintf("%v", val)
+}
+
+// mutatePage returns a copy of a page with part of it truncated, removed, repeated or with
+// broken markup inserted, along with a description of the change
+func mutatePage(rnd *rand.Rand, page []byte) ([]byte, string) {
+	pos := rnd.Intn(len(page) + 1)
+	end := pos + rnd.Intn(len(page)-pos+1)
+
+	switch rnd.Intn(4) {
+	case 0:
+		return append([]byte{}, page[:pos]...), fmt.Sprintf("page truncated at byte %d", pos)
+	case 1:
+		mutated := append(append([]byte{}, page[:pos]...), page[end:]...)
+		return mutated, fmt.Sprintf("page bytes %d to %d removed", pos, end)
+	case 2:
+		mutated := append(append([]byte{}, page[:end]...), page[pos:]...)
+		return mutated, fmt.Sprintf("page bytes %d to %d repeated", pos, end)
+	}
+
+	markup := fuzzMarkup[rnd.Intn(len(fuzzMarkup))]
+	mutated := append(append(append([]byte{}, page[:pos]...), markup...), page[pos:]...)
+	return mutated, fmt.Sprintf("page %q inserted at byte %d", markup, pos)
+}
@@ -0,0 +1,96 @@
+package indexer
+
+import (
+	"math/rand"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+const fuzzDefinition = `
+site: testsite
+links:
+  - https://www.example.org/
+search:
+  rows:
+    selector: table.results tr:not(:first-child)
+  fields:
+    title:
+      selector: a.title
+    download:
+      selector: a.dl
+      attribute: href
+    size:
+      selector: td:nth-child(3)
+      filters:
+        - name: replace
+          args: [",", ""]
+    seeders:
+      selector: td:nth-child(4)
+      filters:
+        - name: split
+          args: ["/", 0]
+    date:
+      selector: td:nth-child(5)
+      filters:
+        - name: timeago
+`
+
+const fuzzPage = `<table class="results">
+<tr><th>Name</th></tr>
+<tr><td><a class="title">Llamas</a></td><td><a class="dl" href="dl.php?id=1">DL</a></td><td>1,234 MB</td><td>10/2</td><td>3 hours ago</td></tr>
+<tr><td><a class="title">Alpacas</a></td><td><a class="dl" href="dl.php?id=2">DL</a></td><td>2.5 GB</td><td>5/1</td><td>2 days ago</td></tr>
+</table>`
+
+func TestFuzzer(t *testing.T) {
+	f := Fuzzer{
+		Definition: []byte(fuzzDefinition),
+		Page:       []byte(fuzzPage),
+		Rand:       rand.New(rand.NewSource(1)),
+	}
+
+	failures, err := f.Run(500)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, failure := range failures {
+		t.Errorf("Mutation #%d panicked with %s after %v", failure.Iteration, failure.Panic, failure.Mutations)
+	}
+}
+
+func TestFuzzerInvalidDefinition(t *testing.T) {
+	f := Fuzzer{Definition: []byte("search:\n  rows:\n    selector: \"tr[\"\n")}
+
+	if _, err := f.Run(1); err == nil {
+		t.Fatal("Expected an error for a definition that doesn't parse")
+	}
+}
+
+func TestMutateDefinition(t *testing.T) {
+	var tree yaml.MapSlice
+	if err := yaml.Unmarshal([]byte(fuzzDefinition), &tree); err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := yaml.Marshal(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 50; i++ {
+		if _, desc := mutateDefinition(rnd, tree); desc == "" {
+			t.Fatal("Expected a description of the mutation")
+		}
+	}
+
+	after, err := yaml.Marshal(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(before) != string(after) {
+		t.Fatal("Expected mutations to leave the original definition alone")
+	}
+}
@@ -0,0 +1,47 @@
+package indexer
+
+import (
+	"net/url"
+	"strings"
+)
+
+// guid returns an identifier for a result that stays the same across searches, restarts and
+// changes to the site's domain, so that clients can tell which releases they've seen before.
+// It's the site's own id for the torrent if the definition extracts one, otherwise it's
+// derived from the details or download url without the scheme and host, as sites with
+// several mirrors serve the same paths on each of them
+func (r *Runner) guid(item extractedItem) string {
+	site := r.definition.Site
+
+	if item.siteID != "" {
+		return site + ":" + item.siteID
+	}
+
+	for _, link := range []string{item.detailsURL, item.Link} {
+		if link == "" {
+			continue
+		}
+
+		u, err := url.Parse(link)
+		if err != nil {
+			continue
+		}
+
+		if u.Scheme == "magnet" {
+			for _, xt := range u.Query()["xt"] {
+				if strings.HasPrefix(xt, "urn:btih:") {
+					return site + ":btih:" + strings.ToLower(strings.TrimPrefix(xt, "urn:btih:"))
+				}
+			}
+			continue
+		}
+
+		if u.Path == "" && u.RawQuery == "" {
+			continue
+		}
+
+		return site + ":" + u.RequestURI()
+	}
+
+	return ""
+}
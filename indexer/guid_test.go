@@ -0,0 +1,27 @@
+package indexer
+
+import (
+	"testing"
+
+	"github.com/cardigann/cardigann/torznab"
+)
+
+func TestGUID(t *testing.T) {
+	r := NewRunner(&IndexerDefinition{Site: "example"}, RunnerOpts{})
+
+	for idx, test := range []struct {
+		item     extractedItem
+		expected string
+	}{
+		{extractedItem{siteID: "1234", detailsURL: "https://example.org/details.php?id=1234"}, "example:1234"},
+		{extractedItem{detailsURL: "https://example.org/details.php?id=1234"}, "example:/details.php?id=1234"},
+		{extractedItem{detailsURL: "https://mirror.example.net/details.php?id=1234"}, "example:/details.php?id=1234"},
+		{extractedItem{ResultItem: torznab.ResultItem{Link: "https://example.org/download/1234.torrent"}}, "example:/download/1234.torrent"},
+		{extractedItem{ResultItem: torznab.ResultItem{Link: "magnet:?xt=urn:btih:ABCDEF&tr=udp://tracker"}}, "example:btih:abcdef"},
+		{extractedItem{}, ""},
+	} {
+		if got := r.guid(test.item); got != test.expected {
+			t.Errorf("Row #%d: expected %q, got %q", idx+1, test.expected, got)
+		}
+	}
+}
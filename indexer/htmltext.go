@@ -0,0 +1,165 @@
+package indexer
+
+import (
+	"bytes"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Formats that descriptions can be converted to from html
+const (
+	descriptionFormatText     = "text"
+	descriptionFormatMarkdown = "markdown"
+)
+
+// elements that start on a new line when converted to text
+var blockElements = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Li: true, atom.Tr: true,
+	atom.Table: true, atom.Ul: true, atom.Ol: true, atom.Blockquote: true, atom.Pre: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Hr: true, atom.Dd: true, atom.Dt: true,
+}
+
+// htmlToText converts a snippet of html to plain text, keeping paragraphs and line breaks.
+// With the markdown format, bold, italics, links and list items are kept as markdown
+func htmlToText(src string, format string) string {
+	nodes, err := html.ParseFragment(strings.NewReader(src), &html.Node{
+		Type:     html.ElementNode,
+		Data:     "div",
+		DataAtom: atom.Div,
+	})
+	if err != nil {
+		return normalizeText(src)
+	}
+
+	w := &textWriter{markdown: format == descriptionFormatMarkdown}
+	for _, n := range nodes {
+		w.write(n)
+	}
+
+	return w.String()
+}
+
+type textWriter struct {
+	markdown bool
+	lines    []string
+	line     bytes.Buffer
+}
+
+func (w *textWriter) text(s string) {
+	for _, r := range s {
+		switch {
+		case isZeroWidth(r):
+		case unicode.IsSpace(r):
+			// collapse whitespace, and drop it at the start of a line
+			if w.line.Len() > 0 && !strings.HasSuffix(w.line.String(), " ") {
+				w.line.WriteByte(' ')
+			}
+		default:
+			w.line.WriteRune(r)
+		}
+	}
+}
+
+// newline ends the current line if there is anything on it, or with force even if there isn't,
+// like for a <br>. Blank lines are never repeated
+func (w *textWriter) newline(force bool) {
+	line := strings.TrimSpace(w.line.String())
+	w.line.Reset()
+
+	if line == "" && (!force || len(w.lines) == 0 || w.lines[len(w.lines)-1] == "") {
+		return
+	}
+	w.lines = append(w.lines, line)
+}
+
+// paragraph ends the current line and leaves a blank line after it
+func (w *textWriter) paragraph() {
+	w.newline(false)
+	w.newline(true)
+}
+
+func (w *textWriter) write(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		w.text(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			w.write(c)
+		}
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Script, atom.Style, atom.Head:
+		return
+	case atom.Img:
+		if alt := attr(n, "alt"); alt != "" {
+			w.text(alt)
+		}
+		return
+	}
+
+	if n.DataAtom == atom.Br {
+		w.newline(true)
+		return
+	}
+
+	block := blockElements[n.DataAtom]
+	if block {
+		w.newline(false)
+	}
+
+	prefix, suffix := "", ""
+	if w.markdown {
+		switch n.DataAtom {
+		case atom.B, atom.Strong:
+			prefix, suffix = "**", "**"
+		case atom.I, atom.Em:
+			prefix, suffix = "_", "_"
+		case atom.Li:
+			prefix = "- "
+		case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+			prefix = "### "
+		case atom.A:
+			if href := attr(n, "href"); href != "" {
+				prefix, suffix = "[", "]("+href+")"
+			}
+		}
+	}
+
+	w.line.WriteString(prefix)
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.write(c)
+	}
+	w.line.WriteString(suffix)
+
+	switch n.DataAtom {
+	case atom.P, atom.Blockquote, atom.Pre, atom.Table, atom.Ul, atom.Ol,
+		atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		w.paragraph()
+	default:
+		if block {
+			w.newline(false)
+		}
+	}
+}
+
+func (w *textWriter) String() string {
+	w.newline(false)
+	return strings.TrimSpace(strings.Join(w.lines, "\n"))
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,60 @@
+package indexer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/cardigann/cardigann/logger"
+)
+
+func TestHTMLToText(t *testing.T) {
+	for idx, test := range []struct {
+		input, format, expected string
+	}{
+		{"Plain   text", "", "Plain text"},
+		{"Line one<br>Line two", "", "Line one\nLine two"},
+		{"One<br><br><br>Two", "", "One\n\nTwo"},
+		{"<p>First  paragraph</p>\n<p>Second</p>", "", "First paragraph\n\nSecond"},
+		{"<div>a</div><div>b</div>", "", "a\nb"},
+		{"Tom &amp; Jerry&nbsp;<b>HD</b>", "", "Tom & Jerry HD"},
+		{"<script>alert(1)</script>Safe<style>p{}</style>", "", "Safe"},
+		{"<img src=x alt=\"Cover\"> art", "", "Cover art"},
+		{"<b>Bold</b> and <i>italic</i>", "markdown", "**Bold** and _italic_"},
+		{"<ul><li>One</li><li>Two</li></ul>", "markdown", "- One\n- Two"},
+		{"<a href=\"https://example.org/\">Link</a>", "markdown", "[Link](https://example.org/)"},
+		{"<a href=\"https://example.org/\">Link</a>", "text", "Link"},
+	} {
+		if got := htmlToText(test.input, test.format); got != test.expected {
+			t.Errorf("Row #%d: expected %q, got %q", idx+1, test.expected, got)
+		}
+	}
+}
+
+func TestRunnerMatchDescription(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(
+		`<div class="plot"><b>Plot:</b> Llamas<br>escape</div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &Runner{definition: &IndexerDefinition{}, logger: logger.Logger}
+	filter := []filterBlock{{Name: "replace", Args: []interface{}{"Plot: ", ""}}}
+
+	for idx, test := range []struct {
+		block    selectorBlock
+		expected string
+	}{
+		// filters see the text, without the tags
+		{selectorBlock{Selector: ".plot", Filters: filter}, "Llamas\nescape"},
+		// unless they're asked to see the html, where the text is split up by tags
+		{selectorBlock{Selector: ".plot", Filters: filter, FilterHTML: true}, "Plot: Llamas\nescape"},
+	} {
+		val, err := r.matchField(fieldBlock{Field: "description", Block: test.block}, doc.Selection)
+		if err != nil {
+			t.Fatal(err)
+		} else if val != test.expected {
+			t.Errorf("Row #%d: expected %q, got %q", idx+1, test.expected, val)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package indexer
+
+import (
+	"github.com/cardigann/cardigann/config"
+	"github.com/cardigann/cardigann/logger"
+	"github.com/cardigann/cardigann/torznab"
+)
+
+// ConfiguredLanguages returns the languages that results are filtered to by default, from the
+// languages global config, or nil if it isn't set
+func ConfiguredLanguages(conf config.Config) []string {
+	if conf == nil {
+		return nil
+	}
+
+	val, err := config.GetGlobalConfig("languages", "", conf)
+	if err != nil || val == "" {
+		return nil
+	}
+
+	langs, err := torznab.ParseLanguages(val)
+	if err != nil {
+		logger.Logger.WithError(err).Warn("Ignoring invalid languages")
+		return nil
+	}
+
+	return langs
+}
@@ -0,0 +1,78 @@
+package indexer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cardigann/cardigann/config"
+	"github.com/cardigann/cardigann/logger"
+	"github.com/cardigann/cardigann/torznab"
+)
+
+const (
+	// latencyWeight is how much each search counts towards the moving average of latency
+	latencyWeight = 0.3
+
+	// latencyRetryAfter is how long an indexer that's too slow for aggregate searches is left
+	// out of them before it's tried again, so that its latency is measured again
+	latencyRetryAfter = 10 * time.Minute
+)
+
+// latencyTracker keeps a moving average of how long an indexer's searches take
+type latencyTracker struct {
+	mu      sync.Mutex
+	avg     time.Duration
+	updated time.Time
+}
+
+func (l *latencyTracker) observe(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.updated.IsZero() {
+		l.avg = d
+	} else {
+		l.avg = time.Duration(latencyWeight*float64(d) + (1-latencyWeight)*float64(l.avg))
+	}
+	l.updated = time.Now()
+}
+
+func (l *latencyTracker) get() (time.Duration, time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.avg, l.updated
+}
+
+// latencyReporter is implemented by indexers that track how long their searches take
+type latencyReporter interface {
+	Latency() (avg time.Duration, updated time.Time)
+}
+
+// AggregateMaxLatency returns the aggregatemaxlatency from the global config, or zero if it
+// isn't set
+func AggregateMaxLatency(conf config.Config) time.Duration {
+	val, err := config.GetGlobalConfig("aggregatemaxlatency", "", conf)
+	if err != nil || val == "" {
+		return 0
+	}
+
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		logger.Logger.WithError(err).Warnf("Ignoring invalid aggregatemaxlatency %q", val)
+		return 0
+	}
+
+	return d
+}
+
+// isSlow returns whether an indexer's searches have recently averaged longer than max. Ones
+// that haven't been searched for a while aren't, so that they get another chance
+func isSlow(ixr torznab.Indexer, max time.Duration, now time.Time) bool {
+	lr, ok := ixr.(latencyReporter)
+	if !ok {
+		return false
+	}
+
+	avg, updated := lr.Latency()
+	return !updated.IsZero() && avg > max && now.Sub(updated) < latencyRetryAfter
+}
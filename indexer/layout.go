@@ -0,0 +1,235 @@
+package indexer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	// layoutSnapshotInterval is how often the layout of an indexer's search results page is
+	// snapshotted, from searches for the latest torrents like rss syncs and verifications
+	layoutSnapshotInterval = time.Hour
+
+	// layoutBaselineWeight is how much each snapshot counts towards the baseline
+	layoutBaselineWeight = 0.2
+
+	// layoutMinSnapshots is how many snapshots make a baseline before changes are reported
+	layoutMinSnapshots = 3
+
+	// layoutDropRatio is how far below its baseline a match rate or row count has to fall to
+	// count as a sharp drop
+	layoutDropRatio = 0.5
+
+	// layoutMinBaselineRate is how often a field has to match usually for a drop in it to count,
+	// a field that's often missing anyway says little about the layout
+	layoutMinBaselineRate = 0.8
+)
+
+// layoutRequiredFields are the fields that a drop is reported in, other fields like seeders or
+// imdb are optional on a lot of sites and come and go with the results
+var layoutRequiredFields = []string{"title", "download", "details", "size"}
+
+// LayoutSnapshot is the structure of a search results page, as seen through a definition's
+// selectors. It's how many rows matched, and the fraction of them each field matched in
+type LayoutSnapshot struct {
+	Site   string             `json:"site"`
+	Time   time.Time          `json:"time"`
+	Rows   int                `json:"rows"`
+	Fields map[string]float64 `json:"fields"`
+}
+
+// takeLayoutSnapshot counts the rows and field matches of a page of search results
+func (r *Runner) takeLayoutSnapshot(rows *goquery.Selection) LayoutSnapshot {
+	s := LayoutSnapshot{
+		Site:   r.definition.Site,
+		Time:   time.Now(),
+		Rows:   rows.Length(),
+		Fields: map[string]float64{},
+	}
+
+	for _, f := range r.definition.Search.Fields {
+		// fields without a selector always match
+		if f.Block.Selector == "" {
+			continue
+		}
+
+		matched := 0
+		for i := 0; i < rows.Length(); i++ {
+			if rows.Eq(i).Find(f.Block.Selector).Length() > 0 {
+				matched++
+			}
+		}
+
+		if s.Rows > 0 {
+			s.Fields[f.Field] = float64(matched) / float64(s.Rows)
+		}
+	}
+
+	return s
+}
+
+// snapshotLayout passes a snapshot of a page of the latest results to the OnLayout option, at
+// most once per layoutSnapshotInterval
+func (r *Runner) snapshotLayout(rows *goquery.Selection) {
+	if r.opts.OnLayout == nil || !r.layout.due(time.Now()) {
+		return
+	}
+	r.opts.OnLayout(r.takeLayoutSnapshot(rows))
+}
+
+// layoutTimer tracks when the layout was last snapshotted, it's shared with clones
+type layoutTimer struct {
+	mu   sync.Mutex
+	last time.Time
+}
+
+// due returns whether a snapshot is due, and if it is counts it as taken
+func (t *layoutTimer) due(now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.last.IsZero() && now.Sub(t.last) < layoutSnapshotInterval {
+		return false
+	}
+	t.last = now
+	return true
+}
+
+// LayoutChange is a sharp drop in the rows or a field's match rate on a search results page,
+// Field is empty for the rows
+type LayoutChange struct {
+	Field    string  `json:"field,omitempty"`
+	Baseline float64 `json:"baseline"`
+	Current  float64 `json:"current"`
+}
+
+func (c LayoutChange) String() string {
+	if c.Field == "" {
+		return fmt.Sprintf("rows dropped from %.0f to %.0f", c.Baseline, c.Current)
+	}
+	return fmt.Sprintf("%s matched %.0f%% of rows, down from %.0f%%", c.Field, c.Current*100, c.Baseline*100)
+}
+
+// LayoutBaseline is the usual layout of an indexer's search results page, as a moving average
+// of its snapshots, along with the changes in the latest one
+type LayoutBaseline struct {
+	Snapshots int                `json:"snapshots"`
+	Rows      float64            `json:"rows"`
+	Fields    map[string]float64 `json:"fields"`
+	Updated   time.Time          `json:"updated"`
+
+	// Changes are the sharp drops in the latest snapshot, since ChangedAt
+	Changes   []LayoutChange `json:"changes,omitempty"`
+	ChangedAt time.Time      `json:"changedAt,omitempty"`
+}
+
+// Observe compares a snapshot to the baseline and returns the sharp drops in the rows or the
+// required fields. The drops aren't added to the baseline, so that a definition that's broken by
+// a redesign keeps being reported until it's fixed or until the baseline is reset, but the rest
+// of the snapshot is, so that the baseline keeps up with the site in the meantime
+func (b *LayoutBaseline) Observe(s LayoutSnapshot) []LayoutChange {
+	changes := []LayoutChange{}
+	dropped := map[string]bool{}
+
+	if b.Snapshots >= layoutMinSnapshots {
+		if float64(s.Rows) < b.Rows*layoutDropRatio {
+			changes = append(changes, LayoutChange{Baseline: b.Rows, Current: float64(s.Rows)})
+			dropped[""] = true
+		}
+
+		// field match rates mean nothing without rows
+		if s.Rows > 0 {
+			for _, field := range layoutRequiredFields {
+				baseline, ok := b.Fields[field]
+				if !ok || baseline < layoutMinBaselineRate {
+					continue
+				}
+				if rate, ok := s.Fields[field]; ok && rate < baseline*layoutDropRatio {
+					changes = append(changes, LayoutChange{Field: field, Baseline: baseline, Current: rate})
+					dropped[field] = true
+				}
+			}
+		}
+	}
+
+	b.add(s, dropped)
+
+	if len(changes) > 0 {
+		if len(b.Changes) == 0 {
+			b.ChangedAt = s.Time
+		}
+		b.Changes = changes
+		return changes
+	}
+
+	b.Changes, b.ChangedAt = nil, time.Time{}
+	return changes
+}
+
+// add folds a snapshot into the moving average, apart from the dropped rows (as "") and fields
+func (b *LayoutBaseline) add(s LayoutSnapshot, dropped map[string]bool) {
+	if b.Fields == nil {
+		b.Fields = map[string]float64{}
+	}
+
+	weight := layoutBaselineWeight
+	if b.Snapshots == 0 {
+		weight = 1
+	}
+
+	if !dropped[""] {
+		b.Rows = weight*float64(s.Rows) + (1-weight)*b.Rows
+	}
+
+	// rates are only known for pages with rows
+	if s.Rows > 0 {
+		for field, rate := range s.Fields {
+			if dropped[field] {
+				continue
+			}
+			if _, ok := b.Fields[field]; !ok {
+				b.Fields[field] = rate
+				continue
+			}
+			b.Fields[field] = weight*rate + (1-weight)*b.Fields[field]
+		}
+	}
+
+	b.Snapshots++
+	b.Updated = s.Time
+}
+
+func sortedLayoutFields(fields map[string]float64) []string {
+	keys := []string{}
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// LayoutChangedError is reported when a search results page has changed sharply from its
+// baseline, which usually means that a redesign of the site has broken its definition
+type LayoutChangedError struct {
+	Site    string
+	Changes []LayoutChange
+}
+
+func (e *LayoutChangedError) Error() string {
+	changes := []string{}
+	for _, c := range e.Changes {
+		changes = append(changes, c.String())
+	}
+	return fmt.Sprintf("The layout of %s's search results has changed: %s", e.Site, strings.Join(changes, ", "))
+}
+
+// IsLayoutChanged returns whether an error is because a search results page changed layout
+func IsLayoutChanged(err error) bool {
+	_, ok := err.(*LayoutChangedError)
+	return ok
+}
@@ -0,0 +1,148 @@
+package indexer
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cardigann/cardigann/config"
+	"github.com/cardigann/cardigann/torznab"
+	"github.com/jarcoal/httpmock"
+)
+
+func TestLayoutBaselineObserve(t *testing.T) {
+	now := time.Now()
+	normal := LayoutSnapshot{Rows: 50, Fields: map[string]float64{"title": 1, "size": 1, "seeders": 1}}
+
+	b := LayoutBaseline{}
+	for idx := 0; idx < layoutMinSnapshots; idx++ {
+		normal.Time = now
+		if changes := b.Observe(normal); len(changes) != 0 {
+			t.Fatalf("Expected no changes whilst making a baseline, got %v", changes)
+		}
+	}
+
+	for idx, example := range []struct {
+		snapshot LayoutSnapshot
+		expected []string
+	}{
+		{LayoutSnapshot{Rows: 40, Fields: map[string]float64{"title": 1, "size": 0.9, "seeders": 0.9}}, nil},
+		{LayoutSnapshot{Rows: 0, Fields: map[string]float64{}}, []string{"rows dropped from 48 to 0"}},
+		{LayoutSnapshot{Rows: 48, Fields: map[string]float64{"title": 1, "size": 0.1, "seeders": 1}}, []string{"size matched 10% of rows, down from 98%"}},
+		// seeders are optional, so aren't reported but do move the baseline
+		{LayoutSnapshot{Rows: 48, Fields: map[string]float64{"title": 1, "size": 1, "seeders": 0.1}}, nil},
+		{normal, nil},
+	} {
+		example.snapshot.Time = now.Add(time.Duration(idx+1) * time.Hour)
+
+		changes := b.Observe(example.snapshot)
+		if len(changes) != len(example.expected) {
+			t.Fatalf("Row #%d: expected changes %q, got %v", idx+1, example.expected, changes)
+		}
+		for i, c := range changes {
+			if c.String() != example.expected[i] {
+				t.Fatalf("Row #%d: expected change %q, got %q", idx+1, example.expected[i], c.String())
+			}
+		}
+	}
+
+	if b.Fields["size"] < 0.95 || b.Fields["seeders"] > 0.9 {
+		t.Fatalf("Expected the size drop to be left out of the baseline and seeders to be in it, got %v", b.Fields)
+	}
+
+	if len(b.Changes) != 0 || !b.ChangedAt.IsZero() {
+		t.Fatalf("Expected the changes to be cleared once the layout is back to normal, got %v", b.Changes)
+	}
+}
+
+func TestLayoutTimerDue(t *testing.T) {
+	now := time.Now()
+	lt := &layoutTimer{}
+
+	if !lt.due(now) {
+		t.Fatal("Expected the first snapshot to be due")
+	}
+	if lt.due(now.Add(time.Minute)) {
+		t.Fatal("Expected no snapshot to be due within the interval")
+	}
+	if !lt.due(now.Add(layoutSnapshotInterval)) {
+		t.Fatal("Expected a snapshot to be due after the interval")
+	}
+}
+
+const exampleLayoutPage = `<table>
+<tr><td class="title">Llamas</td><td class="seeders">10</td></tr>
+<tr><td class="title">Alpacas</td><td class="seeders">5</td></tr>
+<tr><td class="title">Camels</td></tr>
+<tr><td class="title">Vicuñas</td><td class="seeders">1</td></tr>
+</table>`
+
+const exampleLayoutDefinition = `
+---
+  site: example
+  links:
+    - https://example.org/
+
+  caps:
+    categories:
+      1: Movies
+    modes:
+      search: q
+
+  search:
+    path: /torrents.php
+    rows:
+      selector: table tr
+    fields:
+      title:
+        selector: td.title
+      seeders:
+        selector: td.seeders
+      category:
+        text: 1
+`
+
+func TestRunnerLayoutSnapshot(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	def, err := ParseDefinition([]byte(exampleLayoutDefinition))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := &config.ArrayConfig{
+		"example": map[string]string{"url": "https://example.org/"},
+	}
+
+	registerResponder("GET", "https://example.org/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, ""), nil
+	})
+
+	registerResponder("GET", "https://example.org/torrents.php", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, exampleLayoutPage), nil
+	})
+
+	snapshots := []LayoutSnapshot{}
+	r := NewRunner(def, RunnerOpts{Config: conf, CacheTTL: -1, OnLayout: func(s LayoutSnapshot) {
+		snapshots = append(snapshots, s)
+	}})
+
+	// the search fails on the row without seeders, but the layout is still snapshotted
+	for _, q := range []string{"", "llamas", ""} {
+		r.Search(torznab.Query{Q: q})
+	}
+
+	if len(snapshots) != 1 {
+		t.Fatalf("Expected one snapshot of the latest torrents, got %d", len(snapshots))
+	}
+
+	s := snapshots[0]
+	if s.Site != "example" || s.Rows != 4 || s.Fields["title"] != 1 || s.Fields["seeders"] != 0.75 {
+		t.Fatalf("Unexpected snapshot %#v", s)
+	}
+
+	if _, ok := s.Fields["category"]; ok {
+		t.Fatal("Expected fields without a selector to be left out")
+	}
+}
@@ -0,0 +1,164 @@
+package indexer
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cardigann/cardigann/config"
+)
+
+const (
+	// DefaultMaxBodySize is the largest response that will be read from an indexer
+	DefaultMaxBodySize int64 = 10 * 1024 * 1024
+
+	// DefaultMaxRows is the most rows a search results page can have
+	DefaultMaxRows = 1000
+)
+
+// ResponseTooLargeError is returned when an indexer returns more than the maximum body size
+type ResponseTooLargeError struct {
+	URL   string
+	Limit int64
+}
+
+func (e *ResponseTooLargeError) Error() string {
+	return fmt.Sprintf("Response from %s was larger than the limit of %s", e.URL, formatSize(e.Limit))
+}
+
+// ParseSize parses a size in bytes, with an optional k, m or g suffix (e.g 512k or 10MB)
+func ParseSize(s string) (int64, error) {
+	str := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(s)), "b")
+	mult := int64(1)
+
+	if n := len(str); n > 0 {
+		switch str[n-1] {
+		case 'k':
+			mult = 1024
+		case 'm':
+			mult = 1024 * 1024
+		case 'g':
+			mult = 1024 * 1024 * 1024
+		}
+		if mult > 1 {
+			str = str[:n-1]
+		}
+	}
+
+	n, err := strconv.ParseInt(str, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("Invalid size %q", s)
+	}
+
+	return n * mult, nil
+}
+
+func formatSize(n int64) string {
+	switch {
+	case n >= 1024*1024 && n%(1024*1024) == 0:
+		return fmt.Sprintf("%dMB", n/(1024*1024))
+	case n >= 1024 && n%1024 == 0:
+		return fmt.Sprintf("%dKB", n/1024)
+	default:
+		return fmt.Sprintf("%d bytes", n)
+	}
+}
+
+// maxBodySize returns the largest response to read, from the runner options, then the config
+func (r *Runner) maxBodySize() int64 {
+	if r.opts.MaxBodySize != 0 {
+		return r.opts.MaxBodySize
+	}
+
+	if r.opts.Config != nil {
+		val, err := config.GetGlobalConfig("maxbodysize", "", r.opts.Config)
+		if err == nil && val != "" {
+			if n, err := ParseSize(val); err == nil {
+				return n
+			}
+			r.logger.WithField("maxbodysize", val).Warn("Ignoring invalid maxbodysize")
+		}
+	}
+
+	if r.opts.LowMemory {
+		return LowMemoryMaxBodySize
+	}
+	return DefaultMaxBodySize
+}
+
+// maxRows returns the most rows allowed in a search results page, from the runner options, then the config
+func (r *Runner) maxRows() int {
+	if r.opts.MaxRows != 0 {
+		return r.opts.MaxRows
+	}
+
+	if r.opts.Config != nil {
+		val, err := config.GetGlobalConfig("maxrows", "", r.opts.Config)
+		if err == nil && val != "" {
+			if n, err := strconv.Atoi(val); err == nil && n > 0 {
+				return n
+			}
+			r.logger.WithField("maxrows", val).Warn("Ignoring invalid maxrows")
+		}
+	}
+
+	if r.opts.LowMemory {
+		return LowMemoryMaxRows
+	}
+	return DefaultMaxRows
+}
+
+// limitTransport stops reading responses once they reach a maximum size, so that an enormous
+// page or an endless stream can't exhaust memory
+type limitTransport struct {
+	transport http.RoundTripper
+	limit     int64
+}
+
+func (lt *limitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := lt.transport.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	tooLarge := &ResponseTooLargeError{URL: req.URL.String(), Limit: lt.limit}
+
+	if resp.ContentLength > lt.limit {
+		resp.Body.Close()
+		return nil, tooLarge
+	}
+
+	resp.Body = &limitedBody{
+		ReadCloser: resp.Body,
+		remaining:  lt.limit,
+		err:        tooLarge,
+	}
+	return resp, nil
+}
+
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+	err       error
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, l.err
+	}
+
+	// read one more byte than allowed, to tell a body of exactly the limit from a larger one
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+
+	n, err := l.ReadCloser.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n + int(l.remaining), l.err
+	}
+
+	return n, err
+}
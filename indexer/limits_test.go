@@ -0,0 +1,73 @@
+package indexer
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	for idx, test := range []struct {
+		input    string
+		expected int64
+		err      bool
+	}{
+		{"1024", 1024, false},
+		{"512k", 512 * 1024, false},
+		{"10MB", 10 * 1024 * 1024, false},
+		{"1g", 1024 * 1024 * 1024, false},
+		{"", 0, true},
+		{"-5", 0, true},
+		{"lots", 0, true},
+	} {
+		n, err := ParseSize(test.input)
+		if test.err && err == nil {
+			t.Errorf("Row #%d: expected an error for %q", idx+1, test.input)
+		} else if !test.err && err != nil {
+			t.Errorf("Row #%d: unexpected error %v", idx+1, err)
+		} else if n != test.expected {
+			t.Errorf("Row #%d: expected %d, got %d", idx+1, test.expected, n)
+		}
+	}
+}
+
+func TestLimitTransport(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// flush first so the response is chunked and has no content length
+		w.Write([]byte(strings.Repeat("x", 10)))
+		w.(http.Flusher).Flush()
+		w.Write([]byte(strings.Repeat("x", 90)))
+	}))
+	defer ts.Close()
+
+	for idx, test := range []struct {
+		limit   int64
+		tooLong bool
+	}{
+		{1000, false},
+		{100, false},
+		{99, true},
+		{10, true},
+	} {
+		client := &http.Client{Transport: &limitTransport{transport: http.DefaultTransport, limit: test.limit}}
+		resp, err := client.Get(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if _, ok := err.(*ResponseTooLargeError); ok != test.tooLong {
+			t.Errorf("Row #%d: expected too large error to be %v, got %v", idx+1, test.tooLong, err)
+		}
+		if !test.tooLong && len(b) != 100 {
+			t.Errorf("Row #%d: expected the whole body, got %d bytes", idx+1, len(b))
+		}
+		if test.tooLong && int64(len(b)) > test.limit {
+			t.Errorf("Row #%d: read %d bytes, more than the limit", idx+1, len(b))
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package indexer
+
+import "fmt"
+
+// Reasons that a login can fail, declared with the type of an error block in a definition
+const (
+	LoginErrorCredentials = "credentials"
+	LoginErrorBanned      = "banned"
+	LoginErrorMaintenance = "maintenance"
+	LoginErrorTwoFactor   = "2fa"
+	LoginErrorUnknown     = "unknown"
+)
+
+var loginErrorDescriptions = map[string]string{
+	LoginErrorCredentials: "wrong username or password",
+	LoginErrorBanned:      "account is banned or disabled",
+	LoginErrorMaintenance: "site is down for maintenance",
+	LoginErrorTwoFactor:   "two-factor authentication is required",
+}
+
+// LoginError is returned when logging into an indexer fails, with the reason it failed if the
+// definition recognized the page it was shown
+type LoginError struct {
+	Reason  string
+	Message string
+}
+
+func (e *LoginError) Error() string {
+	desc, ok := loginErrorDescriptions[e.Reason]
+	switch {
+	case ok && e.Message != "":
+		return fmt.Sprintf("Login failed, %s: %s", desc, e.Message)
+	case ok:
+		return fmt.Sprintf("Login failed, %s", desc)
+	case e.Message != "":
+		return fmt.Sprintf("Login failed: %s", e.Message)
+	default:
+		return "Login failed"
+	}
+}
+
+// LoginErrorReason returns the reason for a failed login, or an empty string if err isn't a LoginError
+func LoginErrorReason(err error) string {
+	if le, ok := err.(*LoginError); ok {
+		return le.Reason
+	}
+	return ""
+}
+
+func isValidLoginErrorType(t string) bool {
+	if t == "" || t == LoginErrorUnknown {
+		return true
+	}
+	_, ok := loginErrorDescriptions[t]
+	return ok
+}
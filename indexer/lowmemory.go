@@ -0,0 +1,39 @@
+package indexer
+
+import (
+	"strconv"
+
+	"github.com/cardigann/cardigann/config"
+	"github.com/cardigann/cardigann/logger"
+)
+
+// The defaults in low memory mode, for small devices like a Raspberry Pi or a NAS. Settings
+// that are given in the config still take precedence over them
+const (
+	LowMemoryMaxBodySize int64 = 2 * 1024 * 1024
+	LowMemoryMaxRows           = 250
+	LowMemoryConcurrency       = 1
+
+	// lowMemoryCacheEntries is how many queries have their results cached for each indexer
+	lowMemoryCacheEntries = 50
+)
+
+// IsLowMemory returns whether low memory mode is turned on by the lowmemory global config
+func IsLowMemory(conf config.Config) bool {
+	if conf == nil {
+		return false
+	}
+
+	val, err := config.GetGlobalConfig("lowmemory", "", conf)
+	if err != nil || val == "" {
+		return false
+	}
+
+	lowMemory, err := strconv.ParseBool(val)
+	if err != nil {
+		logger.Logger.Warnf("Ignoring invalid lowmemory %q", val)
+		return false
+	}
+
+	return lowMemory
+}
@@ -0,0 +1,111 @@
+package indexer
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+const (
+	// maintenanceMinBackoff is how long to leave a site alone after first seeing its maintenance page,
+	// this doubles each time the site is still down up to maintenanceMaxBackoff
+	maintenanceMinBackoff = 5 * time.Minute
+	maintenanceMaxBackoff = 2 * time.Hour
+)
+
+// MaintenanceError is returned when an indexer is showing its maintenance page, or when it
+// was recently and requests to it are being held off
+type MaintenanceError struct {
+	Site    string
+	Message string
+	Until   time.Time
+}
+
+func (e *MaintenanceError) Error() string {
+	msg := fmt.Sprintf("%s is down for maintenance", e.Site)
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return fmt.Sprintf("%s, retrying after %s", msg, e.Until.Format(time.Kitchen))
+}
+
+// IsMaintenance returns whether an error is because an indexer is down for maintenance
+func IsMaintenance(err error) bool {
+	_, ok := err.(*MaintenanceError)
+	return ok
+}
+
+type maintenanceState struct {
+	message string
+	until   time.Time
+	backoff time.Duration
+}
+
+// checkMaintenance returns a MaintenanceError if the current page matches the maintenance
+// block of the definition. It must only be called whilst holding the browser lock
+func (r *Runner) checkMaintenance() error {
+	for _, e := range r.definition.Maintenance {
+		if !e.matchPage(r.browser) {
+			continue
+		}
+		msg, err := e.errorText(r.browser.Dom(), r.logger)
+		if err != nil {
+			msg = ""
+		}
+		return r.enterMaintenance(strings.TrimSpace(msg))
+	}
+	return nil
+}
+
+// enterMaintenance holds off further requests to the site, for longer each time it happens in a row
+func (r *Runner) enterMaintenance(msg string) error {
+	r.maintenance.backoff *= 2
+	if r.maintenance.backoff < maintenanceMinBackoff {
+		r.maintenance.backoff = maintenanceMinBackoff
+	} else if r.maintenance.backoff > maintenanceMaxBackoff {
+		r.maintenance.backoff = maintenanceMaxBackoff
+	}
+
+	r.maintenance.message = msg
+	r.maintenance.until = time.Now().Add(r.maintenance.backoff)
+
+	r.logger.
+		WithFields(logrus.Fields{"message": msg, "until": r.maintenance.until}).
+		Warn("Site is down for maintenance, backing off")
+
+	return r.maintenanceError()
+}
+
+// checkBackoff returns an error without making any requests if the site was recently down for
+// maintenance, asked for requests to slow down, has used up its request budget, or if the
+// indexer recently crashed
+func (r *Runner) checkBackoff() error {
+	if time.Now().Before(r.maintenance.until) {
+		return r.maintenanceError()
+	}
+	if err := r.checkCrash(); err != nil {
+		return err
+	}
+	if err := r.checkThrottle(); err != nil {
+		return err
+	}
+	if err := r.BudgetExhausted(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// resetMaintenance is called after a successful request to the site
+func (r *Runner) resetMaintenance() {
+	r.maintenance = maintenanceState{}
+}
+
+func (r *Runner) maintenanceError() error {
+	return &MaintenanceError{
+		Site:    r.definition.Site,
+		Message: r.maintenance.message,
+		Until:   r.maintenance.until,
+	}
+}
@@ -0,0 +1,76 @@
+package indexer
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/cardigann/cardigann/config"
+	"github.com/cardigann/cardigann/torznab"
+	"github.com/jarcoal/httpmock"
+)
+
+const exampleMaintenanceDefinition = `
+---
+  site: example
+  links:
+    - https://example.org/
+
+  caps:
+    categories:
+      1: Movies
+    modes:
+      search: q
+
+  maintenance:
+    - match: "(?i)down for maintenance"
+
+  search:
+    path: /torrents.php
+    rows:
+      selector: table tr
+    fields:
+      title:
+        selector: td
+`
+
+func TestRunnerMaintenanceBackoff(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	def, err := ParseDefinition([]byte(exampleMaintenanceDefinition))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := &config.ArrayConfig{
+		"example": map[string]string{"url": "https://example.org/"},
+	}
+
+	registerResponder("GET", "https://example.org/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, ""), nil
+	})
+
+	var requests int
+	registerResponder("GET", "https://example.org/torrents.php", func(req *http.Request) (*http.Response, error) {
+		requests++
+		return httpmock.NewStringResponse(http.StatusOK,
+			"<html><body><h1>We're down for maintenance</h1></body></html>"), nil
+	})
+
+	r := NewRunner(def, RunnerOpts{Config: conf})
+
+	for idx := 0; idx < 2; idx++ {
+		_, err = r.Search(torznab.Query{Q: "llamas"})
+		if !IsMaintenance(err) {
+			t.Fatalf("Row #%d: expected a maintenance error, got %#v", idx+1, err)
+		}
+	}
+
+	if requests != 1 {
+		t.Fatalf("Expected 1 request whilst backing off, got %d", requests)
+	}
+
+	if r.maintenance.backoff != maintenanceMinBackoff {
+		t.Fatalf("Expected a backoff of %s, got %s", maintenanceMinBackoff, r.maintenance.backoff)
+	}
+}
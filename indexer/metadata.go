@@ -0,0 +1,278 @@
+package indexer
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cardigann/cardigann/torznab"
+	imdbscraper "github.com/cardigann/go-imdb-scraper"
+	"github.com/tehjojo/go-tvmaze/tvmaze"
+)
+
+const (
+	// metadataMaxQueries is how many queries have their results kept for each site, dropping
+	// the least recently searched first
+	metadataMaxQueries = 200
+
+	// metadataPruneSlack is how many queries below metadataMaxQueries are kept after pruning,
+	// so that the directory isn't read again for every new query after that
+	metadataPruneSlack = 20
+
+	// lookupTTL is how long a title looked up by id is used for before it's looked up again
+	lookupTTL = 30 * 24 * time.Hour
+)
+
+// metadataCache keeps search results and titles looked up by id in files under a dir, so that
+// they outlive the process and can be served in offline mode
+type metadataCache struct {
+	dir string
+
+	// counts are how many queries have results cached for each site, read from the directory
+	// the first time a site's results are cached
+	counts     map[string]int
+	countsLock sync.Mutex
+}
+
+// cachedResults are the results of a search, as kept by the metadata cache
+type cachedResults struct {
+	Query   string               `json:"query"`
+	Fetched time.Time            `json:"fetched"`
+	Items   []torznab.ResultItem `json:"items"`
+}
+
+// titleLookup is a show or movie title looked up by its id on tvmaze or imdb
+type titleLookup struct {
+	Title   string    `json:"title"`
+	Year    string    `json:"year,omitempty"`
+	Fetched time.Time `json:"fetched"`
+}
+
+func (c *metadataCache) resultsPath(site, key string) string {
+	return filepath.Join(c.dir, "results", site, fmt.Sprintf("%x.json", sha1.Sum([]byte(key))))
+}
+
+func (c *metadataCache) lookupPath(kind, id string) string {
+	return filepath.Join(c.dir, "lookups", kind+"-"+url.QueryEscape(id)+".json")
+}
+
+// read decodes a file into v, returning false if it doesn't exist
+func (c *metadataCache) read(path string, v interface{}) (bool, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return true, json.Unmarshal(b, v)
+}
+
+// write replaces a file with v encoded as json, through a temporary file so that a crash or
+// another process never sees half of it
+func (c *metadataCache) write(path string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// results returns the results that were last cached for a query, or nil if there aren't any
+func (c *metadataCache) results(site, key string) (*cachedResults, error) {
+	var cached cachedResults
+	if ok, err := c.read(c.resultsPath(site, key), &cached); err != nil || !ok {
+		return nil, err
+	}
+	return &cached, nil
+}
+
+// putResults caches the results of a query, dropping the results of the queries that were
+// searched least recently once there are more than metadataMaxQueries for the site. Links aren't
+// kept, as they often hold a passkey and can't be downloaded from offline anyway
+func (c *metadataCache) putResults(site, key string, items []torznab.ResultItem, now time.Time) error {
+	cached := cachedResults{Query: key, Fetched: now, Items: make([]torznab.ResultItem, len(items))}
+	for i, item := range items {
+		item.Link = ""
+		cached.Items[i] = item
+	}
+
+	path := c.resultsPath(site, key)
+
+	c.countsLock.Lock()
+	defer c.countsLock.Unlock()
+
+	if c.counts == nil {
+		c.counts = map[string]int{}
+	}
+
+	count, counted := c.counts[site]
+	if !counted {
+		files, err := ioutil.ReadDir(filepath.Dir(path))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		count = len(files)
+	}
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		count++
+	}
+
+	if err := c.write(path, cached); err != nil {
+		return err
+	}
+
+	c.counts[site] = count
+	if count <= metadataMaxQueries {
+		return nil
+	}
+
+	files, err := ioutil.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+
+	sort.Sort(filesByModTime(files))
+	keep := metadataMaxQueries - metadataPruneSlack
+	if len(files) > keep {
+		for _, f := range files[:len(files)-keep] {
+			os.Remove(filepath.Join(filepath.Dir(path), f.Name()))
+		}
+		files = files[len(files)-keep:]
+	}
+
+	c.counts[site] = len(files)
+	return nil
+}
+
+// lookup returns a title that was looked up by id, or nil if it hasn't been
+func (c *metadataCache) lookup(kind, id string) (*titleLookup, error) {
+	var l titleLookup
+	if ok, err := c.read(c.lookupPath(kind, id), &l); err != nil || !ok {
+		return nil, err
+	}
+	return &l, nil
+}
+
+func (c *metadataCache) putLookup(kind, id string, l titleLookup) error {
+	return c.write(c.lookupPath(kind, id), l)
+}
+
+type filesByModTime []os.FileInfo
+
+func (slice filesByModTime) Len() int {
+	return len(slice)
+}
+
+func (slice filesByModTime) Less(i, j int) bool {
+	return slice[i].ModTime().Before(slice[j].ModTime())
+}
+
+func (slice filesByModTime) Swap(i, j int) {
+	slice[i], slice[j] = slice[j], slice[i]
+}
+
+// saveResults keeps the results of a search in the metadata cache for offline mode, if the
+// offlinecache config is turned on
+func (r *Runner) saveResults(query torznab.Query, items []torznab.ResultItem) {
+	if r.metadata == nil || !r.offlineCache() {
+		return
+	}
+
+	if err := r.metadata.putResults(r.definition.Site, cacheKey(query), items, time.Now()); err != nil {
+		r.baseLogger.WithError(err).Warn("Failed to cache search results")
+	}
+}
+
+// lookupTitle returns a title looked up by id, from the metadata cache if it was looked up
+// recently enough, otherwise with fetch. A title that's too old to use is still better than
+// failing the search when the lookup fails
+func (r *Runner) lookupTitle(kind, id string, fetch func() (titleLookup, error)) (titleLookup, error) {
+	var cached *titleLookup
+	if r.metadata != nil {
+		var err error
+		if cached, err = r.metadata.lookup(kind, id); err != nil {
+			r.logger.WithError(err).Warn("Failed to read cached lookup")
+		}
+	}
+
+	logger := r.logger.WithFields(logrus.Fields{"kind": kind, "id": id})
+
+	if cached != nil && time.Since(cached.Fetched) < lookupTTL {
+		logger.WithField("title", cached.Title).Debug("Using cached lookup")
+		return *cached, nil
+	}
+
+	l, err := fetch()
+	if err != nil {
+		if cached != nil {
+			logger.WithError(err).Warn("Lookup failed, using the cached title")
+			return *cached, nil
+		}
+		return l, err
+	}
+
+	l.Fetched = time.Now()
+	if r.metadata != nil {
+		if err := r.metadata.putLookup(kind, id, l); err != nil {
+			logger.WithError(err).Warn("Failed to cache lookup")
+		}
+	}
+
+	return l, nil
+}
+
+// lookupShow looks up the name of a show on tvmaze
+func (r *Runner) lookupShow(kind, id string, get func(id string) (*tvmaze.Show, error)) (titleLookup, error) {
+	return r.lookupTitle(kind, id, func() (titleLookup, error) {
+		show, err := get(id)
+		if err != nil {
+			return titleLookup{}, err
+		}
+
+		r.logger.
+			WithFields(logrus.Fields{"name": show.Name, "year": show.GetFirstAired().Year()}).
+			Debugf("Found show via tvmaze lookup")
+
+		return titleLookup{Title: show.Name}, nil
+	})
+}
+
+// lookupMovie looks up the title and year of a movie on imdb
+func (r *Runner) lookupMovie(id string) (titleLookup, error) {
+	return r.lookupTitle("imdb", id, func() (titleLookup, error) {
+		movie, err := imdbscraper.FindByID(id)
+		if err != nil {
+			return titleLookup{}, err
+		}
+
+		if movie.Title == "" {
+			return titleLookup{}, fmt.Errorf("Movie title was blank")
+		}
+
+		r.logger.
+			WithFields(logrus.Fields{"title": movie.Title, "year": movie.Year, "movie": movie}).
+			Debugf("Found movie via imdb lookup")
+
+		return titleLookup{Title: movie.Title, Year: movie.Year}, nil
+	})
+}
@@ -0,0 +1,135 @@
+package indexer
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cardigann/cardigann/config"
+	"github.com/cardigann/cardigann/torznab"
+)
+
+func TestRunner_OfflineSearch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metadata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	def := &IndexerDefinition{Site: "example"}
+	query := torznab.Query{Q: "llamas"}
+
+	// results are only kept when offlinecache is turned on
+	NewRunner(def, RunnerOpts{MetadataDir: dir}).saveResults(torznab.Query{Q: "alpacas"}, []torznab.ResultItem{{Title: "Alpacas"}})
+
+	online := NewRunner(def, RunnerOpts{MetadataDir: dir, Config: &config.ArrayConfig{
+		"example": {"offlinecache": "true"},
+	}})
+	online.saveResults(query, []torznab.ResultItem{{Title: "Llamas S01E01", Link: "http://example.org/download/1?passkey=abc"}})
+
+	offline := NewRunner(def, RunnerOpts{MetadataDir: dir, Offline: true})
+
+	// the api key and request id of the client don't matter
+	items, err := offline.Search(torznab.Query{Q: "llamas", APIKey: "abc", RequestID: "1"})
+	if oe, ok := err.(*OfflineError); !ok || oe.Fetched.IsZero() {
+		t.Fatalf("Expected an OfflineError with when the results were cached, got %#v", err)
+	}
+	if len(items) != 1 || items[0].Title != "Llamas S01E01" {
+		t.Fatalf("Expected the cached results, got %#v", items)
+	}
+	if items[0].Link != "" {
+		t.Fatalf("Expected the link not to be kept, got %q", items[0].Link)
+	}
+
+	items, err = offline.Search(torznab.Query{Q: "alpacas"})
+	if oe, ok := err.(*OfflineError); !ok || !oe.Fetched.IsZero() || items != nil {
+		t.Fatalf("Expected an OfflineError without results, got %#v and %#v", items, err)
+	}
+
+	if _, _, err := offline.Download("http://example.org/download/1"); !IsOffline(err) {
+		t.Fatalf("Expected downloads to fail offline, got %v", err)
+	}
+}
+
+func TestMetadataCache_PruneResults(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metadata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := &metadataCache{dir: dir}
+	now := time.Now()
+
+	for i := 0; i < metadataMaxQueries+5; i++ {
+		if err := c.putResults("example", "q="+strconv.Itoa(i), nil, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// pruning drops to metadataPruneSlack under the limit, and new queries fill it up again
+	files, err := ioutil.ReadDir(filepath.Join(dir, "results", "example"))
+	if err != nil {
+		t.Fatal(err)
+	} else if expected := metadataMaxQueries - metadataPruneSlack + 4; len(files) != expected {
+		t.Fatalf("Expected %d cached queries, got %d", expected, len(files))
+	}
+
+	// queries that are cached again don't count twice
+	for i := 0; i < 10; i++ {
+		if err := c.putResults("example", "q="+strconv.Itoa(metadataMaxQueries+4), nil, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c.counts["example"] != metadataMaxQueries-metadataPruneSlack+4 {
+		t.Fatalf("Expected the count not to change, got %d", c.counts["example"])
+	}
+}
+
+func TestRunner_LookupTitle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metadata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r := NewRunner(&IndexerDefinition{Site: "example"}, RunnerOpts{MetadataDir: dir})
+
+	var fetches int
+	fetch := func() (titleLookup, error) {
+		fetches++
+		return titleLookup{Title: "Llamas"}, nil
+	}
+
+	for i := 0; i < 2; i++ {
+		l, err := r.lookupTitle("tvdb", "123", fetch)
+		if err != nil {
+			t.Fatal(err)
+		} else if l.Title != "Llamas" {
+			t.Fatalf("Expected Llamas, got %q", l.Title)
+		}
+	}
+
+	if fetches != 1 {
+		t.Fatalf("Expected the second lookup to be cached, got %d fetches", fetches)
+	}
+
+	// an old title is used when looking it up again fails
+	if err := r.metadata.putLookup("tvdb", "123", titleLookup{Title: "Llamas", Fetched: time.Now().Add(-lookupTTL * 2)}); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := r.lookupTitle("tvdb", "123", func() (titleLookup, error) {
+		fetches++
+		return titleLookup{}, errors.New("tvmaze is down")
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if l.Title != "Llamas" || fetches != 2 {
+		t.Fatalf("Expected the old title after trying to look it up again, got %q after %d fetches", l.Title, fetches)
+	}
+}
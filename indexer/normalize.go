@@ -0,0 +1,35 @@
+package indexer
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// only entities terminated with a semicolon are decoded, so that query strings like
+// ?a=1&copy=2 aren't mangled
+var entityRegexp = regexp.MustCompile(`&(#[0-9]+|#[xX][0-9a-fA-F]+|[a-zA-Z][a-zA-Z0-9]*);`)
+
+func isZeroWidth(r rune) bool {
+	switch r {
+	case '\u200b', '\u200c', '\u200d', '\u2060', '\ufeff', '\u00ad':
+		return true
+	}
+	return false
+}
+
+// normalizeText decodes html entities left in extracted text (often from double escaping),
+// strips zero-width characters and collapses runs of whitespace to a single space
+func normalizeText(s string) string {
+	if strings.Contains(s, "&") {
+		s = entityRegexp.ReplaceAllStringFunc(s, html.UnescapeString)
+	}
+
+	return strings.Join(strings.FieldsFunc(strings.Map(func(r rune) rune {
+		if isZeroWidth(r) {
+			return -1
+		}
+		return r
+	}, s), unicode.IsSpace), " ")
+}
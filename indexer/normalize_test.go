@@ -0,0 +1,52 @@
+package indexer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/cardigann/cardigann/logger"
+)
+
+func TestNormalizeText(t *testing.T) {
+	for idx, test := range []struct {
+		input, expected string
+	}{
+		{"  Llama\n\t llama  ", "Llama llama"},
+		{"Llamas &amp; Alpacas", "Llamas & Alpacas"},
+		{"Llamas&nbsp;&#8211;&#x20;S01", "Llamas – S01"},
+		{"Lla\u200bma\ufeff", "Llama"},
+		{"download.php?id=1&copy=2&not=3", "download.php?id=1&copy=2&not=3"},
+	} {
+		if got := normalizeText(test.input); got != test.expected {
+			t.Errorf("Row #%d: expected %q, got %q", idx+1, test.expected, got)
+		}
+	}
+}
+
+func TestSelectorNormalize(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(
+		`<div><span class="title">  Llama &amp;amp;
+		Alpaca</span></div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	off := false
+	for idx, test := range []struct {
+		block    selectorBlock
+		expected string
+	}{
+		{selectorBlock{Selector: ".title"}, "Llama & Alpaca"},
+		{selectorBlock{Selector: ".title", Normalize: &off}, "Llama &amp;\n\t\tAlpaca"},
+	} {
+		got, err := test.block.MatchText(doc.Selection, logger.Logger, time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.expected {
+			t.Errorf("Row #%d: expected %q, got %q", idx+1, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package indexer
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cardigann/cardigann/config"
+	"github.com/cardigann/cardigann/logger"
+	"github.com/cardigann/cardigann/torznab"
+	"github.com/dustin/go-humanize"
+)
+
+// OfflineError is returned in offline mode for anything that would have to reach the site.
+// Searches return it along with the results that were cached when they were last online
+type OfflineError struct {
+	Site string
+
+	// Fetched is when the results of a search were cached, or zero if there weren't any
+	Fetched time.Time
+}
+
+func (e *OfflineError) Error() string {
+	if e.Fetched.IsZero() {
+		return fmt.Sprintf("Offline, %s can't be reached", e.Site)
+	}
+	return fmt.Sprintf("Offline, serving results from %s cached %s", e.Site, humanize.Time(e.Fetched))
+}
+
+// IsOffline returns whether an error is because cardigann is in offline mode
+func IsOffline(err error) bool {
+	_, ok := err.(*OfflineError)
+	return ok
+}
+
+// IsOfflineMode returns whether offline mode is turned on by the offline global config
+func IsOfflineMode(conf config.Config) bool {
+	if conf == nil {
+		return false
+	}
+
+	val, err := config.GetGlobalConfig("offline", "", conf)
+	if err != nil || val == "" {
+		return false
+	}
+
+	offline, err := strconv.ParseBool(val)
+	if err != nil {
+		logger.Logger.Warnf("Ignoring invalid offline %q", val)
+		return false
+	}
+
+	return offline
+}
+
+// offlineSearch serves the results that were last cached for a query without going to the site,
+// however old they are
+func (r *Runner) offlineSearch(query torznab.Query) ([]torznab.ResultItem, error) {
+	key := cacheKey(query)
+	l := r.baseLogger.WithFields(logrus.Fields{"query": key})
+	if query.RequestID != "" {
+		l = l.WithField("request", query.RequestID)
+	}
+
+	if r.metadata == nil {
+		return nil, &OfflineError{Site: r.definition.Site}
+	}
+
+	cached, err := r.metadata.results(r.definition.Site, key)
+	if err != nil {
+		return nil, err
+	} else if cached == nil {
+		l.Debug("Offline and no results are cached")
+		return nil, &OfflineError{Site: r.definition.Site}
+	}
+
+	l.WithField("fetched", cached.Fetched).Debug("Offline, serving cached search results")
+	return cached.Items, &OfflineError{Site: r.definition.Site, Fetched: cached.Fetched}
+}
+
+// offlineCache returns whether search results are kept for offline mode, which they are if
+// offlinecache is true
+func (r *Runner) offlineCache() bool {
+	val := r.siteConfig("offlinecache")
+	if val == "" {
+		return false
+	}
+
+	cache, err := strconv.ParseBool(val)
+	if err != nil {
+		r.baseLogger.WithField("offlinecache", val).Warn("Ignoring invalid offlinecache")
+		return false
+	}
+
+	return cache
+}
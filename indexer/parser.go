@@ -6,10 +6,12 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"regexp"
 	"strings"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
+	"github.com/Sirupsen/logrus"
 	"github.com/cardigann/cardigann/torznab"
 	"github.com/headzoo/surf/browser"
 
@@ -22,12 +24,19 @@ type IndexerDefinition struct {
 	Name         string                 `yaml:"name"`
 	Description  string                 `yaml:"description"`
 	Language     string                 `yaml:"language"`
+	Encoding     string                 `yaml:"encoding"`
+	Timezone     string                 `yaml:"timezone"`
 	Links        stringorslice          `yaml:"links"`
 	Capabilities capabilitiesBlock      `yaml:"caps"`
 	Login        loginBlock             `yaml:"login"`
 	Ratio        ratioBlock             `yaml:"ratio"`
 	Search       searchBlock            `yaml:"search"`
+	Maintenance  errorBlockOrSlice      `yaml:"maintenance,omitempty"`
+	FloodControl errorBlockOrSlice      `yaml:"floodcontrol,omitempty"`
+	Aliases      stringorslice          `yaml:"aliases,omitempty"`
+	Replaces     stringorslice          `yaml:"replaces,omitempty"`
 	stats        IndexerDefinitionStats `yaml:"-"`
+	raw          []byte
 }
 
 type IndexerDefinitionStats struct {
@@ -41,6 +50,11 @@ func (id *IndexerDefinition) Stats() IndexerDefinitionStats {
 	return id.stats
 }
 
+// Raw returns the yaml source that the definition was parsed from
+func (id *IndexerDefinition) Raw() []byte {
+	return id.raw
+}
+
 type settingsField struct {
 	Name  string `yaml:"name"`
 	Type  string `yaml:"type"`
@@ -86,15 +100,88 @@ func ParseDefinition(src []byte) (*IndexerDefinition, error) {
 		def.Settings = defaultSettingsFields()
 	}
 
+	if _, err := parseSanitizer(def.Search.Sanitize); err != nil {
+		return nil, err
+	}
+
+	for _, blocks := range []errorBlockOrSlice{def.Login.Error, def.Maintenance, def.FloodControl} {
+		for _, e := range blocks {
+			if err := e.validate(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := def.validateSelectors(); err != nil {
+		return nil, err
+	}
+
 	def.stats = IndexerDefinitionStats{
 		Size:    int64(len(src)),
 		ModTime: time.Now(),
 		Hash:    fmt.Sprintf("%x", sha1.Sum(src)),
 	}
+	def.raw = src
 
 	return &def, nil
 }
 
+// validateSelectors checks that every selector in the definition compiles, so that a malformed
+// one is reported when the definition is loaded rather than silently matching nothing
+func (def *IndexerDefinition) validateSelectors() error {
+	selectors := []struct {
+		where, selector string
+	}{
+		{"login form", def.Login.FormSelector},
+		{"login test", def.Login.Test.Selector},
+		{"rows remove", def.Search.Rows.Remove},
+		{"tokens form", def.Search.Tokens.Form},
+	}
+	for idx, step := range def.Login.Steps {
+		selectors = append(selectors, struct{ where, selector string }{
+			fmt.Sprintf("login step %d form", idx+1), step.FormSelector,
+		})
+	}
+
+	for _, s := range selectors {
+		if err := validateSelector(s.where, s.selector); err != nil {
+			return err
+		}
+	}
+
+	blocks := []struct {
+		where string
+		block selectorBlock
+	}{
+		{"rows", def.Search.Rows.selectorBlock},
+		{"dateheaders", def.Search.Rows.DateHeaders},
+		{"ratio", def.Ratio.selectorBlock},
+	}
+	for _, b := range blocks {
+		if err := b.block.validate(b.where); err != nil {
+			return err
+		}
+	}
+
+	lists := []struct {
+		where  string
+		fields fieldsListBlock
+	}{
+		{"field", def.Search.Fields},
+		{"details field", def.Search.Details.Fields},
+		{"token", def.Search.Tokens.Inputs},
+	}
+	for _, l := range lists {
+		for _, f := range l.fields {
+			if err := f.Block.validate(l.where + " " + f.Field); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
 func defaultSettingsFields() []settingsField {
 	return []settingsField{
 		{Name: "username", Label: "Username", Type: "text"},
@@ -126,7 +213,9 @@ func (e *errorBlockOrSlice) UnmarshalYAML(unmarshal func(interface{}) error) err
 type errorBlock struct {
 	Path     string        `yaml:"path"`
 	Selector string        `yaml:"selector"`
+	Match    string        `yaml:"match"`
 	Message  selectorBlock `yaml:"message"`
+	Type     string        `yaml:"type"`
 }
 
 func (e *errorBlock) matchPage(browser browser.Browsable) bool {
@@ -134,19 +223,43 @@ func (e *errorBlock) matchPage(browser browser.Browsable) bool {
 		return e.Path == browser.Url().Path
 	} else if e.Selector != "" {
 		return browser.Find(e.Selector).Length() > 0
+	} else if e.Match != "" {
+		re, err := regexp.Compile(e.Match)
+		return err == nil && re.MatchString(browser.Dom().Text())
 	}
 	return false
 }
 
-func (e *errorBlock) errorText(from *goquery.Selection) (string, error) {
+func (e *errorBlock) errorText(from *goquery.Selection, logger logrus.FieldLogger) (string, error) {
 	if !e.Message.IsEmpty() {
-		return e.Message.MatchText(from)
+		return e.Message.MatchText(from, logger, time.UTC)
 	} else if e.Selector != "" {
 		return from.Find(e.Selector).Text(), nil
+	} else if e.Match != "" {
+		re, err := regexp.Compile(e.Match)
+		if err != nil {
+			return "", err
+		}
+		return re.FindString(from.Text()), nil
 	}
 	return "", errors.New("Error declaration must have either Message block or Selection")
 }
 
+func (e *errorBlock) validate() error {
+	if e.Match != "" {
+		if _, err := regexp.Compile(e.Match); err != nil {
+			return fmt.Errorf("Invalid login error match %q: %v", e.Match, err)
+		}
+	}
+	if !isValidLoginErrorType(e.Type) {
+		return fmt.Errorf("Unknown login error type %q", e.Type)
+	}
+	if err := validateSelector("error", e.Selector); err != nil {
+		return err
+	}
+	return e.Message.validate("error message")
+}
+
 type pageTestBlock struct {
 	Path     string `yaml:"path"`
 	Selector string `yaml:"selector"`
@@ -170,20 +283,55 @@ type loginBlock struct {
 	Inputs       inputsBlock       `yaml:"inputs,omitempty"`
 	Error        errorBlockOrSlice `yaml:"error,omitempty"`
 	Test         pageTestBlock     `yaml:"test,omitempty"`
+
+	// Steps are submitted in order instead of Path, for logins that go through other pages or
+	// a separate auth domain
+	Steps []loginStepBlock `yaml:"steps,omitempty"`
+}
+
+// loginStepBlock is one page of a login. Paths are resolved against the site, so a step on
+// another host needs a full url, and a step without a path submits a form on the page that
+// the last step ended on, like the hidden forms that single sign-on pages post back with
+type loginStepBlock struct {
+	Path         string      `yaml:"path"`
+	FormSelector string      `yaml:"form"`
+	Method       string      `yaml:"method"`
+	Inputs       inputsBlock `yaml:"inputs,omitempty"`
 }
 
 func (l *loginBlock) IsEmpty() bool {
-	return l.Path == "" && l.Method == ""
+	return l.Path == "" && l.Method == "" && len(l.Steps) == 0
 }
 
-func (l *loginBlock) hasError(browser browser.Browsable) error {
+// steps returns the steps of the login, which is a single step made from Path, Method, Inputs
+// and FormSelector unless Steps are given
+func (l *loginBlock) steps() []loginStepBlock {
+	if len(l.Steps) == 0 {
+		return []loginStepBlock{{Path: l.Path, FormSelector: l.FormSelector, Method: l.Method, Inputs: l.Inputs}}
+	}
+
+	steps := make([]loginStepBlock, len(l.Steps))
+	for idx, step := range l.Steps {
+		if step.FormSelector == "" {
+			step.FormSelector = "form"
+		}
+		steps[idx] = step
+	}
+	return steps
+}
+
+func (l *loginBlock) hasError(browser browser.Browsable, logger logrus.FieldLogger) error {
 	for _, e := range l.Error {
 		if e.matchPage(browser) {
-			msg, err := e.errorText(browser.Dom())
+			msg, err := e.errorText(browser.Dom(), logger)
 			if err != nil {
 				return err
 			}
-			return errors.New(strings.TrimSpace(msg))
+			reason := e.Type
+			if reason == "" {
+				reason = LoginErrorUnknown
+			}
+			return &LoginError{Reason: reason, Message: strings.TrimSpace(msg)}
 		}
 	}
 
@@ -206,6 +354,11 @@ func (f *fieldsListBlock) UnmarshalYAML(unmarshal func(interface{}) error) error
 
 	// FIXME: there has got to be a better way to do this
 	for _, item := range fields {
+		name, ok := item.Key.(string)
+		if !ok {
+			return fmt.Errorf("Field name %v must be a string", item.Key)
+		}
+
 		b, err := yaml.Marshal(item.Value)
 		if err != nil {
 			return err
@@ -215,7 +368,7 @@ func (f *fieldsListBlock) UnmarshalYAML(unmarshal func(interface{}) error) error
 			return err
 		}
 		*f = append(*f, fieldBlock{
-			Field: item.Key.(string),
+			Field: name,
 			Block: sb,
 		})
 	}
@@ -263,6 +416,157 @@ type searchBlock struct {
 	Inputs inputsBlock     `yaml:"inputs,omitempty"`
 	Rows   rowsBlock       `yaml:"rows"`
 	Fields fieldsListBlock `yaml:"fields"`
+
+	// Sanitize lists the sanitize options applied to the keywords, see parseSanitizer
+	Sanitize stringorslice `yaml:"sanitize,omitempty"`
+
+	// Paths are searched instead of Path for queries in their categories
+	Paths []searchPathBlock `yaml:"paths,omitempty"`
+
+	// Details are fields extracted from each result's details page
+	Details detailsBlock `yaml:"details,omitempty"`
+
+	// Tokens are scraped from a page before each search and sent along with the inputs
+	Tokens tokensBlock `yaml:"tokens,omitempty"`
+}
+
+// tokensBlock describes per-session form tokens, like csrf tokens, that some sites reject
+// searches without. They're read from Path, or the search page itself if it's empty
+type tokensBlock struct {
+	Path string `yaml:"path"`
+
+	// Form is a selector for a form whose hidden inputs are all sent with the search
+	Form string `yaml:"form"`
+
+	// Inputs are named values selected from the page, like meta tags or data attributes
+	Inputs fieldsListBlock `yaml:"inputs,omitempty"`
+}
+
+func (t *tokensBlock) IsEmpty() bool {
+	return t.Form == "" && len(t.Inputs) == 0
+}
+
+// detailsBlock extracts fields from the details pages of results, for things like exact upload
+// times and grab counts that search results pages don't show
+type detailsBlock struct {
+	Fields fieldsListBlock `yaml:"fields"`
+
+	// Limit is how many results to open the details pages of, which is defaultDetailsLimit if unset
+	Limit int `yaml:"limit,omitempty"`
+}
+
+// searchPathBlock is a section of a site that has its own search page, for some categories
+type searchPathBlock struct {
+	Path       string        `yaml:"path"`
+	Method     string        `yaml:"method"`
+	Categories stringorslice `yaml:"categories"`
+	Inputs     inputsBlock   `yaml:"inputs,omitempty"`
+}
+
+// searchTarget is a search page to load for a query, with the local categories to search for there
+type searchTarget struct {
+	Path      string
+	Method    string
+	Inputs    inputsBlock
+	localCats []string
+}
+
+// targets returns the search pages to load for a query in the given local categories. Paths
+// are used for the categories they list, and the categories that none of them list are searched
+// on the default path, or the paths without categories, as are queries without categories
+func (s *searchBlock) targets(localCats []string) []searchTarget {
+	if len(s.Paths) == 0 {
+		return []searchTarget{{Path: s.Path, Method: s.Method, Inputs: s.Inputs, localCats: localCats}}
+	}
+
+	targets := []searchTarget{}
+	hasCatchAll := false
+	unmatched := []string{}
+	matched := map[string]bool{}
+
+	for _, p := range s.Paths {
+		if len(p.Categories) == 0 {
+			hasCatchAll = true
+			continue
+		}
+
+		matching := []string{}
+		for _, cat := range localCats {
+			for _, pathCat := range p.Categories {
+				if cat == pathCat {
+					matching = append(matching, cat)
+					matched[cat] = true
+				}
+			}
+		}
+		if len(matching) > 0 {
+			targets = append(targets, s.target(p, matching))
+		}
+	}
+
+	for _, cat := range localCats {
+		if !matched[cat] {
+			unmatched = append(unmatched, cat)
+		}
+	}
+
+	if len(localCats) > 0 && len(unmatched) == 0 {
+		return targets
+	}
+
+	// the categories without a path of their own, or every category if none were asked for
+	defaultCats := unmatched
+	if len(localCats) == 0 {
+		defaultCats = localCats
+	}
+
+	switch {
+	case s.Path != "":
+		return append(targets, searchTarget{Path: s.Path, Method: s.Method, Inputs: s.Inputs, localCats: defaultCats})
+	case hasCatchAll:
+		for _, p := range s.Paths {
+			if len(p.Categories) == 0 {
+				targets = append(targets, s.target(p, defaultCats))
+			}
+		}
+		return targets
+	case len(targets) > 0:
+		return targets
+	}
+
+	// search everything on the first path rather than nothing at all
+	return []searchTarget{s.target(s.Paths[0], localCats)}
+}
+
+// target merges a path block with the defaults from the search block
+func (s *searchBlock) target(p searchPathBlock, localCats []string) searchTarget {
+	t := searchTarget{Path: p.Path, Method: p.Method, Inputs: inputsBlock{}, localCats: localCats}
+	if t.Method == "" {
+		t.Method = s.Method
+	}
+	for k, v := range s.Inputs {
+		t.Inputs[k] = v
+	}
+	for k, v := range p.Inputs {
+		t.Inputs[k] = v
+	}
+	return t
+}
+
+// usesRaw returns whether the search path or inputs refer to the raw search syntax in a query
+func (s *searchBlock) usesRaw() bool {
+	paths := append([]searchPathBlock{{Path: s.Path, Inputs: s.Inputs}}, s.Paths...)
+	for _, p := range paths {
+		if strings.Contains(p.Path, ".Query.Raw") {
+			return true
+		}
+		for _, val := range p.Inputs {
+			if strings.Contains(val, ".Query.Raw") {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 type capabilitiesBlock struct {
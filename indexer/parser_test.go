@@ -99,3 +99,73 @@ func TestIndexerParserWithStringLocalCats(t *testing.T) {
     t.Fatal(err)
   }
 }
+
+func TestSearchBlockTargets(t *testing.T) {
+	def, err := ParseDefinition([]byte(`
+---
+  site: testsite
+  search:
+    path: browse.php
+    inputs:
+      q: "{{ .Keywords }}"
+    paths:
+      - path: music.php
+        categories: [6, 8]
+        inputs:
+          type: music
+      - path: movies.php
+        method: post
+        categories: 7
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for idx, test := range []struct {
+		localCats []string
+		paths     []string
+		cats      [][]string
+	}{
+		{nil, []string{"browse.php"}, [][]string{nil}},
+		{[]string{"2"}, []string{"browse.php"}, [][]string{{"2"}}},
+		{[]string{"6"}, []string{"music.php"}, [][]string{{"6"}}},
+		{[]string{"2", "8", "7"}, []string{"music.php", "movies.php", "browse.php"}, [][]string{{"8"}, {"7"}, {"2"}}},
+		{[]string{"8", "7"}, []string{"music.php", "movies.php"}, [][]string{{"8"}, {"7"}}},
+	} {
+		targets := def.Search.targets(test.localCats)
+		paths := [][]string{}
+		names := []string{}
+		for _, target := range targets {
+			names = append(names, target.Path)
+			paths = append(paths, target.localCats)
+		}
+		if !reflect.DeepEqual(names, test.paths) || !reflect.DeepEqual(paths, test.cats) {
+			t.Errorf("Row #%d: expected %v %v, got %v %v", idx+1, test.paths, test.cats, names, paths)
+		}
+	}
+
+	music := def.Search.targets([]string{"6"})[0]
+	if music.Inputs["type"] != "music" || music.Inputs["q"] != "{{ .Keywords }}" {
+		t.Errorf("Expected path inputs to be merged with search inputs, got %v", music.Inputs)
+	}
+
+	if movies := def.Search.targets([]string{"7"})[0]; movies.Method != "post" {
+		t.Errorf("Expected the path's method, got %q", movies.Method)
+	}
+}
+
+func TestIndexerParserInvalidSelectors(t *testing.T) {
+  for idx, example := range []string{
+    "search:\n  rows:\n    selector: \"tr:nth-child(\"\n",
+    "search:\n  rows:\n    selector: tr\n    remove: \"[class\"\n",
+    "search:\n  rows:\n    selector: tr\n  fields:\n    title:\n      selector: \"a[\"\n",
+    "search:\n  rows:\n    selector: tr\n  fields:\n    title:\n      case:\n        \":bogus\": x\n",
+    "search:\n  rows:\n    selector: tr\n  fields:\n    1: {selector: a}\n",
+    "login:\n  form: \"form[\"\n",
+    "login:\n  error:\n    selector: \"div..error\"\n",
+  } {
+    if _, err := ParseDefinition([]byte("site: testsite\n" + example)); err == nil {
+      t.Fatalf("Row #%d expected an error for an invalid definition", idx+1)
+    }
+  }
+}
@@ -0,0 +1,180 @@
+package indexer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cardigann/cardigann/torznab"
+)
+
+// QuietWindow is a time of day during which an indexer isn't searched automatically, as
+// minutes after midnight in local time. A window that ends before it starts runs over midnight
+type QuietWindow struct {
+	Start, End int
+}
+
+func (w QuietWindow) String() string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", w.Start/60, w.Start%60, w.End/60, w.End%60)
+}
+
+// contains returns whether a minute of the day is in the window
+func (w QuietWindow) contains(minute int) bool {
+	if w.Start < w.End {
+		return minute >= w.Start && minute < w.End
+	}
+	return minute >= w.Start || minute < w.End
+}
+
+// QuietHoursError is returned for automatic searches, like those of scheduled jobs, whilst an
+// indexer is in its quiet hours
+type QuietHoursError struct {
+	Site  string
+	Until time.Time
+}
+
+func (e *QuietHoursError) Error() string {
+	return fmt.Sprintf("%s is in its quiet hours until %s", e.Site, e.Until.Format(time.Kitchen))
+}
+
+// IsQuietHours returns whether an error is because an indexer is in its quiet hours
+func IsQuietHours(err error) bool {
+	_, ok := err.(*QuietHoursError)
+	return ok
+}
+
+// ParseQuietHours parses comma separated windows like "08:00-12:00,22:00-06:00"
+func ParseQuietHours(s string) ([]QuietWindow, error) {
+	windows := []QuietWindow{}
+
+	for _, val := range strings.Split(s, ",") {
+		if val = strings.TrimSpace(val); val == "" {
+			continue
+		}
+
+		tokens := strings.SplitN(val, "-", 2)
+		if len(tokens) != 2 {
+			return nil, fmt.Errorf("Invalid quiet hours %q, expected a window like 22:00-06:00", val)
+		}
+
+		start, err := parseTimeOfDay(tokens[0])
+		if err != nil {
+			return nil, err
+		}
+
+		end, err := parseTimeOfDay(tokens[1])
+		if err != nil {
+			return nil, err
+		}
+
+		if start == end {
+			return nil, fmt.Errorf("Invalid quiet hours %q, the window is empty", val)
+		}
+
+		windows = append(windows, QuietWindow{start, end})
+	}
+
+	return windows, nil
+}
+
+// parseTimeOfDay parses a time like 22:00 into minutes after midnight
+func parseTimeOfDay(s string) (int, error) {
+	s = strings.TrimSpace(s)
+
+	tokens := strings.SplitN(s, ":", 2)
+	if len(tokens) != 2 {
+		return 0, fmt.Errorf("Invalid time of day %q, expected a time like 22:00", s)
+	}
+
+	h, err := strconv.Atoi(tokens[0])
+	if err != nil || h < 0 || h > 23 {
+		return 0, fmt.Errorf("Invalid hour in %q", s)
+	}
+
+	m, err := strconv.Atoi(tokens[1])
+	if err != nil || m < 0 || m > 59 {
+		return 0, fmt.Errorf("Invalid minute in %q", s)
+	}
+
+	return h*60 + m, nil
+}
+
+// quietUntil returns when the quiet hours that now is in end, following on to any windows that
+// start as the last one ends, or false if now isn't in any of them
+func quietUntil(windows []QuietWindow, now time.Time) (time.Time, bool) {
+	until := now
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	for i := 0; i <= len(windows); i++ {
+		minute := int(until.Sub(midnight).Minutes()) % (24 * 60)
+		extended := false
+
+		for _, w := range windows {
+			if !w.contains(minute) {
+				continue
+			}
+
+			end := until.Truncate(time.Minute).Add(time.Duration((w.End-minute+24*60)%(24*60)) * time.Minute)
+			if end.After(until) {
+				until = end
+				extended = true
+			}
+		}
+
+		if !extended {
+			break
+		}
+	}
+
+	return until, until.After(now)
+}
+
+// quietHours returns the windows from the quiethours config of the indexer, or the global one
+func (r *Runner) quietHours() []QuietWindow {
+	val := r.siteConfig("quiethours")
+	if val == "" {
+		return nil
+	}
+
+	windows, err := ParseQuietHours(val)
+	if err != nil {
+		r.baseLogger.WithError(err).Warn("Ignoring invalid quiethours")
+		return nil
+	}
+
+	return windows
+}
+
+// quietHoursStrict returns whether searches that aren't automatic are held off in quiet hours
+// too, which they are if quiethoursstrict is true
+func (r *Runner) quietHoursStrict() bool {
+	val := r.siteConfig("quiethoursstrict")
+	if val == "" {
+		return false
+	}
+
+	strict, err := strconv.ParseBool(val)
+	if err != nil {
+		r.baseLogger.WithField("quiethoursstrict", val).Warn("Ignoring invalid quiethoursstrict")
+		return false
+	}
+
+	return strict
+}
+
+// QuietUntil returns when the indexer's quiet hours end, or false if now isn't in them
+func (r *Runner) QuietUntil(now time.Time) (time.Time, bool) {
+	return quietUntil(r.quietHours(), now)
+}
+
+// checkQuietHours returns a QuietHoursError for an automatic search during the indexer's
+// quiet hours, or for any search when they're strict
+func (r *Runner) checkQuietHours(query torznab.Query, now time.Time) error {
+	until, quiet := r.QuietUntil(now)
+	if !quiet || (!query.Automatic && !r.quietHoursStrict()) {
+		return nil
+	}
+
+	return &QuietHoursError{Site: r.definition.Site, Until: until}
+}
@@ -0,0 +1,91 @@
+package indexer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cardigann/cardigann/config"
+	"github.com/cardigann/cardigann/torznab"
+)
+
+func TestParseQuietHours(t *testing.T) {
+	windows, err := ParseQuietHours("08:00-12:30, 22:00-06:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(windows) != 2 || windows[0].String() != "08:00-12:30" || windows[1].String() != "22:00-06:00" {
+		t.Fatalf("Unexpected windows %v", windows)
+	}
+
+	for _, val := range []string{"22:00", "8-12", "08:00-24:00", "08:60-09:00", "08:00-08:00"} {
+		if _, err := ParseQuietHours(val); err == nil {
+			t.Errorf("Expected %q to be invalid", val)
+		}
+	}
+}
+
+func TestQuietUntil(t *testing.T) {
+	windows, err := ParseQuietHours("08:00-12:00,12:00-13:00,22:00-06:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	day := time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC)
+	at := func(h, m int) time.Time {
+		return day.Add(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute)
+	}
+
+	for idx, example := range []struct {
+		now   time.Time
+		until time.Time
+		quiet bool
+	}{
+		{at(7, 59), time.Time{}, false},
+		{at(8, 0), at(13, 0), true},
+		{at(12, 30), at(13, 0), true},
+		{at(13, 0), time.Time{}, false},
+		{at(23, 15), at(30, 0), true},
+		{at(5, 59), at(6, 0), true},
+		{at(6, 0), time.Time{}, false},
+	} {
+		until, quiet := quietUntil(windows, example.now)
+		if quiet != example.quiet || (quiet && !until.Equal(example.until)) {
+			t.Errorf("Row #%d expected %v until %v, got %v until %v", idx+1, example.quiet, example.until, quiet, until)
+		}
+	}
+}
+
+func TestRunner_QuietHours(t *testing.T) {
+	now := time.Now()
+	start := now.Add(-time.Hour)
+	end := now.Add(time.Hour)
+	hours := start.Format("15:04") + "-" + end.Format("15:04")
+
+	def := &IndexerDefinition{Site: "example"}
+
+	r := NewRunner(def, RunnerOpts{Config: &config.ArrayConfig{
+		"example": {"quiethours": hours},
+	}})
+
+	if err := r.checkQuietHours(torznab.Query{Automatic: true}, now); !IsQuietHours(err) {
+		t.Fatalf("Expected automatic searches to be held off, got %v", err)
+	}
+
+	if err := r.checkQuietHours(torznab.Query{}, now); err != nil {
+		t.Fatalf("Expected other searches to be allowed, got %v", err)
+	}
+
+	if err := r.checkQuietHours(torznab.Query{Automatic: true}, now.Add(2*time.Hour)); err != nil {
+		t.Fatalf("Expected searches after the quiet hours to be allowed, got %v", err)
+	}
+
+	strict := NewRunner(def, RunnerOpts{Config: &config.ArrayConfig{
+		"global":  {"quiethours": hours, "quiethoursstrict": "true"},
+		"example": {},
+	}})
+
+	if err := strict.checkQuietHours(torznab.Query{}, now); !IsQuietHours(err) {
+		t.Fatalf("Expected every search to be held off when quiet hours are strict, got %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+package indexer
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cardigann/cardigann/config"
+)
+
+// DefaultConcurrency is how many requests can be made to an indexer at once
+const DefaultConcurrency = 2
+
+// rateLimiter bounds the requests made to a site, both in how many can be in flight at once
+// and in how long to wait between starting them
+type rateLimiter struct {
+	slots    chan struct{}
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+
+	// pausedUntil holds off all requests after the site asked for them to slow down
+	pausedUntil time.Time
+	pauseReason string
+}
+
+func newRateLimiter(concurrency int, interval time.Duration) *rateLimiter {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &rateLimiter{
+		slots:    make(chan struct{}, concurrency),
+		interval: interval,
+	}
+}
+
+// wait blocks until a request can be made, the returned func must be called when it's done
+func (l *rateLimiter) wait() func() {
+	l.slots <- struct{}{}
+
+	if l.interval > 0 {
+		l.mu.Lock()
+		now := time.Now()
+		start := l.next
+		if start.Before(now) {
+			start = now
+		}
+		l.next = start.Add(l.interval)
+		l.mu.Unlock()
+
+		time.Sleep(start.Sub(now))
+	}
+
+	return func() { <-l.slots }
+}
+
+// pause holds off requests for d, unless they're already held off for longer, and returns when
+// they can start again
+func (l *rateLimiter) pause(d time.Duration, reason string, now time.Time) time.Time {
+	if d > throttleMaxBackoff {
+		d = throttleMaxBackoff
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if until := now.Add(d); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+		l.pauseReason = reason
+	}
+	return l.pausedUntil
+}
+
+// paused returns when requests can start again and why, if they're being held off
+func (l *rateLimiter) paused(now time.Time) (time.Time, string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Before(l.pausedUntil) {
+		return l.pausedUntil, l.pauseReason, true
+	}
+	return time.Time{}, "", false
+}
+
+// rateLimitTransport holds requests until the rate limiter allows them, and pauses it when the
+// site responds asking for requests to slow down
+type rateLimitTransport struct {
+	transport http.RoundTripper
+	limiter   *rateLimiter
+	site      string
+	logger    logrus.FieldLogger
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	done := t.limiter.wait()
+	defer done()
+
+	if until, reason, ok := t.limiter.paused(time.Now()); ok {
+		return nil, &ThrottledError{Site: t.site, Message: reason, Until: until}
+	}
+
+	resp, err := t.transport.RoundTrip(req)
+	if err == nil {
+		throttleResponse(t.limiter, resp, time.Now(), t.logger)
+	}
+	return resp, err
+}
+
+// siteConfig returns a key from the indexer's config, falling back to the global config
+func (r *Runner) siteConfig(key string) string {
+	if r.opts.Config == nil {
+		return ""
+	}
+	if val, ok, _ := r.opts.Config.Get(r.definition.Site, key); ok && val != "" {
+		return val
+	}
+	val, _ := config.GetGlobalConfig(key, "", r.opts.Config)
+	return val
+}
+
+// newRateLimiter creates the rate limiter from the concurrency and ratelimit keys of the config
+func (r *Runner) newRateLimiter() *rateLimiter {
+	concurrency := DefaultConcurrency
+	if r.opts.LowMemory {
+		concurrency = LowMemoryConcurrency
+	}
+	if val := r.siteConfig("concurrency"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil && n > 0 {
+			concurrency = n
+		} else {
+			r.logger.Warnf("Ignoring invalid concurrency %q", val)
+		}
+	}
+
+	var interval time.Duration
+	if val := r.siteConfig("ratelimit"); val != "" {
+		if d, err := time.ParseDuration(val); err == nil && d >= 0 {
+			interval = d
+		} else {
+			r.logger.Warnf("Ignoring invalid ratelimit %q", val)
+		}
+	}
+
+	return newRateLimiter(concurrency, interval)
+}
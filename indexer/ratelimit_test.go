@@ -0,0 +1,56 @@
+package indexer
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterConcurrency(t *testing.T) {
+	l := newRateLimiter(2, 0)
+
+	var mu sync.Mutex
+	var running, maxRunning int
+	var wg sync.WaitGroup
+
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			done := l.wait()
+			defer done()
+
+			mu.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mu.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}()
+	}
+
+	wg.Wait()
+
+	if maxRunning != 2 {
+		t.Fatalf("Expected at most 2 requests at once, got %d", maxRunning)
+	}
+}
+
+func TestRateLimiterInterval(t *testing.T) {
+	l := newRateLimiter(3, 20*time.Millisecond)
+	start := time.Now()
+
+	for i := 0; i < 3; i++ {
+		l.wait()()
+	}
+
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Fatalf("Expected requests to be spaced out, 3 took %s", elapsed)
+	}
+}
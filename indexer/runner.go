@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"net/http"
 	"net/url"
 	"os"
@@ -24,7 +25,6 @@ import (
 	"github.com/cardigann/cardigann/config"
 	"github.com/cardigann/cardigann/logger"
 	"github.com/cardigann/cardigann/torznab"
-	imdbscraper "github.com/cardigann/go-imdb-scraper"
 	"github.com/cardigann/releaseinfo"
 	"github.com/dustin/go-humanize"
 	"github.com/f2prateek/train"
@@ -45,6 +45,65 @@ type RunnerOpts struct {
 	Config     config.Config
 	CachePages bool
 	Transport  http.RoundTripper
+	Capture    *Capture
+
+	// MaxBodySize and MaxRows override the maxbodysize and maxrows global config, which
+	// default to DefaultMaxBodySize and DefaultMaxRows
+	MaxBodySize int64
+	MaxRows     int
+
+	// OnError is called with each search or download that fails
+	OnError func(Failure)
+
+	// OnLayout is called with a snapshot of the search results page of searches for the latest
+	// torrents, at most once per layoutSnapshotInterval
+	OnLayout func(LayoutSnapshot)
+
+	// CacheTTL overrides the searchcachettl global config, which is how long search results
+	// are cached for
+	CacheTTL time.Duration
+
+	// LowMemory lowers the limits on responses, rows, concurrent requests and cached searches,
+	// and skips opening details pages
+	LowMemory bool
+
+	// SessionDir is where logins are locked and their sessions saved, so that processes sharing
+	// it don't log in at the same time and log each other out. Empty keeps sessions in memory
+	SessionDir string
+
+	// MetadataDir is where titles looked up by id are cached, along with search results when
+	// offlinecache is turned on, so that they can be served in offline mode. Empty turns the
+	// cache off
+	MetadataDir string
+
+	// Offline serves searches from the results cached in MetadataDir rather than going to the
+	// site, and fails anything else that would reach it with an OfflineError
+	Offline bool
+}
+
+// Failure is a search or download that failed, for keeping a history of them
+type Failure struct {
+	Site      string
+	Operation string
+	RequestID string
+
+	// Query is the encoded query of a search, or the link of a download
+	Query string
+	Err   error
+}
+
+// reportFailure passes a failed operation to the OnError option, if it's set
+func (r *Runner) reportFailure(op, requestID, query string, err error) {
+	if r.opts.OnError == nil {
+		return
+	}
+	r.opts.OnError(Failure{
+		Site:      r.definition.Site,
+		Operation: op,
+		RequestID: requestID,
+		Query:     query,
+		Err:       err,
+	})
 }
 
 type Runner struct {
@@ -52,16 +111,98 @@ type Runner struct {
 	browser     browser.Browsable
 	cookies     http.CookieJar
 	opts        RunnerOpts
+	baseLogger  logrus.FieldLogger
 	logger      logrus.FieldLogger
 	caps        torznab.Capabilities
 	browserLock sync.Mutex
+
+	// requestID is the id of the client request being served, whilst the browser lock is held
+	requestID string
+
+	// debugOutput is where DEBUG_HTTP output goes whilst the browser lock is held
+	debugOutput io.WriteCloser
+
+	// loc caches the site's timezone, as named by locName
+	loc     *time.Location
+	locName string
+
+	// maintenance tracks when the site was last seen down for maintenance, under the browser lock
+	maintenance maintenanceState
+
+	// pageURL is used to resolve links when extracting from a saved page rather than the browser
+	pageURL *url.URL
+
+	// latency is how long searches have been taking
+	latency latencyTracker
+
+	// cache holds recent search results, when searchcachettl is set
+	cache searchCache
+
+	// siteURL is the url of the site when the browser hasn't opened a page yet, for runners
+	// cloned to search concurrently
+	siteURL *url.URL
+
+	// limiter is shared by all of the browsers making requests to the site
+	limiter *rateLimiter
+
+	// budget counts the requests made to the site, when it has a request budget
+	budget *requestBudget
+
+	// crash tracks when the indexer last panicked, it's shared with clones
+	crash *crashState
+
+	// layout tracks when the search results page was last snapshotted, it's shared with clones
+	layout *layoutTimer
+
+	// session shares logins with other processes, when the SessionDir option is set
+	session *sessionFiles
+
+	// metadata caches search results and lookups, when the MetadataDir option is set
+	metadata *metadataCache
 }
 
 func NewRunner(def *IndexerDefinition, opts RunnerOpts) *Runner {
-	return &Runner{
+	l := logger.Logger.WithFields(logrus.Fields{"site": def.Site})
+
+	r := &Runner{
 		opts:       opts,
 		definition: def,
-		logger:     logger.Logger.WithFields(logrus.Fields{"site": def.Site}),
+		baseLogger: l,
+		logger:     l,
+		crash:      &crashState{},
+		layout:     &layoutTimer{},
+	}
+
+	// the limiter and budget are created up front so that whether the site is being held off
+	// can be checked without the browser lock
+	r.limiter = r.newRateLimiter()
+	r.budget = r.newRequestBudget()
+
+	if opts.SessionDir != "" {
+		r.session = &sessionFiles{dir: opts.SessionDir, site: def.Site}
+	}
+
+	if opts.MetadataDir != "" {
+		r.metadata = &metadataCache{dir: opts.MetadataDir}
+	}
+
+	if opts.LowMemory {
+		r.cache.maxEntries = lowMemoryCacheEntries
+	}
+	return r
+}
+
+// startOp attributes log lines to an operation like login or search until the returned
+// func is called. It must only be called whilst holding the browser lock
+func (r *Runner) startOp(op string) func() {
+	prev := r.logger
+	fields := logrus.Fields{"op": op}
+	if r.requestID != "" {
+		fields["request"] = r.requestID
+	}
+	r.logger = r.baseLogger.WithFields(fields)
+	return func() {
+		r.logger = prev
 	}
 }
 
@@ -98,10 +239,21 @@ func (r *Runner) createTransport() (http.RoundTripper, error) {
 func (r *Runner) createBrowser() {
 	r.browserLock.Lock()
 
+	// a panic before the browser is released would otherwise leave the lock held for good
+	defer func() {
+		if rec := recover(); rec != nil {
+			r.browserLock.Unlock()
+			panic(rec)
+		}
+	}()
+
 	if r.cookies == nil {
-		r.cookies = jar.NewMemoryCookies()
+		r.cookies = newSessionJar(jar.NewMemoryCookies())
+		r.restoreSession()
 	}
 
+	r.addSecrets()
+
 	bow := surf.NewBrowser()
 	bow.SetUserAgent(agent.Chrome())
 	bow.SetAttribute(browser.SendReferer, true)
@@ -117,11 +269,30 @@ func (r *Runner) createBrowser() {
 		transport = r.opts.Transport
 	}
 
+	if r.limiter == nil {
+		r.limiter = r.newRateLimiter()
+	}
+
+	if r.budget == nil {
+		r.budget = r.newRequestBudget()
+	}
+
+	transport = &budgetTransport{transport: transport, budget: r.budget}
+	transport = &rateLimitTransport{transport: transport, limiter: r.limiter, site: r.definition.Site, logger: r.baseLogger}
+	transport = &limitTransport{transport: transport, limit: r.maxBodySize()}
+	transport = &decodeTransport{transport: transport, hint: r.definition.Encoding, logger: r.baseLogger}
+
+	if r.opts.Capture != nil {
+		transport = r.opts.Capture.transport(transport, func() string { return r.requestID })
+	}
+
 	switch os.Getenv("DEBUG_HTTP") {
 	case "1", "true", "basic":
-		bow.SetTransport(train.TransportWith(transport, trainlog.New(os.Stderr, trainlog.Basic)))
+		r.debugOutput = logger.RedactedWriter(os.Stderr)
+		bow.SetTransport(train.TransportWith(transport, trainlog.New(r.debugOutput, trainlog.Basic)))
 	case "body":
-		bow.SetTransport(train.TransportWith(transport, trainlog.New(os.Stderr, trainlog.Body)))
+		r.debugOutput = logger.RedactedWriter(os.Stderr)
+		bow.SetTransport(train.TransportWith(transport, trainlog.New(r.debugOutput, trainlog.Body)))
 	case "":
 		bow.SetTransport(transport)
 	default:
@@ -132,7 +303,13 @@ func (r *Runner) createBrowser() {
 }
 
 func (r *Runner) releaseBrowser() {
+	if r.debugOutput != nil {
+		r.debugOutput.Close()
+		r.debugOutput = nil
+	}
 	r.browser = nil
+	r.logger = r.baseLogger
+	r.requestID = ""
 	r.browserLock.Unlock()
 }
 
@@ -150,6 +327,41 @@ func (r *Runner) checkHasConfig() error {
 	return nil
 }
 
+// secretSettings are words in the names of settings whose values are never logged
+var secretSettings = []string{"pass", "key", "token", "cookie", "secret", "session"}
+
+// addSecrets makes sure that the site's credentials are redacted from logs and captures
+func (r *Runner) addSecrets() {
+	if r.opts.Config == nil {
+		return
+	}
+
+	section, err := r.opts.Config.Section(r.definition.Site)
+	if err != nil {
+		return
+	}
+
+	passwords := map[string]bool{}
+	for _, setting := range r.definition.Settings {
+		if setting.Type == "password" {
+			passwords[setting.Name] = true
+		}
+	}
+
+	for key, val := range section {
+		if passwords[key] {
+			logger.AddSecret(val)
+			continue
+		}
+		for _, word := range secretSettings {
+			if strings.Contains(strings.ToLower(key), word) {
+				logger.AddSecret(val)
+				break
+			}
+		}
+	}
+}
+
 func (r *Runner) applyTemplate(name, tpl string, ctx interface{}) (string, error) {
 	funcMap := template.FuncMap{
 		"replace": strings.Replace,
@@ -172,10 +384,18 @@ func (r *Runner) applyTemplate(name, tpl string, ctx interface{}) (string, error
 }
 
 func (r *Runner) currentURL() (*url.URL, error) {
+	if r.pageURL != nil {
+		return r.pageURL, nil
+	}
+
 	if u := r.browser.Url(); u != nil {
 		return u, nil
 	}
 
+	if r.siteURL != nil {
+		return r.siteURL, nil
+	}
+
 	configURL, ok, _ := r.opts.Config.Get(r.definition.Site, "url")
 	if ok && r.testURLWorks(configURL) {
 		return url.Parse(configURL)
@@ -254,7 +474,7 @@ func (r *Runner) openPage(u string) error {
 
 	err := r.browser.Open(u)
 	if err != nil {
-		return err
+		return requestError(err)
 	}
 
 	r.cachePage()
@@ -263,11 +483,15 @@ func (r *Runner) openPage(u string) error {
 		WithFields(logrus.Fields{"code": r.browser.StatusCode(), "page": r.browser.Url()}).
 		Debugf("Finished request")
 
+	if err = r.checkFloodControl(); err != nil {
+		return err
+	}
+
 	if err = r.handleMetaRefreshHeader(); err != nil {
 		return err
 	}
 
-	return nil
+	return r.checkMaintenance()
 }
 
 func (r *Runner) postToPage(u string, vals url.Values) error {
@@ -276,7 +500,7 @@ func (r *Runner) postToPage(u string, vals url.Values) error {
 		Debugf("Posting to page")
 
 	if err := r.browser.PostForm(u, vals); err != nil {
-		return err
+		return requestError(err)
 	}
 
 	r.cachePage()
@@ -285,11 +509,15 @@ func (r *Runner) postToPage(u string, vals url.Values) error {
 		WithFields(logrus.Fields{"code": r.browser.StatusCode(), "page": r.browser.Url()}).
 		Debugf("Finished request")
 
+	if err := r.checkFloodControl(); err != nil {
+		return err
+	}
+
 	if err := r.handleMetaRefreshHeader(); err != nil {
 		return err
 	}
 
-	return nil
+	return r.checkMaintenance()
 }
 
 func (r *Runner) cachePage() error {
@@ -330,8 +558,10 @@ func (r *Runner) loginViaForm(loginURL, formSelector string, vals map[string]str
 		WithFields(logrus.Fields{"url": loginURL, "form": formSelector, "vals": vals}).
 		Debugf("Filling and submitting login form")
 
-	if err := r.openPage(loginURL); err != nil {
-		return err
+	if loginURL != "" {
+		if err := r.openPage(loginURL); err != nil {
+			return err
+		}
 	}
 
 	fm, err := r.browser.Form(formSelector)
@@ -392,14 +622,21 @@ func (r *Runner) loginViaCookie(loginURL string, cookie string) error {
 		WithFields(logrus.Fields{"url": loginURL, "cookies": cookies}).
 		Debugf("Setting cookies for login")
 
-	cj := jar.NewMemoryCookies()
+	// cookies from the config are for the whole site, wherever the login url is
+	for _, c := range cookies {
+		c.Path = "/"
+	}
+
+	cj := newSessionJar(jar.NewMemoryCookies())
 	cj.SetCookies(u, cookies)
 
+	// the runner's jar follows the browser's, so that the session can be saved
+	r.cookies = cj
 	r.browser.SetCookieJar(cj)
 	return nil
 }
 
-func (r *Runner) extractInputLogins() (map[string]string, error) {
+func (r *Runner) extractInputLogins(inputs inputsBlock) (map[string]string, error) {
 	result := map[string]string{}
 
 	cfg, err := r.opts.Config.Section(r.definition.Site)
@@ -413,7 +650,7 @@ func (r *Runner) extractInputLogins() (map[string]string, error) {
 		cfg,
 	}
 
-	for name, val := range r.definition.Login.Inputs {
+	for name, val := range inputs {
 		resolved, err := r.applyTemplate("login_inputs", val, ctx)
 		if err != nil {
 			return nil, err
@@ -502,38 +739,67 @@ func (r *Runner) login() error {
 		defer r.releaseBrowser()
 	}
 
-	filterLogger = r.logger
+	defer r.startOp("login")()
 
-	loginUrl, err := r.resolvePath(r.definition.Login.Path)
-	if err != nil {
+	if r.session != nil {
+		unlock, err := r.session.lock(r.logger)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		// another process might have logged in whilst this one waited for the lock, in which
+		// case logging in again could end its session
+		if r.restoreSession() && !r.definition.Login.Test.IsEmpty() {
+			if match, err := r.matchPageTestBlock(r.definition.Login.Test); err == nil && match {
+				r.logger.Debug("Using the session of another process")
+				return nil
+			}
+		}
+	}
+
+	if err := r.submitLogin(); err != nil {
 		return err
 	}
 
-	vals, err := r.extractInputLogins()
+	r.saveSession()
+	return nil
+}
+
+// submitLogin runs the steps of the login and checks that they worked
+func (r *Runner) submitLogin() error {
+	site, err := r.currentURL()
 	if err != nil {
 		return err
 	}
 
-	switch r.definition.Login.Method {
-	case "", loginMethodForm:
-		if err = r.loginViaForm(loginUrl, r.definition.Login.FormSelector, vals); err != nil {
-			return err
+	steps := r.definition.Login.steps()
+	for idx, step := range steps {
+		if len(steps) > 1 {
+			r.logger.
+				WithFields(logrus.Fields{"step": idx + 1, "path": step.Path, "method": step.Method}).
+				Debug("Running login step")
 		}
-	case loginMethodPost:
-		if err = r.loginViaPost(loginUrl, vals); err != nil {
+
+		if err = r.loginStep(site, step); err != nil {
 			return err
 		}
-	case loginMethodCookie:
-		if err = r.loginViaCookie(loginUrl, vals["cookie"]); err != nil {
-			return err
+
+		if len(r.definition.Login.Error) > 0 {
+			if err = r.definition.Login.hasError(r.browser, r.logger); err != nil {
+				if LoginErrorReason(err) == LoginErrorMaintenance {
+					return r.enterMaintenance(err.(*LoginError).Message)
+				}
+				r.logger.WithError(err).Error("Failed to login")
+				return err
+			}
 		}
-	default:
-		return fmt.Errorf("Unknown login method %q", r.definition.Login.Method)
 	}
 
-	if len(r.definition.Login.Error) > 0 {
-		if err = r.definition.Login.hasError(r.browser); err != nil {
-			r.logger.WithError(err).Error("Failed to login")
+	// paths in the rest of the definition are relative to the site, so go back to it if
+	// the login ended on an auth domain
+	if u := r.browser.Url(); u != nil && u.Host != site.Host {
+		if err = r.openPage(site.String()); err != nil {
 			return err
 		}
 	}
@@ -542,13 +808,65 @@ func (r *Runner) login() error {
 	if err != nil {
 		return err
 	} else if !match {
-		return errors.New("Login check after login failed")
+		return &LoginError{Reason: LoginErrorUnknown, Message: "the login check didn't pass after logging in"}
 	}
 
 	r.logger.Debug("Successfully logged in")
 	return nil
 }
 
+// loginStep submits one page of a login, with a path relative to the site's url. A form step
+// without a path submits a form on the page that the browser is already on
+func (r *Runner) loginStep(site *url.URL, step loginStepBlock) error {
+	u, err := url.Parse(step.Path)
+	if err != nil {
+		return err
+	}
+	loginURL := site.ResolveReference(u).String()
+
+	vals, err := r.extractInputLogins(step.Inputs)
+	if err != nil {
+		return err
+	}
+
+	switch step.Method {
+	case "", loginMethodForm:
+		if step.Path == "" {
+			loginURL = ""
+		}
+		return r.loginViaForm(loginURL, step.FormSelector, vals)
+	case loginMethodPost:
+		return r.loginViaPost(loginURL, vals)
+	case loginMethodCookie:
+		return r.loginViaCookie(loginURL, vals["cookie"])
+	}
+
+	return fmt.Errorf("Unknown login method %q", step.Method)
+}
+
+// Login logs in to the site if it's needed, so that later searches don't have to
+func (r *Runner) Login() (err error) {
+	if r.opts.Offline {
+		return &OfflineError{Site: r.definition.Site}
+	}
+
+	defer r.recoverCrash("login", &err)
+
+	r.createBrowser()
+	defer r.releaseBrowser()
+
+	if err := r.checkBackoff(); err != nil {
+		return err
+	}
+
+	required, err := r.isLoginRequired()
+	if err != nil || !required {
+		return err
+	}
+
+	return r.login()
+}
+
 func (r *Runner) Info() torznab.Info {
 	return torznab.Info{
 		ID:       r.definition.Site,
@@ -586,6 +904,12 @@ func (r *Runner) Capabilities() torznab.Capabilities {
 type extractedItem struct {
 	torznab.ResultItem
 	LocalCategoryID string
+
+	// detailsURL is the result's details page, which details fields are extracted from
+	detailsURL string
+
+	// siteID is the site's own id for the torrent, which the guid is made from if it's set
+	siteID string
 }
 
 // localCategories returns a slice of local categories that should be searched
@@ -609,23 +933,22 @@ func (r *Runner) localCategories(query torznab.Query) []string {
 }
 
 func (r *Runner) resolveQuery(query torznab.Query) (torznab.Query, error) {
-	var show *tvmaze.Show
-	var movie *imdbscraper.Movie
+	var show, movie titleLookup
 	var err error
 
 	// convert show identifiers to season parameter
 	switch {
 	case query.TVDBID != "" && query.TVDBID != "0":
-		show, err = tvmaze.DefaultClient.GetShowWithTVDBID(query.TVDBID)
+		show, err = r.lookupShow("tvdb", query.TVDBID, tvmaze.DefaultClient.GetShowWithTVDBID)
 		query.TVDBID = "0"
 	case query.TVMazeID != "":
-		show, err = tvmaze.DefaultClient.GetShowWithID(query.TVMazeID)
+		show, err = r.lookupShow("tvmaze", query.TVMazeID, tvmaze.DefaultClient.GetShowWithID)
 		query.TVMazeID = "0"
 	case query.TVRageID != "":
-		show, err = tvmaze.DefaultClient.GetShowWithTVRageID(query.TVRageID)
+		show, err = r.lookupShow("tvrage", query.TVRageID, tvmaze.DefaultClient.GetShowWithTVRageID)
 		query.TVRageID = ""
 	case query.IMDBID != "":
-		movie, err = imdbscraper.FindByID(query.IMDBID)
+		movie, err = r.lookupMovie(query.IMDBID)
 		query.IMDBID = ""
 	}
 
@@ -633,31 +956,114 @@ func (r *Runner) resolveQuery(query torznab.Query) (torznab.Query, error) {
 		return query, err
 	}
 
-	if show != nil {
-		query.Series = show.Name
-		r.logger.
-			WithFields(logrus.Fields{"name": show.Name, "year": show.GetFirstAired().Year()}).
-			Debugf("Found show via tvmaze lookup")
+	if show.Title != "" {
+		query.Series = show.Title
 	}
 
-	if movie != nil {
-		if movie.Title == "" {
-			return query, fmt.Errorf("Movie title was blank")
-		}
+	if movie.Title != "" {
 		query.Movie = movie.Title
 		query.Year = movie.Year
-		r.logger.
-			WithFields(logrus.Fields{"title": movie.Title, "year": movie.Year, "movie": movie}).
-			Debugf("Found movie via imdb lookup")
-
 	}
 
 	return query, nil
 }
 
+// templateQuery is the query as seen by search templates, where .Query.Keywords are the sanitized keywords
+type templateQuery struct {
+	torznab.Query
+	keywords string
+}
+
+func (q templateQuery) Keywords() string {
+	return q.keywords
+}
+
+// MaxAgeDays is how many days old results can be at most, from the query's maxage or mindate,
+// for sites that search by age. It's zero for any age
+func (q templateQuery) MaxAgeDays() int {
+	days := q.MaxAge
+
+	// a mindate is rounded up to take in the whole of that day
+	if !q.MinDate.IsZero() {
+		since := int(math.Ceil(time.Since(q.MinDate).Hours() / 24))
+		if since < 1 {
+			since = 1
+		}
+		if days == 0 || since < days {
+			days = since
+		}
+	}
+
+	return days
+}
+
+// From and To are the query's date range as dates like 2006-01-02, for sites that search by
+// date. Either is empty if that end of the range is open
+func (q templateQuery) From() string {
+	from, _ := q.DateRange(time.Now())
+	if from.IsZero() {
+		return ""
+	}
+	return from.Format(torznab.DateFormat)
+}
+
+func (q templateQuery) To() string {
+	if q.MaxDate.IsZero() {
+		return ""
+	}
+	return q.MaxDate.Format(torznab.DateFormat)
+}
+
 func (r *Runner) Search(query torznab.Query) ([]torznab.ResultItem, error) {
+	if r.opts.Offline {
+		return r.offlineSearch(query)
+	}
+
+	if ttl := r.cacheTTL(); ttl > 0 {
+		return r.cachedSearch(query, ttl)
+	}
+	return r.timedSearch(query)
+}
+
+// timedSearch searches the site, recording how long it took and reporting failures
+func (r *Runner) timedSearch(query torznab.Query) (items []torznab.ResultItem, err error) {
+	// held off searches aren't failures of the site
+	if err := r.checkQuietHours(query, time.Now()); err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			r.reportFailure("search", query.RequestID, query.Encode(), err)
+		}
+	}()
+	defer r.recoverCrash("search", &err)
+
+	start := time.Now()
+	items, err = r.search(query)
+	r.latency.observe(time.Since(start))
+
+	if err == nil {
+		r.saveResults(query, items)
+	}
+
+	return items, err
+}
+
+// Latency returns the moving average of how long searches take, and when it was last updated
+func (r *Runner) Latency() (time.Duration, time.Time) {
+	return r.latency.get()
+}
+
+func (r *Runner) search(query torznab.Query) ([]torznab.ResultItem, error) {
 	r.createBrowser()
 	defer r.releaseBrowser()
+	r.requestID = query.RequestID
+	defer r.startOp("search")()
+
+	if err := r.checkBackoff(); err != nil {
+		return nil, err
+	}
 
 	var err error
 	query, err = r.resolveQuery(query)
@@ -665,9 +1071,6 @@ func (r *Runner) Search(query torznab.Query) ([]torznab.ResultItem, error) {
 		return nil, err
 	}
 
-	// TODO: make this concurrency safe
-	filterLogger = r.logger
-
 	if required, err := r.isLoginRequired(); err != nil {
 		return nil, err
 	} else if required {
@@ -679,20 +1082,85 @@ func (r *Runner) Search(query torznab.Query) ([]torznab.ResultItem, error) {
 
 	localCats := r.localCategories(query)
 
+	sanitizer, err := r.sanitizer()
+	if err != nil {
+		return nil, err
+	}
+
+	terms := r.searchTerms(query, sanitizer)
+
 	r.logger.Debugf("Query is %v", query)
-	r.logger.Debugf("Keywords are %q", query.Keywords())
+	r.logger.Debugf("Keywords are %q", terms)
+
+	r.logger.
+		WithFields(logrus.Fields{"query": query.Encode()}).
+		Infof("Searching indexer")
+
+	timer := time.Now()
+
+	var extracted []extractedItem
+	if len(terms) > 1 {
+		extracted, err = r.searchConcurrently(query, localCats, terms)
+	} else {
+		extracted, err = r.searchKeywords(query, localCats, terms[0])
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r.logger.
+		WithFields(logrus.Fields{"time": time.Now().Sub(timer)}).
+		Infof("Query returned %d results", len(extracted))
+
+	r.resetMaintenance()
+	r.crash.reset()
+
+	items := []torznab.ResultItem{}
+	for _, item := range extracted {
+		items = append(items, item.ResultItem)
+	}
+
+	return items, nil
+}
+
+// searchKeywords searches each of the definition's search paths for the categories for some keywords
+func (r *Runner) searchKeywords(query torznab.Query, localCats []string, keywords string) ([]extractedItem, error) {
+	extracted := []extractedItem{}
+
+	for _, target := range r.definition.Search.targets(localCats) {
+		limit := 0
+		if query.Limit > 0 {
+			if limit = query.Limit - len(extracted); limit <= 0 {
+				break
+			}
+		}
+
+		items, err := r.searchPath(target, query, keywords, limit)
+		if err != nil {
+			return nil, err
+		}
+
+		extracted = append(extracted, items...)
+	}
+
+	return extracted, nil
+}
+
+// searchPath runs a search against one of the definition's search paths, returning at most limit items
+func (r *Runner) searchPath(target searchTarget, query torznab.Query, keywords string, limit int) ([]extractedItem, error) {
+	localCats := target.localCats
 
 	templateCtx := struct {
-		Query      torznab.Query
+		Query      templateQuery
 		Keywords   string
 		Categories []string
 	}{
-		query,
-		query.Keywords(),
+		templateQuery{query, keywords},
+		keywords,
 		localCats,
 	}
 
-	searchURL, err := r.applyTemplate("search_path", r.definition.Search.Path, templateCtx)
+	searchURL, err := r.applyTemplate("search_path", target.Path, templateCtx)
 	if err != nil {
 		return nil, err
 	}
@@ -702,13 +1170,9 @@ func (r *Runner) Search(query torznab.Query) ([]torznab.ResultItem, error) {
 		return nil, err
 	}
 
-	r.logger.
-		WithFields(logrus.Fields{"query": query.Encode()}).
-		Infof("Searching indexer")
-
 	vals := url.Values{}
 
-	for name, val := range r.definition.Search.Inputs {
+	for name, val := range target.Inputs {
 		resolved, err := r.applyTemplate("search_inputs", val, templateCtx)
 		if err != nil {
 			return nil, err
@@ -735,9 +1199,25 @@ func (r *Runner) Search(query torznab.Query) ([]torznab.ResultItem, error) {
 		}
 	}
 
-	timer := time.Now()
+	tokens, err := r.scrapeTokens(r.definition.Search.Tokens, searchURL)
+	if err != nil {
+		return nil, err
+	}
 
-	switch r.definition.Search.Method {
+	for name, values := range tokens {
+		vals[name] = values
+	}
+
+	// sites that don't use utf-8 expect search terms in their own encoding
+	if c, ok := lookupCharmap(r.definition.Encoding); ok && c != nil {
+		for _, values := range vals {
+			for idx := range values {
+				values[idx] = c.encode(values[idx])
+			}
+		}
+	}
+
+	switch target.Method {
 	case "", searchMethodGet:
 		if len(vals) > 0 {
 			searchURL = fmt.Sprintf("%s?%s", searchURL, vals.Encode())
@@ -751,43 +1231,32 @@ func (r *Runner) Search(query torznab.Query) ([]torznab.ResultItem, error) {
 		}
 
 	default:
-		return nil, fmt.Errorf("Unknown search method %q", r.definition.Search.Method)
-	}
-
-	dom := r.browser.Dom()
-
-	// merge following rows for After selector
-	if after := r.definition.Search.Rows.After; after > 0 {
-		rows := dom.Find(r.definition.Search.Rows.Selector)
-		for i := 0; i < rows.Length(); i += 1 + after {
-			rows.Eq(i).AppendSelection(rows.Slice(i+1, i+1+after).Find("td"))
-			rows.Slice(i+1, i+1+after).Remove()
-		}
+		return nil, fmt.Errorf("Unknown search method %q", target.Method)
 	}
 
-	// apply Remove if it exists
-	if remove := r.definition.Search.Rows.Remove; remove != "" {
-		matching := dom.Find(r.definition.Search.Rows.Selector).Filter(remove)
-		r.logger.
-			WithFields(logrus.Fields{"selector": remove}).
-			Debugf("Applying remove to %d rows", matching.Length())
-		matching.Remove()
-	}
-
-	rows := dom.Find(r.definition.Search.Rows.Selector)
+	rows := r.selectRows(r.browser.Dom())
 
 	r.logger.
 		WithFields(logrus.Fields{
 			"rows":     rows.Length(),
 			"selector": r.definition.Search.Rows.Selector,
-			"limit":    query.Limit,
+			"limit":    limit,
 			"offset":   query.Offset,
 		}).Debugf("Found %d rows", rows.Length())
 
+	if max := r.maxRows(); rows.Length() > max {
+		return nil, fmt.Errorf("Search results page had %d rows, more than the limit of %d", rows.Length(), max)
+	}
+
+	// the latest torrents make for pages that can be compared over time
+	if keywords == "" && query.Offset == 0 {
+		r.snapshotLayout(rows)
+	}
+
 	extracted := []extractedItem{}
 
 	for i := 0; i < rows.Length(); i++ {
-		if query.Limit > 0 && len(extracted) >= query.Limit {
+		if limit > 0 && len(extracted) >= limit {
 			break
 		}
 
@@ -812,16 +1281,14 @@ func (r *Runner) Search(query torznab.Query) ([]torznab.ResultItem, error) {
 			}
 		}
 
-		if mappedCat, ok := r.definition.Capabilities.CategoryMap[item.LocalCategoryID]; ok {
-			item.Category = mappedCat.ID
-		} else {
-			r.logger.
-				WithFields(logrus.Fields{"localId": item.LocalCategoryID}).
-				Warn("Unknown local category")
+		r.mapCategory(&item)
 
-			if intCatId, err := strconv.Atoi(item.LocalCategoryID); err == nil {
-				item.Category = intCatId + torznab.CustomCategoryOffset
-			}
+		// not all sites can search by category, so make sure nothing from the wrong one gets through
+		if !torznab.CategoryMatches(query.Categories, item.Category) {
+			r.logger.
+				WithFields(logrus.Fields{"category": item.Category, "cats": query.Categories}).
+				Debug("Skipping result in a category that wasn't asked for")
+			continue
 		}
 
 		if query.Series != "" {
@@ -845,16 +1312,47 @@ func (r *Runner) Search(query torznab.Query) ([]torznab.ResultItem, error) {
 		extracted = append(extracted, item)
 	}
 
-	r.logger.
-		WithFields(logrus.Fields{"time": time.Now().Sub(timer)}).
-		Infof("Query returned %d results", len(extracted))
+	r.extractDetails(extracted)
 
-	items := []torznab.ResultItem{}
-	for _, item := range extracted {
-		items = append(items, item.ResultItem)
+	return extracted, nil
+}
+
+// selectRows finds the result rows in a page, applying the after and remove options of the rows block
+func (r *Runner) selectRows(dom *goquery.Selection) *goquery.Selection {
+	// merge following rows for After selector
+	if after := r.definition.Search.Rows.After; after > 0 {
+		rows := dom.Find(r.definition.Search.Rows.Selector)
+		for i := 0; i < rows.Length(); i += 1 + after {
+			rows.Eq(i).AppendSelection(rows.Slice(i+1, i+1+after).Find("td"))
+			rows.Slice(i+1, i+1+after).Remove()
+		}
 	}
 
-	return items, nil
+	// apply Remove if it exists
+	if remove := r.definition.Search.Rows.Remove; remove != "" {
+		matching := dom.Find(r.definition.Search.Rows.Selector).Filter(remove)
+		r.logger.
+			WithFields(logrus.Fields{"selector": remove}).
+			Debugf("Applying remove to %d rows", matching.Length())
+		matching.Remove()
+	}
+
+	return dom.Find(r.definition.Search.Rows.Selector)
+}
+
+// mapCategory maps the local category of an item to a torznab one
+func (r *Runner) mapCategory(item *extractedItem) {
+	if mappedCat, ok := r.definition.Capabilities.CategoryMap[item.LocalCategoryID]; ok {
+		item.Category = mappedCat.ID
+	} else {
+		r.logger.
+			WithFields(logrus.Fields{"localId": item.LocalCategoryID}).
+			Warn("Unknown local category")
+
+		if intCatId, err := strconv.Atoi(item.LocalCategoryID); err == nil {
+			item.Category = intCatId + torznab.CustomCategoryOffset
+		}
+	}
 }
 
 func (r *Runner) extractItem(rowIdx int, selection *goquery.Selection) (extractedItem, error) {
@@ -868,7 +1366,7 @@ func (r *Runner) extractItem(rowIdx int, selection *goquery.Selection) (extracte
 			WithFields(logrus.Fields{"row": rowIdx, "block": item.Block.String()}).
 			Debugf("Processing field %q", item.Field)
 
-		val, err := item.Block.MatchText(selection)
+		val, err := r.matchField(item, selection)
 		if err != nil {
 			return extractedItem{}, err
 		}
@@ -882,7 +1380,9 @@ func (r *Runner) extractItem(rowIdx int, selection *goquery.Selection) (extracte
 
 	item := extractedItem{
 		ResultItem: torznab.ResultItem{
-			Site: r.definition.Site,
+			Site:     r.definition.Site,
+			SiteName: r.definition.Name,
+			Language: torznab.NormalizeLanguage(r.definition.Language),
 		},
 	}
 
@@ -891,120 +1391,10 @@ func (r *Runner) extractItem(rowIdx int, selection *goquery.Selection) (extracte
 		Debugf("Finished row %d", rowIdx)
 
 	for key, val := range row {
-		switch key {
-		case "download":
-			u, err := r.resolvePath(val)
-			if err != nil {
-				r.logger.Warnf("Row #%d has unparseable url %q in %s", rowIdx, val, key)
-				continue
-			}
-			item.Link = u
-		case "details":
-			u, err := r.resolvePath(val)
-			if err != nil {
-				r.logger.Warnf("Row #%d has unparseable url %q in %s", rowIdx, val, key)
-				continue
-			}
-			item.GUID = u
-
-			// comments is used by Sonarr for linking to
-			if item.Comments == "" {
-				item.Comments = u
-			}
-		case "comments":
-			u, err := r.resolvePath(val)
-			if err != nil {
-				r.logger.Warnf("Row #%d has unparseable url %q in %s", rowIdx, val, key)
-				continue
-			}
-			item.Comments = u
-		case "title":
-			item.Title = val
-		case "description":
-			item.Description = val
-		case "category":
-			item.LocalCategoryID = val
-		case "size":
-			bytes, err := humanize.ParseBytes(strings.Replace(val, ",", "", -1))
-			if err != nil {
-				r.logger.Warnf("Row #%d has unparseable size %q: %v", rowIdx, val, err.Error())
-				continue
-			}
-			r.logger.Debugf("After parsing, size is %v", bytes)
-			item.Size = bytes
-		case "leechers":
-			leechers, err := strconv.Atoi(normalizeNumber(val))
-			if err != nil {
-				r.logger.Warnf("Row #%d has unparseable leechers value %q in %s", rowIdx, val, key)
-				continue
-			}
-			item.Peers += leechers
-		case "seeders":
-			seeders, err := strconv.Atoi(normalizeNumber(val))
-			if err != nil {
-				r.logger.Warnf("Row #%d has unparseable seeders value %q in %s", rowIdx, val, key)
-				continue
-			}
-			item.Seeders = seeders
-			item.Peers += seeders
-		case "date":
-			t, err := parseFuzzyTime(val, time.Now())
-			if err != nil {
-				r.logger.Warnf("Row #%d has unparseable time %q in %s", rowIdx, val, key)
-				continue
-			}
-			item.PublishDate = t
-		case "files":
-			files, err := strconv.Atoi(normalizeNumber(val))
-			if err != nil {
-				r.logger.Warnf("Row #%d has unparseable files value %q in %s", rowIdx, val, key)
-				continue
-			}
-			item.Files = files
-		case "grabs":
-			grabs, err := strconv.Atoi(normalizeNumber(val))
-			if err != nil {
-				r.logger.Warnf("Row #%d has unparseable grabs value %q in %s", rowIdx, val, key)
-				continue
-			}
-			item.Grabs = grabs
-		case "downloadvolumefactor":
-			downloadvolumefactor, err := strconv.ParseFloat(normalizeNumber(val), 64)
-			if err != nil {
-				r.logger.Warnf("Row #%d has unparseable downloadvolumefactor value %q in %s", rowIdx, val, key)
-				continue
-			}
-			item.DownloadVolumeFactor = downloadvolumefactor
-		case "uploadvolumefactor":
-			uploadvolumefactor, err := strconv.ParseFloat(normalizeNumber(val), 64)
-			if err != nil {
-				r.logger.Warnf("Row #%d has unparseable uploadvolumefactor value %q in %s", rowIdx, val, key)
-				continue
-			}
-			item.UploadVolumeFactor = uploadvolumefactor
-		case "minimumratio":
-			minimumratio, err := strconv.ParseFloat(normalizeNumber(val), 64)
-			if err != nil {
-				r.logger.Warnf("Row #%d has unparseable minimumratio value %q in %s", rowIdx, val, key)
-				continue
-			}
-			item.MinimumRatio = minimumratio
-		case "minimumseedtime":
-			minimumseedtime, err := strconv.ParseFloat(normalizeNumber(val), 64)
-			if err != nil {
-				r.logger.Warnf("Row #%d has unparseable minimumseedtime value %q in %s", rowIdx, val, key)
-				continue
-			}
-			item.MinimumSeedTime = time.Duration(minimumseedtime) * time.Second
-		default:
-			r.logger.Warnf("Row #%d has unknown field %s", rowIdx, key)
-			continue
-		}
+		r.setField(&item, rowIdx, key, val)
 	}
 
-	if item.GUID == "" && item.Link != "" {
-		item.GUID = item.Link
-	}
+	item.GUID = r.guid(item)
 
 	if r.hasDateHeader() {
 		date, err := r.extractDateHeader(selection)
@@ -1018,6 +1408,176 @@ func (r *Runner) extractItem(rowIdx int, selection *goquery.Selection) (extracte
 	return item, nil
 }
 
+// matchField extracts the value of a field from a selection. Descriptions are extracted as html
+// and converted, so that they keep their line breaks, and then filtered unless the field asks for
+// its filters to be applied to the html
+func (r *Runner) matchField(f fieldBlock, from *goquery.Selection) (string, error) {
+	block := f.Block
+	if f.Field != "description" {
+		return block.MatchText(from, r.logger, r.location())
+	}
+
+	block.html = true
+	if !block.FilterHTML {
+		block.Filters = nil
+	}
+
+	val, err := block.MatchText(from, r.logger, r.location())
+	if err != nil {
+		return "", err
+	}
+
+	val = htmlToText(val, block.Format)
+
+	if !block.FilterHTML {
+		block.Filters = f.Block.Filters
+		return block.applyFilters(val, r.logger, r.location())
+	}
+
+	return val, nil
+}
+
+// setField parses the extracted value of a field into the item
+func (r *Runner) setField(item *extractedItem, rowIdx int, key, val string) {
+	switch key {
+	case "download":
+		u, err := r.resolvePath(val)
+		if err != nil {
+			r.logger.Warnf("Row #%d has unparseable url %q in %s", rowIdx, val, key)
+			return
+		}
+		item.Link = u
+	case "details":
+		u, err := r.resolvePath(val)
+		if err != nil {
+			r.logger.Warnf("Row #%d has unparseable url %q in %s", rowIdx, val, key)
+			return
+		}
+		item.detailsURL = u
+
+		// comments is used by Sonarr for linking to
+		if item.Comments == "" {
+			item.Comments = u
+		}
+	case "comments":
+		u, err := r.resolvePath(val)
+		if err != nil {
+			r.logger.Warnf("Row #%d has unparseable url %q in %s", rowIdx, val, key)
+			return
+		}
+		item.Comments = u
+	case "id":
+		item.siteID = strings.TrimSpace(val)
+	case "title":
+		item.Title = val
+	case "description":
+		item.Description = val
+	case "genre":
+		item.Genre = val
+	case "language":
+		// rows without a language keep the definition's
+		if strings.TrimSpace(val) == "" {
+			return
+		}
+		lang := torznab.NormalizeLanguage(val)
+		if lang == "" {
+			r.logger.Warnf("Row #%d has unknown language %q in %s", rowIdx, val, key)
+			return
+		}
+		item.Language = lang
+	case torznab.FlagInternal, torznab.FlagScene, torznab.FlagExclusive:
+		flag, err := torznab.ParseFlag(key, val)
+		if err != nil {
+			r.logger.Warnf("Row #%d has unparseable %s value %q", rowIdx, key, val)
+			return
+		}
+		item.SetFlag(key, flag)
+	case "poster":
+		u, err := r.resolvePath(val)
+		if err != nil {
+			r.logger.Warnf("Row #%d has unparseable url %q in %s", rowIdx, val, key)
+			return
+		}
+		item.Poster = u
+	case "category":
+		item.LocalCategoryID = val
+	case "size":
+		bytes, err := humanize.ParseBytes(strings.Replace(val, ",", "", -1))
+		if err != nil {
+			r.logger.Warnf("Row #%d has unparseable size %q: %v", rowIdx, val, err.Error())
+			return
+		}
+		r.logger.Debugf("After parsing, size is %v", bytes)
+		item.Size = bytes
+	case "leechers":
+		leechers, err := strconv.Atoi(normalizeNumber(val))
+		if err != nil {
+			r.logger.Warnf("Row #%d has unparseable leechers value %q in %s", rowIdx, val, key)
+			return
+		}
+		item.Peers += leechers
+	case "seeders":
+		seeders, err := strconv.Atoi(normalizeNumber(val))
+		if err != nil {
+			r.logger.Warnf("Row #%d has unparseable seeders value %q in %s", rowIdx, val, key)
+			return
+		}
+		item.Seeders = seeders
+		item.Peers += seeders
+	case "date":
+		t, err := r.parseDate(val)
+		if err != nil {
+			r.logger.Warnf("Row #%d has unparseable time %q in %s", rowIdx, val, key)
+			return
+		}
+		item.PublishDate = t
+	case "files":
+		files, err := strconv.Atoi(normalizeNumber(val))
+		if err != nil {
+			r.logger.Warnf("Row #%d has unparseable files value %q in %s", rowIdx, val, key)
+			return
+		}
+		item.Files = files
+	case "grabs", "snatched":
+		grabs, err := strconv.Atoi(normalizeNumber(val))
+		if err != nil {
+			r.logger.Warnf("Row #%d has unparseable grabs value %q in %s", rowIdx, val, key)
+			return
+		}
+		item.Grabs = grabs
+	case "downloadvolumefactor":
+		downloadvolumefactor, err := strconv.ParseFloat(normalizeNumber(val), 64)
+		if err != nil {
+			r.logger.Warnf("Row #%d has unparseable downloadvolumefactor value %q in %s", rowIdx, val, key)
+			return
+		}
+		item.DownloadVolumeFactor = downloadvolumefactor
+	case "uploadvolumefactor":
+		uploadvolumefactor, err := strconv.ParseFloat(normalizeNumber(val), 64)
+		if err != nil {
+			r.logger.Warnf("Row #%d has unparseable uploadvolumefactor value %q in %s", rowIdx, val, key)
+			return
+		}
+		item.UploadVolumeFactor = uploadvolumefactor
+	case "minimumratio":
+		minimumratio, err := strconv.ParseFloat(normalizeNumber(val), 64)
+		if err != nil {
+			r.logger.Warnf("Row #%d has unparseable minimumratio value %q in %s", rowIdx, val, key)
+			return
+		}
+		item.MinimumRatio = minimumratio
+	case "minimumseedtime":
+		minimumseedtime, err := strconv.ParseFloat(normalizeNumber(val), 64)
+		if err != nil {
+			r.logger.Warnf("Row #%d has unparseable minimumseedtime value %q in %s", rowIdx, val, key)
+			return
+		}
+		item.MinimumSeedTime = time.Duration(minimumseedtime) * time.Second
+	default:
+		r.logger.Warnf("Row #%d has unknown field %s", rowIdx, key)
+	}
+}
+
 func (r *Runner) hasDateHeader() bool {
 	return !r.definition.Search.Rows.DateHeaders.IsEmpty()
 }
@@ -1034,12 +1594,42 @@ func (r *Runner) extractDateHeader(selection *goquery.Selection) (time.Time, err
 		return time.Time{}, fmt.Errorf("No date header row found")
 	}
 
-	dv, _ := dateHeaders.Text(prev.First())
-	return parseFuzzyTime(dv, time.Now())
+	dv, _ := dateHeaders.Text(prev.First(), r.logger, r.location())
+	return r.parseDate(dv)
 }
 
-func (r *Runner) Download(u string) (io.ReadCloser, http.Header, error) {
+func (r *Runner) Download(u string) (rc io.ReadCloser, h http.Header, err error) {
+	if r.opts.Offline {
+		return nil, nil, &OfflineError{Site: r.definition.Site}
+	}
+
+	defer func() {
+		if err != nil {
+			r.reportFailure("download", "", u, err)
+		}
+	}()
+	defer r.recoverCrash("download", &err)
+
+	return r.download(u)
+}
+
+// download opens a download, the browser lock is held until the returned reader has been
+// read to the end, or released straight away if opening it fails
+func (r *Runner) download(u string) (rc io.ReadCloser, h http.Header, err error) {
 	r.createBrowser()
+	endOp := r.startOp("download")
+
+	released := false
+	defer func() {
+		if !released {
+			endOp()
+			r.releaseBrowser()
+		}
+	}()
+
+	if err := r.checkBackoff(); err != nil {
+		return nil, http.Header{}, err
+	}
 
 	if required, err := r.isLoginRequired(); required {
 		if err := r.login(); err != nil {
@@ -1056,24 +1646,37 @@ func (r *Runner) Download(u string) (io.ReadCloser, http.Header, error) {
 	}
 
 	if err := r.browser.Open(fullUrl); err != nil {
-		return nil, http.Header{}, err
+		return nil, http.Header{}, requestError(err)
 	}
 
+	// the headers are read before the browser can be released by the goroutine
+	headers := r.browser.ResponseHeaders()
+	bow, logger := r.browser, r.logger
+
 	pipeR, pipeW := io.Pipe()
 	go func() {
-		defer pipeW.Close()
-		defer r.releaseBrowser()
-		n, err := r.browser.Download(pipeW)
+		var err error
+		defer func() {
+			pipeW.CloseWithError(err)
+			endOp()
+			r.releaseBrowser()
+		}()
+		defer r.recoverCrash("download", &err)
+
+		n, err := bow.Download(pipeW)
 		if err != nil {
-			r.logger.Error(err)
+			logger.Error(err)
 		}
-		r.logger.WithFields(logrus.Fields{"url": fullUrl}).Debugf("Downloaded %d bytes", n)
+		logger.WithFields(logrus.Fields{"url": fullUrl}).Debugf("Downloaded %d bytes", n)
 	}()
 
-	return pipeR, r.browser.ResponseHeaders(), nil
+	released = true
+	return pipeR, headers, nil
 }
 
-func (r *Runner) Ratio() (string, error) {
+func (r *Runner) Ratio() (ratio string, err error) {
+	defer r.recoverCrash("ratio", &err)
+
 	if r.definition.Ratio.TextVal != "" {
 		return r.definition.Ratio.TextVal, nil
 	}
@@ -1082,8 +1685,17 @@ func (r *Runner) Ratio() (string, error) {
 		return "unknown", nil
 	}
 
+	if r.opts.Offline {
+		return "", &OfflineError{Site: r.definition.Site}
+	}
+
 	r.createBrowser()
 	defer r.releaseBrowser()
+	defer r.startOp("ratio")()
+
+	if err := r.checkBackoff(); err != nil {
+		return "error", err
+	}
 
 	if required, err := r.isLoginRequired(); required {
 		if err := r.login(); err != nil {
@@ -1105,7 +1717,7 @@ func (r *Runner) Ratio() (string, error) {
 		return "error", nil
 	}
 
-	ratio, err := r.definition.Ratio.MatchText(r.browser.Dom())
+	ratio, err = r.definition.Ratio.MatchText(r.browser.Dom(), r.logger, r.location())
 	if err != nil {
 		return ratio, err
 	}
@@ -2,6 +2,8 @@ package indexer
 
 import (
 	"net/http"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
@@ -31,6 +33,7 @@ const exampleDefinition2 = `
       llamas_password: "{{ .Config.password }}"
     error:
       selector: .loginerror a
+      type: credentials
     test:
       path: /profile.php
       selector: .header:contains('Welcome back')
@@ -283,8 +286,8 @@ func TestIndexerDefinitionRunner_Login(t *testing.T) {
 	r := NewRunner(def, RunnerOpts{Config: conf})
 	err = r.login()
 
-	if err == nil || err.Error() != "Login failed" {
-		t.Fatalf("Expected 'Login failed', got %#v", err)
+	if le, ok := err.(*LoginError); !ok || le.Message != "Login failed" || le.Reason != LoginErrorCredentials {
+		t.Fatalf("Expected a credentials LoginError with 'Login failed', got %#v", err)
 	}
 
 	registerResponder("POST", "https://example.org/login.php", func(req *http.Request) (*http.Response, error) {
@@ -303,6 +306,10 @@ func TestIndexerDefinitionRunner_Login(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+
+	if err = r.Login(); err != nil {
+		t.Fatalf("Expected Login to succeed once already logged in, got %v", err)
+	}
 }
 
 func TestIndexerDefinitionRunner_Search(t *testing.T) {
@@ -322,7 +329,8 @@ func TestIndexerDefinitionRunner_Search(t *testing.T) {
 		},
 	}
 
-	r := NewRunner(def, RunnerOpts{Config: conf})
+	capture := &Capture{}
+	r := NewRunner(def, RunnerOpts{Config: conf, Capture: capture})
 
 	var loggedIn bool
 
@@ -352,7 +360,7 @@ func TestIndexerDefinitionRunner_Search(t *testing.T) {
 		return httpmock.NewStringResponse(http.StatusOK, exampleSearchPage), nil
 	})
 
-	results, err := r.Search(torznab.Query{Type: "tv-search", Q: "llamas", Categories: []int{torznab.CategoryAudio_Foreign.ID}})
+	results, err := r.Search(torznab.Query{Type: "tv-search", Q: "llamas", Categories: []int{torznab.CategoryAudio_Foreign.ID}, RequestID: "abc123"})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -361,6 +369,17 @@ func TestIndexerDefinitionRunner_Search(t *testing.T) {
 		t.Fatalf("Expected 1 result, got %d", len(results))
 	}
 
+	exchanges := capture.Exchanges(nil)
+	if len(exchanges) == 0 {
+		t.Fatal("Expected requests to be captured")
+	}
+
+	for idx, ex := range exchanges {
+		if ex.RequestID != "abc123" {
+			t.Errorf("Row #%d: expected request id abc123, got %q", idx+1, ex.RequestID)
+		}
+	}
+
 	if results[0].MinimumRatio != 0.5 {
 		t.Fatal("Incorrect minimum ratio")
 	}
@@ -453,6 +472,52 @@ func TestIndexerDefinitionRunner_MultiRowSearch(t *testing.T) {
 		t.Fatalf("Expected row 2 to have publish date of %q, got %q",
 			expectedDate.String(), results[1].PublishDate)
 	}
+
+	r.opts.MaxRows = 1
+	if _, err = r.Search(torznab.Query{Type: "tv-search", Q: "llamas"}); err == nil {
+		t.Fatal("Expected an error when the page has more rows than the limit")
+	}
+}
+
+func TestIndexerDefinitionRunner_Extract(t *testing.T) {
+	def, err := ParseDefinition([]byte(exampleDefinition2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := Extract(def, strings.NewReader(exampleSearchPage), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 1 {
+		t.Fatalf("Expected 1 row, got %d", len(rows))
+	}
+
+	if rows[0].Error != nil {
+		t.Fatal(rows[0].Error)
+	}
+
+	fields := map[string]string{}
+	for _, f := range rows[0].Fields {
+		if f.Error != nil {
+			t.Fatalf("Field %s had an unexpected error: %v", f.Field, f.Error)
+		}
+		fields[f.Field] = f.Value
+	}
+
+	if fields["size"] != "4GB" {
+		t.Fatalf("Expected size field to be 4GB, got %q", fields["size"])
+	}
+
+	expectedLink := "http://www.example.org/download/mma_llama_309960/mma_llama_309960_archive.torrent"
+	if rows[0].Item.Link != expectedLink {
+		t.Fatalf("Expected link %q, got %q", expectedLink, rows[0].Item.Link)
+	}
+
+	if rows[0].Item.Category != torznab.CategoryAudio.ID {
+		t.Fatalf("Expected category %d, got %d", torznab.CategoryAudio.ID, rows[0].Item.Category)
+	}
 }
 
 func TestIndexerDefinitionRunner_Ratio(t *testing.T) {
@@ -491,3 +556,409 @@ func TestIndexerDefinitionRunner_Ratio(t *testing.T) {
 		t.Fatalf("Expected ratio of 1.5, got %v", ratio)
 	}
 }
+
+func TestIndexerDefinitionRunner_RawSearch(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	def, err := ParseDefinition([]byte(exampleDefinitionWithMultiRow))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := &config.ArrayConfig{
+		"example": map[string]string{"url": "https://example.org/"},
+	}
+
+	registerResponder("GET", "https://example.org/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, ""), nil
+	})
+
+	registerResponder("GET", "https://example.org/profile.php", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, ""), nil
+	})
+
+	var search string
+	registerResponder("GET", "https://example.org/torrents.php", func(req *http.Request) (*http.Response, error) {
+		search = req.URL.Query().Get("search")
+		return httpmock.NewStringResponse(http.StatusOK, exampleSearchPageWithDateHeadersAndMultiRow), nil
+	})
+
+	r := NewRunner(def, RunnerOpts{Config: conf})
+	if _, err = r.Search(torznab.Query{Q: "llamas", Raw: "@artist alpaca"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if search != "llamas @artist alpaca" {
+		t.Fatalf("Expected raw search syntax to be passed through, got %q", search)
+	}
+}
+
+func TestIndexerDefinitionRunner_DateSearch(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	def, err := ParseDefinition([]byte(strings.Replace(exampleDefinitionWithMultiRow,
+		"&cat=0", "&cat=0&days={{ .Query.MaxAgeDays }}&from={{ .Query.From }}&to={{ .Query.To }}", 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := &config.ArrayConfig{
+		"example": map[string]string{"url": "https://example.org/"},
+	}
+
+	registerResponder("GET", "https://example.org/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, ""), nil
+	})
+
+	registerResponder("GET", "https://example.org/profile.php", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, ""), nil
+	})
+
+	var vals url.Values
+	registerResponder("GET", "https://example.org/torrents.php", func(req *http.Request) (*http.Response, error) {
+		vals = req.URL.Query()
+		return httpmock.NewStringResponse(http.StatusOK, exampleSearchPageWithDateHeadersAndMultiRow), nil
+	})
+
+	r := NewRunner(def, RunnerOpts{Config: conf})
+
+	maxDate := time.Now().AddDate(0, 0, -1).Truncate(24 * time.Hour)
+	if _, err = r.Search(torznab.Query{Q: "llamas", MaxAge: 7, MaxDate: maxDate}); err != nil {
+		t.Fatal(err)
+	}
+
+	from := time.Now().AddDate(0, 0, -7).Format(torznab.DateFormat)
+	if vals.Get("days") != "7" || vals.Get("from") != from || vals.Get("to") != maxDate.Format(torznab.DateFormat) {
+		t.Fatalf("Expected the date range to be passed to the site, got %v", vals)
+	}
+
+	if _, err = r.Search(torznab.Query{Q: "alpacas"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if vals.Get("days") != "0" || vals.Get("from") != "" || vals.Get("to") != "" {
+		t.Fatalf("Expected no date range to be passed to the site, got %v", vals)
+	}
+}
+
+func TestIndexerDefinitionRunner_DetailsSearch(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	def, err := ParseDefinition([]byte(exampleDefinitionWithMultiRow))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	def.Search.Details = detailsBlock{
+		Fields: fieldsListBlock{
+			{Field: "snatched", Block: selectorBlock{Selector: ".snatched"}},
+			{Field: "date", Block: selectorBlock{Selector: ".added", Attribute: "title"}},
+		},
+		Limit: 2,
+	}
+
+	conf := &config.ArrayConfig{
+		"example": map[string]string{"url": "https://example.org/"},
+	}
+
+	registerResponder("GET", "https://example.org/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, ""), nil
+	})
+
+	registerResponder("GET", "https://example.org/profile.php", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, ""), nil
+	})
+
+	registerResponder("GET", "https://example.org/torrents.php", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, exampleSearchPageWithDateHeadersAndMultiRow), nil
+	})
+
+	opened := []string{}
+	registerResponder("GET", "https://example.org/details.php", func(req *http.Request) (*http.Response, error) {
+		opened = append(opened, req.URL.RawQuery)
+		return httpmock.NewStringResponse(http.StatusOK, `<html><body>
+			<span class="added" title="2016-08-25 13:14:15">3 days ago</span>
+			<span class="snatched">1,234</span>
+		</body></html>`), nil
+	})
+
+	r := NewRunner(def, RunnerOpts{Config: conf})
+	results, err := r.Search(torznab.Query{Q: "llamas"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(opened) != 2 {
+		t.Fatalf("Expected the details of 2 results to be opened, got %q", opened)
+	}
+
+	if results[0].Grabs != 1234 {
+		t.Fatalf("Expected grabs from the details page, got %d", results[0].Grabs)
+	}
+
+	expectedDate := time.Date(2016, time.August, 25, 13, 14, 15, 0, time.UTC)
+	if !results[0].PublishDate.Equal(expectedDate) {
+		t.Fatalf("Expected publish date %s from the details page, got %s", expectedDate, results[0].PublishDate)
+	}
+
+	if results[2].Grabs != 0 {
+		t.Fatalf("Expected no grabs past the details limit, got %d", results[2].Grabs)
+	}
+}
+
+func TestIndexerDefinitionRunner_SearchTokens(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	def, err := ParseDefinition([]byte(exampleDefinitionWithMultiRow))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	def.Search.Tokens = tokensBlock{
+		Path: "/browse.php",
+		Form: "form#search",
+		Inputs: fieldsListBlock{
+			{Field: "csrf", Block: selectorBlock{Selector: `meta[name="csrf-token"]`, Attribute: "content"}},
+		},
+	}
+
+	conf := &config.ArrayConfig{
+		"example": map[string]string{"url": "https://example.org/"},
+	}
+
+	registerResponder("GET", "https://example.org/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, ""), nil
+	})
+
+	registerResponder("GET", "https://example.org/profile.php", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, ""), nil
+	})
+
+	registerResponder("GET", "https://example.org/browse.php", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, `<html>
+			<head><meta name="csrf-token" content="abc123"></head>
+			<body><form id="search">
+				<input type="hidden" name="session" value="s3ss10n">
+				<input type="text" name="q" value="">
+			</form></body>
+		</html>`), nil
+	})
+
+	var query url.Values
+	registerResponder("GET", "https://example.org/torrents.php", func(req *http.Request) (*http.Response, error) {
+		query = req.URL.Query()
+		return httpmock.NewStringResponse(http.StatusOK, exampleSearchPageWithDateHeadersAndMultiRow), nil
+	})
+
+	r := NewRunner(def, RunnerOpts{Config: conf})
+	if _, err = r.Search(torznab.Query{Q: "llamas"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for key, expected := range map[string]string{"csrf": "abc123", "session": "s3ss10n", "search": "llamas"} {
+		if got := query.Get(key); got != expected {
+			t.Errorf("Expected search input %s to be %q, got %q", key, expected, got)
+		}
+	}
+
+	if _, ok := query["q"]; ok {
+		t.Errorf("Expected only hidden inputs to be sent from the form, got %v", query)
+	}
+}
+
+func TestIndexerDefinitionRunner_LoginSteps(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	def, err := ParseDefinition([]byte(exampleDefinition2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	def.Login.Steps = []loginStepBlock{
+		{
+			Path:   "https://auth.example.net/sso?app=example",
+			Inputs: inputsBlock{"user": "{{ .Config.username }}", "pass": "{{ .Config.password }}"},
+		},
+		{FormSelector: "form#callback"},
+	}
+
+	conf := &config.ArrayConfig{
+		"example": map[string]string{
+			"username": "myusername",
+			"password": "mypassword",
+			"url":      "https://example.org/",
+		},
+	}
+
+	registerResponder("GET", "https://example.org/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, ""), nil
+	})
+
+	registerResponder("GET", "https://example.org/profile.php", func(req *http.Request) (*http.Response, error) {
+		if c, err := req.Cookie("session"); err != nil || c.Value != "s3ss10n" {
+			return httpmock.NewStringResponse(http.StatusForbidden, ""), nil
+		}
+		return httpmock.NewStringResponse(http.StatusOK, exampleSearchPage), nil
+	})
+
+	registerResponder("GET", "https://auth.example.net/sso", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, `<html><body>
+			<form method="post" action="/sso"><input name="user"><input name="pass" type="password"></form>
+		</body></html>`), nil
+	})
+
+	registerResponder("POST", "https://auth.example.net/sso", func(req *http.Request) (*http.Response, error) {
+		if req.FormValue("user") != "myusername" || req.FormValue("pass") != "mypassword" {
+			t.Fatalf("Incorrect credentials %v were provided", req.Form)
+		}
+		return httpmock.NewStringResponse(http.StatusOK, `<html><body>
+			<form id="callback" method="post" action="https://example.org/sso/callback">
+				<input type="hidden" name="assertion" value="signed">
+			</form>
+		</body></html>`), nil
+	})
+
+	registerResponder("POST", "https://example.org/sso/callback", func(req *http.Request) (*http.Response, error) {
+		if req.FormValue("assertion") != "signed" {
+			t.Fatalf("Expected the hidden assertion to be posted back, got %v", req.Form)
+		}
+		resp := httpmock.NewStringResponse(http.StatusOK, "")
+		resp.Header.Set("Set-Cookie", "session=s3ss10n; Path=/")
+		return resp, nil
+	})
+
+	r := NewRunner(def, RunnerOpts{Config: conf})
+	if err = r.Login(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIndexerDefinitionRunner_Verify(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	def, err := ParseDefinition([]byte(exampleDefinition2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := &config.ArrayConfig{
+		"example": map[string]string{
+			"username": "myusername",
+			"password": "mypassword",
+			"url":      "https://example.org/",
+		},
+	}
+
+	var loggedIn bool
+
+	registerResponder("GET", "https://example.org/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, ""), nil
+	})
+
+	registerResponder("GET", "https://example.org/profile.php", func(req *http.Request) (*http.Response, error) {
+		if !loggedIn {
+			resp := httpmock.NewStringResponse(http.StatusTemporaryRedirect, "")
+			resp.Header.Set("Location", "/login.php")
+			return resp, nil
+		}
+		return httpmock.NewStringResponse(http.StatusOK, exampleSearchPage), nil
+	})
+
+	registerResponder("GET", "https://example.org/login.php", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, exampleLoginPage), nil
+	})
+
+	registerResponder("POST", "https://example.org/login.php", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, exampleLoginErrorPage), nil
+	})
+
+	registerResponder("GET", "https://example.org/torrents.php", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, exampleSearchPage), nil
+	})
+
+	r := NewRunner(def, RunnerOpts{Config: conf})
+
+	v := r.Verify()
+	if v.OK || v.Stage != VerifyStageLogin || v.Reason != LoginErrorCredentials {
+		t.Fatalf("Expected verification to fail logging in with bad credentials, got %#v", v)
+	}
+
+	registerResponder("POST", "https://example.org/login.php", func(req *http.Request) (*http.Response, error) {
+		loggedIn = true
+		return httpmock.NewStringResponse(http.StatusOK, "Success"), nil
+	})
+
+	if v = r.Verify(); !v.OK || v.Results != 1 {
+		t.Fatalf("Expected verification to pass with 1 result, got %#v", v)
+	}
+}
+
+func TestIndexerDefinitionRunner_OnError(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	def, err := ParseDefinition([]byte(exampleDefinition2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := &config.ArrayConfig{
+		"example": map[string]string{
+			"username": "myusername",
+			"password": "mypassword",
+			"url":      "https://example.org/",
+		},
+	}
+
+	registerResponder("GET", "https://example.org/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, ""), nil
+	})
+
+	registerResponder("GET", "https://example.org/profile.php", func(req *http.Request) (*http.Response, error) {
+		resp := httpmock.NewStringResponse(http.StatusTemporaryRedirect, "")
+		resp.Header.Set("Location", "/login.php")
+		return resp, nil
+	})
+
+	registerResponder("GET", "https://example.org/login.php", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, exampleLoginPage), nil
+	})
+
+	registerResponder("POST", "https://example.org/login.php", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, exampleLoginErrorPage), nil
+	})
+
+	failures := []Failure{}
+	r := NewRunner(def, RunnerOpts{Config: conf, OnError: func(f Failure) {
+		failures = append(failures, f)
+	}})
+
+	if _, err = r.Search(torznab.Query{Q: "llamas", RequestID: "abc123"}); err == nil {
+		t.Fatal("Expected the search to fail")
+	}
+
+	if len(failures) != 1 {
+		t.Fatalf("Expected 1 failure to be reported, got %#v", failures)
+	}
+
+	if f := failures[0]; f.Site != "example" || f.Operation != "search" || f.RequestID != "abc123" || f.Err != err {
+		t.Fatalf("Unexpected failure %#v", f)
+	}
+
+	// a failed download has to release the browser, or the next one would block forever
+	for idx := 0; idx < 2; idx++ {
+		if _, _, err = r.Download("https://example.org/download.php?id=1"); err == nil {
+			t.Fatalf("Row #%d: expected the download to fail", idx+1)
+		}
+	}
+
+	if len(failures) != 3 || failures[2].Operation != "download" {
+		t.Fatalf("Expected the downloads to be reported as failures, got %#v", failures)
+	}
+}
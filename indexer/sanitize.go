@@ -0,0 +1,108 @@
+package indexer
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Sanitize options remove things from search keywords that a site's search engine chokes on
+const (
+	SanitizeApostrophes = "apostrophes"
+	SanitizeAmpersand   = "ampersand"
+	SanitizeYears       = "years"
+	SanitizePunctuation = "punctuation"
+	SanitizeMaxLength   = "maxlength"
+)
+
+var yearRegexp = regexp.MustCompile(`\b(19|20)\d{2}\b`)
+
+// sanitizer is a set of sanitize options, parsed from a list like "apostrophes, maxlength=50"
+type sanitizer struct {
+	apostrophes, ampersand, years, punctuation bool
+	maxLength                                  int
+}
+
+func parseSanitizer(opts []string) (sanitizer, error) {
+	s := sanitizer{}
+
+	for _, opt := range opts {
+		opt = strings.ToLower(strings.TrimSpace(opt))
+		name, arg := opt, ""
+		if idx := strings.IndexAny(opt, "=:"); idx != -1 {
+			name, arg = strings.TrimSpace(opt[:idx]), strings.TrimSpace(opt[idx+1:])
+		}
+
+		switch name {
+		case "", "none":
+		case SanitizeApostrophes:
+			s.apostrophes = true
+		case SanitizeAmpersand:
+			s.ampersand = true
+		case SanitizeYears:
+			s.years = true
+		case SanitizePunctuation:
+			s.punctuation = true
+		case SanitizeMaxLength:
+			n, err := strconv.Atoi(arg)
+			if err != nil || n <= 0 {
+				return s, fmt.Errorf("Sanitize option %q needs a length, e.g maxlength=50", opt)
+			}
+			s.maxLength = n
+		default:
+			return s, fmt.Errorf("Unknown sanitize option %q", opt)
+		}
+	}
+
+	return s, nil
+}
+
+func (s sanitizer) apply(keywords string) string {
+	if s.apostrophes {
+		keywords = strings.NewReplacer("'", "", "’", "", "`", "").Replace(keywords)
+	}
+	if s.ampersand {
+		keywords = strings.Replace(keywords, "&", " and ", -1)
+	}
+	if s.years {
+		keywords = yearRegexp.ReplaceAllString(keywords, "")
+	}
+	if s.punctuation {
+		keywords = strings.Map(func(r rune) rune {
+			if unicode.IsPunct(r) || unicode.IsSymbol(r) {
+				return ' '
+			}
+			return r
+		}, keywords)
+	}
+
+	keywords = strings.Join(strings.Fields(keywords), " ")
+
+	// cut at a word boundary where possible, as a partial word won't match anything
+	if runes := []rune(keywords); s.maxLength > 0 && len(runes) > s.maxLength {
+		cut := string(runes[:s.maxLength])
+		if runes[s.maxLength] != ' ' {
+			if idx := strings.LastIndex(cut, " "); idx > 0 {
+				cut = cut[:idx]
+			}
+		}
+		keywords = strings.TrimSpace(cut)
+	}
+
+	return keywords
+}
+
+// sanitizer returns the sanitize options from the indexer's config, or otherwise the definition
+func (r *Runner) sanitizer() (sanitizer, error) {
+	opts := []string(r.definition.Search.Sanitize)
+
+	if r.opts.Config != nil {
+		if val, ok, _ := r.opts.Config.Get(r.definition.Site, "sanitize"); ok {
+			opts = strings.Split(val, ",")
+		}
+	}
+
+	return parseSanitizer(opts)
+}
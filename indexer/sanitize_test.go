@@ -0,0 +1,56 @@
+package indexer
+
+import (
+	"testing"
+
+	"github.com/cardigann/cardigann/torznab"
+)
+
+func TestSanitizer(t *testing.T) {
+	for idx, test := range []struct {
+		opts     []string
+		input    string
+		expected string
+	}{
+		{nil, "Marvel's Agents of S.H.I.E.L.D. 2013", "Marvel's Agents of S.H.I.E.L.D. 2013"},
+		{[]string{"apostrophes"}, "Marvel's Agents", "Marvels Agents"},
+		{[]string{"ampersand"}, "Law & Order", "Law and Order"},
+		{[]string{"years"}, "Doctor Who 2005 S01E01", "Doctor Who S01E01"},
+		{[]string{"punctuation"}, "S.H.I.E.L.D: Origins", "S H I E L D Origins"},
+		{[]string{"maxlength=12"}, "The Walking Dead S01E01", "The Walking"},
+		{[]string{"maxlength=11"}, "The Walking Dead", "The Walking"},
+		{[]string{" apostrophes", "ampersand ", "years"}, "Bob's Burgers & Fries 2011", "Bobs Burgers and Fries"},
+	} {
+		s, err := parseSanitizer(test.opts)
+		if err != nil {
+			t.Fatalf("Row #%d: %v", idx+1, err)
+		}
+		if got := s.apply(test.input); got != test.expected {
+			t.Errorf("Row #%d: expected %q, got %q", idx+1, test.expected, got)
+		}
+	}
+
+	for idx, opts := range [][]string{{"llamas"}, {"maxlength"}, {"maxlength=-1"}} {
+		if _, err := parseSanitizer(opts); err == nil {
+			t.Errorf("Row #%d: expected an error for %v", idx+1, opts)
+		}
+	}
+}
+
+func TestSanitizedTemplateKeywords(t *testing.T) {
+	r := NewRunner(&IndexerDefinition{Site: "example"}, RunnerOpts{})
+
+	q := templateQuery{torznab.Query{Q: "Law & Order"}, "Law and Order"}
+	for idx, tpl := range []string{"{{ .Query.Keywords }}", "{{ .Keywords }}"} {
+		got, err := r.applyTemplate("test", tpl, struct {
+			Query    templateQuery
+			Keywords string
+		}{q, q.Keywords()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != "Law and Order" {
+			t.Errorf("Row #%d: expected sanitized keywords, got %q", idx+1, got)
+		}
+	}
+}
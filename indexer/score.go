@@ -0,0 +1,194 @@
+package indexer
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/cardigann/cardigann/config"
+	"github.com/cardigann/cardigann/logger"
+	"github.com/cardigann/cardigann/torznab"
+)
+
+// Scorer scores the results of an aggregate search, which are ordered by their scores with the
+// highest first. It can be set on an Aggregate to rank results differently when embedding
+// cardigann as a library
+type Scorer interface {
+	Score(query torznab.Query, item torznab.ResultItem) float64
+}
+
+// ScoreWeights are how much each part of a result's score counts for, parts without a weight
+// don't count at all
+type ScoreWeights struct {
+	// Seeders counts log10 of one more than the number of seeders, so 99 seeders score 2
+	Seeders float64
+
+	// Freeleech counts how much of a download doesn't count against the ratio, from 0 to 1
+	Freeleech float64
+
+	// Priority counts the priority of the indexer from its config
+	Priority float64
+
+	// Title counts the fraction of the words searched for that are in the title, from 0 to 1
+	Title float64
+}
+
+// ParseScoreWeights parses weights like "seeders=1,freeleech=2,priority=1,title=3"
+func ParseScoreWeights(s string) (ScoreWeights, error) {
+	var weights ScoreWeights
+
+	for _, val := range strings.Split(s, ",") {
+		if val = strings.TrimSpace(val); val == "" {
+			continue
+		}
+
+		tokens := strings.SplitN(val, "=", 2)
+		if len(tokens) != 2 {
+			return weights, fmt.Errorf("Invalid score weight %q, expected part=weight", val)
+		}
+
+		weight, err := strconv.ParseFloat(strings.TrimSpace(tokens[1]), 64)
+		if err != nil {
+			return weights, fmt.Errorf("Invalid weight in %q", val)
+		}
+
+		switch strings.ToLower(strings.TrimSpace(tokens[0])) {
+		case "seeders":
+			weights.Seeders = weight
+		case "freeleech":
+			weights.Freeleech = weight
+		case "priority":
+			weights.Priority = weight
+		case "title":
+			weights.Title = weight
+		default:
+			return weights, fmt.Errorf("Unknown score part in %q, expected seeders, freeleech, priority or title", val)
+		}
+	}
+
+	return weights, nil
+}
+
+// WeightedScorer scores results with a weighted sum of their seeders, how freeleech they are, the
+// priority of their indexer and how well their title matches the search
+type WeightedScorer struct {
+	Weights ScoreWeights
+
+	// Priorities are the priorities of indexers by key, those without one have a priority of 0
+	Priorities map[string]float64
+}
+
+func (s WeightedScorer) Score(query torznab.Query, item torznab.ResultItem) float64 {
+	return s.Weights.Seeders*math.Log10(1+math.Max(float64(item.Seeders), 0)) +
+		s.Weights.Freeleech*freeleechScore(item) +
+		s.Weights.Priority*s.Priorities[item.Site] +
+		s.Weights.Title*titleMatchScore(query.Keywords(), item.Title)
+}
+
+// freeleechScore is how much of a download doesn't count against the ratio. Results from
+// definitions that don't extract the volume factors have neither, and score 0
+func freeleechScore(item torznab.ResultItem) float64 {
+	if item.DownloadVolumeFactor == 0 && item.UploadVolumeFactor == 0 {
+		return 0
+	}
+	return math.Max(0, math.Min(1, 1-item.DownloadVolumeFactor))
+}
+
+// titleMatchScore is the fraction of the words in the keywords that are also in the title
+func titleMatchScore(keywords, title string) float64 {
+	words := scoreWords(keywords)
+	if len(words) == 0 {
+		return 0
+	}
+
+	inTitle := map[string]bool{}
+	for _, w := range scoreWords(title) {
+		inTitle[w] = true
+	}
+
+	matched := 0
+	for _, w := range words {
+		if inTitle[w] {
+			matched++
+		}
+	}
+
+	return float64(matched) / float64(len(words))
+}
+
+// scoreWords splits text into lower case words, ignoring punctuation like the dots in release names
+func scoreWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// ConfiguredScorer returns the scorer set up by the scoreweights global config, with the
+// priority config of each of the indexers, or nil if scoreweights isn't set
+func ConfiguredScorer(conf config.Config, keys []string) Scorer {
+	val, err := config.GetGlobalConfig("scoreweights", "", conf)
+	if err != nil || val == "" {
+		return nil
+	}
+
+	weights, err := ParseScoreWeights(val)
+	if err != nil {
+		logger.Logger.WithError(err).Warn("Ignoring invalid scoreweights")
+		return nil
+	}
+
+	scorer := WeightedScorer{Weights: weights, Priorities: map[string]float64{}}
+	for _, key := range keys {
+		val, ok, _ := conf.Get(key, "priority")
+		if !ok || val == "" {
+			continue
+		}
+		priority, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			logger.Logger.WithField("site", key).Warnf("Ignoring invalid priority %q", val)
+			continue
+		}
+		scorer.Priorities[key] = priority
+	}
+
+	return scorer
+}
+
+type scoredItem struct {
+	item  torznab.ResultItem
+	score float64
+}
+
+type scoredItems []scoredItem
+
+func (slice scoredItems) Len() int {
+	return len(slice)
+}
+
+func (slice scoredItems) Less(i, j int) bool {
+	return slice[i].score > slice[j].score
+}
+
+func (slice scoredItems) Swap(i, j int) {
+	slice[i], slice[j] = slice[j], slice[i]
+}
+
+// rankResults orders results by their scores, highest first, keeping the order of those that
+// score the same
+func rankResults(scorer Scorer, query torznab.Query, items []torznab.ResultItem) []torznab.ResultItem {
+	scored := make(scoredItems, len(items))
+	for i, item := range items {
+		scored[i] = scoredItem{item, scorer.Score(query, item)}
+	}
+
+	sort.Stable(scored)
+
+	ranked := make([]torznab.ResultItem, len(scored))
+	for i, s := range scored {
+		ranked[i] = s.item
+	}
+	return ranked
+}
@@ -0,0 +1,87 @@
+package indexer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cardigann/cardigann/config"
+	"github.com/cardigann/cardigann/torznab"
+)
+
+func TestParseScoreWeights(t *testing.T) {
+	weights, err := ParseScoreWeights("seeders=1, freeleech=2.5,title=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if weights != (ScoreWeights{Seeders: 1, Freeleech: 2.5, Title: 3}) {
+		t.Fatalf("Unexpected weights %#v", weights)
+	}
+
+	for _, val := range []string{"seeders", "seeders=lots", "leechers=1"} {
+		if _, err := ParseScoreWeights(val); err == nil {
+			t.Errorf("Expected %q to be invalid", val)
+		}
+	}
+}
+
+func TestWeightedScorer(t *testing.T) {
+	scorer := ConfiguredScorer(&config.ArrayConfig{
+		"global":  {"scoreweights": "seeders=1,freeleech=1,priority=1,title=2"},
+		"private": {"priority": "2"},
+	}, []string{"public", "private"})
+
+	items := []torznab.ResultItem{
+		{Title: "Llamas S01E01 720p", Site: "public", Seeders: 9},
+		{Title: "Alpacas S01E01", Site: "public", Seeders: 99},
+		{Title: "Llamas.S01E01.1080p", Site: "private", Seeders: 9, DownloadVolumeFactor: 1, UploadVolumeFactor: 1},
+		{Title: "Llamas S01E01 480p", Site: "public", Seeders: 9, DownloadVolumeFactor: 0, UploadVolumeFactor: 1},
+	}
+
+	titles := []string{}
+	for _, item := range rankResults(scorer, torznab.Query{Q: "llamas", Season: "1", Ep: "1"}, items) {
+		titles = append(titles, item.Title)
+	}
+
+	expected := "Llamas.S01E01.1080p,Llamas S01E01 480p,Llamas S01E01 720p,Alpacas S01E01"
+	if got := strings.Join(titles, ","); got != expected {
+		t.Fatalf("Expected %s, got %s", expected, got)
+	}
+
+	if ConfiguredScorer(&config.ArrayConfig{"global": {}}, nil) != nil {
+		t.Fatal("Expected no scorer without scoreweights")
+	}
+}
+
+// seedersScorer only counts seeders, like a scorer that an application embedding cardigann
+// might plug in
+type seedersScorer struct{}
+
+func (s seedersScorer) Score(query torznab.Query, item torznab.ResultItem) float64 {
+	return float64(item.Seeders)
+}
+
+func TestAggregateSearch_Scorer(t *testing.T) {
+	agg := Aggregate{
+		Indexers: []torznab.Indexer{
+			testIndexer{id: "a", items: []torznab.ResultItem{{Title: "a1", Seeders: 1}, {Title: "a2", Seeders: 5}}},
+			testIndexer{id: "b", items: []torznab.ResultItem{{Title: "b1", Seeders: 3}, {Title: "b2", Seeders: 5}}},
+		},
+		Scorer: seedersScorer{},
+	}
+
+	results, err := agg.Search(torznab.Query{Limit: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the results that score the same keep the order they were interleaved in
+	titles := []string{}
+	for _, item := range results {
+		titles = append(titles, item.Title)
+	}
+
+	if got := strings.Join(titles, ","); got != "a2,b2,b1" {
+		t.Fatalf("Expected the best 3 results ordered by seeders, got %s", got)
+	}
+}
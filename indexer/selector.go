@@ -3,10 +3,13 @@ package indexer
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/Sirupsen/logrus"
+	"github.com/andybalholm/cascadia"
 	"github.com/yosssi/gohtml"
 )
 
@@ -22,29 +25,41 @@ type selectorBlock struct {
 	Remove    string            `yaml:"remove,omitempty"`
 	Filters   []filterBlock     `yaml:"filters,omitempty"`
 	Case      map[string]string `yaml:"case,omitempty"`
+
+	// Normalize can be set to false to keep entities and whitespace in the extracted text
+	Normalize *bool `yaml:"normalize,omitempty"`
+
+	// Format is what a description is converted to from html, either text (the default) or markdown
+	Format string `yaml:"format,omitempty"`
+
+	// FilterHTML applies a description's filters to its html rather than to the converted text
+	FilterHTML bool `yaml:"filterhtml,omitempty"`
+
+	// html extracts the html of the selection rather than its text, which isn't normalized
+	html bool
 }
 
 func (s *selectorBlock) Match(selection *goquery.Selection) bool {
 	return !s.IsEmpty() && (selection.Find(s.Selector).Length() > 0 || s.TextVal != "")
 }
 
-func (s *selectorBlock) MatchText(from *goquery.Selection) (string, error) {
-	if s.TextVal != "" {
-		return s.TextVal, nil
+func (s *selectorBlock) MatchText(from *goquery.Selection, logger logrus.FieldLogger, loc *time.Location) (string, error) {
+	if s.TextVal != "" {
+		return s.TextVal, nil
 	}
 	if s.Selector != "" {
 		result := from.Find(s.Selector)
 		if result.Length() == 0 {
 			return "", fmt.Errorf("Failed to match selector %q", s.Selector)
 		}
-		return s.Text(result)
+		return s.Text(result, logger, loc)
 	}
-	return s.Text(from)
+	return s.Text(from, logger, loc)
 }
 
-func (s *selectorBlock) Text(el *goquery.Selection) (string, error) {
+func (s *selectorBlock) Text(el *goquery.Selection, logger logrus.FieldLogger, loc *time.Location) (string, error) {
 	if s.TextVal != "" {
-		return s.applyFilters(s.TextVal)
+		return s.applyFilters(s.TextVal, logger, loc)
 	}
 
 	if s.Remove != "" {
@@ -52,23 +67,26 @@ func (s *selectorBlock) Text(el *goquery.Selection) (string, error) {
 	}
 
 	if s.Case != nil {
-		filterLogger.
+		logger.
 			WithFields(logrus.Fields{"case": s.Case}).
 			Debugf("Applying case to selection")
-		for pattern, value := range s.Case {
+		for _, pattern := range s.casePatterns() {
 			if el.Is(pattern) || el.Has(pattern).Length() >= 1 {
-				return s.applyFilters(value)
+				return s.applyFilters(s.Case[pattern], logger, loc)
 			}
 		}
 		return "", errors.New("None of the cases match")
 	}
 
 	html, _ := goquery.OuterHtml(el)
-	filterLogger.
+	logger.
 		WithFields(logrus.Fields{"html": gohtml.Format(html)}).
 		Debugf("Extracting text from selection")
 
 	output := strings.TrimSpace(el.Text())
+	if s.html {
+		output, _ = el.Html()
+	}
 
 	if s.Attribute != "" {
 		val, exists := el.Attr(s.Attribute)
@@ -78,25 +96,75 @@ func (s *selectorBlock) Text(el *goquery.Selection) (string, error) {
 		output = val
 	}
 
-	return s.applyFilters(output)
+	return s.applyFilters(output, logger, loc)
+}
+
+// casePatterns returns the patterns of the cases in the order they are tried, with "*" last as
+// it matches anything
+func (s *selectorBlock) casePatterns() []string {
+	patterns := []string{}
+	for pattern := range s.Case {
+		if pattern != "*" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	sort.Strings(patterns)
+
+	if _, ok := s.Case["*"]; ok {
+		patterns = append(patterns, "*")
+	}
+	return patterns
 }
 
-func (s *selectorBlock) applyFilters(val string) (string, error) {
+func (s *selectorBlock) applyFilters(val string, logger logrus.FieldLogger, loc *time.Location) (string, error) {
 	for _, f := range s.Filters {
-		filterLogger.
+		logger.
 			WithFields(logrus.Fields{"args": f.Args, "before": val}).
 			Debugf("Applying filter %s", f.Name)
 
 		var err error
-		val, err = invokeFilter(f.Name, f.Args, val)
+		val, err = invokeFilter(f.Name, f.Args, val, loc)
 		if err != nil {
 			return "", err
 		}
 	}
 
+	if (s.Normalize == nil || *s.Normalize) && !s.html {
+		val = normalizeText(val)
+	}
+
 	return val, nil
 }
 
+// validate checks that the selectors of the block compile. goquery treats a selector that doesn't
+// as one that matches nothing, which hides typos in definitions
+func (s *selectorBlock) validate(where string) error {
+	if err := validateSelector(where, s.Selector); err != nil {
+		return err
+	}
+	if err := validateSelector(where+" remove", s.Remove); err != nil {
+		return err
+	}
+	for pattern := range s.Case {
+		if err := validateSelector(where+" case", pattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateSelector returns an error if a selector doesn't compile, where describes where in the
+// definition it's from
+func validateSelector(where, selector string) error {
+	if selector == "" {
+		return nil
+	}
+	if _, err := cascadia.Compile(selector); err != nil {
+		return fmt.Errorf("Invalid %s selector %q: %v", where, selector, err)
+	}
+	return nil
+}
+
 func (s *selectorBlock) IsEmpty() bool {
 	return s.Selector == "" && s.TextVal == ""
 }
@@ -1,6 +1,12 @@
 package indexer
 
-import "testing"
+import (
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/Sirupsen/logrus"
+)
 
 func TestSelectorIsEmpty(t *testing.T) {
 	for idx, test := range []struct {
@@ -17,3 +23,34 @@ func TestSelectorIsEmpty(t *testing.T) {
 		}
 	}
 }
+
+func TestSelectorCaseMatchesPage(t *testing.T) {
+	block := selectorBlock{Case: map[string]string{
+		`body:has(div.alertbar:contains("freeleech")) *`: "0",
+		"*": "1",
+	}}
+
+	for idx, test := range []struct {
+		html     string
+		expected string
+	}{
+		{`<div class="alertbar">Sitewide freeleech!</div><table><tr class="torrent"><td>llamas</td></tr></table>`, "0"},
+		{`<div class="alertbar">Welcome</div><table><tr class="torrent"><td>llamas</td></tr></table>`, "1"},
+	} {
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader("<html><body>" + test.html + "</body></html>"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the catch-all case is tried last, however the cases are ordered in the definition
+		for i := 0; i < 10; i++ {
+			result, err := block.Text(doc.Find("tr.torrent"), logrus.New(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result != test.expected {
+				t.Fatalf("Row #%d expected %q, got %q", idx+1, test.expected, result)
+			}
+		}
+	}
+}
@@ -0,0 +1,369 @@
+package indexer
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+const (
+	// sessionLockStale is how old a login or budget lock can get before the process holding it
+	// is assumed to have died, a login shouldn't take anywhere near this long
+	sessionLockStale = 2 * time.Minute
+
+	// sessionLockPoll is how often to check whether another process has finished logging in
+	sessionLockPoll = 100 * time.Millisecond
+)
+
+// savedSession is the cookies of a login, saved so that other processes sharing the data dir
+// can use the session rather than logging in again, which logs out the first session on sites
+// that only allow one at a time
+type savedSession struct {
+	URL     string        `json:"url"`
+	Cookies []savedCookie `json:"cookies"`
+	Saved   time.Time     `json:"saved"`
+}
+
+// savedCookie is a cookie with where it's sent. Sessions saved before the host and path were
+// kept are restored for the whole site
+type savedCookie struct {
+	Name     string    `json:"name"`
+	Value    string    `json:"value"`
+	Host     string    `json:"host,omitempty"`
+	Domain   string    `json:"domain,omitempty"`
+	Path     string    `json:"path,omitempty"`
+	Expires  time.Time `json:"expires,omitempty"`
+	Secure   bool      `json:"secure,omitempty"`
+	HttpOnly bool      `json:"httpOnly,omitempty"`
+}
+
+// sessionJar is a cookie jar that remembers the domain, path and expiry of the cookies set in
+// it, which a cookie jar doesn't return, so that they can be saved and restored as they were
+type sessionJar struct {
+	http.CookieJar
+
+	mu      sync.Mutex
+	cookies map[string]savedCookie
+}
+
+func newSessionJar(jar http.CookieJar) *sessionJar {
+	return &sessionJar{CookieJar: jar, cookies: map[string]savedCookie{}}
+}
+
+func (j *sessionJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.CookieJar.SetCookies(u, cookies)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	for _, c := range cookies {
+		saved := savedCookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Host:     u.Host,
+			Domain:   strings.TrimPrefix(c.Domain, "."),
+			Path:     c.Path,
+			Secure:   c.Secure,
+			HttpOnly: c.HttpOnly,
+		}
+
+		// cookies without a path are sent to the directory of the page that set them
+		if saved.Path == "" || saved.Path[0] != '/' {
+			saved.Path = defaultCookiePath(u.Path)
+		}
+
+		switch {
+		case c.MaxAge > 0:
+			saved.Expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+		case c.MaxAge == 0 && !c.Expires.IsZero():
+			saved.Expires = c.Expires
+		}
+
+		key := saved.Domain + ";" + saved.Host + ";" + saved.Path + ";" + saved.Name
+		if c.MaxAge < 0 || (!saved.Expires.IsZero() && saved.Expires.Before(now)) {
+			delete(j.cookies, key)
+			continue
+		}
+
+		j.cookies[key] = saved
+	}
+}
+
+// saved returns the cookies that are still current
+func (j *sessionJar) saved(now time.Time) []savedCookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	cookies := []savedCookie{}
+	for _, c := range j.cookies {
+		if c.Expires.IsZero() || c.Expires.After(now) {
+			cookies = append(cookies, c)
+		}
+	}
+
+	sort.Sort(savedCookiesByName(cookies))
+	return cookies
+}
+
+type savedCookiesByName []savedCookie
+
+func (slice savedCookiesByName) Len() int {
+	return len(slice)
+}
+
+func (slice savedCookiesByName) Less(i, j int) bool {
+	return slice[i].Name < slice[j].Name
+}
+
+func (slice savedCookiesByName) Swap(i, j int) {
+	slice[i], slice[j] = slice[j], slice[i]
+}
+
+// defaultCookiePath is the path of a cookie set without one, as in RFC 6265 section 5.1.4
+func defaultCookiePath(p string) string {
+	if p == "" || p[0] != '/' {
+		return "/"
+	}
+
+	i := strings.LastIndex(p, "/")
+	if i == 0 {
+		return "/"
+	}
+	return p[:i]
+}
+
+// sessionFiles locks logins to a site and shares their sessions between processes, through
+// files named after the site in a dir
+type sessionFiles struct {
+	dir  string
+	site string
+
+	// saved is when the session that the runner is using was saved, under the browser lock
+	saved time.Time
+}
+
+func (s *sessionFiles) path(ext string) string {
+	return filepath.Join(s.dir, s.site+ext)
+}
+
+// lock waits for any other process logging in to the site to finish, and returns a func that
+// lets the next one in
+func (s *sessionFiles) lock(logger logrus.FieldLogger) (func(), error) {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return nil, err
+	}
+	return lockFile(s.path(".lock"), "Waiting for another process to finish logging in", logger)
+}
+
+// lockFile waits for any other process holding the lock file at path to release it, logging
+// waiting when it first has to, and returns a func that releases it. A lock that's been held for
+// longer than sessionLockStale is taken over
+func lockFile(path, waiting string, logger logrus.FieldLogger) (func(), error) {
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	// the lock holds the pid and a nonce, so that only the process that wrote it removes it
+	owner := fmt.Sprintf("%d %x\n", os.Getpid(), nonce)
+
+	for {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			_, err = f.WriteString(owner)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				os.Remove(path)
+				return nil, err
+			}
+			return func() { removeLock(path, owner) }, nil
+		} else if !os.IsExist(err) {
+			return nil, err
+		}
+
+		if fi, err := os.Stat(path); err == nil && time.Since(fi.ModTime()) > sessionLockStale {
+			if stale, err := ioutil.ReadFile(path); err == nil && removeLock(path, string(stale)) {
+				logger.WithField("lock", path).Warn("Took over a stale lock")
+			}
+			continue
+		}
+
+		if waiting != "" {
+			logger.Debug(waiting)
+			waiting = ""
+		}
+		time.Sleep(sessionLockPoll)
+	}
+}
+
+// removeLock removes the lock file at path if it still holds owner. The lock is first renamed
+// out of the way, which only one process can do, and then checked, so a lock that another
+// process took in the meantime is put back rather than removed
+func removeLock(path, owner string) bool {
+	b, err := ioutil.ReadFile(path)
+	if err != nil || string(b) != owner {
+		return false
+	}
+
+	moved := fmt.Sprintf("%s.%d.%d", path, os.Getpid(), time.Now().UnixNano())
+	if err := os.Rename(path, moved); err != nil {
+		return false
+	}
+	defer os.Remove(moved)
+
+	if b, err := ioutil.ReadFile(moved); err == nil && string(b) == owner {
+		return true
+	}
+
+	// someone else's lock, put it back unless yet another process has taken the lock since
+	os.Link(moved, path)
+	return false
+}
+
+// load returns the saved session for the site, or nil if there isn't one
+func (s *sessionFiles) load() (*savedSession, error) {
+	b, err := ioutil.ReadFile(s.path(".json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var session savedSession
+	if err := json.Unmarshal(b, &session); err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// save replaces the saved session for the site. It's written to a temporary file first, so
+// that other processes never read half of it
+func (s *sessionFiles) save(u *url.URL, cookies []savedCookie, now time.Time) error {
+	session := savedSession{URL: u.String(), Cookies: cookies, Saved: now}
+
+	b, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+
+	tmp := s.path(".json.tmp")
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, s.path(".json")); err != nil {
+		return err
+	}
+
+	s.saved = now
+	return nil
+}
+
+// restoreSession puts the cookies of a session saved by another process into the runner's cookie
+// jar, returning whether there was one that's newer than the session the runner is using. It must
+// only be called whilst holding the browser lock
+func (r *Runner) restoreSession() bool {
+	if r.session == nil {
+		return false
+	}
+
+	session, err := r.session.load()
+	if err != nil {
+		r.logger.WithError(err).Warn("Failed to load the saved session")
+		return false
+	} else if session == nil || session.Saved.Equal(r.session.saved) {
+		return false
+	}
+
+	u, err := url.Parse(session.URL)
+	if err != nil {
+		r.logger.WithError(err).Warn("Failed to parse the url of the saved session")
+		return false
+	}
+
+	now := time.Now()
+	restored := 0
+
+	for _, c := range session.Cookies {
+		if !c.Expires.IsZero() && c.Expires.Before(now) {
+			continue
+		}
+
+		// cookies are set as if by the host and path they were set for, or the site's root
+		cu := &url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/"}
+		if c.Host != "" {
+			cu.Host = c.Host
+		}
+		if c.Path != "" {
+			cu.Path = c.Path
+		}
+
+		r.cookies.SetCookies(cu, []*http.Cookie{{
+			Name:     c.Name,
+			Value:    c.Value,
+			Domain:   c.Domain,
+			Path:     cu.Path,
+			Expires:  c.Expires,
+			Secure:   c.Secure,
+			HttpOnly: c.HttpOnly,
+		}})
+		restored++
+	}
+
+	r.session.saved = session.Saved
+
+	r.logger.
+		WithFields(logrus.Fields{"saved": session.Saved, "cookies": restored}).
+		Debug("Restored a saved session")
+	return true
+}
+
+// saveSession saves the cookies of the site for other processes to use. It must only be called
+// whilst holding the browser lock
+func (r *Runner) saveSession() {
+	if r.session == nil {
+		return
+	}
+
+	u, err := r.currentURL()
+	if err != nil {
+		r.logger.WithError(err).Warn("Failed to save the session")
+		return
+	}
+
+	now := time.Now()
+
+	var cookies []savedCookie
+	if j, ok := r.cookies.(*sessionJar); ok {
+		cookies = j.saved(now)
+	} else {
+		// without the cookies' paths, they're saved for the whole site
+		cookies = []savedCookie{}
+		for _, c := range r.cookies.Cookies(u) {
+			cookies = append(cookies, savedCookie{Name: c.Name, Value: c.Value, Host: u.Host, Path: "/"})
+		}
+	}
+
+	if err := r.session.save(u, cookies, now); err != nil {
+		r.logger.WithError(err).Warn("Failed to save the session")
+	}
+}
@@ -0,0 +1,246 @@
+package indexer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cardigann/cardigann/config"
+	"github.com/cardigann/cardigann/logger"
+	"github.com/headzoo/surf/jar"
+	"github.com/jarcoal/httpmock"
+)
+
+func TestRunner_SharedSession(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	dir, err := ioutil.TempDir("", "sessions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	def, err := ParseDefinition([]byte(exampleDefinition2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := &config.ArrayConfig{
+		"example": map[string]string{
+			"username": "myusername",
+			"password": "mypassword",
+			"url":      "https://example.org/",
+		},
+	}
+
+	// the site only allows one session at a time, so each login ends the one before it
+	var logins int
+	session := func() string {
+		return fmt.Sprintf("session%d", logins)
+	}
+
+	registerResponder("GET", "https://example.org/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, exampleSearchPage), nil
+	})
+
+	registerResponder("GET", "https://example.org/profile.php", func(req *http.Request) (*http.Response, error) {
+		if c, err := req.Cookie("session"); err != nil || c.Value != session() {
+			resp := httpmock.NewStringResponse(http.StatusTemporaryRedirect, "")
+			resp.Header.Set("Location", "/login.php")
+			return resp, nil
+		}
+		return httpmock.NewStringResponse(http.StatusOK, exampleSearchPage), nil
+	})
+
+	registerResponder("GET", "https://example.org/login.php", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, exampleLoginPage), nil
+	})
+
+	registerResponder("POST", "https://example.org/login.php", func(req *http.Request) (*http.Response, error) {
+		logins++
+		resp := httpmock.NewStringResponse(http.StatusOK, exampleSearchPage)
+		resp.Header.Set("Set-Cookie", "session="+session()+"; Path=/")
+		return resp, nil
+	})
+
+	first := NewRunner(def, RunnerOpts{Config: conf, SessionDir: dir})
+	if err := first.Login(); err != nil {
+		t.Fatal(err)
+	} else if logins != 1 {
+		t.Fatalf("Expected 1 login, got %d", logins)
+	}
+
+	if fi, err := os.Stat(filepath.Join(dir, "example.json")); err != nil {
+		t.Fatal(err)
+	} else if fi.Mode().Perm() != 0600 {
+		t.Errorf("Expected the saved session to only be readable by its owner, got %v", fi.Mode())
+	}
+
+	// a second process starts with the session that the first saved
+	second := NewRunner(def, RunnerOpts{Config: conf, SessionDir: dir})
+	if err := second.Login(); err != nil {
+		t.Fatal(err)
+	} else if logins != 1 {
+		t.Fatalf("Expected the saved session to be used, got %d logins", logins)
+	}
+
+	// logging in directly always logs in, which ends the session of the first runner. It
+	// should pick up the new session rather than logging in again itself
+	if err := second.login(); err != nil {
+		t.Fatal(err)
+	} else if logins != 2 {
+		t.Fatalf("Expected 2 logins, got %d", logins)
+	}
+
+	first.createBrowser()
+	required, err := first.isLoginRequired()
+	if err != nil {
+		first.releaseBrowser()
+		t.Fatal(err)
+	} else if !required {
+		first.releaseBrowser()
+		t.Fatal("Expected the first session to have ended")
+	}
+	err = first.login()
+	first.releaseBrowser()
+	if err != nil {
+		t.Fatal(err)
+	} else if logins != 2 {
+		t.Fatalf("Expected the new saved session to be used, got %d logins", logins)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "example.lock")); !os.IsNotExist(err) {
+		t.Errorf("Expected the login lock to be released, got %v", err)
+	}
+}
+
+func TestSessionFiles_StaleLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sessions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := &sessionFiles{dir: dir, site: "example"}
+	lock := filepath.Join(dir, "example.lock")
+
+	if err := ioutil.WriteFile(lock, []byte("1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	old := time.Now().Add(-sessionLockStale - time.Minute)
+	if err := os.Chtimes(lock, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	unlock, err := s.lock(logger.Logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(lock)
+	if err != nil {
+		t.Fatal(err)
+	} else if string(b) == "1\n" {
+		t.Fatal("Expected the stale lock to be taken over")
+	}
+
+	unlock()
+	if _, err := os.Stat(lock); !os.IsNotExist(err) {
+		t.Errorf("Expected the lock to be removed, got %v", err)
+	}
+}
+
+func TestSessionFiles_UnlockKeepsOtherLocks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sessions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := &sessionFiles{dir: dir, site: "example"}
+	lock := filepath.Join(dir, "example.lock")
+
+	unlock, err := s.lock(logger.Logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// another process took the lock over, thinking this one had died
+	if err := ioutil.WriteFile(lock, []byte("2 feedface\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	unlock()
+
+	if b, err := ioutil.ReadFile(lock); err != nil {
+		t.Fatal(err)
+	} else if string(b) != "2 feedface\n" {
+		t.Fatalf("Expected the other process's lock to be kept, got %q", b)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(files) != 1 {
+		t.Fatalf("Expected only the lock to be left, got %d files", len(files))
+	}
+}
+
+func TestRunner_RestoreSessionPaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sessions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	def := &IndexerDefinition{Site: "example"}
+	now := time.Now()
+
+	// the login page sets a session cookie for the whole site, and a preference without a path
+	loginURL, _ := url.Parse("https://example.org/account/login.php")
+	saving := newSessionJar(jar.NewMemoryCookies())
+	saving.SetCookies(loginURL, []*http.Cookie{
+		{Name: "session", Value: "s3ss10n", Path: "/"},
+		{Name: "pref", Value: "dark"},
+		{Name: "old", Value: "gone", Expires: now.Add(-time.Hour)},
+	})
+
+	landingURL, _ := url.Parse("https://example.org/account/index.php")
+	first := NewRunner(def, RunnerOpts{SessionDir: dir})
+	if err := first.session.save(landingURL, saving.saved(now), now); err != nil {
+		t.Fatal(err)
+	}
+
+	second := NewRunner(def, RunnerOpts{SessionDir: dir})
+	second.cookies = newSessionJar(jar.NewMemoryCookies())
+	if !second.restoreSession() {
+		t.Fatal("Expected the saved session to be restored")
+	}
+
+	names := func(u string) string {
+		parsed, _ := url.Parse(u)
+		s := []string{}
+		for _, c := range second.cookies.Cookies(parsed) {
+			s = append(s, c.Name)
+		}
+		sort.Strings(s)
+		return strings.Join(s, ",")
+	}
+
+	if got := names("https://example.org/profile.php"); got != "session" {
+		t.Errorf("Expected only the session cookie outside of /account, got %q", got)
+	}
+
+	if got := names("https://example.org/account/settings.php"); got != "pref,session" {
+		t.Errorf("Expected both cookies in /account, got %q", got)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"net/url"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/cardigann/cardigann/logger"
@@ -25,6 +26,17 @@ type Tester struct {
 	Runner *Runner
 	Opts   TesterOpts
 	Output io.Writer
+
+	// Results are the outcomes of the tests that have run, for reporting them as json
+	Results []TestResult
+}
+
+// TestResult is the outcome of one of the tests run against an indexer
+type TestResult struct {
+	Name     string        `json:"name"`
+	OK       bool          `json:"ok"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
 }
 
 func (t *Tester) printf(format string, args ...interface{}) {
@@ -41,6 +53,17 @@ func (t *Tester) printfWithResult(format string, args []interface{}, f func() er
 	t.printf(format+" ", args...)
 
 	err := f()
+
+	result := TestResult{
+		Name:     strings.TrimSpace(fmt.Sprintf(format, args...)),
+		OK:       err == nil,
+		Duration: time.Now().Sub(timer),
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	t.Results = append(t.Results, result)
+
 	if err == nil {
 		t.printf("%s %s\n",
 			ansi.Color("SUCCESS ✓", "green"),
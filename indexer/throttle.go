@@ -0,0 +1,168 @@
+package indexer
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+const (
+	// throttleDefaultBackoff is how long to leave a site alone when it says it's limiting requests
+	// without saying for how long
+	throttleDefaultBackoff = time.Minute
+
+	// throttleMaxBackoff caps how long a site can ask to be left alone for, so that a bogus
+	// Retry-After doesn't pause an indexer for days
+	throttleMaxBackoff = 6 * time.Hour
+)
+
+// ThrottledError is returned when an indexer has asked for requests to slow down, with a 429 or
+// 503 response or a flood control message, and requests to it are being held off until then
+type ThrottledError struct {
+	Site    string
+	Message string
+	Until   time.Time
+}
+
+func (e *ThrottledError) Error() string {
+	msg := fmt.Sprintf("%s is limiting requests", e.Site)
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return fmt.Sprintf("%s, retrying after %s", msg, e.Until.Format(time.Kitchen))
+}
+
+// IsThrottled returns whether an error is because an indexer asked for requests to slow down
+func IsThrottled(err error) bool {
+	_, ok := err.(*ThrottledError)
+	return ok
+}
+
+// parseRetryAfter parses a Retry-After header, which is either a number of seconds or a date
+func parseRetryAfter(val string, now time.Time) (time.Duration, bool) {
+	val = strings.TrimSpace(val)
+	if val == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(val); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(val); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+var floodWaitRegexp = regexp.MustCompile(`(?i)(\d+)\s*(seconds?|secs?|minutes?|mins?|hours?|hrs?|s|m|h)\b`)
+
+// parseFloodWait finds how long a flood control message asks to wait, like "please wait 30 seconds"
+func parseFloodWait(msg string) (time.Duration, bool) {
+	m := floodWaitRegexp.FindStringSubmatch(msg)
+	if m == nil {
+		return 0, false
+	}
+	n, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0, false
+	}
+	switch strings.ToLower(m[2])[0] {
+	case 'h':
+		return time.Duration(n) * time.Hour, true
+	case 'm':
+		return time.Duration(n) * time.Minute, true
+	default:
+		return time.Duration(n) * time.Second, true
+	}
+}
+
+// throttleResponse pauses the rate limiter when a response asks for requests to slow down,
+// either with a 429, or with a 503 that says when to retry
+func throttleResponse(l *rateLimiter, resp *http.Response, now time.Time, logger logrus.FieldLogger) {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return
+	}
+
+	d, ok := parseRetryAfter(resp.Header.Get("Retry-After"), now)
+	if !ok {
+		if resp.StatusCode != http.StatusTooManyRequests {
+			return
+		}
+		d = throttleDefaultBackoff
+	}
+
+	until := l.pause(d, fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode)), now)
+	logger.
+		WithFields(logrus.Fields{"code": resp.StatusCode, "until": until}).
+		Warn("Site is limiting requests, backing off")
+}
+
+// checkFloodControl pauses the rate limiter and returns a ThrottledError if the current page
+// matches the floodcontrol block of the definition. It must only be called whilst holding the
+// browser lock
+func (r *Runner) checkFloodControl() error {
+	for _, e := range r.definition.FloodControl {
+		if !e.matchPage(r.browser) {
+			continue
+		}
+		msg, err := e.errorText(r.browser.Dom(), r.logger)
+		if err != nil {
+			msg = ""
+		}
+		msg = strings.TrimSpace(msg)
+
+		d, ok := parseFloodWait(msg)
+		if !ok {
+			d = throttleDefaultBackoff
+		}
+		until := r.limiter.pause(d, msg, time.Now())
+		r.logger.
+			WithFields(logrus.Fields{"message": msg, "until": until}).
+			Warn("Site is limiting requests, backing off")
+		break
+	}
+
+	return r.checkThrottle()
+}
+
+// requestError returns why a request was refused without being made, when the site asked for
+// requests to slow down or its request budget ran out, in place of the error wrapping it
+func requestError(err error) error {
+	if ue, ok := err.(*url.Error); ok {
+		switch ue.Err.(type) {
+		case *ThrottledError, *BudgetExhaustedError:
+			return ue.Err
+		}
+	}
+	return err
+}
+
+// checkThrottle returns a ThrottledError if the site has asked for requests to slow down and
+// the time it asked for hasn't passed yet
+func (r *Runner) checkThrottle() error {
+	if err := r.Throttled(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Throttled returns the reason requests to the site are being held off for asking them to slow
+// down, or nil if they aren't
+func (r *Runner) Throttled() *ThrottledError {
+	if r.limiter == nil {
+		return nil
+	}
+	until, msg, ok := r.limiter.paused(time.Now())
+	if !ok {
+		return nil
+	}
+	return &ThrottledError{Site: r.definition.Site, Message: msg, Until: until}
+}
@@ -0,0 +1,160 @@
+package indexer
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cardigann/cardigann/config"
+	"github.com/cardigann/cardigann/torznab"
+	"github.com/jarcoal/httpmock"
+)
+
+const exampleFloodControlDefinition = `
+---
+  site: example
+  links:
+    - https://example.org/
+
+  caps:
+    categories:
+      1: Movies
+    modes:
+      search: q
+
+  floodcontrol:
+    - match: "(?i)please wait \\d+ minutes"
+
+  search:
+    path: /torrents.php
+    rows:
+      selector: table tr
+    fields:
+      title:
+        selector: td
+`
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2017, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for val, expected := range map[string]time.Duration{
+		"120":                           2 * time.Minute,
+		"Sun, 01 Jan 2017 12:05:00 GMT": 5 * time.Minute,
+		"Sun, 01 Jan 2017 11:00:00 GMT": 0,
+	} {
+		d, ok := parseRetryAfter(val, now)
+		if !ok || d != expected {
+			t.Errorf("Expected %q to be %s, got %s", val, expected, d)
+		}
+	}
+
+	for _, val := range []string{"", "soon", "-5"} {
+		if _, ok := parseRetryAfter(val, now); ok {
+			t.Errorf("Expected %q not to parse", val)
+		}
+	}
+}
+
+func TestParseFloodWait(t *testing.T) {
+	for msg, expected := range map[string]time.Duration{
+		"Flood control: please wait 30 seconds":     30 * time.Second,
+		"Too many searches, try again in 5 minutes": 5 * time.Minute,
+		"Banned from searching for 2h":              2 * time.Hour,
+	} {
+		d, ok := parseFloodWait(msg)
+		if !ok || d != expected {
+			t.Errorf("Expected %q to be %s, got %s", msg, expected, d)
+		}
+	}
+
+	if _, ok := parseFloodWait("Slow down"); ok {
+		t.Error("Expected a message without a time not to parse")
+	}
+}
+
+func TestRunnerRetryAfter(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	def, err := ParseDefinition([]byte(exampleMaintenanceDefinition))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := &config.ArrayConfig{
+		"example": map[string]string{"url": "https://example.org/"},
+	}
+
+	registerResponder("GET", "https://example.org/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, ""), nil
+	})
+
+	var requests int
+	registerResponder("GET", "https://example.org/torrents.php", func(req *http.Request) (*http.Response, error) {
+		requests++
+		resp := httpmock.NewStringResponse(http.StatusTooManyRequests, "Too many requests")
+		resp.Header.Set("Retry-After", "120")
+		return resp, nil
+	})
+
+	r := NewRunner(def, RunnerOpts{Config: conf})
+
+	for idx := 0; idx < 2; idx++ {
+		_, err = r.Search(torznab.Query{Q: "llamas"})
+		if !IsThrottled(err) {
+			t.Fatalf("Row #%d: expected a throttled error, got %#v", idx+1, err)
+		}
+	}
+
+	if requests != 1 {
+		t.Fatalf("Expected 1 request whilst backing off, got %d", requests)
+	}
+
+	te := r.Throttled()
+	if te == nil {
+		t.Fatal("Expected the runner to be throttled")
+	}
+
+	if d := te.Until.Sub(time.Now()); d < time.Minute || d > 2*time.Minute {
+		t.Fatalf("Expected to be held off for about 2 minutes, got %s", d)
+	}
+}
+
+func TestRunnerFloodControl(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	def, err := ParseDefinition([]byte(exampleFloodControlDefinition))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := &config.ArrayConfig{
+		"example": map[string]string{"url": "https://example.org/"},
+	}
+
+	registerResponder("GET", "https://example.org/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, ""), nil
+	})
+
+	registerResponder("GET", "https://example.org/torrents.php", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK,
+			"<html><body><p>Flood control, please wait 10 minutes</p></body></html>"), nil
+	})
+
+	r := NewRunner(def, RunnerOpts{Config: conf})
+
+	_, err = r.Search(torznab.Query{Q: "llamas"})
+	te, ok := err.(*ThrottledError)
+	if !ok {
+		t.Fatalf("Expected a throttled error, got %#v", err)
+	}
+
+	if te.Message != "please wait 10 minutes" {
+		t.Fatalf("Unexpected message %q", te.Message)
+	}
+
+	if d := te.Until.Sub(time.Now()); d < 9*time.Minute || d > 10*time.Minute {
+		t.Fatalf("Expected to be held off for about 10 minutes, got %s", d)
+	}
+}
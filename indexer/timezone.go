@@ -0,0 +1,91 @@
+package indexer
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var fixedOffsetRegexp = regexp.MustCompile(`^(?i:UTC|GMT)?([+-])(\d{1,2})(?::?(\d{2}))?$`)
+
+// ParseTimezone parses either a zone name like Europe/Paris, which observes daylight saving
+// time, or a fixed offset like +02:00 or UTC-5, which doesn't
+func ParseTimezone(s string) (*time.Location, error) {
+	s = strings.TrimSpace(s)
+	switch strings.ToUpper(s) {
+	case "", "UTC", "GMT", "Z":
+		return time.UTC, nil
+	}
+
+	if m := fixedOffsetRegexp.FindStringSubmatch(s); m != nil {
+		hours, _ := strconv.Atoi(m[2])
+		mins, _ := strconv.Atoi("0" + m[3])
+		if hours > 14 || mins > 59 {
+			return nil, fmt.Errorf("Invalid timezone offset %q", s)
+		}
+		offset := hours*3600 + mins*60
+		if m[1] == "-" {
+			offset = -offset
+		}
+		return time.FixedZone(s, offset), nil
+	}
+
+	return time.LoadLocation(s)
+}
+
+// location returns the timezone that the site reports dates in, which is the timezone in the
+// indexer's config, then the one in the definition, otherwise UTC
+func (r *Runner) location() *time.Location {
+	name := r.definition.Timezone
+	if r.opts.Config != nil {
+		if val, ok, _ := r.opts.Config.Get(r.definition.Site, "timezone"); ok && val != "" {
+			name = val
+		}
+	}
+
+	if r.loc != nil && r.locName == name {
+		return r.loc
+	}
+
+	loc, err := ParseTimezone(name)
+	if err != nil {
+		r.logger.WithError(err).Warnf("Ignoring invalid timezone %q", name)
+		loc = time.UTC
+	}
+
+	r.loc, r.locName = loc, name
+	return loc
+}
+
+// clockSkew returns how far ahead the site's clock is, from the clockskew key of the indexer's
+// config, which is taken off dates extracted from it
+func (r *Runner) clockSkew() time.Duration {
+	if r.opts.Config == nil {
+		return 0
+	}
+
+	val, ok, _ := r.opts.Config.Get(r.definition.Site, "clockskew")
+	if !ok || val == "" {
+		return 0
+	}
+
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		r.logger.WithError(err).Warnf("Ignoring invalid clockskew %q", val)
+		return 0
+	}
+
+	return d
+}
+
+// parseDate parses a date extracted from the site, in the site's timezone and corrected for its
+// clock. Relative dates like "2 hours ago" don't depend on the site's clock, so aren't corrected
+func (r *Runner) parseDate(val string) (time.Time, error) {
+	t, err := parseFuzzyTime(val, time.Now(), r.location())
+	if err != nil || timeAgoRegexp.MatchString(val) {
+		return t, err
+	}
+	return t.Add(-r.clockSkew()), nil
+}
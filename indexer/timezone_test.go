@@ -0,0 +1,63 @@
+package indexer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimezone(t *testing.T) {
+	for idx, test := range []struct {
+		input  string
+		offset int
+		err    bool
+	}{
+		{"", 0, false},
+		{"UTC", 0, false},
+		{"+02:00", 2 * 3600, false},
+		{"-0530", -(5*3600 + 30*60), false},
+		{"UTC+3", 3 * 3600, false},
+		{"GMT-5", -5 * 3600, false},
+		{"+25:00", 0, true},
+		{"Not/AZone", 0, true},
+	} {
+		loc, err := ParseTimezone(test.input)
+		if test.err {
+			if err == nil {
+				t.Errorf("Row #%d: expected an error for %q", idx+1, test.input)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("Row #%d: unexpected error %v", idx+1, err)
+			continue
+		}
+		if _, offset := time.Date(2017, 1, 1, 0, 0, 0, 0, loc).Zone(); offset != test.offset {
+			t.Errorf("Row #%d: expected offset %d, got %d", idx+1, test.offset, offset)
+		}
+	}
+}
+
+func TestParseFuzzyTimeInLocation(t *testing.T) {
+	loc := time.FixedZone("+02:00", 2*3600)
+	now := time.Date(2017, 6, 10, 23, 30, 0, 0, time.UTC)
+
+	for idx, test := range []struct {
+		input    string
+		expected time.Time
+	}{
+		// no offset, so it's local to the site
+		{"2017-06-01 12:00:00", time.Date(2017, 6, 1, 10, 0, 0, 0, time.UTC)},
+		// an explicit offset wins
+		{"Thu, 01 Jun 2017 12:00:00 +0000", time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)},
+		// it's already tomorrow for the site
+		{"Today 00:15", time.Date(2017, 6, 10, 22, 15, 0, 0, time.UTC)},
+	} {
+		got, err := parseFuzzyTime(test.input, now, loc)
+		if err != nil {
+			t.Errorf("Row #%d: unexpected error %v", idx+1, err)
+			continue
+		}
+		if !got.Equal(test.expected) {
+			t.Errorf("Row #%d: expected %s, got %s", idx+1, test.expected, got.UTC())
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package indexer
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/Sirupsen/logrus"
+)
+
+// scrapeTokens opens the page that a search's form tokens are on and returns them as inputs.
+// The page defaults to searchURL, for sites that only accept searches from their own form
+func (r *Runner) scrapeTokens(block tokensBlock, searchURL string) (url.Values, error) {
+	if block.IsEmpty() {
+		return nil, nil
+	}
+
+	tokensURL := searchURL
+	if block.Path != "" {
+		var err error
+		if tokensURL, err = r.resolvePath(block.Path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := r.openPage(tokensURL); err != nil {
+		return nil, err
+	}
+
+	dom := r.browser.Dom()
+	vals := url.Values{}
+
+	if block.Form != "" {
+		form := dom.Find(block.Form).First()
+		if form.Length() == 0 {
+			return nil, fmt.Errorf("Failed to find search token form %q on %s", block.Form, tokensURL)
+		}
+
+		form.Find(`input[type="hidden"]`).Each(func(i int, s *goquery.Selection) {
+			if name := s.AttrOr("name", ""); name != "" {
+				vals.Set(name, s.AttrOr("value", ""))
+			}
+		})
+	}
+
+	for _, f := range block.Inputs {
+		val, err := f.Block.MatchText(dom, r.logger, r.location())
+		if err != nil {
+			return nil, fmt.Errorf("Failed to find search token %q on %s: %v", f.Field, tokensURL, err)
+		}
+		vals.Set(f.Field, val)
+	}
+
+	r.logger.
+		WithFields(logrus.Fields{"url": tokensURL, "tokens": len(vals)}).
+		Debugf("Scraped search tokens")
+
+	return vals, nil
+}
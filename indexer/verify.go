@@ -0,0 +1,78 @@
+package indexer
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cardigann/cardigann/torznab"
+)
+
+// The stages of verifying an indexer, which say where a failed verification went wrong
+const (
+	VerifyStageConfig  = "config"
+	VerifyStageLogin   = "login"
+	VerifyStageSearch  = "search"
+	VerifyStageResults = "results"
+)
+
+// verifyLimit is how many results the canned search asks for
+const verifyLimit = 5
+
+// Verification is the outcome of checking that an indexer's credentials work and that it
+// returns results, for showing whether it's healthy without waiting for a client to search it
+type Verification struct {
+	Site     string        `json:"site"`
+	OK       bool          `json:"ok"`
+	Stage    string        `json:"stage,omitempty"`
+	Reason   string        `json:"reason,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Results  int           `json:"results"`
+	Duration time.Duration `json:"duration"`
+	Checked  time.Time     `json:"checked"`
+}
+
+// Verify logs in to the site and searches for its latest torrents, recording the stage that
+// failed and why if it didn't work
+func (r *Runner) Verify() Verification {
+	v := Verification{Site: r.definition.Site, Checked: time.Now()}
+
+	fail := func(stage string, err error) Verification {
+		v.Stage = stage
+		v.Error = err.Error()
+		v.Reason = LoginErrorReason(err)
+		if IsMaintenance(err) {
+			v.Reason = LoginErrorMaintenance
+		}
+		v.Duration = time.Since(v.Checked)
+		return v
+	}
+
+	if !r.definition.Login.IsEmpty() {
+		if err := r.checkHasConfig(); err != nil {
+			return fail(VerifyStageConfig, err)
+		}
+
+		if err := r.Login(); err != nil {
+			return fail(VerifyStageLogin, err)
+		}
+	}
+
+	results, err := r.Search(torznab.Query{Limit: verifyLimit})
+	if err != nil {
+		return fail(VerifyStageSearch, err)
+	}
+
+	v.Results = len(results)
+	if len(results) == 0 {
+		return fail(VerifyStageResults, errors.New("The search for the latest torrents returned nothing"))
+	}
+
+	tester := Tester{Runner: r}
+	if err = tester.assertValidResults(results); err != nil {
+		return fail(VerifyStageResults, err)
+	}
+
+	v.OK = true
+	v.Duration = time.Since(v.Checked)
+	return v
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/cardigann/cardigann/config"
+	"github.com/cardigann/cardigann/indexer"
+	"github.com/cardigann/cardigann/torznab"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// indexerListing is an installed definition, as listed by the list command
+type indexerListing struct {
+	Key      string `json:"key"`
+	Name     string `json:"name"`
+	Language string `json:"language"`
+	Link     string `json:"link"`
+	Enabled  bool   `json:"enabled"`
+	Source   string `json:"source"`
+}
+
+func configureListCommand(app *kingpin.Application) {
+	var enabledOnly bool
+
+	cmd := app.Command("list", "List the indexers that definitions are installed for")
+	cmd.Alias("ls")
+
+	cmd.Flag("enabled", "Only list the indexers that are enabled").
+		BoolVar(&enabledOnly)
+
+	configureGlobalFlags(cmd)
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		applyGlobalFlags()
+		return listCommand(enabledOnly)
+	})
+}
+
+func listCommand(enabledOnly bool) error {
+	conf, err := newConfig()
+	if err != nil {
+		return err
+	}
+
+	keys, err := indexer.DefaultDefinitionLoader.List()
+	if err != nil {
+		return err
+	}
+	sort.Strings(keys)
+
+	listings := []indexerListing{}
+
+	for _, key := range keys {
+		def, err := indexer.DefaultDefinitionLoader.Load(key)
+		if err != nil {
+			return err
+		}
+
+		enabled := config.IsSectionEnabled(key, conf)
+		if enabledOnly && !enabled {
+			continue
+		}
+
+		listing := indexerListing{
+			Key:      key,
+			Name:     def.Name,
+			Language: def.Language,
+			Enabled:  enabled,
+			Source:   def.Stats().Source,
+		}
+		if len(def.Links) > 0 {
+			listing.Link = def.Links[0]
+		}
+
+		listings = append(listings, listing)
+	}
+
+	if outputJSON() {
+		return printJSON(listings)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "KEY\tNAME\tLANGUAGE\tENABLED\tLINK\n")
+	for _, l := range listings {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%v\t%s\n", l.Key, l.Name, l.Language, l.Enabled, l.Link)
+	}
+	return w.Flush()
+}
+
+type searchModeView struct {
+	Key             string   `json:"key"`
+	Available       bool     `json:"available"`
+	SupportedParams []string `json:"supportedParams"`
+}
+
+type categoryView struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// capsView is what an indexer can search for, as shown by the caps command
+type capsView struct {
+	SearchModes []searchModeView `json:"searchModes"`
+	Categories  []categoryView   `json:"categories"`
+}
+
+func configureCapsCommand(app *kingpin.Application) {
+	var key string
+
+	cmd := app.Command("caps", "Show the search modes and categories an indexer supports")
+	cmd.Arg("key", "The indexer key").
+		Required().
+		HintAction(func() []string {
+			return append(completeIndexerKeys(), "aggregate")
+		}).
+		StringVar(&key)
+
+	configureGlobalFlags(cmd)
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		applyGlobalFlags()
+		return capsCommand(key)
+	})
+}
+
+func capsCommand(key string) error {
+	conf, err := newConfig()
+	if err != nil {
+		return err
+	}
+
+	runner, err := lookupRunner(key, indexer.RunnerOpts{
+		Config: conf,
+	})
+	if err != nil {
+		return err
+	}
+
+	caps := runner.Capabilities()
+	cats := append(torznab.Categories{}, caps.Categories...)
+	sort.Sort(cats)
+
+	view := capsView{SearchModes: []searchModeView{}, Categories: []categoryView{}}
+	for _, mode := range caps.SearchModes {
+		params := mode.SupportedParams
+		if params == nil {
+			params = []string{}
+		}
+		view.SearchModes = append(view.SearchModes, searchModeView{mode.Key, mode.Available, params})
+	}
+	for _, cat := range cats {
+		view.Categories = append(view.Categories, categoryView{cat.ID, cat.Name})
+	}
+
+	if outputJSON() {
+		return printJSON(view)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "Search modes:\n")
+	for _, mode := range view.SearchModes {
+		available := "yes"
+		if !mode.Available {
+			available = "no"
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\n", mode.Key, available, strings.Join(mode.SupportedParams, ","))
+	}
+	fmt.Fprintf(w, "Categories:\n")
+	for _, cat := range view.Categories {
+		fmt.Fprintf(w, "  %d\t%s\n", cat.ID, cat.Name)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/cardigann/cardigann/config"
+	"github.com/cardigann/cardigann/indexer"
+	"github.com/cardigann/cardigann/scheduler"
+	"github.com/cardigann/cardigann/store"
+	"github.com/cardigann/cardigann/torznab"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+func configureJobsCommand(app *kingpin.Application) {
+	var name string
+	var dryRun bool
+
+	cmd := app.Command("jobs", "Run the scheduled jobs in the config")
+
+	run := cmd.Command("run", "Run a job now, rather than waiting for its schedule")
+	run.Arg("name", "The name of the job").
+		Required().
+		HintAction(completeJobNames).
+		StringVar(&name)
+
+	run.Flag("dry-run", "Show what the job would push, without downloading or pushing anything").
+		BoolVar(&dryRun)
+
+	configureGlobalFlags(run)
+	run.Action(func(c *kingpin.ParseContext) error {
+		applyGlobalFlags()
+		return runJobCommand(name, dryRun)
+	})
+}
+
+// completeJobNames lists the jobs in the config for shell completion
+func completeJobNames() []string {
+	conf, err := newConfig()
+	if err != nil {
+		return nil
+	}
+
+	jobs, err := scheduler.LoadJobs(conf)
+	if err != nil {
+		return nil
+	}
+
+	names := []string{}
+	for _, job := range jobs {
+		names = append(names, job.Name)
+	}
+	return names
+}
+
+func runJobCommand(name string, dryRun bool) error {
+	conf, err := newConfig()
+	if err != nil {
+		return err
+	}
+
+	job, err := scheduler.LoadJob(conf, name)
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		job.DryRun = true
+	}
+
+	st, err := store.Open(config.GetDataPath(""))
+	if err != nil {
+		return err
+	}
+
+	// results from an aggregate are downloaded from the indexer they came from, which should
+	// reuse the session from searching it
+	indexers := map[string]torznab.Indexer{}
+
+	s := scheduler.New(conf, st, func(key string) (torznab.Indexer, error) {
+		if idx, ok := indexers[key]; ok {
+			return idx, nil
+		}
+		idx, err := lookupRunner(key, indexer.RunnerOpts{Config: conf})
+		if err != nil {
+			return nil, err
+		}
+		indexers[key] = idx
+		return idx, nil
+	})
+
+	runErr := s.Run(job)
+	status := s.Status(job)
+
+	if outputJSON() {
+		if err := printJSON(status); err != nil {
+			return err
+		}
+		return runErr
+	}
+
+	if status.DryRun {
+		for _, p := range status.Planned {
+			fmt.Printf("Would push %q from %s: %s\n", p.Title, p.Indexer, p.Action)
+			if p.Fetch != "" {
+				fmt.Printf("  after downloading %s\n", p.Fetch)
+			}
+		}
+		if more := status.Pushed - len(status.Planned); more > 0 {
+			fmt.Printf("...and %d more\n", more)
+		}
+		fmt.Printf("Would push %d, skipped %d already pushed\n", status.Pushed, status.Skipped)
+	} else {
+		fmt.Printf("Pushed %d, skipped %d already pushed\n", status.Pushed, status.Skipped)
+	}
+
+	return runErr
+}
@@ -0,0 +1,101 @@
+package logger
+
+import (
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+)
+
+var levels = &levelFilter{
+	base:  logrus.InfoLevel,
+	sites: map[string]logrus.Level{},
+}
+
+// levelFilter allows the log level to be raised for individual sites, by setting the
+// logger to the most verbose level needed and then dropping entries that aren't wanted
+type levelFilter struct {
+	sync.RWMutex
+	base  logrus.Level
+	sites map[string]logrus.Level
+}
+
+func (l *levelFilter) effective() logrus.Level {
+	level := l.base
+	for _, siteLevel := range l.sites {
+		if siteLevel > level {
+			level = siteLevel
+		}
+	}
+	return level
+}
+
+func (l *levelFilter) allowed(entry *logrus.Entry) bool {
+	l.RLock()
+	defer l.RUnlock()
+
+	if site, ok := entry.Data["site"].(string); ok {
+		if siteLevel, ok := l.sites[site]; ok {
+			return entry.Level <= siteLevel
+		}
+	}
+
+	return entry.Level <= l.base
+}
+
+type filteredFormatter struct {
+	logrus.Formatter
+}
+
+func (f *filteredFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	if !levels.allowed(entry) {
+		return nil, nil
+	}
+	return f.Formatter.Format(entry)
+}
+
+// Allowed returns whether an entry should be logged, for hooks that receive every entry
+func Allowed(entry *logrus.Entry) bool {
+	return levels.allowed(entry)
+}
+
+func applyLevels() {
+	Logger.(*logrus.Logger).Level = levels.effective()
+}
+
+// Level returns the log level that applies to sites without their own level
+func Level() logrus.Level {
+	levels.RLock()
+	defer levels.RUnlock()
+
+	return levels.base
+}
+
+// SiteLevels returns the sites that have their own log level
+func SiteLevels() map[string]logrus.Level {
+	levels.RLock()
+	defer levels.RUnlock()
+
+	result := map[string]logrus.Level{}
+	for site, level := range levels.sites {
+		result[site] = level
+	}
+	return result
+}
+
+// SetSiteLevel sets the log level for a single site, e.g to debug a misbehaving indexer
+func SetSiteLevel(site string, level logrus.Level) {
+	levels.Lock()
+	defer levels.Unlock()
+
+	levels.sites[site] = level
+	applyLevels()
+}
+
+// ClearSiteLevel makes a site use the same log level as everything else
+func ClearSiteLevel(site string) {
+	levels.Lock()
+	defer levels.Unlock()
+
+	delete(levels.sites, site)
+	applyLevels()
+}
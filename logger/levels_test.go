@@ -0,0 +1,34 @@
+package logger
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+)
+
+func TestSiteLevels(t *testing.T) {
+	buf := &bytes.Buffer{}
+	SetOutput(buf)
+	SetLevel(logrus.InfoLevel)
+	SetSiteLevel("llamas", logrus.DebugLevel)
+	defer ClearSiteLevel("llamas")
+
+	Logger.WithField("site", "llamas").Debug("llamas debug")
+	Logger.WithField("site", "alpacas").Debug("alpacas debug")
+	Logger.WithField("site", "alpacas").Info("alpacas info")
+
+	for idx, example := range []struct {
+		msg      string
+		expected bool
+	}{
+		{"llamas debug", true},
+		{"alpacas debug", false},
+		{"alpacas info", true},
+	} {
+		if got := strings.Contains(buf.String(), example.msg); got != example.expected {
+			t.Errorf("Row #%d expected %q to be logged: %v, got %v", idx+1, example.msg, example.expected, got)
+		}
+	}
+}
@@ -15,15 +15,15 @@ func init() {
 	Logger = logrus.New()
 	Logger.(*logrus.Logger).Level = logrus.InfoLevel
 	Logger.(*logrus.Logger).Out = os.Stderr
-	Logger.(*logrus.Logger).Formatter = &redactedLogFormatter{Formatter: &logrus.TextFormatter{}}
+	Logger.(*logrus.Logger).Formatter = &filteredFormatter{&redactedLogFormatter{Formatter: &logrus.TextFormatter{}}}
 
 	if os.Getenv("DEBUG") != "" || os.Getenv("CARDIGANN_DEBUG") != "" {
-		Logger.(*logrus.Logger).Level = logrus.DebugLevel
+		SetLevel(logrus.DebugLevel)
 	}
 }
 
 func SetFormatter(f logrus.Formatter) {
-	Logger.(*logrus.Logger).Formatter = f
+	Logger.(*logrus.Logger).Formatter = &filteredFormatter{&redactedLogFormatter{Formatter: f}}
 }
 
 func SetOutput(out io.Writer) {
@@ -31,7 +31,11 @@ func SetOutput(out io.Writer) {
 }
 
 func SetLevel(level logrus.Level) {
-	Logger.(*logrus.Logger).Level = level
+	levels.Lock()
+	defer levels.Unlock()
+
+	levels.base = level
+	applyLevels()
 }
 
 func AddHook(h logrus.Hook) {
@@ -1,83 +1,257 @@
 package logger
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"regexp"
 	"strings"
 	"sync"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/Sirupsen/logrus"
 )
 
 const (
 	redactedMarker = "r̶e̶d̶a̶c̶t̶e̶d̶"
+
+	// minSecretLength is the shortest secret seen in a log line that is remembered, shorter
+	// values like ids would redact far more than intended
+	minSecretLength = 8
+
+	// minAddedSecretLength is the shortest secret given to AddSecret that is remembered, those
+	// come from settings that are known to be credentials so they can be shorter
+	minAddedSecretLength = 4
+
+	// maxSecrets is how many secrets are remembered before they are forgotten, as session
+	// cookies change all the time
+	maxSecrets = 1000
 )
 
 var (
+	// redactedRegexps match a secret in the third group, after a name in the first
 	redactedRegexps = []*regexp.Regexp{
-		regexp.MustCompile("(?i)(torrent_pass|pass|authkey|token|apikey)(=)([^&$]+)"),
-		regexp.MustCompile("(?i)(cookie|password)(:)([^\\s$\\]]+)"),
+		regexp.MustCompile(`(?i)\b(torrent_pass|passkey|rsskey|authkey|auth_key|apikey|api_key|token|secret|password|pass)(=)([^&\s"';]+)`),
+		regexp.MustCompile(`(?i)(cookie|password)(:)([^\s$\]]+)`),
+		regexp.MustCompile(`(?i)((?:set-)?cookie|authorization)(:\s+)([^\r\n]+)`),
 	}
+
+	// credentialNames are words in the names of cookies whose values are remembered as secrets,
+	// other cookies like preferences are redacted from the cookie header but not elsewhere
+	credentialNames = []string{"pass", "key", "token", "sess", "auth", "uid", "sid", "login", "secret", "hash", "remember"}
+
+	secrets = &redactor{}
 )
 
-type redactedLogFormatter struct {
-	logrus.Formatter
+// redactor masks secrets that match redactedRegexps, and remembers them so that they are also
+// masked wherever else they turn up
+type redactor struct {
 	sync.Mutex
 	secrets      map[string]struct{}
 	secretsRegex *regexp.Regexp
 }
 
-func (f *redactedLogFormatter) Format(entry *logrus.Entry) ([]byte, error) {
-	f.Lock()
-	defer f.Unlock()
+func (r *redactor) add(secret string, minLength int) {
+	if len(secret) < minLength || strings.Contains(secret, redactedMarker) {
+		return
+	}
 
-	if f.secrets == nil {
-		f.secrets = map[string]struct{}{}
+	r.Lock()
+	defer r.Unlock()
+
+	if r.secrets == nil || len(r.secrets) >= maxSecrets {
+		r.secrets = map[string]struct{}{}
 	}
 
-	for k, v := range entry.Data {
-		s := fmt.Sprintf("%v", v)
+	if _, ok := r.secrets[secret]; ok {
+		return
+	}
 
-		for _, re := range redactedRegexps {
-			var found bool
-			if matches := re.FindAllStringSubmatch(s, -1); len(matches) > 0 {
-				for _, match := range matches {
-					if match[2] == redactedMarker {
-						continue
-					}
-					s = strings.Replace(s, match[0], match[1]+match[2]+redactedMarker, -1)
-					f.secrets[match[3]] = struct{}{}
-					found = true
-				}
+	r.secrets[secret] = struct{}{}
+	r.updateRegexp()
+}
+
+func (r *redactor) redact(s string) string {
+	for _, re := range redactedRegexps {
+		for _, match := range re.FindAllStringSubmatch(s, -1) {
+			if match[3] == redactedMarker {
+				continue
 			}
-			if found {
-				entry.Data[k] = s
-				if err := f.updateRegexp(); err != nil {
-					return nil, err
-				}
+			s = strings.Replace(s, match[0], match[1]+match[2]+redactedMarker, -1)
+			for _, secret := range matchedSecrets(match[1], match[3]) {
+				r.add(secret, minSecretLength)
 			}
 		}
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	if r.secretsRegex == nil {
+		return s
+	}
+
+	// secrets are only replaced where they are a whole token, so that one doesn't mangle a longer
+	// word that happens to contain it
+	var buf bytes.Buffer
+	last := 0
+	for _, loc := range r.secretsRegex.FindAllStringIndex(s, -1) {
+		if !tokenBoundary(s, loc[0], loc[1]) {
+			continue
+		}
+		buf.WriteString(s[last:loc[0]])
+		buf.WriteString(redactedMarker)
+		last = loc[1]
+	}
+	buf.WriteString(s[last:])
+
+	return buf.String()
+}
+
+// tokenBoundary returns whether the text between start and end isn't part of a longer word
+func tokenBoundary(s string, start, end int) bool {
+	if start > 0 {
+		if r, _ := utf8.DecodeLastRuneInString(s[:start]); isTokenRune(r) {
+			return false
+		}
+	}
+	if end < len(s) {
+		if r, _ := utf8.DecodeRuneInString(s[end:]); isTokenRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isTokenRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
 
-		if f.secretsRegex != nil && f.secretsRegex.MatchString(s) {
-			s = f.secretsRegex.ReplaceAllLiteralString(s, redactedMarker)
-			entry.Data[k] = s
+// isCredentialName returns whether the name of a cookie looks like it holds a credential
+func isCredentialName(name string) bool {
+	name = strings.ToLower(name)
+	for _, word := range credentialNames {
+		if strings.Contains(name, word) {
+			return true
 		}
 	}
+	return false
+}
+
+// matchedSecrets returns the secrets in a matched value, which for cookie headers are the values
+// of the cookies that look like credentials rather than the whole header
+func matchedSecrets(name, value string) []string {
+	var pairs []string
+
+	switch strings.ToLower(name) {
+	case "cookie":
+		pairs = strings.Split(value, ";")
+	case "set-cookie":
+		pairs = strings.SplitN(value, ";", 2)[:1]
+	default:
+		return []string{value}
+	}
 
-	return f.Formatter.Format(entry)
+	values := []string{}
+	for _, pair := range pairs {
+		tokens := strings.SplitN(pair, "=", 2)
+		if len(tokens) == 2 && isCredentialName(strings.TrimSpace(tokens[0])) {
+			values = append(values, strings.TrimSpace(tokens[1]))
+		}
+	}
+	return values
 }
 
-func (f *redactedLogFormatter) updateRegexp() error {
+func (r *redactor) updateRegexp() {
 	quoted := []string{}
-	for secret := range f.secrets {
+	for secret := range r.secrets {
 		quoted = append(quoted, regexp.QuoteMeta(secret))
 	}
 
-	re, err := regexp.Compile(fmt.Sprintf("(?i)(%s)", strings.Join(quoted, "|")))
-	if err != nil {
-		return err
+	r.secretsRegex = regexp.MustCompile(fmt.Sprintf("(%s)", strings.Join(quoted, "|")))
+}
+
+// AddSecret makes sure that a value like a password or passkey is never logged
+func AddSecret(secret string) {
+	secrets.add(secret, minAddedSecretLength)
+}
+
+// Redact masks anything that looks like a credential in s, along with the values given to AddSecret
+func Redact(s string) string {
+	return secrets.redact(s)
+}
+
+// RedactedWriter returns a writer that redacts each line written to it before passing it on,
+// for debug output that doesn't go through the logger. Closing it writes out the last line if
+// it wasn't terminated, without closing w
+func RedactedWriter(w io.Writer) io.WriteCloser {
+	return &redactedWriter{w: w}
+}
+
+type redactedWriter struct {
+	mu  sync.Mutex
+	w   io.Writer
+	buf bytes.Buffer
+}
+
+func (rw *redactedWriter) Write(p []byte) (int, error) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	rw.buf.Write(p)
+	for {
+		idx := bytes.IndexByte(rw.buf.Bytes(), '\n')
+		if idx < 0 {
+			break
+		}
+		line := string(rw.buf.Next(idx + 1))
+		if _, err := io.WriteString(rw.w, Redact(line)); err != nil {
+			return len(p), err
+		}
+	}
+
+	return len(p), nil
+}
+
+// Flush writes out whatever is left of an unterminated line
+func (rw *redactedWriter) Flush() error {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	if rw.buf.Len() == 0 {
+		return nil
+	}
+
+	line := rw.buf.String()
+	rw.buf.Reset()
+
+	_, err := io.WriteString(rw.w, Redact(line))
+	return err
+}
+
+func (rw *redactedWriter) Close() error {
+	return rw.Flush()
+}
+
+type redactedLogFormatter struct {
+	logrus.Formatter
+}
+
+func (f *redactedLogFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	// the entry's fields can be shared with other entries, so redact a copy of them
+	redacted := *entry
+	redacted.Message = Redact(entry.Message)
+	redacted.Data = make(logrus.Fields, len(entry.Data))
+
+	for k, v := range entry.Data {
+		s := fmt.Sprintf("%v", v)
+		if r := Redact(s); r != s {
+			redacted.Data[k] = r
+		} else {
+			redacted.Data[k] = v
+		}
 	}
 
-	f.secretsRegex = re
-	return nil
+	return f.Formatter.Format(&redacted)
 }
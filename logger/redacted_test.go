@@ -0,0 +1,89 @@
+package logger
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+)
+
+func TestRedact(t *testing.T) {
+	AddSecret("llamasecret")
+
+	for idx, example := range []struct {
+		input  string
+		secret string
+	}{
+		{"GET https://example.org/rss.php?passkey=abcdef123&cat=1", "abcdef123"},
+		{"https://example.org/download.php?id=1&torrent_pass=fedcba321", "fedcba321"},
+		{"Cookie: uid=1234; pass=0a1b2c3d", "0a1b2c3d"},
+		{"Set-Cookie: session=s3ss10ntok3n; Path=/; HttpOnly", "s3ss10ntok3n"},
+		{"map[password:hunter22 username:llama]", "hunter22"},
+		{"Logged in with llamasecret", "llamasecret"},
+	} {
+		if got := Redact(example.input); strings.Contains(got, example.secret) {
+			t.Errorf("Row #%d expected %q to be redacted, got %q", idx+1, example.secret, got)
+		}
+	}
+
+	// secrets seen once are redacted wherever else they turn up
+	if got := Redact("the session is s3ss10ntok3n"); strings.Contains(got, "s3ss10ntok3n") {
+		t.Errorf("Expected a session cookie to be redacted after it was seen, got %q", got)
+	}
+}
+
+func TestRedact_OnlyCredentials(t *testing.T) {
+	Redact("Cookie: theme=darkmode99; uid=1234")
+	Redact("Set-Cookie: lang=english1; Path=/")
+
+	// cookies that aren't credentials, or are too short, aren't remembered
+	if got := Redact("using darkmode99 in english1 for 1234"); got != "using darkmode99 in english1 for 1234" {
+		t.Errorf("Expected nothing to be redacted, got %q", got)
+	}
+
+	// secrets are only redacted where they are a whole word
+	AddSecret("engi")
+	if got := Redact("the engine engi"); got != "the engine "+redactedMarker {
+		t.Errorf("Expected only the whole word to be redacted, got %q", got)
+	}
+}
+
+func TestRedactedLogFormatter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	SetOutput(buf)
+	SetFormatter(&logrus.TextFormatter{DisableColors: true})
+	SetLevel(logrus.InfoLevel)
+
+	fields := logrus.Fields{"url": "https://example.org/?apikey=0123abcd"}
+	Logger.WithFields(fields).Info("Fetching with rsskey=9876fedc")
+
+	if s := buf.String(); strings.Contains(s, "0123abcd") || strings.Contains(s, "9876fedc") {
+		t.Fatalf("Expected the log line to be redacted, got %q", s)
+	}
+
+	if fields["url"] != "https://example.org/?apikey=0123abcd" {
+		t.Fatalf("Expected the logged fields not to be changed, got %q", fields["url"])
+	}
+
+	buf.Reset()
+	w := RedactedWriter(buf)
+	w.Write([]byte("GET /download.php?authkey=ab"))
+	w.Write([]byte("cdef99&id=1\n"))
+
+	if s := buf.String(); strings.Contains(s, "abcdef99") || !strings.HasPrefix(s, "GET /download.php") {
+		t.Fatalf("Expected a redacted line, got %q", s)
+	}
+
+	// the last line is written out on close even though it wasn't terminated
+	buf.Reset()
+	w.Write([]byte("GET /download.php?authkey=abcdef99"))
+	if buf.Len() != 0 {
+		t.Fatalf("Expected an unterminated line to be held back, got %q", buf.String())
+	}
+
+	w.Close()
+	if s := buf.String(); strings.Contains(s, "abcdef99") || !strings.HasPrefix(s, "GET /download.php") {
+		t.Fatalf("Expected the redacted line on close, got %q", s)
+	}
+}
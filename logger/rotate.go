@@ -0,0 +1,134 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const rotatedTimeFormat = "20060102-150405"
+
+// RotatingFile is a log file that is rotated when it gets too big, keeping a limited
+// number of old files around for a limited time
+type RotatingFile struct {
+	Path       string
+	MaxSize    int64
+	MaxAge     time.Duration
+	MaxBackups int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// OpenRotatingFile opens a log file for appending, rotating it first if it's already too big
+func OpenRotatingFile(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*RotatingFile, error) {
+	r := &RotatingFile{
+		Path:       path,
+		MaxSize:    maxSize,
+		MaxAge:     maxAge,
+		MaxBackups: maxBackups,
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	r.f, r.size = f, fi.Size()
+	return nil
+}
+
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.MaxSize > 0 && r.size+int64(len(p)) > r.MaxSize && r.size > 0 {
+		if err := r.rotate(time.Now()); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Close closes the current log file
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.f.Close()
+}
+
+func (r *RotatingFile) rotate(now time.Time) error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+
+	rotated := fmt.Sprintf("%s.%s", r.Path, now.Format(rotatedTimeFormat))
+	if err := os.Rename(r.Path, rotated); err != nil {
+		return err
+	}
+
+	if err := r.open(); err != nil {
+		return err
+	}
+
+	return r.prune(now)
+}
+
+// prune removes rotated files that are too old, or beyond the number of backups kept
+func (r *RotatingFile) prune(now time.Time) error {
+	matches, err := filepath.Glob(r.Path + ".*")
+	if err != nil {
+		return err
+	}
+
+	backups := []string{}
+	for _, m := range matches {
+		if _, err := time.Parse(rotatedTimeFormat, strings.TrimPrefix(m, r.Path+".")); err == nil {
+			backups = append(backups, m)
+		}
+	}
+
+	// newest first, the timestamp format sorts lexically
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+
+	for idx, backup := range backups {
+		t, _ := time.ParseInLocation(rotatedTimeFormat, strings.TrimPrefix(backup, r.Path+"."), time.Local)
+		tooOld := r.MaxAge > 0 && now.Sub(t) > r.MaxAge
+		tooMany := r.MaxBackups > 0 && idx >= r.MaxBackups
+
+		if tooOld || tooMany {
+			if err := os.Remove(backup); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package logger
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRotatingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "cardigann.log")
+
+	// an old backup that should be pruned by age
+	old := path + "." + time.Now().Add(-48*time.Hour).Format(rotatedTimeFormat)
+	if err = ioutil.WriteFile(old, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := OpenRotatingFile(path, 10, 24*time.Hour, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if _, err = r.Write([]byte("12345678")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = r.Write([]byte("abcdef")); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "abcdef" {
+		t.Fatalf("Expected current log to only contain the last write, got %q", b)
+	}
+
+	matches, _ := filepath.Glob(path + ".*")
+	if len(matches) != 1 {
+		t.Fatalf("Expected one backup after pruning, got %v", matches)
+	}
+	if matches[0] == old {
+		t.Fatalf("Expected old backup to be pruned")
+	}
+}
@@ -10,8 +10,11 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
+	"time"
 
 	_ "net/http/pprof"
 
@@ -21,6 +24,7 @@ import (
 	"github.com/cardigann/cardigann/logger"
 	"github.com/cardigann/cardigann/server"
 	"github.com/cardigann/cardigann/torznab"
+	"github.com/cardigann/cardigann/updates"
 	"github.com/equinox-io/equinox"
 	"github.com/kardianos/service"
 	"gopkg.in/alecthomas/kingpin.v2"
@@ -54,6 +58,10 @@ func run(args []string, exit func(code int)) {
 
 	if err := configureServerCommand(app); err != nil {
 		log.Error(err)
+
+		// restoring a backup is how a broken config gets fixed, so that still works without one
+		configureBackupCommand(app)
+		kingpin.MustParse(app.Parse(args))
 		return
 	}
 
@@ -62,7 +70,19 @@ func run(args []string, exit func(code int)) {
 	configureTestDefinitionCommand(app)
 	configureServiceCommand(app)
 	configureUpdateCommand(app)
+	configureVersionCommand(app)
 	configureRatiosCommand(app)
+	configureUsersCommand(app)
+	configureDiagnoseCommand(app)
+	configureExtractCommand(app)
+	configureCheckCommand(app)
+	configureBackupCommand(app)
+	configureBenchCommand(app)
+	configureFuzzDefinitionCommand(app)
+	configureListCommand(app)
+	configureCapsCommand(app)
+	configureCompletionCommand(app)
+	configureJobsCommand(app)
 
 	kingpin.MustParse(app.Parse(args))
 }
@@ -74,10 +94,32 @@ func newConfig() (config.Config, error) {
 	}
 
 	log.WithField("path", f).Debug("Reading config")
+
+	problems, err := config.ValidateFile(f, configSchema)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range problems {
+		log.WithField("path", f).Warn(p.Error())
+	}
+
 	return config.NewJSONConfig(f)
 }
 
+// sessionDir is where runners share their logins with the server and other commands
+func sessionDir() string {
+	return config.GetDataPath("sessions")
+}
+
 func lookupRunner(key string, opts indexer.RunnerOpts) (torznab.Indexer, error) {
+	if opts.SessionDir == "" {
+		opts.SessionDir = sessionDir()
+	}
+
+	if opts.MetadataDir == "" {
+		opts.MetadataDir = config.GetCachePath("metadata")
+	}
+
 	if key == "aggregate" {
 		return lookupAggregate(opts)
 	}
@@ -96,7 +138,10 @@ func lookupAggregate(opts indexer.RunnerOpts) (torznab.Indexer, error) {
 		return nil, err
 	}
 
-	agg := indexer.Aggregate{}
+	agg := indexer.Aggregate{
+		Timeout: indexer.AggregateTimeout(opts.Config),
+		Scorer:  indexer.ConfiguredScorer(opts.Config, keys),
+	}
 	for _, key := range keys {
 		if config.IsSectionEnabled(key, opts.Config) {
 			def, err := indexer.DefaultDefinitionLoader.Load(key)
@@ -104,7 +149,7 @@ func lookupAggregate(opts indexer.RunnerOpts) (torznab.Indexer, error) {
 				return nil, err
 			}
 
-			agg = append(agg, indexer.NewRunner(def, opts))
+			agg.Indexers = append(agg.Indexers, indexer.NewRunner(def, opts))
 		}
 	}
 
@@ -112,11 +157,14 @@ func lookupAggregate(opts indexer.RunnerOpts) (torznab.Indexer, error) {
 }
 
 var globals struct {
-	Debug bool
+	Debug  bool
+	Output string
 }
 
 func configureGlobalFlags(cmd *kingpin.CmdClause) {
 	cmd.Flag("debug", "Print out debug logging").BoolVar(&globals.Debug)
+	cmd.Flag("output", "Either text or json, json is for scripts to read").
+		EnumVar(&globals.Output, "text", "json")
 }
 
 func applyGlobalFlags() {
@@ -125,9 +173,41 @@ func applyGlobalFlags() {
 	}
 }
 
+// outputFormat returns the format given with --output, or def if there wasn't one
+func outputFormat(def string) string {
+	if globals.Output != "" {
+		return globals.Output
+	}
+	return def
+}
+
+// outputJSON returns whether --output json was given
+func outputJSON() bool {
+	return globals.Output == "json"
+}
+
+func printJSON(v interface{}) error {
+	j, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Failed to marshal JSON: %s", err.Error())
+	}
+	fmt.Printf("%s\n", j)
+	return nil
+}
+
+// completeIndexerKeys lists the keys of the installed definitions for shell completion
+func completeIndexerKeys() []string {
+	keys, err := indexer.DefaultDefinitionLoader.List()
+	if err != nil {
+		return nil
+	}
+	return keys
+}
+
 func configureQueryCommand(app *kingpin.Application) {
 	var key, format string
 	var args []string
+	var offline bool
 
 	cmd := app.Command("query", "Manually query an indexer using torznab commands")
 	cmd.Alias("q")
@@ -138,27 +218,37 @@ func configureQueryCommand(app *kingpin.Application) {
 
 	cmd.Arg("key", "The indexer key").
 		Required().
+		HintAction(func() []string {
+			return append(completeIndexerKeys(), "aggregate")
+		}).
 		StringVar(&key)
 
 	cmd.Arg("args", "Arguments to use to query").
 		StringsVar(&args)
 
+	cmd.Flag("offline", "Show the results cached when the query was last searched, without searching").
+		BoolVar(&offline)
+
 	configureGlobalFlags(cmd)
 
 	cmd.Action(func(c *kingpin.ParseContext) error {
 		applyGlobalFlags()
-		return queryCommand(key, format, args)
+		if outputJSON() {
+			format = "json"
+		}
+		return queryCommand(key, format, args, offline)
 	})
 }
 
-func queryCommand(key, format string, args []string) error {
+func queryCommand(key, format string, args []string, offline bool) error {
 	conf, err := newConfig()
 	if err != nil {
 		return err
 	}
 
-	indexer, err := lookupRunner(key, indexer.RunnerOpts{
-		Config: conf,
+	idx, err := lookupRunner(key, indexer.RunnerOpts{
+		Config:  conf,
+		Offline: offline || indexer.IsOfflineMode(conf),
 	})
 	if err != nil {
 		return err
@@ -179,11 +269,22 @@ func queryCommand(key, format string, args []string) error {
 		return fmt.Errorf("Parsing query failed: %s", err.Error())
 	}
 
-	feed, err := indexer.Search(query)
-	if err != nil {
+	feed, err := idx.Search(query)
+	if indexer.IsOffline(err) {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", err)
+		if feed == nil {
+			feed = []torznab.ResultItem{}
+		}
+	} else if err != nil {
 		return fmt.Errorf("Searching failed: %s", err.Error())
 	}
 
+	if len(query.Languages) == 0 {
+		query.Languages = indexer.ConfiguredLanguages(conf)
+	}
+
+	feed = torznab.Filter(feed, query)
+
 	switch format {
 	case "xml":
 		x, err := xml.MarshalIndent(feed, "", "  ")
@@ -205,10 +306,12 @@ func queryCommand(key, format string, args []string) error {
 
 func configureDownloadCommand(app *kingpin.Application) {
 	var key, url, file string
+	var dryRun bool
 
 	cmd := app.Command("download", "Download a torrent from the tracker")
 	cmd.Arg("key", "The indexer key").
 		Required().
+		HintAction(completeIndexerKeys).
 		StringVar(&key)
 
 	cmd.Arg("url", "The url of the file to download").
@@ -219,15 +322,18 @@ func configureDownloadCommand(app *kingpin.Application) {
 		Required().
 		StringVar(&file)
 
+	cmd.Flag("dry-run", "Show what would be downloaded, without logging in or downloading it").
+		BoolVar(&dryRun)
+
 	configureGlobalFlags(cmd)
 
 	cmd.Action(func(c *kingpin.ParseContext) error {
 		applyGlobalFlags()
-		return downloadCommand(key, url, file)
+		return downloadCommand(key, url, file, dryRun)
 	})
 }
 
-func downloadCommand(key, url, file string) error {
+func downloadCommand(key, url, file string, dryRun bool) error {
 	conf, err := newConfig()
 	if err != nil {
 		return err
@@ -240,6 +346,19 @@ func downloadCommand(key, url, file string) error {
 		return err
 	}
 
+	if dryRun {
+		if outputJSON() {
+			return printJSON(struct {
+				Indexer string `json:"indexer"`
+				URL     string `json:"url"`
+				File    string `json:"file"`
+				DryRun  bool   `json:"dryRun"`
+			}{key, url, file, true})
+		}
+		fmt.Printf("Would download %s from %s to %s\n", url, key, file)
+		return nil
+	}
+
 	rc, _, err := indexer.Download(url)
 	if err != nil {
 		return fmt.Errorf("Downloading failed: %s", err.Error())
@@ -258,6 +377,13 @@ func downloadCommand(key, url, file string) error {
 	}
 
 	log.WithFields(logrus.Fields{"bytes": n}).Info("Downloading file")
+
+	if outputJSON() {
+		return printJSON(struct {
+			File  string `json:"file"`
+			Bytes int64  `json:"bytes"`
+		}{file, n})
+	}
 	return nil
 }
 
@@ -277,6 +403,10 @@ func configureServerCommand(app *kingpin.Application) error {
 		Default(s.Port).
 		StringVar(&s.Port)
 
+	cmd.Flag("grpc-port", "A port to serve the gRPC interface on, which needs a build with -tags grpc").
+		Default(s.GRPCPort).
+		StringVar(&s.GRPCPort)
+
 	cmd.Flag("bind", "The address to bind to").
 		Default(s.Bind).
 		StringVar(&s.Bind)
@@ -292,9 +422,68 @@ func configureServerCommand(app *kingpin.Application) error {
 	cmd.Flag("hostname", "The hostname to use for the links back to the server").
 		StringVar(&s.Hostname)
 
+	cmd.Flag("user", "A user to switch to after binding, when started as root").
+		StringVar(&s.User)
+
+	cmd.Flag("group", "A group to switch to after binding, defaults to the user's primary group").
+		StringVar(&s.Group)
+
+	cmd.Flag("allow-root", "Allow the server to keep running as root").
+		BoolVar(&s.AllowRoot)
+
+	cmd.Flag("web-dir", "Serve the web interface from a directory instead of the one built in").
+		Default(s.WebDir).
+		StringVar(&s.WebDir)
+
+	cmd.Flag("read-only", "Turn off changing the config, leaving search and downloads working").
+		Default(strconv.FormatBool(s.ReadOnly)).
+		BoolVar(&s.ReadOnly)
+
+	cmd.Flag("low-memory", "Use less memory, for small devices like a Raspberry Pi or a NAS").
+		Default(strconv.FormatBool(s.LowMemory)).
+		BoolVar(&s.LowMemory)
+
+	cmd.Flag("offline", "Serve searches from cached results without reaching trackers or the internet").
+		Default(strconv.FormatBool(s.Offline)).
+		BoolVar(&s.Offline)
+
+	var logFile string
+	var logMaxSize int64
+	var logMaxAge time.Duration
+	var logMaxBackups int
+
+	cmd.Flag("log-file", "A file to write logs to, as well as stderr").
+		StringVar(&logFile)
+
+	cmd.Flag("log-max-size", "The size in megabytes at which the log file is rotated").
+		Default("10").
+		Int64Var(&logMaxSize)
+
+	cmd.Flag("log-max-age", "How long rotated log files are kept for").
+		Default("168h").
+		DurationVar(&logMaxAge)
+
+	cmd.Flag("log-max-backups", "How many rotated log files are kept").
+		Default("5").
+		IntVar(&logMaxBackups)
+
 	configureGlobalFlags(cmd)
 	cmd.Action(func(c *kingpin.ParseContext) error {
 		applyGlobalFlags()
+
+		if logFile != "" {
+			f, err := logger.OpenRotatingFile(logFile, logMaxSize*1024*1024, logMaxAge, logMaxBackups)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			logger.SetOutput(io.MultiWriter(os.Stderr, f))
+		}
+
+		if err := runMigrations(conf); err != nil {
+			return err
+		}
+
 		return serverCommand(s)
 	})
 
@@ -345,14 +534,28 @@ func configureTestDefinitionCommand(app *kingpin.Application) {
 	})
 }
 
+// testDefinitionReport is the outcome of testing a definition, for --output json
+type testDefinitionReport struct {
+	Site  string               `json:"site"`
+	OK    bool                 `json:"ok"`
+	Error string               `json:"error,omitempty"`
+	Tests []indexer.TestResult `json:"tests"`
+}
+
 func testDefinitionCommand(f *os.File, cachePages bool, savePath, replayPath string) error {
+	// json output has to be the only thing on stdout
+	out := io.Writer(os.Stdout)
+	if outputJSON() {
+		out = os.Stderr
+	}
+
 	logOutput := &bytes.Buffer{}
 	logger.SetOutput(logOutput)
 	defer func() {
 		if logOutput.Len() > 0 {
-			fmt.Printf("\nLogging output:\n")
+			fmt.Fprintf(out, "\nLogging output:\n")
 			io.Copy(os.Stderr, logOutput)
-			fmt.Println()
+			fmt.Fprintln(out)
 		}
 	}()
 
@@ -377,36 +580,215 @@ func testDefinitionCommand(f *os.File, cachePages bool, savePath, replayPath str
 		defs = append(defs, def)
 	}
 
-	fmt.Printf("→ Testing %d definition(s) (%s/%s/%s)\n",
-		len(defs),
-		version(),
-		runtime.GOOS, runtime.GOARCH,
-	)
+	if !outputJSON() {
+		fmt.Printf("→ Testing %d definition(s) (%s/%s/%s)\n",
+			len(defs),
+			version(),
+			runtime.GOOS, runtime.GOARCH,
+		)
+	}
+
+	reports := []testDefinitionReport{}
 
 	for _, def := range defs {
 		runner := indexer.NewRunner(def, indexer.RunnerOpts{
 			Config:     conf,
 			CachePages: cachePages,
+			SessionDir: sessionDir(),
 		})
 		tester := indexer.Tester{Runner: runner, Opts: indexer.TesterOpts{
 			Download: true,
 		}}
-		if err = tester.Test(); err != nil {
-			return fmt.Errorf("One or more tests failed")
+		if outputJSON() {
+			tester.Output = ioutil.Discard
+		}
+
+		err = tester.Test()
+
+		report := testDefinitionReport{Site: def.Site, OK: err == nil, Tests: tester.Results}
+		if err != nil {
+			report.Error = err.Error()
+		}
+		reports = append(reports, report)
+
+		if err != nil {
+			break
 		}
 	}
+
+	if outputJSON() {
+		if jsonErr := printJSON(reports); jsonErr != nil {
+			return jsonErr
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("One or more tests failed")
+	}
 	return nil
 }
 
+func configureExtractCommand(app *kingpin.Application) {
+	var defFile, pageFile *os.File
+	var baseURL string
+
+	cmd := app.Command("extract", "Run a definition's selectors against a saved search results page")
+	cmd.Arg("definition", "The definition yaml file").
+		Required().
+		FileVar(&defFile)
+
+	cmd.Arg("page", "The saved html page").
+		Required().
+		FileVar(&pageFile)
+
+	cmd.Flag("base", "The url to resolve relative links against, defaults to the definition's first link").
+		StringVar(&baseURL)
+
+	configureGlobalFlags(cmd)
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		logger.SetLevel(logrus.WarnLevel)
+		applyGlobalFlags()
+		return extractCommand(defFile, pageFile, baseURL)
+	})
+}
+
+func extractCommand(defFile, pageFile *os.File, baseURL string) error {
+	defer defFile.Close()
+	defer pageFile.Close()
+
+	def, err := indexer.ParseDefinitionFile(defFile)
+	if err != nil {
+		return err
+	}
+
+	var base *url.URL
+	if baseURL != "" {
+		if base, err = url.Parse(baseURL); err != nil {
+			return err
+		}
+	}
+
+	rows, err := indexer.Extract(def, pageFile, base)
+	if err != nil {
+		return err
+	}
+
+	if len(rows) == 0 {
+		return fmt.Errorf("No rows matched selector %q", def.Search.Rows.Selector)
+	}
+
+	if outputJSON() {
+		return printJSON(extractedRowViews(rows))
+	}
+
+	for idx, row := range rows {
+		fmt.Printf("Row #%d\n", idx+1)
+
+		for _, f := range row.Fields {
+			if f.Error != nil {
+				fmt.Printf("  %-22s ERROR: %v\n", f.Field, f.Error)
+			} else {
+				fmt.Printf("  %-22s %q\n", f.Field, f.Value)
+			}
+		}
+
+		if row.Error != nil {
+			fmt.Printf("  → Row failed: %v\n\n", row.Error)
+			continue
+		}
+
+		fmt.Printf("  → title=%q link=%q size=%d category=%d (local %q) seeders=%d peers=%d date=%s\n\n",
+			row.Item.Title, row.Item.Link, row.Item.Size, row.Item.Category, row.LocalCategoryID,
+			row.Item.Seeders, row.Item.Peers, row.Item.PublishDate.Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+type extractedFieldView struct {
+	Field string `json:"field"`
+	Value string `json:"value"`
+	Error string `json:"error,omitempty"`
+}
+
+// extractedRowView is an extracted row for --output json, errors don't marshal by themselves
+type extractedRowView struct {
+	Fields          []extractedFieldView `json:"fields"`
+	Item            *torznab.ResultItem  `json:"item,omitempty"`
+	LocalCategoryID string               `json:"localCategoryId,omitempty"`
+	Error           string               `json:"error,omitempty"`
+}
+
+func extractedRowViews(rows []indexer.ExtractedRow) []extractedRowView {
+	views := []extractedRowView{}
+
+	for _, row := range rows {
+		view := extractedRowView{Fields: []extractedFieldView{}}
+
+		for _, f := range row.Fields {
+			fv := extractedFieldView{Field: f.Field, Value: f.Value}
+			if f.Error != nil {
+				fv.Error = f.Error.Error()
+			}
+			view.Fields = append(view.Fields, fv)
+		}
+
+		if row.Error != nil {
+			view.Error = row.Error.Error()
+		} else {
+			item := row.Item
+			view.Item = &item
+			view.LocalCategoryID = row.LocalCategoryID
+		}
+
+		views = append(views, view)
+	}
+
+	return views
+}
+
 func configureServiceCommand(app *kingpin.Application) {
 	var action string
-	var userService bool
+	var opts programOpts
+	var restartDelay time.Duration
+	var noRecovery bool
 	var possibleActions = append(service.ControlAction[:], "run")
 
 	cmd := app.Command("service", "Control the cardigann service")
 
 	cmd.Flag("user", "Whether to use a user service rather than a system one").
-		BoolVar(&userService)
+		BoolVar(&opts.UserService)
+
+	cmd.Flag("name", "The name of the service, defaults to Cardigann, or Cardigann-<username> for user services").
+		StringVar(&opts.Name)
+
+	cmd.Flag("port", "The port the installed service listens on").
+		StringVar(&opts.Port)
+
+	cmd.Flag("bind", "The address the installed service binds to").
+		StringVar(&opts.Bind)
+
+	cmd.Flag("config", "The config file the installed service reads").
+		StringVar(&opts.ConfigFile)
+
+	cmd.Flag("data-dir", "The directory the installed service stores its data in").
+		StringVar(&opts.DataDir)
+
+	cmd.Flag("run-as", "A user the installed service switches to after binding").
+		StringVar(&opts.RunAs)
+
+	cmd.Flag("run-as-group", "A group the installed service switches to after binding").
+		StringVar(&opts.RunAsGroup)
+
+	cmd.Flag("log-file", "A file the installed service writes its logs to, as well as the system log").
+		StringVar(&opts.LogFile)
+
+	cmd.Flag("restart-delay", "How long to wait before restarting the service if it fails").
+		Default(defaultRestartDelay.String()).
+		DurationVar(&restartDelay)
+
+	cmd.Flag("no-recovery", "Don't configure the service to restart when it fails").
+		BoolVar(&noRecovery)
 
 	cmd.Arg("action", "One of "+strings.Join(possibleActions, ", ")).
 		Required().
@@ -416,20 +798,53 @@ func configureServiceCommand(app *kingpin.Application) {
 	cmd.Action(func(c *kingpin.ParseContext) error {
 		applyGlobalFlags()
 
-		prg, err := newProgram(programOpts{
-			UserService: userService,
-		})
+		// services run from a different working directory and often as a different user,
+		// so make sure the config they are installed with resolves to the same place
+		if opts.ConfigFile != "" {
+			abs, err := filepath.Abs(opts.ConfigFile)
+			if err != nil {
+				return err
+			}
+			opts.ConfigFile = abs
+		} else if opts.UserService && action == "install" {
+			path, err := config.GetConfigPath()
+			if err != nil {
+				return err
+			}
+			opts.ConfigFile = path
+		}
+
+		if opts.LogFile != "" {
+			abs, err := filepath.Abs(opts.LogFile)
+			if err != nil {
+				return err
+			}
+			opts.LogFile = abs
+		}
+
+		opts.applyEnv()
+
+		prg, err := newProgram(opts)
 		if err != nil {
 			return err
 		}
 
 		log.Debugf("Running service action %s on platform %v.", action, service.Platform())
 
-		if action != "run" {
-			return service.Control(prg.service, action)
+		switch action {
+		case "run":
+			return runServiceCommand(prg)
+		case "install":
+			if err := service.Control(prg.service, action); err != nil {
+				return err
+			}
+			if noRecovery {
+				return nil
+			}
+			return configureServiceRecovery(opts.serviceName(), restartDelay)
 		}
 
-		return runServiceCommand(prg)
+		return service.Control(prg.service, action)
 	})
 }
 
@@ -443,7 +858,18 @@ func runServiceCommand(prg *program) error {
 
 	logger.SetOutput(ioutil.Discard)
 	logger.AddHook(&serviceLogHook{prg.logger})
-	logger.SetFormatter(&serviceLogFormatter{})
+
+	// the system log can be hard to get at, so a service can also write to a file of its own
+	if prg.opts.LogFile != "" {
+		f, err := logger.OpenRotatingFile(prg.opts.LogFile, serviceLogMaxSize, serviceLogMaxAge, serviceLogMaxBackups)
+		if err != nil {
+			prg.logger.Error(err)
+		} else {
+			defer f.Close()
+			logger.SetFormatter(&logrus.TextFormatter{DisableColors: true})
+			logger.SetOutput(f)
+		}
+	}
 
 	go func() {
 		for {
@@ -462,6 +888,57 @@ func runServiceCommand(prg *program) error {
 	return nil
 }
 
+func configureVersionCommand(app *kingpin.Application) {
+	var check bool
+
+	cmd := app.Command("version", "Show the version of cardigann")
+
+	cmd.Flag("check", "Also check for a newer release and updated definitions").
+		BoolVar(&check)
+
+	configureGlobalFlags(cmd)
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		applyGlobalFlags()
+		return versionCommand(check)
+	})
+}
+
+func versionCommand(check bool) error {
+	if !outputJSON() {
+		fmt.Println(version())
+	}
+
+	if !check {
+		if outputJSON() {
+			return printJSON(struct {
+				Current string `json:"current"`
+			}{version()})
+		}
+		return nil
+	}
+
+	status, err := updates.Check(version())
+	if err != nil {
+		return err
+	}
+
+	if outputJSON() {
+		return printJSON(status)
+	}
+
+	if status.Available {
+		fmt.Printf("Cardigann %s is available, see %s\n", status.Latest, status.URL)
+	} else {
+		fmt.Printf("No newer release, the latest is %s\n", status.Latest)
+	}
+
+	if len(status.Definitions) > 0 {
+		fmt.Printf("Definitions updated since this release: %s\n", strings.Join(status.Definitions, ", "))
+	}
+
+	return nil
+}
+
 func configureUpdateCommand(app *kingpin.Application) {
 	var channel string
 	var dryRun bool
@@ -476,10 +953,19 @@ func configureUpdateCommand(app *kingpin.Application) {
 
 	configureGlobalFlags(cmd)
 	cmd.Action(func(c *kingpin.ParseContext) error {
+		applyGlobalFlags()
 		return runUpdateCommand(channel, dryRun)
 	})
 }
 
+// updateResult is the outcome of the update command, for --output json
+type updateResult struct {
+	Current string `json:"current"`
+	Latest  string `json:"latest,omitempty"`
+	Updated bool   `json:"updated"`
+	DryRun  bool   `json:"dryRun,omitempty"`
+}
+
 const appID = "app_doJjayUsKxb"
 
 var publicKey = []byte(`
@@ -504,6 +990,9 @@ func runUpdateCommand(channel string, dryRun bool) error {
 	switch {
 	case err == equinox.NotAvailableErr:
 		log.Info("No update available, already at the latest version!")
+		if outputJSON() {
+			return printJSON(updateResult{Current: version()})
+		}
 		return nil
 	case err != nil:
 		log.Errorf("Update failed:", err)
@@ -512,6 +1001,9 @@ func runUpdateCommand(channel string, dryRun bool) error {
 
 	if dryRun {
 		log.Infof("Update found from %s to %s, would be applied", Version, resp.ReleaseVersion)
+		if outputJSON() {
+			return printJSON(updateResult{Current: version(), Latest: resp.ReleaseVersion, DryRun: true})
+		}
 		return nil
 	}
 
@@ -522,6 +1014,9 @@ func runUpdateCommand(channel string, dryRun bool) error {
 	}
 
 	log.Infof("Updated to new version: %s!\n", resp.ReleaseVersion)
+	if outputJSON() {
+		return printJSON(updateResult{Current: version(), Latest: resp.ReleaseVersion, Updated: true})
+	}
 	return nil
 }
 
@@ -530,6 +1025,7 @@ func configureRatiosCommand(app *kingpin.Application) {
 
 	configureGlobalFlags(cmd)
 	cmd.Action(func(c *kingpin.ParseContext) error {
+		applyGlobalFlags()
 		return runRatiosCommand()
 	})
 }
@@ -545,9 +1041,17 @@ func runRatiosCommand() error {
 		return err
 	}
 
+	type ratioResult struct {
+		Site  string `json:"site"`
+		Ratio string `json:"ratio"`
+	}
+
+	ratios := []ratioResult{}
+
 	for _, def := range defs {
 		runner := indexer.NewRunner(def, indexer.RunnerOpts{
-			Config: conf,
+			Config:     conf,
+			SessionDir: sessionDir(),
 		})
 
 		ratio, err := runner.Ratio()
@@ -555,8 +1059,123 @@ func runRatiosCommand() error {
 			return fmt.Errorf("Failed to get ratio for %s: %v", def.Site, err)
 		}
 
+		if outputJSON() {
+			ratios = append(ratios, ratioResult{def.Site, ratio})
+			continue
+		}
+
 		fmt.Printf("Ratio for %s is %v\n", def.Site, ratio)
 	}
 
+	if outputJSON() {
+		return printJSON(ratios)
+	}
 	return nil
 }
+
+func configureUsersCommand(app *kingpin.Application) {
+	var name, passphrase, role, languages string
+
+	cmd := app.Command("users", "Manage the users that can log into the web interface")
+
+	add := cmd.Command("add", "Add or update a user")
+	add.Arg("name", "The name of the user").
+		Required().
+		StringVar(&name)
+
+	add.Flag("passphrase", "The passphrase the user logs in with").
+		Short('p').
+		Required().
+		StringVar(&passphrase)
+
+	add.Flag("role", "Admins can manage indexers, readonly users can only search").
+		Default(server.RoleReadOnly).
+		EnumVar(&role, server.RoleAdmin, server.RoleReadOnly)
+
+	add.Flag("languages", "Filter search results with the user's api key to these languages, like en,fr").
+		StringVar(&languages)
+
+	configureGlobalFlags(add)
+	add.Action(func(c *kingpin.ParseContext) error {
+		applyGlobalFlags()
+		return addUserCommand(name, passphrase, role, languages)
+	})
+
+	list := cmd.Command("list", "List the users that are configured")
+
+	configureGlobalFlags(list)
+	list.Action(func(c *kingpin.ParseContext) error {
+		applyGlobalFlags()
+		return listUsersCommand()
+	})
+}
+
+func addUserCommand(name, passphrase, role, languages string) error {
+	conf, err := newConfig()
+	if err != nil {
+		return err
+	}
+
+	u, err := server.SetUser(conf, name, passphrase, role)
+	if err != nil {
+		return err
+	}
+
+	if languages != "" {
+		if err := server.SetUserLanguages(conf, name, languages); err != nil {
+			return err
+		}
+		if u.Languages, err = torznab.ParseLanguages(languages); err != nil {
+			return err
+		}
+	}
+
+	if outputJSON() {
+		return printJSON(newUserView(*u))
+	}
+
+	fmt.Printf("Saved user %s with role %s, api key is %x\n", u.Name, u.Role, u.APIKey)
+	return nil
+}
+
+func listUsersCommand() error {
+	conf, err := newConfig()
+	if err != nil {
+		return err
+	}
+
+	users, err := server.LoadUsers(conf)
+	if err != nil {
+		return err
+	}
+
+	if outputJSON() {
+		views := []userView{}
+		for _, u := range users {
+			views = append(views, newUserView(*u))
+		}
+		return printJSON(views)
+	}
+
+	for _, u := range users {
+		fmt.Printf("%s\t%s\t%x\t%s\n", u.Name, u.Role, u.APIKey, strings.Join(u.Languages, ","))
+	}
+
+	return nil
+}
+
+// userView is a user for --output json, with the api key in hex like the text output
+type userView struct {
+	Name      string   `json:"name"`
+	Role      string   `json:"role"`
+	APIKey    string   `json:"apiKey"`
+	Languages []string `json:"languages"`
+}
+
+func newUserView(u server.User) userView {
+	langs := u.Languages
+	if langs == nil {
+		langs = []string{}
+	}
+	return userView{Name: u.Name, Role: u.Role, APIKey: fmt.Sprintf("%x", u.APIKey), Languages: langs}
+}
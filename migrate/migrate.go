@@ -0,0 +1,153 @@
+// Package migrate upgrades the config and data store of an existing install when the format
+// they're kept in changes, so that upgrading cardigann never strands a working setup.
+package migrate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cardigann/cardigann/config"
+	"github.com/cardigann/cardigann/store"
+)
+
+const (
+	versionBucket = "migrations"
+	versionKey    = "version"
+)
+
+// Migration changes the config or data store from the format of the version before it to the
+// format of Version
+type Migration struct {
+	Version     int
+	Description string
+	Migrate     func(conf config.Config, st *store.Store) error
+}
+
+// Migrations are all of the migrations in order of version. Add new ones to the end, and never
+// change or remove one that has been released
+var Migrations = []Migration{
+	{
+		Version:     1,
+		Description: `Replace "enabled": "ok" from old configs with "enabled": "true"`,
+		Migrate:     replaceEnabledOK,
+	},
+}
+
+// Latest returns the version that the migrations bring an install up to
+func Latest(migrations []Migration) int {
+	if len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+// Migrator brings an install's config and data store up to date
+type Migrator struct {
+	Config     config.Config
+	Store      *store.Store
+	Migrations []Migration
+
+	// Backup is called once before any migrations are applied, and should return where it
+	// backed things up to. Nothing is migrated if it fails
+	Backup func() (string, error)
+}
+
+// Version returns the version the install was last migrated to. An install that has never been
+// migrated is at version 0, unless it has no config yet, in which case it's new and is already
+// in the latest format
+func (m Migrator) Version() (int, error) {
+	var v int
+	ok, err := m.Store.Get(versionBucket, versionKey, &v)
+	if err != nil || ok {
+		return v, err
+	}
+
+	sections, err := m.Config.Sections()
+	if err != nil {
+		return 0, err
+	}
+
+	if len(sections) == 0 {
+		return Latest(m.Migrations), nil
+	}
+
+	return 0, nil
+}
+
+// Pending returns the migrations that haven't been applied yet
+func (m Migrator) Pending() ([]Migration, error) {
+	v, err := m.Version()
+	if err != nil {
+		return nil, err
+	}
+
+	pending := []Migration{}
+	for _, mig := range m.Migrations {
+		if mig.Version > v {
+			pending = append(pending, mig)
+		}
+	}
+
+	return pending, nil
+}
+
+// Run applies the pending migrations in order, recording the version after each one so that an
+// install is never migrated twice. It returns the migrations that were applied, and where the
+// install was backed up to before them
+func (m Migrator) Run() ([]Migration, string, error) {
+	pending, err := m.Pending()
+	if err != nil {
+		return nil, "", err
+	}
+
+	var backupPath string
+	if len(pending) > 0 && m.Backup != nil {
+		if backupPath, err = m.Backup(); err != nil {
+			return nil, "", fmt.Errorf("Failed to back up before migrating: %v", err)
+		}
+	}
+
+	applied := []Migration{}
+	for _, mig := range pending {
+		if err := mig.Migrate(m.Config, m.Store); err != nil {
+			return applied, backupPath, fmt.Errorf("Migration %d (%s) failed: %v", mig.Version, mig.Description, err)
+		}
+		if err := m.Store.Put(versionBucket, versionKey, mig.Version); err != nil {
+			return applied, backupPath, err
+		}
+		applied = append(applied, mig)
+	}
+
+	// a new install still needs its version recorded, or it would look unmigrated once it has
+	// a config
+	if len(pending) == 0 {
+		if ok, err := m.Store.Get(versionBucket, versionKey, new(int)); err == nil && !ok {
+			return applied, backupPath, m.Store.Put(versionBucket, versionKey, Latest(m.Migrations))
+		}
+	}
+
+	return applied, backupPath, nil
+}
+
+// replaceEnabledOK rewrites the "ok" that very old versions used for enabled indexers, so that
+// it's only true or false from here on
+func replaceEnabledOK(conf config.Config, st *store.Store) error {
+	sections, err := conf.Sections()
+	if err != nil {
+		return err
+	}
+
+	for _, section := range sections {
+		val, ok, err := conf.Get(section, "enabled")
+		if err != nil {
+			return err
+		}
+		if ok && strings.ToLower(val) == "ok" {
+			if err := conf.Set(section, "enabled", "true"); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
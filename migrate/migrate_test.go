@@ -0,0 +1,104 @@
+package migrate
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cardigann/cardigann/config"
+	"github.com/cardigann/cardigann/store"
+)
+
+func newTestMigrator(t *testing.T) (Migrator, func()) {
+	dir, err := ioutil.TempDir("", "migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf, err := config.NewJSONConfig(filepath.Join(dir, "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := store.Open(filepath.Join(dir, "data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return Migrator{Config: conf, Store: st, Migrations: Migrations}, func() { os.RemoveAll(dir) }
+}
+
+func TestMigratorRun(t *testing.T) {
+	m, cleanup := newTestMigrator(t)
+	defer cleanup()
+
+	m.Config.Set("llamas", "enabled", "ok")
+	m.Config.Set("alpacas", "enabled", "false")
+
+	backups := 0
+	m.Backup = func() (string, error) {
+		backups++
+		return "backup.tar.gz", nil
+	}
+
+	applied, backupPath, err := m.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(applied) != len(Migrations) || backups != 1 || backupPath != "backup.tar.gz" {
+		t.Fatalf("Expected all migrations after a backup, got %d after %d backups", len(applied), backups)
+	}
+
+	if v, _, _ := m.Config.Get("llamas", "enabled"); v != "true" {
+		t.Fatalf("Expected enabled to be migrated to true, got %q", v)
+	}
+
+	if v, _, _ := m.Config.Get("alpacas", "enabled"); v != "false" {
+		t.Fatalf("Expected enabled to stay false, got %q", v)
+	}
+
+	if applied, _, err = m.Run(); err != nil || len(applied) != 0 || backups != 1 {
+		t.Fatalf("Expected nothing to be migrated twice, got %d migrations and %d backups", len(applied), backups)
+	}
+}
+
+func TestMigratorNewInstall(t *testing.T) {
+	m, cleanup := newTestMigrator(t)
+	defer cleanup()
+
+	m.Backup = func() (string, error) {
+		t.Fatal("Expected a new install not to be backed up")
+		return "", nil
+	}
+
+	if applied, _, err := m.Run(); err != nil || len(applied) != 0 {
+		t.Fatalf("Expected nothing to be migrated for a new install, got %d, %v", len(applied), err)
+	}
+
+	m.Config.Set("llamas", "enabled", "ok")
+
+	if v, err := m.Version(); err != nil || v != Latest(Migrations) {
+		t.Fatalf("Expected a new install to stay at the latest version once it has a config, got %d", v)
+	}
+}
+
+func TestMigratorFailedBackup(t *testing.T) {
+	m, cleanup := newTestMigrator(t)
+	defer cleanup()
+
+	m.Config.Set("llamas", "enabled", "ok")
+	m.Backup = func() (string, error) {
+		return "", errors.New("disk full")
+	}
+
+	if _, _, err := m.Run(); err == nil {
+		t.Fatal("Expected an error when the backup fails")
+	}
+
+	if v, _, _ := m.Config.Get("llamas", "enabled"); v != "ok" {
+		t.Fatalf("Expected nothing to be migrated without a backup, got %q", v)
+	}
+}
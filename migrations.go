@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cardigann/cardigann/backup"
+	"github.com/cardigann/cardigann/config"
+	"github.com/cardigann/cardigann/indexer"
+	"github.com/cardigann/cardigann/migrate"
+	"github.com/cardigann/cardigann/store"
+)
+
+// migrationBackupDir is where the config and data are backed up before migrating them when no
+// backupdir is configured, it's next to the config file
+const migrationBackupDir = "backups"
+
+// runMigrations brings the config and data store up to date with this version, after backing
+// them up so that the backup can be restored to go back to an older version. The config of
+// indexers that have been replaced by another definition is moved to it
+func runMigrations(conf config.Config) error {
+	st, err := store.Open(config.GetDataPath(""))
+	if err != nil {
+		return err
+	}
+
+	m := migrate.Migrator{
+		Config:     conf,
+		Store:      st,
+		Migrations: migrate.Migrations,
+		Backup: func() (string, error) {
+			return migrationBackup(conf)
+		},
+	}
+
+	applied, backupPath, err := m.Run()
+	for _, mig := range applied {
+		log.WithFields(logrus.Fields{"version": mig.Version}).Info("Migrated: " + mig.Description)
+	}
+
+	if backupPath != "" {
+		log.WithField("file", backupPath).Info("Backed up before migrating, restore it with cardigann backup restore to go back")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// indexers that have been renamed or merged into another keep their config, which is
+	// backed up first like a migration if there wasn't one to do
+	replaced, err := indexer.ReplacedConfig(conf, indexer.DefaultDefinitionLoader)
+	if err != nil {
+		return err
+	}
+
+	if len(replaced) > 0 && backupPath == "" {
+		if backupPath, err = migrationBackup(conf); err != nil {
+			return fmt.Errorf("Failed to back up before moving replaced config: %v", err)
+		}
+		log.WithField("file", backupPath).Info("Backed up before moving replaced config, restore it with cardigann backup restore to go back")
+	}
+
+	moved, err := indexer.MoveReplacedConfig(conf, indexer.DefaultDefinitionLoader)
+	for _, alias := range moved {
+		log.WithFields(logrus.Fields{"indexer": alias.Key, "replacement": alias.Target}).
+			Info("Moved config to the indexer that replaces it")
+	}
+
+	return err
+}
+
+func migrationBackup(conf config.Config) (string, error) {
+	settings, err := backup.LoadSettings(conf)
+	if err != nil {
+		return "", err
+	}
+
+	sources, err := backup.DefaultSources()
+	if err != nil {
+		return "", err
+	}
+
+	if settings.Dir == "" {
+		configPath, err := config.GetConfigPath()
+		if err != nil {
+			return "", err
+		}
+		settings.Dir = filepath.Join(filepath.Dir(configPath), migrationBackupDir)
+	}
+
+	return backup.Create(settings.Dir, sources, time.Now())
+}
@@ -0,0 +1,46 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	now := time.Date(2017, time.March, 10, 10, 30, 15, 0, time.UTC)
+
+	for idx, example := range []struct {
+		spec     string
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2017, time.March, 10, 10, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2017, time.March, 10, 10, 45, 0, 0, time.UTC)},
+		{"0 * * * *", time.Date(2017, time.March, 10, 11, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2017, time.March, 10, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2017, time.March, 11, 0, 0, 0, 0, time.UTC)},
+		{"5 4 * * 1-5", time.Date(2017, time.March, 13, 4, 5, 0, 0, time.UTC)},
+		{"0 2,14 1 * *", time.Date(2017, time.April, 1, 2, 0, 0, 0, time.UTC)},
+		{"@every 90m", time.Date(2017, time.March, 10, 12, 0, 15, 0, time.UTC)},
+	} {
+		s, err := ParseSchedule(example.spec)
+		if err != nil {
+			t.Fatalf("Row #%d had an unexpected error: %s", idx+1, err.Error())
+		}
+		if next := s.Next(now); !next.Equal(example.expected) {
+			t.Fatalf("Row #%d was expecting %s, got %s", idx+1, example.expected, next)
+		}
+	}
+}
+
+func TestScheduleInvalid(t *testing.T) {
+	for idx, spec := range []string{
+		"* * * *",
+		"60 * * * *",
+		"*/0 * * * *",
+		"a b c d e",
+		"@every 10s",
+	} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Fatalf("Row #%d expected %q to fail to parse", idx+1, spec)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/cardigann/cardigann/config"
+	"github.com/cardigann/cardigann/torznab"
+)
+
+const (
+	jobSectionPrefix = "job:"
+)
+
+// Job is a search that is run on a schedule, with the results pushed to a target
+type Job struct {
+	Name      string   `json:"name"`
+	Schedule  string   `json:"schedule"`
+	Query     string   `json:"query"`
+	Indexers  []string `json:"indexers"`
+	Target    string   `json:"target"`
+	Retention string   `json:"retention,omitempty"`
+	Enabled   bool     `json:"enabled"`
+
+	// DryRun jobs log and record what they would push without downloading or pushing anything
+	DryRun bool `json:"dryrun"`
+}
+
+// Validate checks that the schedule, query and target of the job can be parsed
+func (j Job) Validate() error {
+	if j.Name == "" {
+		return errors.New("A job must have a name")
+	}
+
+	if _, err := ParseSchedule(j.Schedule); err != nil {
+		return err
+	}
+
+	if _, err := j.ParseQuery(); err != nil {
+		return err
+	}
+
+	if len(j.Indexers) == 0 {
+		return errors.New("A job must have at least one indexer")
+	}
+
+	if _, err := ParseTarget(j.Target); err != nil {
+		return err
+	}
+
+	if _, err := ParseRetention(j.Retention); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ParseQuery parses the job's query, which is in the same format as a torznab query string
+func (j Job) ParseQuery() (torznab.Query, error) {
+	vals, err := url.ParseQuery(j.Query)
+	if err != nil {
+		return torznab.Query{}, fmt.Errorf("Invalid query %q: %v", j.Query, err)
+	}
+	return torznab.ParseQuery(vals)
+}
+
+// LoadJobs returns the jobs defined in the config, sorted by name
+func LoadJobs(conf config.Config) ([]Job, error) {
+	sections, err := conf.Sections()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(sections)
+
+	jobs := []Job{}
+	for _, section := range sections {
+		if !strings.HasPrefix(section, jobSectionPrefix) {
+			continue
+		}
+
+		vals, err := conf.Section(section)
+		if err != nil {
+			return nil, err
+		}
+
+		jobs = append(jobs, Job{
+			Name:      strings.TrimPrefix(section, jobSectionPrefix),
+			Schedule:  vals["schedule"],
+			Query:     vals["query"],
+			Indexers:  splitList(vals["indexers"]),
+			Target:    vals["target"],
+			Retention: vals["retention"],
+			Enabled:   config.IsSectionEnabled(section, conf),
+			DryRun:    vals["dryrun"] == "true",
+		})
+	}
+
+	return jobs, nil
+}
+
+// LoadJob returns a single job from the config
+func LoadJob(conf config.Config, name string) (Job, error) {
+	jobs, err := LoadJobs(conf)
+	if err != nil {
+		return Job{}, err
+	}
+
+	for _, job := range jobs {
+		if job.Name == name {
+			return job, nil
+		}
+	}
+
+	return Job{}, fmt.Errorf("Unknown job %q", name)
+}
+
+// SaveJob validates a job and then writes it to the config
+func SaveJob(conf config.Config, job Job) error {
+	if err := job.Validate(); err != nil {
+		return err
+	}
+
+	section := jobSectionPrefix + job.Name
+
+	for key, val := range map[string]string{
+		"schedule":  job.Schedule,
+		"query":     job.Query,
+		"indexers":  strings.Join(job.Indexers, ","),
+		"target":    job.Target,
+		"retention": job.Retention,
+		"enabled":   fmt.Sprintf("%v", job.Enabled),
+		"dryrun":    fmt.Sprintf("%v", job.DryRun),
+	} {
+		if err := conf.Set(section, key, val); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteJob removes a job from the config
+func DeleteJob(conf config.Config, name string) error {
+	return conf.DeleteSection(jobSectionPrefix + name)
+}
+
+func splitList(s string) []string {
+	results := []string{}
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			results = append(results, item)
+		}
+	}
+	return results
+}
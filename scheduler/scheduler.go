@@ -0,0 +1,395 @@
+package scheduler
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cardigann/cardigann/config"
+	"github.com/cardigann/cardigann/indexer"
+	"github.com/cardigann/cardigann/logger"
+	"github.com/cardigann/cardigann/store"
+	"github.com/cardigann/cardigann/torznab"
+)
+
+const (
+	tickInterval = 30 * time.Second
+
+	// maxPlannedPushes is how many of the pushes that a dry run would have made are kept in its status
+	maxPlannedPushes = 100
+)
+
+// IndexerLookup returns an indexer for a key, including "aggregate"
+type IndexerLookup func(key string) (torznab.Indexer, error)
+
+// JobStatus is the outcome of the most recent run of a job
+type JobStatus struct {
+	LastRun time.Time `json:"lastrun,omitempty"`
+	NextRun time.Time `json:"nextrun,omitempty"`
+	Running bool      `json:"running"`
+	Pushed  int       `json:"pushed"`
+	Skipped int       `json:"skipped"`
+	Error   string    `json:"error,omitempty"`
+
+	// DryRun is set when the run was a dry run, in which case Pushed is how many releases would
+	// have been pushed and Planned is what pushing them would have done
+	DryRun  bool          `json:"dryrun,omitempty"`
+	Planned []PlannedPush `json:"planned,omitempty"`
+
+	// Quiet are the indexers that a scheduled run left out for being in their quiet hours
+	Quiet []string `json:"quiet,omitempty"`
+}
+
+// PlannedPush is a release that a dry run would have pushed, with the link that would have been
+// downloaded and what the target would have done with it
+type PlannedPush struct {
+	Indexer string `json:"indexer"`
+	Site    string `json:"site,omitempty"`
+	Title   string `json:"title"`
+	Fetch   string `json:"fetch,omitempty"`
+	Action  string `json:"action"`
+}
+
+// Release is a new release that a job found, Pushed is false for a dry run
+type Release struct {
+	Job     string
+	Indexer string
+	Item    torznab.ResultItem
+	Found   time.Time
+	Pushed  bool
+}
+
+// Scheduler runs the jobs defined in the config on their schedules
+type Scheduler struct {
+	conf      config.Config
+	lookup    IndexerLookup
+	logger    logrus.FieldLogger
+	seen      *seenDB
+	onRelease func(Release)
+
+	mu     sync.Mutex
+	next   map[string]time.Time
+	status map[string]JobStatus
+	stop   chan struct{}
+}
+
+// New returns a scheduler for the jobs in the config, which uses lookup to find indexers to search.
+// Releases that have already been pushed are remembered in st, which may be nil
+func New(conf config.Config, st *store.Store, lookup IndexerLookup) *Scheduler {
+	return &Scheduler{
+		conf:   conf,
+		lookup: lookup,
+		seen:   &seenDB{store: st},
+		logger: logger.Logger.WithFields(logrus.Fields{"component": "scheduler"}),
+		next:   map[string]time.Time{},
+		status: map[string]JobStatus{},
+	}
+}
+
+// OnRelease sets a func to be called with each new release that a job finds, whether it's pushed
+// or only planned in a dry run
+func (s *Scheduler) OnRelease(f func(Release)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.onRelease = f
+}
+
+func (s *Scheduler) notify(r Release) {
+	s.mu.Lock()
+	f := s.onRelease
+	s.mu.Unlock()
+
+	if f != nil {
+		f(r)
+	}
+}
+
+// Start runs the scheduler in the background until Stop is called
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stop != nil {
+		return
+	}
+
+	s.stop = make(chan struct{})
+	go s.loop(s.stop)
+}
+
+// Stop stops the scheduler, jobs that are already running will complete
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+func (s *Scheduler) loop(stop chan struct{}) {
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+
+	s.tick(time.Now())
+
+	for {
+		select {
+		case now := <-ticker.C:
+			s.tick(now)
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (s *Scheduler) tick(now time.Time) {
+	jobs, err := LoadJobs(s.conf)
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to load jobs")
+		return
+	}
+
+	for _, job := range jobs {
+		if !job.Enabled {
+			continue
+		}
+
+		sched, err := ParseSchedule(job.Schedule)
+		if err != nil {
+			s.logger.WithError(err).Warnf("Job %q has an invalid schedule", job.Name)
+			continue
+		}
+
+		// the schedule is part of the key, so changing it resets when the job is next due
+		key := job.Name + "\x00" + job.Schedule
+
+		s.mu.Lock()
+		next, ok := s.next[key]
+		if !ok {
+			next = sched.Next(now)
+			s.next[key] = next
+		}
+		due := !now.Before(next)
+		if due {
+			s.next[key] = sched.Next(now)
+		}
+		s.mu.Unlock()
+
+		if due {
+			go func(job Job) {
+				if err := s.start(job, true); err != nil {
+					s.logger.WithError(err).Warnf("Job %q failed", job.Name)
+				}
+			}(job)
+		}
+	}
+}
+
+// Status returns the status of a job, including when it is next due
+func (s *Scheduler) Status(job Job) JobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := s.status[job.Name]
+	if next, ok := s.next[job.Name+"\x00"+job.Schedule]; ok && job.Enabled {
+		status.NextRun = next
+	}
+
+	return status
+}
+
+func (s *Scheduler) setStatus(name string, status JobStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.status[name] = status
+}
+
+// Run runs a job immediately, searching each of its indexers and pushing results to its target.
+// Unlike scheduled runs, it searches indexers that are in their quiet hours unless they're strict
+func (s *Scheduler) Run(job Job) error {
+	return s.start(job, false)
+}
+
+// DryRun runs a job once as a dry run and returns its status. That isn't kept as the job's
+// status, which still shows how the job last ran
+func (s *Scheduler) DryRun(job Job) (JobStatus, error) {
+	key := job.Name + "\x00dryrun"
+	if !s.claim(key) {
+		return JobStatus{}, fmt.Errorf("Job %q is already being dry run", job.Name)
+	}
+
+	job.DryRun = true
+	status, err := s.execute(job, false)
+
+	s.mu.Lock()
+	delete(s.status, key)
+	s.mu.Unlock()
+
+	return status, err
+}
+
+// start runs a job, its searches are automatic when the job is run on its schedule
+func (s *Scheduler) start(job Job, automatic bool) error {
+	if !s.claim(job.Name) {
+		return fmt.Errorf("Job %q is already running", job.Name)
+	}
+
+	status, err := s.execute(job, automatic)
+	s.setStatus(job.Name, status)
+
+	return err
+}
+
+// claim marks the status under key as running, unless it already is
+func (s *Scheduler) claim(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.status[key].Running {
+		return false
+	}
+	s.status[key] = JobStatus{Running: true, LastRun: time.Now()}
+	return true
+}
+
+// execute runs a job and returns its status
+func (s *Scheduler) execute(job Job, automatic bool) (JobStatus, error) {
+	status := JobStatus{DryRun: job.DryRun}
+	err := s.run(job, &status, automatic)
+
+	status.LastRun = time.Now()
+	if err != nil {
+		status.Error = err.Error()
+	}
+
+	return status, err
+}
+
+// Forget clears the releases that a job has seen, so they will be pushed again
+func (s *Scheduler) Forget(name string) error {
+	return s.seen.forget(name)
+}
+
+func (s *Scheduler) run(job Job, status *JobStatus, automatic bool) error {
+	jobLogger := s.logger.WithFields(logrus.Fields{"job": job.Name})
+
+	query, err := job.ParseQuery()
+	if err != nil {
+		return err
+	}
+	query.Automatic = automatic
+
+	// results are in the languages the query asks for, or otherwise the ones in the global config
+	filter := query
+	if len(filter.Languages) == 0 {
+		filter.Languages = indexer.ConfiguredLanguages(s.conf)
+	}
+
+	target, err := ParseTarget(job.Target)
+	if err != nil {
+		return err
+	}
+
+	retention, err := ParseRetention(job.Retention)
+	if err != nil {
+		return err
+	}
+
+	seen, err := s.seen.load(job.Name, retention)
+	if err != nil {
+		return err
+	}
+
+	jobLogger.
+		WithFields(logrus.Fields{"query": query.Encode(), "indexers": job.Indexers, "target": target.String(), "dryrun": job.DryRun}).
+		Info("Running job")
+
+	for _, key := range job.Indexers {
+		idx, err := s.lookup(key)
+		if err != nil {
+			return err
+		}
+
+		// an aggregate returns what it has alongside an error when some indexers are too slow,
+		// and an indexer in its quiet hours returns results it cached earlier if it has them
+		items, err := idx.Search(query)
+		if indexer.IsQuietHours(err) && len(items) == 0 {
+			jobLogger.WithError(err).Infof("Leaving out %s", key)
+			status.Quiet = append(status.Quiet, key)
+			continue
+		} else if err != nil && len(items) == 0 {
+			return fmt.Errorf("Searching %s failed: %v", key, err)
+		} else if err != nil {
+			jobLogger.WithError(err).Warnf("Searching %s returned partial results", key)
+		}
+
+		items = torznab.Filter(items, filter)
+
+		for _, item := range items {
+			if seen.contains(item) {
+				status.Skipped++
+				continue
+			}
+
+			// a dry run only remembers releases until the end of the run, so that it skips the
+			// same ones that a real run would
+			if job.DryRun {
+				s.planPush(jobLogger, status, key, item, target)
+				s.notify(Release{Job: job.Name, Indexer: key, Item: item, Found: time.Now()})
+				seen.add(item, time.Now())
+				continue
+			}
+
+			// results from an aggregate need to be downloaded from the indexer they came from
+			source := idx
+			if item.Site != "" && item.Site != key {
+				if source, err = s.lookup(item.Site); err != nil {
+					return err
+				}
+			}
+
+			if err := target.Push(item, source); err != nil {
+				return fmt.Errorf("Pushing %q to %s failed: %v", item.Title, target, err)
+			}
+
+			jobLogger.WithFields(logrus.Fields{"title": item.Title, "site": item.Site}).Info("Pushed release")
+			status.Pushed++
+			s.notify(Release{Job: job.Name, Indexer: key, Item: item, Found: time.Now(), Pushed: true})
+
+			// save after every push, so a failure part way through doesn't cause duplicates
+			seen.add(item, time.Now())
+			if err := s.seen.save(job.Name, seen); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// planPush logs and records what pushing a release would do, instead of pushing it
+func (s *Scheduler) planPush(jobLogger logrus.FieldLogger, status *JobStatus, key string, item torznab.ResultItem, target Target) {
+	plan := PlannedPush{
+		Indexer: key,
+		Site:    item.Site,
+		Title:   item.Title,
+		Action:  target.Plan(item),
+	}
+	if !isMagnet(item.Link) {
+		plan.Fetch = item.Link
+	}
+
+	jobLogger.
+		WithFields(logrus.Fields{"title": plan.Title, "site": plan.Site, "fetch": plan.Fetch, "action": plan.Action}).
+		Info("Dry run, would push release")
+
+	status.Pushed++
+	if len(status.Planned) < maxPlannedPushes {
+		status.Planned = append(status.Planned, plan)
+	}
+}
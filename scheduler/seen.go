@@ -0,0 +1,156 @@
+package scheduler
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cardigann/cardigann/store"
+	"github.com/cardigann/cardigann/torznab"
+)
+
+const (
+	seenBucket       = "seen"
+	defaultRetention = 30 * 24 * time.Hour
+)
+
+// ParseRetention parses how long releases are remembered for, either as a
+// go duration like "72h" or as a number of days like "30d"
+func ParseRetention(s string) (time.Duration, error) {
+	if s == "" {
+		return defaultRetention, nil
+	}
+
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil || days <= 0 {
+			return 0, fmt.Errorf("Invalid retention %q", s)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("Invalid retention %q", s)
+	}
+
+	return d, nil
+}
+
+// releaseKeys returns the identifiers a release is remembered by. The infohash is
+// preferred as it's the same across indexers, but not every indexer exposes one
+func releaseKeys(item torznab.ResultItem) []string {
+	keys := []string{}
+
+	if hash := infoHash(item.Link); hash != "" {
+		keys = append(keys, "btih:"+hash)
+	}
+	if item.GUID != "" {
+		keys = append(keys, "guid:"+item.GUID)
+	} else if item.Link != "" && !isMagnet(item.Link) {
+		keys = append(keys, "link:"+item.Link)
+	}
+
+	return keys
+}
+
+func infoHash(link string) string {
+	if !isMagnet(link) {
+		return ""
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+
+	for _, xt := range u.Query()["xt"] {
+		if strings.HasPrefix(xt, "urn:btih:") {
+			return strings.ToLower(strings.TrimPrefix(xt, "urn:btih:"))
+		}
+	}
+
+	return ""
+}
+
+// seenReleases tracks when the releases pushed by a job were first seen
+type seenReleases map[string]time.Time
+
+func (s seenReleases) contains(item torznab.ResultItem) bool {
+	for _, key := range releaseKeys(item) {
+		if _, ok := s[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (s seenReleases) add(item torznab.ResultItem, now time.Time) {
+	for _, key := range releaseKeys(item) {
+		s[key] = now
+	}
+}
+
+func (s seenReleases) expire(before time.Time) {
+	for key, t := range s {
+		if t.Before(before) {
+			delete(s, key)
+		}
+	}
+}
+
+// seenDB persists the releases seen by each job so that restarts don't cause them to be pushed again.
+// Without a store, releases are only remembered until the process exits
+type seenDB struct {
+	store  *store.Store
+	mu     sync.Mutex
+	memory map[string]seenReleases
+}
+
+func (db *seenDB) load(job string, retention time.Duration) (seenReleases, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	seen := seenReleases{}
+
+	if db.store == nil {
+		for k, v := range db.memory[job] {
+			seen[k] = v
+		}
+	} else if _, err := db.store.Get(seenBucket, job, &seen); err != nil {
+		return nil, err
+	}
+
+	seen.expire(time.Now().Add(-retention))
+	return seen, nil
+}
+
+func (db *seenDB) save(job string, seen seenReleases) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.store == nil {
+		if db.memory == nil {
+			db.memory = map[string]seenReleases{}
+		}
+		db.memory[job] = seen
+		return nil
+	}
+
+	return db.store.Put(seenBucket, job, seen)
+}
+
+func (db *seenDB) forget(job string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.store == nil {
+		delete(db.memory, job)
+		return nil
+	}
+
+	return db.store.Delete(seenBucket, job)
+}
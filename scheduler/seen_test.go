@@ -0,0 +1,87 @@
+package scheduler
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/cardigann/cardigann/store"
+	"github.com/cardigann/cardigann/torznab"
+)
+
+func TestSeenReleasesSurviveReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "seen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	st, err := store.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	magnet := torznab.ResultItem{Link: "magnet:?xt=urn:btih:ABCDEF&dn=llamas", GUID: "1"}
+	sameHash := torznab.ResultItem{Link: "magnet:?xt=urn:btih:abcdef", GUID: "other-site-2"}
+	torrent := torznab.ResultItem{Link: "http://example.org/download/3", GUID: "3"}
+	unseen := torznab.ResultItem{Link: "http://example.org/download/4", GUID: "4"}
+
+	db := &seenDB{store: st}
+	seen, err := db.load("job", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen.add(magnet, time.Now())
+	seen.add(torrent, time.Now().Add(-2*time.Hour))
+
+	if err = db.save("job", seen); err != nil {
+		t.Fatal(err)
+	}
+
+	// a new db simulates a restart
+	seen, err = (&seenDB{store: st}).load("job", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for idx, example := range []struct {
+		item     torznab.ResultItem
+		expected bool
+	}{
+		{magnet, true},
+		{sameHash, true},
+		{torrent, false},
+		{unseen, false},
+	} {
+		if got := seen.contains(example.item); got != example.expected {
+			t.Errorf("Row #%d was expecting %v, got %v", idx+1, example.expected, got)
+		}
+	}
+}
+
+func TestParseRetention(t *testing.T) {
+	for idx, example := range []struct {
+		spec     string
+		expected time.Duration
+	}{
+		{"", defaultRetention},
+		{"7d", 7 * 24 * time.Hour},
+		{"36h", 36 * time.Hour},
+	} {
+		d, err := ParseRetention(example.spec)
+		if err != nil {
+			t.Fatalf("Row #%d had an unexpected error: %s", idx+1, err.Error())
+		}
+		if d != example.expected {
+			t.Fatalf("Row #%d was expecting %s, got %s", idx+1, example.expected, d)
+		}
+	}
+
+	for _, spec := range []string{"0d", "-1h", "forever"} {
+		if _, err := ParseRetention(spec); err == nil {
+			t.Errorf("Expected %q to be invalid", spec)
+		}
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !dev
+// +build !dev
+
+package server
+
+// useLocalAssets is whether the web ui is served from web/build on disk rather than the copy
+// embedded in static.go, which is only the case in builds with the dev tag
+const useLocalAssets = false
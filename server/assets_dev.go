@@ -0,0 +1,8 @@
+//go:build dev
+// +build dev
+
+package server
+
+// useLocalAssets serves the web ui from where static.go was generated from, so that a rebuilt
+// frontend shows up without regenerating static.go and rebuilding the binary
+const useLocalAssets = true
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cardigann/cardigann/config"
+	"github.com/cardigann/cardigann/store"
+)
+
+const (
+	auditLogName = "audit"
+
+	// defaultAuditLogSize is how many audit events are kept unless auditlogsize says otherwise,
+	// and auditTrimInterval how many are recorded between trims of the log
+	defaultAuditLogSize = 10000
+	auditTrimInterval   = 100
+
+	auditActionConfig            = "config"
+	auditActionEnable            = "enable"
+	auditActionDisable           = "disable"
+	auditActionGrab              = "grab"
+	auditActionJob               = "job"
+	auditActionDeleteJob         = "deletejob"
+	auditActionLogging           = "logging"
+	auditActionSavedSearch       = "search"
+	auditActionDeleteSavedSearch = "deletesearch"
+	auditActionResetLayout       = "resetlayout"
+	auditActionDeleteGrab        = "deletegrab"
+)
+
+// auditEvent records who did what to the configuration, or which torrents were grabbed
+type auditEvent struct {
+	Time    time.Time         `json:"time"`
+	User    string            `json:"user"`
+	Action  string            `json:"action"`
+	Indexer string            `json:"indexer,omitempty"`
+	Remote  string            `json:"remote,omitempty"`
+	Request string            `json:"request,omitempty"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+func (h *handler) audit(r *http.Request, user, action, indexer string, details map[string]string) {
+	ev := auditEvent{
+		Time:    time.Now(),
+		User:    user,
+		Action:  action,
+		Indexer: indexer,
+		Remote:  r.RemoteAddr,
+		Request: requestID(r),
+		Details: details,
+	}
+
+	log.WithFields(logrus.Fields{
+		"user":    ev.User,
+		"action":  ev.Action,
+		"indexer": ev.Indexer,
+		"request": ev.Request,
+	}).Debug("Recording audit event")
+
+	if h.Params.Store == nil {
+		return
+	}
+
+	if err := h.Params.Store.Append(auditLogName, ev); err != nil {
+		log.WithError(err).Warn("Failed to write audit log")
+		return
+	}
+
+	if atomic.AddInt32(&h.auditAppends, 1)%auditTrimInterval == 0 {
+		if err := h.Params.Store.TrimLog(auditLogName, h.auditLogSize()); err != nil {
+			log.WithError(err).Warn("Failed to trim audit log")
+		}
+	}
+}
+
+// auditLogSize returns how many audit events are kept, from auditlogsize
+func (h *handler) auditLogSize() int {
+	val, err := config.GetGlobalConfig("auditlogsize", "", h.Params.Config)
+	if err != nil || val == "" {
+		return defaultAuditLogSize
+	}
+
+	n, err := strconv.Atoi(val)
+	if err != nil || n < 1 {
+		log.Warnf("Ignoring invalid auditlogsize %q", val)
+		return defaultAuditLogSize
+	}
+
+	return n
+}
+
+// loadAuditEvents returns the most recent audit events first, up to limit unless it's zero. The
+// log is read from the end, so only the events that are returned are read
+func (h *handler) loadAuditEvents(limit int) ([]auditEvent, error) {
+	events := []auditEvent{}
+
+	if h.Params.Store == nil {
+		return events, nil
+	}
+
+	err := h.Params.Store.ReadLogReverse(auditLogName, func(raw json.RawMessage) error {
+		var ev auditEvent
+		if err := json.Unmarshal(raw, &ev); err != nil {
+			return err
+		}
+		events = append(events, ev)
+		if limit > 0 && len(events) >= limit {
+			return store.ErrStopReading
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+func (h *handler) getAuditHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.authorizeRequest(w, r, RoleAdmin); !ok {
+		return
+	}
+
+	var limit int
+	if l := r.URL.Query().Get("limit"); l != "" {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil {
+			jsonError(w, "Invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	events, err := h.loadAuditEvents(limit)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if r.URL.Query().Get("download") != "" {
+		w.Header().Set("Content-Disposition", "attachment; filename=cardigann-audit.json")
+	}
+
+	jsonOutput(w, events)
+}
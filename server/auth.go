@@ -2,6 +2,7 @@ package server
 
 import (
 	"crypto/sha1"
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
 	"math/rand"
@@ -30,25 +31,53 @@ func jsonOutput(w http.ResponseWriter, v interface{}) {
 	w.Write(append(b, '\n'))
 }
 
+type authResponse struct {
+	Token    string `json:"token"`
+	User     string `json:"user,omitempty"`
+	Role     string `json:"role,omitempty"`
+	ReadOnly bool   `json:"readOnly,omitempty"`
+	Offline  bool   `json:"offline,omitempty"`
+}
+
+func (h *handler) newAuthResponse(u *User) authResponse {
+	return authResponse{
+		Token:    fmt.Sprintf("%x", u.APIKey),
+		User:     u.Name,
+		Role:     u.Role,
+		ReadOnly: h.Params.ReadOnly,
+		Offline:  h.Params.Offline,
+	}
+}
+
 func (h *handler) getAuthHandler(w http.ResponseWriter, r *http.Request) {
-	var resp struct {
-		Token string `json:"token"`
+	if u, ok := h.requestUser(r); ok {
+		jsonOutput(w, h.newAuthResponse(u))
+		return
 	}
 
-	if h.Params.Passphrase == "" || h.checkRequestAuthorized(r) {
-		k, err := h.sharedKey()
+	users, err := LoadUsers(h.Params.Config)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// without a passphrase or users, everyone is an admin
+	if h.Params.Passphrase == "" && len(users) == 0 {
+		u, err := h.globalUser()
 		if err != nil {
 			jsonError(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		resp.Token = fmt.Sprintf("%x", k)
+		jsonOutput(w, h.newAuthResponse(u))
+		return
 	}
 
-	jsonOutput(w, resp)
+	jsonOutput(w, authResponse{ReadOnly: h.Params.ReadOnly, Offline: h.Params.Offline})
 }
 
 func (h *handler) postAuthHandler(w http.ResponseWriter, r *http.Request) {
 	var req struct {
+		Username   string `json:"username"`
 		Passphrase string `json:"passphrase"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -58,25 +87,47 @@ func (h *handler) postAuthHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer r.Body.Close()
 
-	if h.Params.Passphrase != req.Passphrase {
+	users, err := LoadUsers(h.Params.Config)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if req.Username != "" {
+		for _, u := range users {
+			if u.Name == req.Username && u.checkPassphrase(req.Passphrase) {
+				log.WithField("user", u.Name).Debug("User successfully authenticated")
+				jsonOutput(w, h.newAuthResponse(u))
+				return
+			}
+		}
+		log.WithField("user", req.Username).Info("Client provided username or password was incorrect")
+		jsonError(w, "Incorrect username or passphrase", http.StatusOK)
+		return
+	}
+
+	// without a global passphrase, only the users can log in once there are any
+	if h.Params.Passphrase == "" && len(users) > 0 {
+		log.Info("Client didn't provide a username")
+		jsonError(w, "Incorrect username or passphrase", http.StatusOK)
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(h.Params.Passphrase), []byte(req.Passphrase)) != 1 {
 		log.Info("Client provided password was incorrect")
 		jsonError(w, "Incorrect passphrase", http.StatusOK)
 		return
 	}
 
 	log.Debug("Client successfully authenticated")
-	k, err := h.sharedKey()
+	u, err := h.globalUser()
 	if err != nil {
 		log.WithError(err).Error("Generating shared key failed")
 		jsonError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	jsonOutput(w, struct {
-		Token string `json:"token"`
-	}{
-		fmt.Sprintf("%x", k),
-	})
+	jsonOutput(w, h.newAuthResponse(u))
 }
 
 func (h *handler) sharedKey() ([]byte, error) {
@@ -98,26 +149,74 @@ func (h *handler) sharedKey() ([]byte, error) {
 	return b, nil
 }
 
-func (h *handler) checkAPIKey(s string) (result bool) {
+// globalUser returns a user for the global api key, which always has the admin role
+func (h *handler) globalUser() (*User, error) {
 	k, err := h.sharedKey()
 	if err != nil {
-		return false
+		return nil, err
+	}
+	return &User{Name: "admin", Role: RoleAdmin, APIKey: k}, nil
+}
+
+// lookupAPIKey finds the user that an api key belongs to
+func (h *handler) lookupAPIKey(s string) (*User, bool) {
+	global, err := h.globalUser()
+	if err != nil {
+		return nil, false
+	}
+	if apiKeyEqual(s, global.APIKey) {
+		return global, true
+	}
+
+	users, err := LoadUsers(h.Params.Config)
+	if err != nil {
+		log.WithError(err).Warn("Failed to load users")
+		return nil, false
 	}
-	if s == fmt.Sprintf("%x", k) {
-		return true
+	for _, u := range users {
+		if apiKeyEqual(s, u.APIKey) {
+			return u, true
+		}
 	}
-	log.Printf("Incorrect api key %q, expected %x", s, k)
-	return false
+
+	log.Printf("Incorrect api key %q", s)
+	return nil, false
+}
+
+// apiKeyEqual compares an api key from a request with a user's in constant time
+func apiKeyEqual(s string, apiKey []byte) bool {
+	return subtle.ConstantTimeCompare([]byte(s), []byte(fmt.Sprintf("%x", apiKey))) == 1
 }
 
-func (h *handler) checkRequestAuthorized(r *http.Request) bool {
+func (h *handler) checkAPIKey(s string) (result bool) {
+	_, ok := h.lookupAPIKey(s)
+	return ok
+}
+
+// requestUser returns the user that a request is authenticated as
+func (h *handler) requestUser(r *http.Request) (*User, bool) {
 	if auth := r.Header.Get("Authorization"); auth != "" {
 		log.WithField("method", "header").Debug("Authenticating request")
-		return h.checkAPIKey(strings.TrimPrefix(auth, "apitoken "))
+		return h.lookupAPIKey(strings.TrimPrefix(auth, "apitoken "))
 	} else if apiKey := r.URL.Query().Get("apikey"); apiKey != "" {
 		log.WithField("method", "query-string").Debug("Authenticating request")
-		return h.checkAPIKey(apiKey)
+		return h.lookupAPIKey(apiKey)
 	}
 	log.Debug("Failed to authenticate request")
-	return false
+	return nil, false
+}
+
+// authorizeRequest checks that a request is authenticated with a user that has the given role, writing
+// an error to the response if not
+func (h *handler) authorizeRequest(w http.ResponseWriter, r *http.Request, role string) (*User, bool) {
+	u, ok := h.requestUser(r)
+	if !ok {
+		jsonError(w, "Not Authorized", http.StatusUnauthorized)
+		return nil, false
+	}
+	if role == RoleAdmin && !u.IsAdmin() {
+		jsonError(w, "Forbidden, requires the admin role", http.StatusForbidden)
+		return nil, false
+	}
+	return u, true
 }
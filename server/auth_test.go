@@ -0,0 +1,52 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cardigann/cardigann/config"
+)
+
+func postAuth(h *handler, body string) authResponse {
+	w := httptest.NewRecorder()
+	h.postAuthHandler(w, httptest.NewRequest("POST", "/xhr/auth", strings.NewReader(body)))
+
+	var resp authResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	return resp
+}
+
+func TestPostAuthHandler_EmptyPassphraseWithUsers(t *testing.T) {
+	conf := &config.ArrayConfig{}
+	if _, err := SetUser(conf, "llama", "secret", RoleReadOnly); err != nil {
+		t.Fatal(err)
+	}
+
+	h := &handler{Params: Params{Config: conf}}
+
+	if resp := postAuth(h, `{"passphrase":""}`); resp.Token != "" {
+		t.Fatalf("Expected an empty passphrase to be refused once there are users, got role %q", resp.Role)
+	}
+
+	if resp := postAuth(h, `{"username":"llama","passphrase":"secret"}`); resp.Role != RoleReadOnly {
+		t.Fatalf("Expected llama to log in as readonly, got %#v", resp)
+	}
+
+	if resp := postAuth(h, `{"username":"llama","passphrase":"wrong"}`); resp.Token != "" {
+		t.Fatal("Expected a wrong passphrase to be refused")
+	}
+}
+
+func TestPostAuthHandler_GlobalPassphrase(t *testing.T) {
+	h := &handler{Params: Params{Config: &config.ArrayConfig{}, Passphrase: "secret"}}
+
+	if resp := postAuth(h, `{"passphrase":"wrong"}`); resp.Token != "" {
+		t.Fatal("Expected a wrong passphrase to be refused")
+	}
+
+	if resp := postAuth(h, `{"passphrase":"secret"}`); resp.Role != RoleAdmin {
+		t.Fatalf("Expected the global passphrase to log in as admin, got %#v", resp)
+	}
+}
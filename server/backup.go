@@ -0,0 +1,57 @@
+package server
+
+import (
+	"time"
+
+	"github.com/cardigann/cardigann/backup"
+)
+
+// startBackups backs up the config, definitions and data store in the background, if a
+// backupdir is configured
+func (h *handler) startBackups() error {
+	settings, err := backup.LoadSettings(h.Params.Config)
+	if err != nil {
+		return err
+	}
+
+	if settings.Dir == "" {
+		log.Debug("Scheduled backups are disabled")
+		return nil
+	}
+
+	sources, err := backup.DefaultSources()
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for {
+			// carry on from the last backup rather than making one on every restart
+			if wait := settings.Interval - time.Since(backup.Latest(settings.Dir)); wait > 0 {
+				time.Sleep(wait)
+			}
+			runBackup(settings, sources)
+		}
+	}()
+
+	return nil
+}
+
+func runBackup(settings backup.Settings, sources []backup.Source) {
+	f, err := backup.Create(settings.Dir, sources, time.Now())
+	if err != nil {
+		log.WithError(err).Error("Backup failed")
+		// try again later rather than straight away
+		time.Sleep(time.Hour)
+		return
+	}
+	log.WithField("file", f).Info("Wrote backup")
+
+	removed, err := backup.Prune(settings.Dir, settings.Retention)
+	if err != nil {
+		log.WithError(err).Warn("Failed to remove old backups")
+	}
+	for _, old := range removed {
+		log.WithField("file", old).Debug("Removed old backup")
+	}
+}
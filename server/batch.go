@@ -0,0 +1,112 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cardigann/cardigann/torznab"
+	"github.com/gorilla/mux"
+)
+
+// maxBatchQueries is the most queries that can be sent in a single batch
+const maxBatchQueries = 100
+
+// batchRequest is a list of queries, each in the same format as a torznab query string
+type batchRequest struct {
+	Queries []string `json:"queries"`
+}
+
+type batchResult struct {
+	Query   string               `json:"query"`
+	Items   []torznab.ResultItem `json:"items"`
+	Warning string               `json:"warning,omitempty"`
+	Error   string               `json:"error,omitempty"`
+}
+
+type batchResponse struct {
+	Results []batchResult `json:"results"`
+}
+
+// batchHandler runs a list of searches against an indexer one after another, so they share its
+// session and rate limiting, and returns the results of each
+func (h *handler) batchHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.authorizeRequest(w, r, RoleReadOnly)
+	if !ok {
+		return
+	}
+
+	indexerID := mux.Vars(r)["indexer"]
+	indexer, err := h.lookupIndexer(indexerID)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	h.warnIfDeprecated(w, indexerID)
+
+	var req batchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if len(req.Queries) > maxBatchQueries {
+		jsonError(w, fmt.Sprintf("A batch can have at most %d queries", maxBatchQueries), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	queries := make([]torznab.Query, len(req.Queries))
+	for idx, q := range req.Queries {
+		vals, err := url.ParseQuery(q)
+		if err != nil {
+			jsonError(w, fmt.Sprintf("Invalid query %q: %v", q, err), http.StatusBadRequest)
+			return
+		}
+		if queries[idx], err = torznab.ParseQuery(vals); err != nil {
+			jsonError(w, fmt.Sprintf("Invalid query %q: %v", q, err), http.StatusBadRequest)
+			return
+		}
+		queries[idx].RequestID = requestID(r)
+	}
+
+	log.WithFields(logrus.Fields{
+		"indexer": indexerID,
+		"queries": len(queries),
+		"request": requestID(r),
+	}).Info("Running batch of searches")
+
+	resp := batchResponse{Results: []batchResult{}}
+	for idx, query := range queries {
+		result := batchResult{Query: req.Queries[idx], Items: []torznab.ResultItem{}}
+
+		items, err := indexer.Search(query)
+		h.recordStragglers(query, err)
+
+		switch {
+		case isSoftError(err):
+			result.Warning = err.Error()
+		case err != nil:
+			result.Error = err.Error()
+			resp.Results = append(resp.Results, result)
+			continue
+		}
+
+		if items != nil {
+			filter := query
+			filter.Languages = h.resultLanguages(query, user)
+			items = torznab.Filter(items, filter)
+			if result.Items, err = h.rewriteLinks(r, items, user); err != nil {
+				jsonError(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		resp.Results = append(resp.Results, result)
+	}
+
+	jsonOutput(w, resp)
+}
@@ -0,0 +1,218 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/cardigann/cardigann/config"
+	"github.com/cardigann/cardigann/indexer"
+	"github.com/cardigann/cardigann/torznab"
+)
+
+const (
+	// errorFeedBucket holds the recent failures of each indexer
+	errorFeedBucket = "errors"
+
+	defaultErrorFeedSize = 50
+)
+
+// The categories of failures in the error feed
+const (
+	errorCategoryLogin       = "login"
+	errorCategoryMaintenance = "maintenance"
+	errorCategoryThrottled   = "throttled"
+	errorCategoryBudget      = "budget"
+	errorCategoryCrash       = "crash"
+	errorCategoryLayout      = "layout"
+	errorCategoryTimeout     = "timeout"
+	errorCategoryNetwork     = "network"
+	errorCategoryOther       = "error"
+)
+
+// errorEvent is a search or download of an indexer that failed
+type errorEvent struct {
+	Time      time.Time `json:"time"`
+	Indexer   string    `json:"indexer"`
+	Operation string    `json:"operation"`
+	Category  string    `json:"category"`
+	Reason    string    `json:"reason,omitempty"`
+	Error     string    `json:"error"`
+	Query     string    `json:"query,omitempty"`
+	Request   string    `json:"request,omitempty"`
+}
+
+type errorEventsByTime []errorEvent
+
+func (slice errorEventsByTime) Len() int {
+	return len(slice)
+}
+
+func (slice errorEventsByTime) Less(i, j int) bool {
+	return slice[i].Time.After(slice[j].Time)
+}
+
+func (slice errorEventsByTime) Swap(i, j int) {
+	slice[i], slice[j] = slice[j], slice[i]
+}
+
+// errorCategory sorts errors into broad causes, so the feed can be skimmed for patterns
+func errorCategory(err error) string {
+	switch {
+	case indexer.IsMaintenance(err):
+		return errorCategoryMaintenance
+	case indexer.IsThrottled(err):
+		return errorCategoryThrottled
+	case indexer.IsBudgetExhausted(err):
+		return errorCategoryBudget
+	case indexer.IsCrash(err):
+		return errorCategoryCrash
+	case indexer.IsLayoutChanged(err):
+		return errorCategoryLayout
+	case indexer.LoginErrorReason(err) != "":
+		return errorCategoryLogin
+	case indexer.IsPartialResults(err):
+		return errorCategoryTimeout
+	}
+
+	if ne, ok := err.(net.Error); ok {
+		if ne.Timeout() {
+			return errorCategoryTimeout
+		}
+		return errorCategoryNetwork
+	}
+
+	return errorCategoryOther
+}
+
+// errorFeedSize returns how many failures are kept for each indexer, from errorfeedsize
+func (h *handler) errorFeedSize() int {
+	val, err := config.GetGlobalConfig("errorfeedsize", "", h.Params.Config)
+	if err != nil || val == "" {
+		return defaultErrorFeedSize
+	}
+
+	n, err := strconv.Atoi(val)
+	if err != nil || n < 1 {
+		log.Warnf("Ignoring invalid errorfeedsize %q", val)
+		return defaultErrorFeedSize
+	}
+
+	return n
+}
+
+// recordFailure adds a failed search or download to the indexer's error feed, dropping the
+// oldest failures once there are more than errorfeedsize
+func (h *handler) recordFailure(f indexer.Failure) {
+	if h.Params.Store == nil {
+		return
+	}
+
+	ev := errorEvent{
+		Time:      time.Now(),
+		Indexer:   f.Site,
+		Operation: f.Operation,
+		Category:  errorCategory(f.Err),
+		Reason:    indexer.LoginErrorReason(f.Err),
+		Error:     f.Err.Error(),
+		Query:     f.Query,
+		Request:   f.RequestID,
+	}
+
+	h.errorFeedLock.Lock()
+	defer h.errorFeedLock.Unlock()
+
+	events := []errorEvent{}
+	if _, err := h.Params.Store.Get(errorFeedBucket, f.Site, &events); err != nil {
+		log.WithError(err).Warn("Failed to read error feed")
+	}
+
+	events = append(events, ev)
+	if size := h.errorFeedSize(); len(events) > size {
+		events = events[len(events)-size:]
+	}
+
+	if err := h.Params.Store.Put(errorFeedBucket, f.Site, events); err != nil {
+		log.WithError(err).Warn("Failed to write error feed")
+	}
+}
+
+// recordStragglers adds the indexers that an aggregate search gave up waiting for to their feeds
+func (h *handler) recordStragglers(query torznab.Query, err error) {
+	pe, ok := err.(*indexer.PartialResultsError)
+	if !ok {
+		return
+	}
+
+	for _, site := range pe.Stragglers {
+		h.recordFailure(indexer.Failure{
+			Site:      site,
+			Operation: "search",
+			RequestID: query.RequestID,
+			Query:     query.Encode(),
+			Err:       err,
+		})
+	}
+}
+
+// loadErrorFeed returns the recent failures of an indexer, or of all of them if it's empty,
+// most recent first
+func (h *handler) loadErrorFeed(site string, limit int) ([]errorEvent, error) {
+	events := []errorEvent{}
+
+	if h.Params.Store == nil {
+		return events, nil
+	}
+
+	h.errorFeedLock.Lock()
+	defer h.errorFeedLock.Unlock()
+
+	sites := []string{site}
+	if site == "" {
+		var err error
+		if sites, err = h.Params.Store.Keys(errorFeedBucket); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, s := range sites {
+		siteEvents := []errorEvent{}
+		if _, err := h.Params.Store.Get(errorFeedBucket, s, &siteEvents); err != nil {
+			return nil, err
+		}
+		events = append(events, siteEvents...)
+	}
+
+	sort.Stable(errorEventsByTime(events))
+
+	if limit > 0 && len(events) > limit {
+		events = events[:limit]
+	}
+
+	return events, nil
+}
+
+func (h *handler) getErrorsHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.authorizeRequest(w, r, RoleAdmin); !ok {
+		return
+	}
+
+	var limit int
+	if l := r.URL.Query().Get("limit"); l != "" {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil {
+			jsonError(w, "Invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	events, err := h.loadErrorFeed(r.URL.Query().Get("indexer"), limit)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jsonOutput(w, events)
+}
@@ -0,0 +1,257 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cardigann/cardigann/scheduler"
+	"github.com/cardigann/cardigann/torznab"
+)
+
+const (
+	// eventBacklogSize is how many releases are kept for clients that reconnect with a Last-Event-ID
+	eventBacklogSize = 100
+
+	// eventBufferSize is how many releases can be waiting to be sent to a slow client before
+	// newer ones are dropped
+	eventBufferSize = 16
+
+	// eventKeepAlive is how often a comment is sent to idle clients, so proxies don't time them out
+	eventKeepAlive = 30 * time.Second
+
+	// eventSearchMemory is how many releases of each saved search are remembered, so that only
+	// the ones that weren't in its feed before are published
+	eventSearchMemory = 500
+)
+
+// releaseEvent is a release found by a job, or that turned up in a saved search's feed, in
+// which case Search is its name and Job is empty
+type releaseEvent struct {
+	ID      int                `json:"id"`
+	Job     string             `json:"job,omitempty"`
+	Search  string             `json:"search,omitempty"`
+	Indexer string             `json:"indexer"`
+	Found   time.Time          `json:"found"`
+	Pushed  bool               `json:"pushed"`
+	Item    torznab.ResultItem `json:"item"`
+}
+
+// eventSubscriber is a client that wants releases from some indexers, jobs or saved searches, or
+// all of them if they're all empty
+type eventSubscriber struct {
+	indexers map[string]bool
+	jobs     map[string]bool
+	searches map[string]bool
+	events   chan releaseEvent
+}
+
+func (s *eventSubscriber) wants(ev releaseEvent) bool {
+	if len(s.indexers) == 0 && len(s.jobs) == 0 && len(s.searches) == 0 {
+		return true
+	}
+	return s.indexers[ev.Indexer] || s.indexers[ev.Item.Site] ||
+		(ev.Job != "" && s.jobs[ev.Job]) || (ev.Search != "" && s.searches[ev.Search])
+}
+
+// eventHub passes the releases found by scheduled jobs and saved searches on to the clients
+// subscribed to them
+type eventHub struct {
+	mu          sync.Mutex
+	lastID      int
+	backlog     []releaseEvent
+	subscribers map[*eventSubscriber]bool
+
+	// searches are the releases last seen in each saved search's feed, oldest first
+	searches map[string][]string
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{
+		subscribers: map[*eventSubscriber]bool{},
+		searches:    map[string][]string{},
+	}
+}
+
+func (hub *eventHub) publish(r scheduler.Release) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	hub.send(releaseEvent{Job: r.Job, Indexer: r.Indexer, Found: r.Found, Pushed: r.Pushed, Item: r.Item})
+}
+
+// discover publishes the items in a saved search's feed that weren't in it before. The first
+// time a search is seen its items are only remembered, as there's nothing to compare them to
+func (hub *eventHub) discover(search string, items []torznab.ResultItem) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	seen, known := hub.searches[search]
+	remembered := map[string]bool{}
+	for _, key := range seen {
+		remembered[key] = true
+	}
+
+	now := time.Now()
+	for _, item := range items {
+		key := item.GUID
+		if key == "" {
+			key = item.Link
+		}
+		if key == "" || remembered[key] {
+			continue
+		}
+
+		remembered[key] = true
+		seen = append(seen, key)
+
+		if known {
+			hub.send(releaseEvent{Search: search, Indexer: item.Site, Found: now, Item: item})
+		}
+	}
+
+	if len(seen) > eventSearchMemory {
+		seen = seen[len(seen)-eventSearchMemory:]
+	}
+	hub.searches[search] = seen
+}
+
+// send numbers an event, keeps it in the backlog and passes it to the subscribers that want
+// it. It must only be called whilst holding the lock
+func (hub *eventHub) send(ev releaseEvent) {
+	hub.lastID++
+	ev.ID = hub.lastID
+
+	hub.backlog = append(hub.backlog, ev)
+	if len(hub.backlog) > eventBacklogSize {
+		hub.backlog = hub.backlog[len(hub.backlog)-eventBacklogSize:]
+	}
+
+	for s := range hub.subscribers {
+		if !s.wants(ev) {
+			continue
+		}
+		select {
+		case s.events <- ev:
+		default:
+			log.WithFields(logrus.Fields{"id": ev.ID}).Debug("Client is too slow, dropping release event")
+		}
+	}
+}
+
+// subscribe adds a subscriber, and returns the releases it missed since lastID
+func (hub *eventHub) subscribe(s *eventSubscriber, lastID int) []releaseEvent {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	hub.subscribers[s] = true
+
+	missed := []releaseEvent{}
+	if lastID > 0 {
+		for _, ev := range hub.backlog {
+			if ev.ID > lastID && s.wants(ev) {
+				missed = append(missed, ev)
+			}
+		}
+	}
+
+	return missed
+}
+
+func (hub *eventHub) unsubscribe(s *eventSubscriber) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	delete(hub.subscribers, s)
+}
+
+// getEventsHandler streams the releases found by scheduled jobs and saved searches as server-sent
+// events, optionally only for some indexers, jobs or saved searches with ?indexer=x&job=y&search=z
+func (h *handler) getEventsHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.authorizeRequest(w, r, RoleReadOnly)
+	if !ok {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		jsonError(w, "Streaming isn't supported", http.StatusInternalServerError)
+		return
+	}
+
+	s := &eventSubscriber{
+		indexers: map[string]bool{},
+		jobs:     map[string]bool{},
+		searches: map[string]bool{},
+		events:   make(chan releaseEvent, eventBufferSize),
+	}
+	for _, key := range r.URL.Query()["indexer"] {
+		s.indexers[key] = true
+	}
+	for _, name := range r.URL.Query()["job"] {
+		s.jobs[name] = true
+	}
+	for _, name := range r.URL.Query()["search"] {
+		s.searches[name] = true
+	}
+
+	lastID, _ := strconv.Atoi(r.Header.Get("Last-Event-ID"))
+	missed := h.events.subscribe(s, lastID)
+	defer h.events.unsubscribe(s)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	log.WithFields(logrus.Fields{"user": user.Name, "request": requestID(r)}).Debug("Client subscribed to releases")
+
+	send := func(ev releaseEvent) error {
+		items, err := h.rewriteLinks(r, []torznab.ResultItem{ev.Item}, user)
+		if err != nil {
+			return err
+		}
+		ev.Item = items[0]
+
+		b, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+
+		if _, err = fmt.Fprintf(w, "id: %d\nevent: release\ndata: %s\n\n", ev.ID, b); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+
+	for _, ev := range missed {
+		if err := send(ev); err != nil {
+			return
+		}
+	}
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case ev := <-s.events:
+			if err := send(ev); err != nil {
+				log.WithError(err).Debug("Failed to send release event")
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/cardigann/cardigann/torznab"
+)
+
+func TestEventHubDiscover(t *testing.T) {
+	hub := newEventHub()
+
+	s := &eventSubscriber{
+		searches: map[string]bool{"llamas": true},
+		events:   make(chan releaseEvent, eventBufferSize),
+	}
+	hub.subscribe(s, 0)
+
+	// the first fetch of a feed has nothing to compare to
+	hub.discover("llamas", []torznab.ResultItem{{GUID: "1"}, {GUID: "2"}})
+	if len(s.events) != 0 {
+		t.Fatalf("Expected no events for the first fetch, got %d", len(s.events))
+	}
+
+	hub.discover("llamas", []torznab.ResultItem{{GUID: "3", Site: "example"}, {GUID: "1"}, {GUID: "2"}})
+	hub.discover("alpacas", []torznab.ResultItem{{GUID: "4"}})
+	hub.discover("alpacas", []torznab.ResultItem{{GUID: "5"}})
+
+	if len(s.events) != 1 {
+		t.Fatalf("Expected one new release, got %d", len(s.events))
+	}
+
+	if ev := <-s.events; ev.Search != "llamas" || ev.Item.GUID != "3" || ev.Indexer != "example" {
+		t.Fatalf("Unexpected event %#v", ev)
+	}
+}
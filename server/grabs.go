@@ -0,0 +1,331 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cardigann/cardigann/config"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// grabsBucket holds what was grabbed, and grabsBlobDir the torrent files themselves
+	grabsBucket  = "grabs"
+	grabsBlobDir = "grabs"
+
+	defaultGrabArchiveSize = 500
+
+	// torrent files bigger than this aren't archived, they are usually a few hundred KB
+	maxArchivedGrabSize = 10 * 1024 * 1024
+)
+
+// archivedGrab is a torrent file that was grabbed through a download link and kept in the store,
+// so that it can be downloaded again after the tracker has pruned it. Each user has their own
+// grab of a torrent, but the file itself is only kept once under its Hash
+type archivedGrab struct {
+	ID       string    `json:"id"`
+	Hash     string    `json:"hash"`
+	Time     time.Time `json:"time"`
+	User     string    `json:"user"`
+	Indexer  string    `json:"indexer"`
+	Filename string    `json:"filename"`
+	Size     int       `json:"size"`
+}
+
+// grabID returns the id of a user's grab of a torrent file
+func grabID(user, hash string) string {
+	sum := sha1.Sum([]byte(user + "\x00" + hash))
+	return hex.EncodeToString(sum[:])
+}
+
+type archivedGrabsByTime []archivedGrab
+
+func (slice archivedGrabsByTime) Len() int {
+	return len(slice)
+}
+
+func (slice archivedGrabsByTime) Less(i, j int) bool {
+	return slice[i].Time.After(slice[j].Time)
+}
+
+func (slice archivedGrabsByTime) Swap(i, j int) {
+	slice[i], slice[j] = slice[j], slice[i]
+}
+
+// archivingGrabs returns whether grabbed torrent files are kept, which they are if archivegrabs is true
+func (h *handler) archivingGrabs() bool {
+	if h.Params.Store == nil {
+		return false
+	}
+
+	val, err := config.GetGlobalConfig("archivegrabs", "", h.Params.Config)
+	if err != nil || val == "" {
+		return false
+	}
+
+	archive, err := strconv.ParseBool(val)
+	if err != nil {
+		log.Warnf("Ignoring invalid archivegrabs %q", val)
+		return false
+	}
+
+	return archive
+}
+
+// grabArchiveSize returns how many grabbed torrent files are kept, from grabarchivesize
+func (h *handler) grabArchiveSize() int {
+	val, err := config.GetGlobalConfig("grabarchivesize", "", h.Params.Config)
+	if err != nil || val == "" {
+		return defaultGrabArchiveSize
+	}
+
+	n, err := strconv.Atoi(val)
+	if err != nil || n < 1 {
+		log.Warnf("Ignoring invalid grabarchivesize %q", val)
+		return defaultGrabArchiveSize
+	}
+
+	return n
+}
+
+// copyDownload copies a download to the response, keeping a copy of the torrent file in the
+// archive if grabs are being archived
+func (h *handler) copyDownload(w io.Writer, rc io.Reader, user, site, filename string) {
+	if h.archivingGrabs() {
+		data, err := ioutil.ReadAll(io.LimitReader(rc, maxArchivedGrabSize+1))
+		if err != nil {
+			log.WithError(err).Warn("Failed to read download")
+		}
+
+		// torrent files are bencoded dictionaries, anything else is likely an error page
+		if err == nil && len(data) <= maxArchivedGrabSize && bytes.HasPrefix(data, []byte("d")) {
+			h.archiveGrab(user, site, filename, data)
+		}
+
+		if _, err := w.Write(data); err != nil {
+			return
+		}
+	}
+
+	io.Copy(w, rc)
+}
+
+// archiveGrab stores a grabbed torrent file, dropping the oldest grabs once there are more than
+// grabarchivesize. The same torrent grabbed again by the same user replaces their earlier grab
+func (h *handler) archiveGrab(user, site, filename string, data []byte) {
+	sum := sha1.Sum(data)
+	hash := hex.EncodeToString(sum[:])
+
+	grab := archivedGrab{
+		ID:       grabID(user, hash),
+		Hash:     hash,
+		Time:     time.Now(),
+		User:     user,
+		Indexer:  site,
+		Filename: filename,
+		Size:     len(data),
+	}
+
+	h.grabsLock.Lock()
+	defer h.grabsLock.Unlock()
+
+	if err := h.Params.Store.PutBlob(grabsBlobDir, grab.Hash, data); err != nil {
+		log.WithError(err).Warn("Failed to archive grabbed torrent")
+		return
+	}
+
+	if err := h.Params.Store.Put(grabsBucket, grab.ID, grab); err != nil {
+		log.WithError(err).Warn("Failed to archive grabbed torrent")
+		return
+	}
+
+	log.WithFields(logrus.Fields{"site": site, "filename": filename, "id": grab.ID}).
+		Debug("Archived grabbed torrent")
+
+	grabs, err := h.loadGrabs()
+	if err != nil {
+		log.WithError(err).Warn("Failed to read archived grabs")
+		return
+	}
+
+	if size := h.grabArchiveSize(); len(grabs) > size {
+		if err := h.deleteGrabs(grabs[size:], grabs[:size]); err != nil {
+			log.WithError(err).Warn("Failed to trim archived grabs")
+		}
+	}
+}
+
+// deleteGrabs deletes grabs from the store, along with their torrent files unless one of the
+// grabs that are kept is of the same torrent. It must be called whilst holding grabsLock
+func (h *handler) deleteGrabs(deleted, kept []archivedGrab) error {
+	inUse := map[string]bool{}
+	for _, g := range kept {
+		inUse[g.Hash] = true
+	}
+
+	ids, blobs := []string{}, []string{}
+	for _, g := range deleted {
+		ids = append(ids, g.ID)
+		if !inUse[g.Hash] {
+			inUse[g.Hash] = true
+			blobs = append(blobs, g.Hash)
+		}
+	}
+
+	if err := h.Params.Store.Delete(grabsBucket, ids...); err != nil {
+		return err
+	}
+	return h.Params.Store.DeleteBlobs(grabsBlobDir, blobs...)
+}
+
+// loadGrabs returns the archived grabs, most recent first
+func (h *handler) loadGrabs() ([]archivedGrab, error) {
+	grabs := []archivedGrab{}
+
+	if h.Params.Store == nil {
+		return grabs, nil
+	}
+
+	ids, err := h.Params.Store.Keys(grabsBucket)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		var grab archivedGrab
+		if _, err := h.Params.Store.Get(grabsBucket, id, &grab); err != nil {
+			return nil, err
+		}
+		grabs = append(grabs, grab)
+	}
+
+	sort.Sort(archivedGrabsByTime(grabs))
+	return grabs, nil
+}
+
+// lookupGrab returns an archived grab, users that aren't admins can only get their own
+func (h *handler) lookupGrab(id string, user *User) (archivedGrab, bool, error) {
+	var grab archivedGrab
+
+	if h.Params.Store == nil {
+		return grab, false, nil
+	}
+
+	ok, err := h.Params.Store.Get(grabsBucket, id, &grab)
+	if err != nil || !ok {
+		return grab, false, err
+	}
+
+	if !user.IsAdmin() && grab.User != user.Name {
+		return grab, false, nil
+	}
+
+	return grab, true, nil
+}
+
+func (h *handler) getGrabsHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.authorizeRequest(w, r, RoleReadOnly)
+	if !ok {
+		return
+	}
+
+	h.grabsLock.Lock()
+	grabs, err := h.loadGrabs()
+	h.grabsLock.Unlock()
+
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// users that aren't admins only see their own grabs
+	visible := []archivedGrab{}
+	for _, grab := range grabs {
+		if user.IsAdmin() || grab.User == user.Name {
+			visible = append(visible, grab)
+		}
+	}
+
+	jsonOutput(w, visible)
+}
+
+func (h *handler) getGrabTorrentHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.authorizeRequest(w, r, RoleReadOnly)
+	if !ok {
+		return
+	}
+
+	grab, ok, err := h.lookupGrab(mux.Vars(r)["grab"], user)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	} else if !ok {
+		jsonError(w, "Grab not found", http.StatusNotFound)
+		return
+	}
+
+	rc, ok, err := h.Params.Store.OpenBlob(grabsBlobDir, grab.Hash)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	} else if !ok {
+		jsonError(w, "Torrent file is missing from the archive", http.StatusNotFound)
+		return
+	}
+	defer rc.Close()
+
+	w.Header().Set("Content-Type", "application/x-bittorrent")
+	w.Header().Set("Content-Disposition", attachmentDisposition(grab.Filename))
+	w.Header().Set("Content-Transfer-Encoding", "binary")
+
+	io.Copy(w, rc)
+}
+
+func (h *handler) deleteGrabHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.authorizeRequest(w, r, RoleAdmin)
+	if !ok {
+		return
+	}
+
+	grab, ok, err := h.lookupGrab(mux.Vars(r)["grab"], user)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	} else if !ok {
+		jsonError(w, "Grab not found", http.StatusNotFound)
+		return
+	}
+
+	h.grabsLock.Lock()
+	defer h.grabsLock.Unlock()
+
+	grabs, err := h.loadGrabs()
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// other users' grabs of the same torrent keep the file
+	others := []archivedGrab{}
+	for _, g := range grabs {
+		if g.ID != grab.ID {
+			others = append(others, g)
+		}
+	}
+
+	if err := h.deleteGrabs([]archivedGrab{grab}, others); err != nil {
+		jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.audit(r, user.Name, auditActionDeleteGrab, grab.Indexer, map[string]string{"filename": grab.Filename})
+	jsonOutput(w, grab)
+}
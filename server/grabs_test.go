@@ -0,0 +1,64 @@
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/cardigann/cardigann/config"
+	"github.com/cardigann/cardigann/store"
+)
+
+func TestArchiveGrabPerUser(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grabs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	st, err := store.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &handler{Params: Params{Config: &config.ArrayConfig{}, Store: st}}
+	torrent := []byte("d8:announce3:urle")
+
+	h.archiveGrab("alice", "example", "llamas.torrent", torrent)
+	h.archiveGrab("bob", "example", "llamas.torrent", torrent)
+
+	grabs, err := h.loadGrabs()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(grabs) != 2 || grabs[0].ID == grabs[1].ID || grabs[0].Hash != grabs[1].Hash {
+		t.Fatalf("Expected a grab for each user of the same torrent, got %#v", grabs)
+	}
+
+	// deleting one user's grab keeps the file for the other
+	h.grabsLock.Lock()
+	err = h.deleteGrabs(grabs[:1], grabs[1:])
+	h.grabsLock.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rc, ok, err := st.OpenBlob(grabsBlobDir, grabs[1].Hash)
+	if err != nil || !ok {
+		t.Fatalf("Expected the torrent file to be kept, got %v", err)
+	}
+	rc.Close()
+}
+
+func TestAttachmentDisposition(t *testing.T) {
+	for idx, test := range []struct {
+		filename, expected string
+	}{
+		{"llamas.torrent", `attachment; filename="llamas.torrent"; filename*=UTF-8''llamas.torrent`},
+		{`Llamas "HD"; x=1.torrent`, `attachment; filename="Llamas _HD_; x=1.torrent"; filename*=UTF-8''Llamas%20%22HD%22%3B%20x%3D1.torrent`},
+		{"Lamas über alles.torrent", `attachment; filename="Lamas _ber alles.torrent"; filename*=UTF-8''Lamas%20%C3%BCber%20alles.torrent`},
+	} {
+		if got := attachmentDisposition(test.filename); got != test.expected {
+			t.Errorf("Row #%d: expected %s, got %s", idx+1, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+//go:build grpc
+// +build grpc
+
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cardigann/cardigann/indexer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// grpcSupported is whether the gRPC interface is built in, which needs the grpc build tag
+const grpcSupported = true
+
+// rpcServiceDesc describes the Cardigann service in cardigann.proto
+var rpcServiceDesc = grpc.ServiceDesc{
+	ServiceName: "cardigann.Cardigann",
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		rpcMethod("Search", func() rpcMessage { return &rpcSearchRequest{} },
+			func(s *rpcService, ctx context.Context, req rpcMessage) (rpcMessage, error) {
+				return s.search(ctx, req.(*rpcSearchRequest))
+			}),
+		rpcMethod("ListIndexers", func() rpcMessage { return &rpcListIndexersRequest{} },
+			func(s *rpcService, ctx context.Context, req rpcMessage) (rpcMessage, error) {
+				return s.listIndexers(ctx, req.(*rpcListIndexersRequest))
+			}),
+		rpcMethod("SetIndexerEnabled", func() rpcMessage { return &rpcSetIndexerEnabledRequest{} },
+			func(s *rpcService, ctx context.Context, req rpcMessage) (rpcMessage, error) {
+				return s.setIndexerEnabled(ctx, req.(*rpcSetIndexerEnabledRequest))
+			}),
+	},
+	Metadata: "cardigann.proto",
+}
+
+// rpcMethod describes a unary method of the service, which decodes its request into newReq
+func rpcMethod(name string, newReq func() rpcMessage,
+	call func(s *rpcService, ctx context.Context, req rpcMessage) (rpcMessage, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error,
+			interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			req := newReq()
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+
+			handle := func(ctx context.Context, req interface{}) (interface{}, error) {
+				return call(srv.(*rpcService), ctx, req.(rpcMessage))
+			}
+			if interceptor == nil {
+				return handle(ctx, req)
+			}
+
+			info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/cardigann.Cardigann/" + name}
+			return interceptor(ctx, req, info, handle)
+		},
+	}
+}
+
+// rpcService answers gRPC calls with the same handler as HTTP requests, each call is turned into
+// a request so that it's authenticated, searched and audited the same way
+type rpcService struct {
+	h *handler
+}
+
+// serveGRPC serves the gRPC interface on ln until it's closed
+func serveGRPC(ln net.Listener, h *handler) error {
+	srv := grpc.NewServer(grpc.ForceServerCodec(rpcCodec{}))
+	srv.RegisterService(&rpcServiceDesc, &rpcService{h: h})
+	return srv.Serve(ln)
+}
+
+// request returns a request for a call, authenticated with the api key in the call's
+// authorization metadata as a user with the given role
+func (s *rpcService) request(ctx context.Context, method, role string) (*http.Request, *User, error) {
+	r, err := http.NewRequest("POST", s.h.Params.BaseURL, nil)
+	if err != nil {
+		return nil, nil, status.Error(codes.Internal, err.Error())
+	}
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, auth := range md.Get("authorization") {
+			r.Header.Add("Authorization", auth)
+		}
+	}
+
+	if p, ok := peer.FromContext(ctx); ok {
+		r.RemoteAddr = p.Addr.String()
+	}
+
+	id, err := randomHex(8)
+	if err != nil {
+		return nil, nil, status.Error(codes.Internal, err.Error())
+	}
+	r = r.WithContext(context.WithValue(ctx, requestIDKey{}, id))
+
+	log.WithFields(logrus.Fields{
+		"method":  method,
+		"remote":  r.RemoteAddr,
+		"request": id,
+	}).Debugf("gRPC %s", method)
+
+	user, ok := s.h.requestUser(r)
+	if !ok {
+		return nil, nil, status.Error(codes.Unauthenticated, "Not Authorized")
+	}
+	if role == RoleAdmin && !user.IsAdmin() {
+		return nil, nil, status.Error(codes.PermissionDenied, "Forbidden, requires the admin role")
+	}
+
+	return r, user, nil
+}
+
+func (s *rpcService) search(ctx context.Context, req *rpcSearchRequest) (*rpcSearchResponse, error) {
+	r, user, err := s.request(ctx, "Search", RoleReadOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	query := req.Query
+	if query == nil {
+		query = &rpcQuery{}
+	}
+
+	vals, err := query.values()
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	r.URL.RawQuery = vals.Encode()
+
+	idx, err := s.h.lookupIndexer(req.Indexer)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	resp := &rpcSearchResponse{}
+
+	// soft errors like partial results from an aggregate are a warning alongside the results
+	feed, err := s.h.torznabSearch(r, idx, user)
+	if isSoftError(err) {
+		resp.Warning = err.Error()
+	} else if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+
+	if feed != nil {
+		for _, item := range feed.Items {
+			resp.Releases = append(resp.Releases, newRPCReleaseInfo(item))
+		}
+	}
+
+	return resp, nil
+}
+
+func (s *rpcService) listIndexers(ctx context.Context, req *rpcListIndexersRequest) (*rpcListIndexersResponse, error) {
+	if _, _, err := s.request(ctx, "ListIndexers", RoleReadOnly); err != nil {
+		return nil, err
+	}
+
+	views, err := s.h.loadIndexerViews(s.h.Params.BaseURL)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	resp := &rpcListIndexersResponse{}
+	for _, view := range views {
+		resp.Indexers = append(resp.Indexers, newRPCIndexerStatus(view))
+	}
+
+	return resp, nil
+}
+
+func (s *rpcService) setIndexerEnabled(ctx context.Context, req *rpcSetIndexerEnabledRequest) (*rpcIndexerStatus, error) {
+	r, user, err := s.request(ctx, "SetIndexerEnabled", RoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.h.Params.ReadOnly {
+		return nil, status.Error(codes.PermissionDenied, "Forbidden, the server is in read-only mode")
+	}
+
+	if _, err := indexer.DefaultDefinitionLoader.Load(req.Indexer); err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	if err := s.h.Params.Config.Set(req.Indexer, "enabled", strconv.FormatBool(req.Enabled)); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	action := auditActionDisable
+	if req.Enabled {
+		action = auditActionEnable
+	}
+	s.h.audit(r, user.Name, action, req.Indexer, nil)
+
+	views, err := s.h.loadIndexerViews(s.h.Params.BaseURL)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	for _, view := range views {
+		if view.ID == req.Indexer {
+			return newRPCIndexerStatus(view), nil
+		}
+	}
+
+	return &rpcIndexerStatus{ID: req.Indexer, Enabled: req.Enabled}, nil
+}
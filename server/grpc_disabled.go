@@ -0,0 +1,17 @@
+//go:build !grpc
+// +build !grpc
+
+package server
+
+import (
+	"errors"
+	"net"
+)
+
+// grpcSupported is whether the gRPC interface is built in, which needs the grpc build tag
+const grpcSupported = false
+
+// serveGRPC fails as the gRPC interface isn't built in without the grpc build tag
+func serveGRPC(ln net.Listener, h *handler) error {
+	return errors.New("Cardigann was built without gRPC support, rebuild it with -tags grpc")
+}
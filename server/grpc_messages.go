@@ -0,0 +1,574 @@
+//go:build grpc
+// +build grpc
+
+package server
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/cardigann/cardigann/torznab"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The messages of cardigann.proto are encoded by hand with protowire rather than generated, so
+// building with grpc doesn't also need protoc. The field numbers here must match the proto file
+
+// rpcMessage is a message of the gRPC interface
+type rpcMessage interface {
+	marshal(w *protoWriter)
+	unmarshal(b []byte) error
+}
+
+// rpcCodec encodes the messages of the gRPC interface as protobuf
+type rpcCodec struct{}
+
+func (rpcCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(rpcMessage)
+	if !ok {
+		return nil, fmt.Errorf("Can't encode %T as a gRPC message", v)
+	}
+
+	w := protoWriter{}
+	m.marshal(&w)
+	return w, nil
+}
+
+func (rpcCodec) Unmarshal(b []byte, v interface{}) error {
+	m, ok := v.(rpcMessage)
+	if !ok {
+		return fmt.Errorf("Can't decode %T as a gRPC message", v)
+	}
+	return m.unmarshal(b)
+}
+
+func (rpcCodec) Name() string {
+	return "proto"
+}
+
+// protoWriter appends the fields of a message, leaving out zero values like proto3 does
+type protoWriter []byte
+
+func (w *protoWriter) string(num protowire.Number, v string) {
+	if v != "" {
+		*w = protowire.AppendTag(*w, num, protowire.BytesType)
+		*w = protowire.AppendString(*w, v)
+	}
+}
+
+func (w *protoWriter) varint(num protowire.Number, v uint64) {
+	if v != 0 {
+		*w = protowire.AppendTag(*w, num, protowire.VarintType)
+		*w = protowire.AppendVarint(*w, v)
+	}
+}
+
+// int writes an int32 or int64 field, negative values are sign extended to 64 bits
+func (w *protoWriter) int(num protowire.Number, v int64) {
+	w.varint(num, uint64(v))
+}
+
+func (w *protoWriter) bool(num protowire.Number, v bool) {
+	w.varint(num, protowire.EncodeBool(v))
+}
+
+func (w *protoWriter) double(num protowire.Number, v float64) {
+	if v != 0 {
+		*w = protowire.AppendTag(*w, num, protowire.Fixed64Type)
+		*w = protowire.AppendFixed64(*w, math.Float64bits(v))
+	}
+}
+
+// ints writes a repeated int32 field, packed like proto3 does
+func (w *protoWriter) ints(num protowire.Number, vs []int) {
+	if len(vs) == 0 {
+		return
+	}
+
+	packed := []byte{}
+	for _, v := range vs {
+		packed = protowire.AppendVarint(packed, uint64(int64(v)))
+	}
+	*w = protowire.AppendTag(*w, num, protowire.BytesType)
+	*w = protowire.AppendBytes(*w, packed)
+}
+
+func (w *protoWriter) strings(num protowire.Number, vs []string) {
+	for _, v := range vs {
+		*w = protowire.AppendTag(*w, num, protowire.BytesType)
+		*w = protowire.AppendString(*w, v)
+	}
+}
+
+func (w *protoWriter) message(num protowire.Number, m rpcMessage) {
+	nested := protoWriter{}
+	m.marshal(&nested)
+	*w = protowire.AppendTag(*w, num, protowire.BytesType)
+	*w = protowire.AppendBytes(*w, nested)
+}
+
+// protoField is a field read from a message, with its value in either varint or bytes depending
+// on its wire type
+type protoField struct {
+	num    protowire.Number
+	typ    protowire.Type
+	varint uint64
+	bytes  []byte
+}
+
+func (f protoField) string() string {
+	return string(f.bytes)
+}
+
+func (f protoField) int() int {
+	return int(int64(f.varint))
+}
+
+func (f protoField) bool() bool {
+	return protowire.DecodeBool(f.varint)
+}
+
+func (f protoField) double() float64 {
+	return math.Float64frombits(f.varint)
+}
+
+// ints appends the values of a repeated int32 field, which can be packed or not
+func (f protoField) ints(vs []int) ([]int, error) {
+	if f.typ != protowire.BytesType {
+		return append(vs, f.int()), nil
+	}
+
+	for b := f.bytes; len(b) > 0; {
+		v, n := protowire.ConsumeVarint(b)
+		if n < 0 {
+			return vs, protowire.ParseError(n)
+		}
+		vs = append(vs, int(int64(v)))
+		b = b[n:]
+	}
+	return vs, nil
+}
+
+// readProto calls read for each field of a message. Fields that read doesn't know are skipped,
+// like protobuf does with fields from newer versions of a message
+func readProto(b []byte, read func(f protoField) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		f := protoField{num: num, typ: typ}
+		switch typ {
+		case protowire.VarintType:
+			f.varint, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			f.varint, n = protowire.ConsumeFixed64(b)
+		case protowire.Fixed32Type:
+			var v uint32
+			v, n = protowire.ConsumeFixed32(b)
+			f.varint = uint64(v)
+		case protowire.BytesType:
+			f.bytes, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		if err := read(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rpcQuery is a torznab search
+type rpcQuery struct {
+	Type       string
+	Q          string
+	Categories []int
+	IMDBID     string
+	TVDBID     string
+	Season     string
+	Episode    string
+	Limit      int
+	Offset     int
+	Languages  []string
+
+	// Params are any other torznab parameters, as a query string
+	Params string
+}
+
+func (q *rpcQuery) marshal(w *protoWriter) {
+	w.string(1, q.Type)
+	w.string(2, q.Q)
+	w.ints(3, q.Categories)
+	w.string(4, q.IMDBID)
+	w.string(5, q.TVDBID)
+	w.string(6, q.Season)
+	w.string(7, q.Episode)
+	w.int(8, int64(q.Limit))
+	w.int(9, int64(q.Offset))
+	w.strings(10, q.Languages)
+	w.string(11, q.Params)
+}
+
+func (q *rpcQuery) unmarshal(b []byte) error {
+	return readProto(b, func(f protoField) (err error) {
+		switch f.num {
+		case 1:
+			q.Type = f.string()
+		case 2:
+			q.Q = f.string()
+		case 3:
+			q.Categories, err = f.ints(q.Categories)
+		case 4:
+			q.IMDBID = f.string()
+		case 5:
+			q.TVDBID = f.string()
+		case 6:
+			q.Season = f.string()
+		case 7:
+			q.Episode = f.string()
+		case 8:
+			q.Limit = f.int()
+		case 9:
+			q.Offset = f.int()
+		case 10:
+			q.Languages = append(q.Languages, f.string())
+		case 11:
+			q.Params = f.string()
+		}
+		return err
+	})
+}
+
+// values returns the query as torznab parameters, the typed fields take the place of any of the
+// same parameters in Params
+func (q *rpcQuery) values() (url.Values, error) {
+	vals, err := url.ParseQuery(q.Params)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid params %q: %v", q.Params, err)
+	}
+
+	set := func(key, val string) {
+		if val != "" {
+			vals.Set(key, val)
+		}
+	}
+
+	if vals.Get("t") == "" {
+		vals.Set("t", "search")
+	}
+	set("t", q.Type)
+	set("q", q.Q)
+	set("imdbid", q.IMDBID)
+	set("tvdbid", q.TVDBID)
+	set("season", q.Season)
+	set("ep", q.Episode)
+	set("language", strings.Join(q.Languages, ","))
+
+	if q.Limit > 0 {
+		vals.Set("limit", strconv.Itoa(q.Limit))
+	}
+	if q.Offset > 0 {
+		vals.Set("offset", strconv.Itoa(q.Offset))
+	}
+
+	cats := []string{}
+	for _, cat := range q.Categories {
+		cats = append(cats, strconv.Itoa(cat))
+	}
+	set("cat", strings.Join(cats, ","))
+
+	return vals, nil
+}
+
+type rpcSearchRequest struct {
+	Indexer string
+	Query   *rpcQuery
+}
+
+func (r *rpcSearchRequest) marshal(w *protoWriter) {
+	w.string(1, r.Indexer)
+	if r.Query != nil {
+		w.message(2, r.Query)
+	}
+}
+
+func (r *rpcSearchRequest) unmarshal(b []byte) error {
+	return readProto(b, func(f protoField) error {
+		switch f.num {
+		case 1:
+			r.Indexer = f.string()
+		case 2:
+			r.Query = &rpcQuery{}
+			return r.Query.unmarshal(f.bytes)
+		}
+		return nil
+	})
+}
+
+type rpcSearchResponse struct {
+	Releases []*rpcReleaseInfo
+
+	// Warning is set when some results are missing
+	Warning string
+}
+
+func (r *rpcSearchResponse) marshal(w *protoWriter) {
+	for _, release := range r.Releases {
+		w.message(1, release)
+	}
+	w.string(2, r.Warning)
+}
+
+func (r *rpcSearchResponse) unmarshal(b []byte) error {
+	return readProto(b, func(f protoField) error {
+		switch f.num {
+		case 1:
+			release := &rpcReleaseInfo{}
+			r.Releases = append(r.Releases, release)
+			return release.unmarshal(f.bytes)
+		case 2:
+			r.Warning = f.string()
+		}
+		return nil
+	})
+}
+
+// rpcReleaseInfo is a search result
+type rpcReleaseInfo struct {
+	Site                 string
+	Title                string
+	GUID                 string
+	Link                 string
+	Comments             string
+	Size                 uint64
+	Seeders              int
+	Peers                int
+	Category             int
+	PublishDate          int64
+	Language             string
+	Poster               string
+	DownloadVolumeFactor float64
+	UploadVolumeFactor   float64
+	Files                int
+	Grabs                int
+}
+
+func newRPCReleaseInfo(item torznab.ResultItem) *rpcReleaseInfo {
+	r := &rpcReleaseInfo{
+		Site:                 item.Site,
+		Title:                item.Title,
+		GUID:                 item.GUID,
+		Link:                 item.Link,
+		Comments:             item.Comments,
+		Size:                 item.Size,
+		Seeders:              item.Seeders,
+		Peers:                item.Peers,
+		Category:             item.Category,
+		Language:             item.Language,
+		Poster:               item.Poster,
+		DownloadVolumeFactor: item.DownloadVolumeFactor,
+		UploadVolumeFactor:   item.UploadVolumeFactor,
+		Files:                item.Files,
+		Grabs:                item.Grabs,
+	}
+	if !item.PublishDate.IsZero() {
+		r.PublishDate = item.PublishDate.Unix()
+	}
+	return r
+}
+
+func (r *rpcReleaseInfo) marshal(w *protoWriter) {
+	w.string(1, r.Site)
+	w.string(2, r.Title)
+	w.string(3, r.GUID)
+	w.string(4, r.Link)
+	w.string(5, r.Comments)
+	w.varint(6, r.Size)
+	w.int(7, int64(r.Seeders))
+	w.int(8, int64(r.Peers))
+	w.int(9, int64(r.Category))
+	w.int(10, r.PublishDate)
+	w.string(11, r.Language)
+	w.string(12, r.Poster)
+	w.double(13, r.DownloadVolumeFactor)
+	w.double(14, r.UploadVolumeFactor)
+	w.int(15, int64(r.Files))
+	w.int(16, int64(r.Grabs))
+}
+
+func (r *rpcReleaseInfo) unmarshal(b []byte) error {
+	return readProto(b, func(f protoField) error {
+		switch f.num {
+		case 1:
+			r.Site = f.string()
+		case 2:
+			r.Title = f.string()
+		case 3:
+			r.GUID = f.string()
+		case 4:
+			r.Link = f.string()
+		case 5:
+			r.Comments = f.string()
+		case 6:
+			r.Size = f.varint
+		case 7:
+			r.Seeders = f.int()
+		case 8:
+			r.Peers = f.int()
+		case 9:
+			r.Category = f.int()
+		case 10:
+			r.PublishDate = int64(f.varint)
+		case 11:
+			r.Language = f.string()
+		case 12:
+			r.Poster = f.string()
+		case 13:
+			r.DownloadVolumeFactor = f.double()
+		case 14:
+			r.UploadVolumeFactor = f.double()
+		case 15:
+			r.Files = f.int()
+		case 16:
+			r.Grabs = f.int()
+		}
+		return nil
+	})
+}
+
+type rpcListIndexersRequest struct{}
+
+func (r *rpcListIndexersRequest) marshal(w *protoWriter) {}
+
+func (r *rpcListIndexersRequest) unmarshal(b []byte) error {
+	return readProto(b, func(f protoField) error {
+		return nil
+	})
+}
+
+type rpcListIndexersResponse struct {
+	Indexers []*rpcIndexerStatus
+}
+
+func (r *rpcListIndexersResponse) marshal(w *protoWriter) {
+	for _, status := range r.Indexers {
+		w.message(1, status)
+	}
+}
+
+func (r *rpcListIndexersResponse) unmarshal(b []byte) error {
+	return readProto(b, func(f protoField) error {
+		if f.num == 1 {
+			status := &rpcIndexerStatus{}
+			r.Indexers = append(r.Indexers, status)
+			return status.unmarshal(f.bytes)
+		}
+		return nil
+	})
+}
+
+// rpcIndexerStatus is an indexer and how it's doing
+type rpcIndexerStatus struct {
+	ID                string
+	Name              string
+	Enabled           bool
+	Verified          bool
+	VerifiedOK        bool
+	VerificationError string
+	HeldOffReason     string
+	HeldOffUntil      int64
+	LayoutChanged     bool
+}
+
+func newRPCIndexerStatus(view indexerView) *rpcIndexerStatus {
+	s := &rpcIndexerStatus{
+		ID:            view.ID,
+		Name:          view.Name,
+		Enabled:       view.Enabled,
+		LayoutChanged: view.Layout != nil,
+	}
+
+	if v := view.Verification; v != nil && v.Verification != nil {
+		s.Verified = true
+		s.VerifiedOK = v.OK
+		s.VerificationError = v.Error
+	}
+
+	if b := view.Backoff; b != nil {
+		s.HeldOffReason = b.Reason
+		s.HeldOffUntil = b.Until.Unix()
+	}
+
+	return s
+}
+
+func (s *rpcIndexerStatus) marshal(w *protoWriter) {
+	w.string(1, s.ID)
+	w.string(2, s.Name)
+	w.bool(3, s.Enabled)
+	w.bool(4, s.Verified)
+	w.bool(5, s.VerifiedOK)
+	w.string(6, s.VerificationError)
+	w.string(7, s.HeldOffReason)
+	w.int(8, s.HeldOffUntil)
+	w.bool(9, s.LayoutChanged)
+}
+
+func (s *rpcIndexerStatus) unmarshal(b []byte) error {
+	return readProto(b, func(f protoField) error {
+		switch f.num {
+		case 1:
+			s.ID = f.string()
+		case 2:
+			s.Name = f.string()
+		case 3:
+			s.Enabled = f.bool()
+		case 4:
+			s.Verified = f.bool()
+		case 5:
+			s.VerifiedOK = f.bool()
+		case 6:
+			s.VerificationError = f.string()
+		case 7:
+			s.HeldOffReason = f.string()
+		case 8:
+			s.HeldOffUntil = int64(f.varint)
+		case 9:
+			s.LayoutChanged = f.bool()
+		}
+		return nil
+	})
+}
+
+type rpcSetIndexerEnabledRequest struct {
+	Indexer string
+	Enabled bool
+}
+
+func (r *rpcSetIndexerEnabledRequest) marshal(w *protoWriter) {
+	w.string(1, r.Indexer)
+	w.bool(2, r.Enabled)
+}
+
+func (r *rpcSetIndexerEnabledRequest) unmarshal(b []byte) error {
+	return readProto(b, func(f protoField) error {
+		switch f.num {
+		case 1:
+			r.Indexer = f.string()
+		case 2:
+			r.Enabled = f.bool()
+		}
+		return nil
+	})
+}
@@ -0,0 +1,196 @@
+//go:build grpc
+// +build grpc
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cardigann/cardigann/config"
+	"github.com/cardigann/cardigann/torznab"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type rpcTestIndexer struct {
+	query torznab.Query
+}
+
+func (i *rpcTestIndexer) Info() torznab.Info {
+	return torznab.Info{ID: "llamas", Title: "Llamas"}
+}
+
+func (i *rpcTestIndexer) Search(query torznab.Query) ([]torznab.ResultItem, error) {
+	i.query = query
+	return []torznab.ResultItem{{
+		Site:        "llamas",
+		Title:       "Llama Llama S01E01",
+		GUID:        "1",
+		Link:        "magnet:?xt=urn:btih:llama",
+		Size:        1024,
+		Seeders:     5,
+		Category:    5000,
+		PublishDate: time.Unix(1500000000, 0),
+	}}, nil
+}
+
+func (i *rpcTestIndexer) Download(urlStr string) (io.ReadCloser, http.Header, error) {
+	return nil, nil, nil
+}
+
+func (i *rpcTestIndexer) Capabilities() torznab.Capabilities {
+	return torznab.Capabilities{}
+}
+
+func TestRPCMessagesRoundTrip(t *testing.T) {
+	req := &rpcSearchRequest{
+		Indexer: "llamas",
+		Query: &rpcQuery{
+			Type:       "tvsearch",
+			Q:          "llama",
+			Categories: []int{5000, 5030},
+			Season:     "1",
+			Episode:    "2",
+			Limit:      10,
+			Languages:  []string{"en", "fr"},
+			Params:     "minage=2",
+		},
+	}
+
+	b, err := rpcCodec{}.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got rpcSearchRequest
+	if err := (rpcCodec{}).Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(req, &got) {
+		t.Fatalf("Expected %#v, got %#v", req.Query, got.Query)
+	}
+
+	resp := &rpcSearchResponse{
+		Releases: []*rpcReleaseInfo{
+			{Title: "Llama", Size: 1 << 40, Seeders: 3, DownloadVolumeFactor: 0.5, PublishDate: 1500000000},
+		},
+		Warning: "slow",
+	}
+
+	if b, err = (rpcCodec{}).Marshal(resp); err != nil {
+		t.Fatal(err)
+	}
+
+	var gotResp rpcSearchResponse
+	if err := (rpcCodec{}).Unmarshal(b, &gotResp); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(resp, &gotResp) {
+		t.Fatalf("Expected %#v, got %#v", resp, gotResp)
+	}
+}
+
+func TestRPCQueryValues(t *testing.T) {
+	vals, err := (&rpcQuery{Q: "llama", Categories: []int{5000}, Params: "minage=2&q=alpaca"}).values()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "cat=5000&minage=2&q=llama&t=search"; vals.Encode() != expected {
+		t.Fatalf("Expected %q, got %q", expected, vals.Encode())
+	}
+}
+
+func serveTestRPC(t *testing.T, h *handler) *grpc.ClientConn {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go serveGRPC(ln, h)
+
+	conn, err := grpc.NewClient(ln.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(rpcCodec{})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func TestRPCService(t *testing.T) {
+	conf := &config.ArrayConfig{}
+	user, err := SetUser(conf, "llama", "secret", RoleReadOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ixr := &rpcTestIndexer{}
+	h := &handler{
+		Params:   Params{Config: conf, APIKey: []byte("admin"), BaseURL: "http://localhost:5060/"},
+		indexers: map[string]torznab.Indexer{"llamas": ixr},
+	}
+
+	conn := serveTestRPC(t, h)
+	withKey := func(k []byte) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), "authorization", fmt.Sprintf("apitoken %x", k))
+	}
+
+	search := &rpcSearchRequest{Indexer: "llamas", Query: &rpcQuery{Q: "llama", Categories: []int{5000}}}
+
+	err = conn.Invoke(context.Background(), "/cardigann.Cardigann/Search", search, &rpcSearchResponse{})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("Expected a call without an api key to be unauthenticated, got %v", err)
+	}
+
+	var resp rpcSearchResponse
+	if err := conn.Invoke(withKey(user.APIKey), "/cardigann.Cardigann/Search", search, &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if ixr.query.Q != "llama" || !reflect.DeepEqual(ixr.query.Categories, []int{5000}) {
+		t.Fatalf("Expected the query to be passed to the indexer, got %#v", ixr.query)
+	}
+
+	if len(resp.Releases) != 1 || resp.Releases[0].Title != "Llama Llama S01E01" ||
+		resp.Releases[0].Seeders != 5 || resp.Releases[0].PublishDate != 1500000000 {
+		t.Fatalf("Unexpected releases %#v", resp.Releases)
+	}
+
+	set := &rpcSetIndexerEnabledRequest{Indexer: "llamas", Enabled: true}
+	err = conn.Invoke(withKey(user.APIKey), "/cardigann.Cardigann/SetIndexerEnabled", set, &rpcIndexerStatus{})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("Expected a readonly user to be refused, got %v", err)
+	}
+
+	var st rpcIndexerStatus
+	enable := &rpcSetIndexerEnabledRequest{Indexer: "apollo", Enabled: true}
+	if err := conn.Invoke(withKey([]byte("admin")), "/cardigann.Cardigann/SetIndexerEnabled", enable, &st); err != nil {
+		t.Fatal(err)
+	}
+
+	if !st.Enabled || !config.IsSectionEnabled("apollo", conf) {
+		t.Fatalf("Expected apollo to be enabled, got %#v", st)
+	}
+
+	h.Params.ReadOnly = true
+	err = conn.Invoke(withKey([]byte("admin")), "/cardigann.Cardigann/SetIndexerEnabled", set, &rpcIndexerStatus{})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("Expected changes to be refused in read-only mode, got %v", err)
+	}
+}
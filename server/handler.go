@@ -2,6 +2,7 @@
 package server
 
 import (
+	"bytes"
 	"encoding/hex"
 	"encoding/xml"
 	"errors"
@@ -11,13 +12,17 @@ import (
 	"net/url"
 	"path"
 	"strings"
+	"sync"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/cardigann/cardigann/config"
 	"github.com/cardigann/cardigann/indexer"
 	"github.com/cardigann/cardigann/logger"
+	"github.com/cardigann/cardigann/scheduler"
+	"github.com/cardigann/cardigann/store"
 	"github.com/cardigann/cardigann/torrentpotato"
 	"github.com/cardigann/cardigann/torznab"
+	"github.com/cardigann/cardigann/updates"
 	"github.com/gorilla/mux"
 )
 
@@ -35,26 +40,94 @@ type Params struct {
 	APIKey     []byte
 	Passphrase string
 	Config     config.Config
+	Store      *store.Store
 	Version    string
+
+	// WebDir serves the web ui from a directory instead of the one built into the binary
+	WebDir string
+
+	// ReadOnly turns off everything that changes the config, leaving search and downloads
+	ReadOnly bool
+
+	// LowMemory lowers the limits of indexers and searches aggregated indexers one at a time
+	LowMemory bool
+
+	// Offline serves searches from cached results, and doesn't reach trackers or the internet
+	// in the background
+	Offline bool
+
+	// Scorer orders the results of aggregate searches, instead of the one set up by the
+	// scoreweights config, for applications that embed the server
+	Scorer indexer.Scorer
 }
 
 type handler struct {
 	http.Handler
-	Params      Params
-	FileHandler http.Handler
-	indexers    map[string]torznab.Indexer
+	Params       Params
+	FileHandler  http.Handler
+	indexers     map[string]torznab.Indexer
+	indexersLock sync.Mutex
+	scheduler    *scheduler.Scheduler
+
+	// aliases are the keys that indexers have been looked up by that aren't their own
+	aliases map[string]indexer.Alias
+
+	// updates is the result of the latest check for updates, if there's been one
+	updates     *updates.Status
+	updatesLock sync.Mutex
+
+	// verifications are the latest checks of each indexer, and verifying the ones in progress
+	verifications     map[string]indexer.Verification
+	verifying         map[string]bool
+	verificationsLock sync.Mutex
+
+	// errorFeedLock guards reading and trimming the error feeds in the store
+	errorFeedLock sync.Mutex
+
+	// layoutsLock guards comparing and updating the layout baselines in the store
+	layoutsLock sync.Mutex
+
+	// grabsLock guards adding to and trimming the archived grabs in the store
+	grabsLock sync.Mutex
+
+	// auditAppends counts the audit events since the audit log was last trimmed
+	auditAppends int32
+
+	// events passes releases found by scheduled jobs to subscribed clients
+	events *eventHub
+
+	// posters caches the posters that are proxied for results
+	posters *posterCache
 }
 
 func NewHandler(p Params) (http.Handler, error) {
+	return newHandler(p)
+}
+
+func newHandler(p Params) (*handler, error) {
+	fs := FS(useLocalAssets)
+	if p.WebDir != "" {
+		log.Infof("Serving web ui from %s", p.WebDir)
+		fs = http.Dir(p.WebDir)
+	}
+
 	h := &handler{
 		Params: p,
 		FileHandler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			log.Printf("Loading %s from fs", r.URL.RequestURI())
-			http.FileServer(FS(false)).ServeHTTP(w, r)
+			http.FileServer(fs).ServeHTTP(w, r)
 		}),
-		indexers: map[string]torznab.Indexer{},
+		indexers:      map[string]torznab.Indexer{},
+		aliases:       map[string]indexer.Alias{},
+		verifications: map[string]indexer.Verification{},
+		verifying:     map[string]bool{},
+		events:        newEventHub(),
+		posters:       newPosterCache(config.GetCachePath("posters")),
 	}
 
+	h.scheduler = scheduler.New(p.Config, p.Store, h.lookupIndexer)
+	h.scheduler.OnRelease(h.events.publish)
+
 	router := mux.NewRouter()
 
 	// apply the path prefix
@@ -72,6 +145,11 @@ func NewHandler(p Params) (http.Handler, error) {
 	// torznab routes
 	subrouter.HandleFunc("/torznab/{indexer}", h.torznabHandler).Methods("GET")
 	subrouter.HandleFunc("/torznab/{indexer}/api", h.torznabHandler).Methods("GET")
+	subrouter.HandleFunc("/torznab/{indexer}/batch", h.batchHandler).Methods("POST")
+
+	// saved search routes
+	subrouter.HandleFunc("/search/{search}", h.savedSearchHandler).Methods("GET")
+	subrouter.HandleFunc("/search/{search}/api", h.savedSearchHandler).Methods("GET")
 
 	// torrentpotato routes
 	subrouter.HandleFunc("/torrentpotato/{indexer}", h.torrentPotatoHandler).Methods("GET")
@@ -82,22 +160,69 @@ func NewHandler(p Params) (http.Handler, error) {
 	subrouter.HandleFunc("/download/{token}/{filename}", h.downloadHandler).Methods("HEAD")
 	subrouter.HandleFunc("/download/{token}/{filename}", h.downloadHandler).Methods("GET")
 
+	// poster routes
+	subrouter.HandleFunc("/poster/{token}", h.posterHandler).Methods("GET", "HEAD")
+
 	// xhr routes for the webapp
 	subrouter.HandleFunc("/xhr/indexers/{indexer}/test", h.getIndexerTestHandler).Methods("GET")
+	subrouter.HandleFunc("/xhr/indexers/{indexer}/test", h.postIndexerTestHandler).Methods("POST")
+	subrouter.HandleFunc("/xhr/indexers/{indexer}/status", h.getIndexerStatusHandler).Methods("GET")
 	subrouter.HandleFunc("/xhr/indexers/{indexer}/config", h.getIndexersConfigHandler).Methods("GET")
-	subrouter.HandleFunc("/xhr/indexers/{indexer}/config", h.patchIndexersConfigHandler).Methods("PATCH")
+	subrouter.HandleFunc("/xhr/indexers/{indexer}/config", h.mutating(h.patchIndexersConfigHandler)).Methods("PATCH")
+	subrouter.HandleFunc("/xhr/indexers/{indexer}/layout", h.mutating(h.deleteLayoutHandler)).Methods("DELETE")
 	subrouter.HandleFunc("/xhr/indexers", h.getIndexersHandler).Methods("GET")
-	subrouter.HandleFunc("/xhr/indexers", h.patchIndexersHandler).Methods("PATCH")
+	subrouter.HandleFunc("/xhr/indexers", h.mutating(h.patchIndexersHandler)).Methods("PATCH")
 	subrouter.HandleFunc("/xhr/auth", h.getAuthHandler).Methods("GET")
 	subrouter.HandleFunc("/xhr/auth", h.postAuthHandler).Methods("POST")
 	subrouter.HandleFunc("/xhr/version", h.getVersionHandler).Methods("GET")
+	subrouter.HandleFunc("/xhr/updates", h.getUpdatesHandler).Methods("GET")
+	subrouter.HandleFunc("/xhr/audit", h.getAuditHandler).Methods("GET")
+	subrouter.HandleFunc("/xhr/errors", h.getErrorsHandler).Methods("GET")
+	subrouter.HandleFunc("/xhr/events", h.getEventsHandler).Methods("GET")
+	subrouter.HandleFunc("/xhr/jobs", h.getJobsHandler).Methods("GET")
+	subrouter.HandleFunc("/xhr/jobs/{job}", h.mutating(h.putJobHandler)).Methods("PUT")
+	subrouter.HandleFunc("/xhr/jobs/{job}", h.mutating(h.deleteJobHandler)).Methods("DELETE")
+	subrouter.HandleFunc("/xhr/jobs/{job}/run", h.runJobHandler).Methods("POST")
+	subrouter.HandleFunc("/xhr/searches", h.getSavedSearchesHandler).Methods("GET")
+	subrouter.HandleFunc("/xhr/searches/{search}", h.mutating(h.putSavedSearchHandler)).Methods("PUT")
+	subrouter.HandleFunc("/xhr/searches/{search}", h.mutating(h.deleteSavedSearchHandler)).Methods("DELETE")
+	subrouter.HandleFunc("/xhr/grabs", h.getGrabsHandler).Methods("GET")
+	subrouter.HandleFunc("/xhr/grabs/{grab}/torrent", h.getGrabTorrentHandler).Methods("GET")
+	subrouter.HandleFunc("/xhr/grabs/{grab}", h.mutating(h.deleteGrabHandler)).Methods("DELETE")
+	subrouter.HandleFunc("/xhr/logging", h.getLoggingHandler).Methods("GET")
+	subrouter.HandleFunc("/xhr/logging", h.mutating(h.putLoggingHandler)).Methods("PUT")
 
 	// anything else
 	subrouter.PathPrefix("/").Handler(h.FileHandler)
 	subrouter.PathPrefix("/static").Handler(h.FileHandler)
 
 	h.Handler = router
-	return h, h.initialize()
+	if err := h.initialize(); err != nil {
+		return h, err
+	}
+
+	if err := h.startBackups(); err != nil {
+		return h, err
+	}
+
+	// scheduled jobs, update checks, verification and warming up all reach trackers or the
+	// internet, so none of them run offline
+	if h.Params.Offline {
+		return h, nil
+	}
+
+	h.scheduler.Start()
+	h.startUpdateCheck()
+
+	if err := h.startVerification(); err != nil {
+		return h, err
+	}
+
+	if err := h.startWarmUp(); err != nil {
+		return h, err
+	}
+
+	return h, nil
 }
 
 func (h *handler) initialize() error {
@@ -114,6 +239,10 @@ func (h *handler) initialize() error {
 				return err
 			}
 			h.Params.APIKey = k
+			if h.Params.ReadOnly {
+				log.Warn("Using an api key that changes on each restart, set apikey in the config to keep one")
+				return nil
+			}
 			return h.Params.Config.Set("global", "apikey", fmt.Sprintf("%x", k))
 		}
 		k, err := hex.DecodeString(apiKey)
@@ -139,6 +268,17 @@ func (h *handler) initialize() error {
 	return nil
 }
 
+// mutating wraps a handler that changes the config, refusing requests in read-only mode
+func (h *handler) mutating(f http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.Params.ReadOnly {
+			jsonError(w, "Forbidden, the server is in read-only mode", http.StatusForbidden)
+			return
+		}
+		f(w, r)
+	}
+}
+
 func (h *handler) baseURL(r *http.Request, appendPath string) (*url.URL, error) {
 	proto := "http"
 	if r.TLS != nil {
@@ -157,7 +297,13 @@ func (h *handler) createIndexer(key string) (torznab.Indexer, error) {
 
 	log.WithFields(logrus.Fields{"indexer": key}).Debugf("Loaded indexer")
 	indexer, err := indexer.NewRunner(def, indexer.RunnerOpts{
-		Config: h.Params.Config,
+		Config:      h.Params.Config,
+		OnError:     h.recordFailure,
+		OnLayout:    h.observeLayout,
+		LowMemory:   h.Params.LowMemory,
+		SessionDir:  config.GetDataPath("sessions"),
+		MetadataDir: config.GetCachePath("metadata"),
+		Offline:     h.Params.Offline,
 	}), nil
 	if err != nil {
 		return nil, err
@@ -170,31 +316,74 @@ func (h *handler) lookupIndexer(key string) (torznab.Indexer, error) {
 	if key == "aggregate" {
 		return h.createAggregate()
 	}
+
+	h.indexersLock.Lock()
+	defer h.indexersLock.Unlock()
+
 	if _, ok := h.indexers[key]; !ok {
-		indexer, err := h.createIndexer(key)
+		alias, err := indexer.ResolveAlias(indexer.DefaultDefinitionLoader, key)
 		if err != nil {
+			log.WithError(err).Warnf("Failed to load definition for %q", key)
 			return nil, err
 		}
-		h.indexers[key] = indexer
+
+		// an alias shares the runner of the indexer it refers to, along with its session
+		if alias.Target != key {
+			h.aliases[key] = alias
+			if alias.Deprecated {
+				log.WithFields(logrus.Fields{"indexer": key, "replacement": alias.Target}).Warn(alias.Warning())
+			}
+		}
+
+		ixr, ok := h.indexers[alias.Target]
+		if !ok {
+			if ixr, err = h.createIndexer(alias.Target); err != nil {
+				return nil, err
+			}
+			h.indexers[alias.Target] = ixr
+		}
+		h.indexers[key] = ixr
 	}
 
 	return h.indexers[key], nil
 }
 
+// warnIfDeprecated adds a warning to a response for an indexer that was looked up by a key
+// that has been replaced by another one
+func (h *handler) warnIfDeprecated(w http.ResponseWriter, key string) {
+	h.indexersLock.Lock()
+	alias, ok := h.aliases[key]
+	h.indexersLock.Unlock()
+
+	if ok && alias.Deprecated {
+		w.Header().Add(warningHeader, alias.Warning())
+	}
+}
+
 func (h *handler) createAggregate() (torznab.Indexer, error) {
 	keys, err := indexer.DefaultDefinitionLoader.List()
 	if err != nil {
 		return nil, err
 	}
 
-	agg := indexer.Aggregate{}
+	agg := indexer.Aggregate{
+		Timeout:    indexer.AggregateTimeout(h.Params.Config),
+		MaxLatency: indexer.AggregateMaxLatency(h.Params.Config),
+		Scorer:     h.Params.Scorer,
+	}
+	if agg.Scorer == nil {
+		agg.Scorer = indexer.ConfiguredScorer(h.Params.Config, keys)
+	}
+	if h.Params.LowMemory {
+		agg.Concurrency = 1
+	}
 	for _, key := range keys {
 		if config.IsSectionEnabled(key, h.Params.Config) {
 			indexer, err := h.lookupIndexer(key)
 			if err != nil {
 				return nil, err
 			}
-			agg = append(agg, indexer)
+			agg.Indexers = append(agg.Indexers, indexer)
 		}
 	}
 
@@ -208,15 +397,20 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
 		w.Header().Set("Access-Control-Allow-Headers",
 			"Accept, Cache-Control, Content-Type, Content-Length, Accept-Encoding, Authorization, Last-Event-ID")
+		w.Header().Set("Access-Control-Expose-Headers", requestIDHeader+", "+warningHeader)
 	}
 	if r.Method == "OPTIONS" {
 		return
 	}
 
+	r = withRequestID(w, r)
+	defer recoverHandler(w, r)
+
 	log.WithFields(logrus.Fields{
-		"method": r.Method,
-		"path":   r.URL.RequestURI(),
-		"remote": r.RemoteAddr,
+		"method":  r.Method,
+		"path":    r.URL.RequestURI(),
+		"remote":  r.RemoteAddr,
+		"request": requestID(r),
 	}).Debugf("%s %s", r.Method, r.URL.RequestURI())
 
 	h.Handler.ServeHTTP(w, r)
@@ -227,7 +421,8 @@ func (h *handler) torznabHandler(w http.ResponseWriter, r *http.Request) {
 	indexerID := params["indexer"]
 
 	apiKey := r.URL.Query().Get("apikey")
-	if !h.checkAPIKey(apiKey) {
+	user, ok := h.lookupAPIKey(apiKey)
+	if !ok {
 		torznab.Error(w, "Invalid apikey parameter", torznab.ErrInsufficientPrivs)
 		return
 	}
@@ -238,6 +433,12 @@ func (h *handler) torznabHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.warnIfDeprecated(w, indexerID)
+	h.serveTorznab(w, r, indexer, user)
+}
+
+// serveTorznab answers a torznab request for the caps or a search of an indexer
+func (h *handler) serveTorznab(w http.ResponseWriter, r *http.Request, indexer torznab.Indexer, user *User) {
 	t := r.URL.Query().Get("t")
 
 	if t == "" {
@@ -250,8 +451,13 @@ func (h *handler) torznabHandler(w http.ResponseWriter, r *http.Request) {
 		indexer.Capabilities().ServeHTTP(w, r)
 
 	case "search", "tvsearch", "tv-search", "movie", "movie-search", "moviesearch":
-		feed, err := h.torznabSearch(r, indexer, indexerID)
-		if err != nil {
+		feed, err := h.torznabSearch(r, indexer, user)
+		if isSoftError(err) {
+			setWarning(w, err)
+			if feed == nil || feed.Items == nil {
+				feed = &torznab.ResultFeed{Info: indexer.Info(), Items: []torznab.ResultItem{}}
+			}
+		} else if err != nil {
 			torznab.Error(w, err.Error(), torznab.ErrUnknownError)
 			return
 		}
@@ -278,7 +484,8 @@ func (h *handler) torrentPotatoHandler(w http.ResponseWriter, r *http.Request) {
 	indexerID := params["indexer"]
 
 	apiKey := r.URL.Query().Get("passkey")
-	if !h.checkAPIKey(apiKey) {
+	user, ok := h.lookupAPIKey(apiKey)
+	if !ok {
 		torrentpotato.Error(w, errors.New("Invalid passkey"))
 		return
 	}
@@ -309,13 +516,20 @@ func (h *handler) torrentPotatoHandler(w http.ResponseWriter, r *http.Request) {
 		query.IMDBID = imdbid
 	}
 
+	query.RequestID = requestID(r)
+
 	items, err := indexer.Search(query)
-	if err != nil {
+	if isSoftError(err) {
+		setWarning(w, err)
+		if items == nil {
+			items = []torznab.ResultItem{}
+		}
+	} else if err != nil {
 		torrentpotato.Error(w, err)
 		return
 	}
 
-	rewritten, err := h.rewriteLinks(r, items)
+	rewritten, err := h.rewriteLinks(r, items, user)
 	if err != nil {
 		torrentpotato.Error(w, err)
 		return
@@ -329,7 +543,7 @@ func (h *handler) downloadHandler(w http.ResponseWriter, r *http.Request) {
 	token := params["token"]
 	filename := params["filename"]
 
-	log.WithFields(logrus.Fields{"filename": filename}).Debugf("Processing download via handler")
+	log.WithFields(logrus.Fields{"filename": filename, "request": requestID(r)}).Debugf("Processing download via handler")
 
 	k, err := h.sharedKey()
 	if err != nil {
@@ -338,11 +552,24 @@ func (h *handler) downloadHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	t, err := decodeToken(token, k)
-	if err != nil {
+	if err == errTokenExpired {
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	} else if err != nil {
 		http.Error(w, err.Error(), http.StatusBadGateway)
 		return
 	}
 
+	if err = h.checkDownloadToken(t); err == errTokenExpired {
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	} else if err != nil {
+		log.WithFields(logrus.Fields{"user": t.User, "request": requestID(r)}).
+			WithError(err).Warn("Refused download link")
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
 	indexer, err := h.lookupIndexer(t.Site)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadGateway)
@@ -351,44 +578,123 @@ func (h *handler) downloadHandler(w http.ResponseWriter, r *http.Request) {
 
 	rc, _, err := indexer.Download(t.Link)
 	if err != nil {
+		log.WithFields(logrus.Fields{"site": t.Site, "request": requestID(r)}).
+			WithError(err).Warn("Download failed")
+		if setRetryAfter(w, err) {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusBadGateway)
 		return
 	}
 
+	if r.Method == "GET" {
+		h.audit(r, t.User, auditActionGrab, t.Site, map[string]string{"filename": filename})
+	}
+
 	w.Header().Set("Content-Type", "application/x-bittorrent")
-	w.Header().Set("Content-Disposition", "attachment; filename="+filename)
+	w.Header().Set("Content-Disposition", attachmentDisposition(filename))
 	w.Header().Set("Content-Transfer-Encoding", "binary")
 
 	defer rc.Close()
-	io.Copy(w, rc)
+
+	if r.Method != "GET" {
+		io.Copy(w, rc)
+		return
+	}
+
+	h.copyDownload(w, rc, t.User, t.Site, filename)
+}
+
+// attachmentDisposition returns a Content-Disposition header for downloading a file, with an
+// ascii fallback for the name and the name itself encoded as in RFC 6266
+func attachmentDisposition(filename string) string {
+	fallback := &bytes.Buffer{}
+	encoded := &bytes.Buffer{}
+
+	for _, r := range filename {
+		if r < 0x20 || r >= 0x7f || r == '"' || r == '\\' {
+			fallback.WriteByte('_')
+		} else {
+			fallback.WriteRune(r)
+		}
+	}
+
+	for _, b := range []byte(filename) {
+		if isAttrChar(b) {
+			encoded.WriteByte(b)
+		} else {
+			fmt.Fprintf(encoded, "%%%02X", b)
+		}
+	}
+
+	return fmt.Sprintf(`attachment; filename="%s"; filename*=UTF-8''%s`, fallback.String(), encoded.String())
 }
 
-func (h *handler) torznabSearch(r *http.Request, indexer torznab.Indexer, siteKey string) (*torznab.ResultFeed, error) {
+// isAttrChar returns whether a byte can appear unencoded in an RFC 5987 extended value
+func isAttrChar(b byte) bool {
+	switch {
+	case 'a' <= b && b <= 'z', 'A' <= b && b <= 'Z', '0' <= b && b <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$&+-.^_`|~", b) >= 0
+}
+
+func (h *handler) torznabSearch(r *http.Request, indexer torznab.Indexer, user *User) (*torznab.ResultFeed, error) {
 	query, err := torznab.ParseQuery(r.URL.Query())
 	if err != nil {
 		return nil, err
 	}
 
-	items, err := indexer.Search(query)
-	if err != nil {
-		return nil, err
+	query.RequestID = requestID(r)
+
+	// saved searches run their own query, which their results are filtered by
+	if qr, ok := indexer.(queryResolver); ok {
+		if query, err = qr.resolveQuery(query); err != nil {
+			return nil, err
+		}
+	}
+
+	// soft errors like partial results from an aggregate are returned along with the feed
+	items, searchErr := indexer.Search(query)
+	h.recordStragglers(query, searchErr)
+	if searchErr != nil && !isSoftError(searchErr) {
+		return nil, searchErr
 	}
 
+	filter := query
+	filter.Languages = h.resultLanguages(query, user)
+	items = torznab.Filter(items, filter)
+
 	feed := &torznab.ResultFeed{
 		Info:  indexer.Info(),
 		Items: items,
 	}
 
-	rewritten, err := h.rewriteLinks(r, items)
+	rewritten, err := h.rewriteLinks(r, items, user)
 	if err != nil {
 		return nil, err
 	}
 
 	feed.Items = rewritten
-	return feed, err
+	return feed, searchErr
+}
+
+// resultLanguages returns the languages that results are filtered to, which are the ones the
+// query asks for, or otherwise the user's, or otherwise the languages in the global config
+func (h *handler) resultLanguages(query torznab.Query, user *User) []string {
+	if len(query.Languages) > 0 {
+		return query.Languages
+	}
+
+	if user != nil && len(user.Languages) > 0 {
+		return user.Languages
+	}
+
+	return indexer.ConfiguredLanguages(h.Params.Config)
 }
 
-func (h *handler) rewriteLinks(r *http.Request, items []torznab.ResultItem) ([]torznab.ResultItem, error) {
+func (h *handler) rewriteLinks(r *http.Request, items []torznab.ResultItem, user *User) ([]torznab.ResultItem, error) {
 	baseURL, err := h.baseURL(r, "/download")
 	if err != nil {
 		return nil, err
@@ -399,17 +705,29 @@ func (h *handler) rewriteLinks(r *http.Request, items []torznab.ResultItem) ([]t
 		return nil, err
 	}
 
+	posterURL, err := h.baseURL(r, "/poster")
+	if err != nil {
+		return nil, err
+	}
+
 	// rewrite non-magnet links to use the server
 	for idx, item := range items {
-		if strings.HasPrefix(item.Link, "magnet:") {
-			continue
+		// posters are proxied too, as sites often need a login to see them
+		if item.Poster != "" {
+			pte, err := newPosterToken(item.Site, item.Poster).Encode(k)
+			if err != nil {
+				return nil, err
+			}
+			items[idx].Poster = fmt.Sprintf("%s/%s", posterURL.String(), pte)
 		}
 
-		t := &token{
-			Site: item.Site,
-			Link: item.Link,
+		// results served offline have no link, as links aren't kept with them
+		if item.Link == "" || strings.HasPrefix(item.Link, "magnet:") {
+			continue
 		}
 
+		t := h.newDownloadToken(item.Site, item.Link, user)
+
 		te, err := t.Encode(k)
 		if err != nil {
 			log.Debugf("Error encoding token: %v", err)
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/cardigann/cardigann/scheduler"
+	"github.com/gorilla/mux"
+)
+
+type jobView struct {
+	scheduler.Job
+	Status scheduler.JobStatus `json:"status"`
+}
+
+func (h *handler) getJobsHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.authorizeRequest(w, r, RoleReadOnly)
+	if !ok {
+		return
+	}
+
+	jobs, err := scheduler.LoadJobs(h.Params.Config)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	views := []jobView{}
+	for _, job := range jobs {
+		view := jobView{Job: job, Status: h.scheduler.Status(job)}
+
+		// admins see the whole target so that they can edit jobs without entering it again
+		if !user.IsAdmin() {
+			view.Target = scheduler.RedactTarget(job.Target)
+		}
+
+		views = append(views, view)
+	}
+
+	jsonOutput(w, views)
+}
+
+func (h *handler) putJobHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.authorizeRequest(w, r, RoleAdmin)
+	if !ok {
+		return
+	}
+
+	var job scheduler.Job
+	if err := json.NewDecoder(r.Body).Decode(&job); err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	job.Name = mux.Vars(r)["job"]
+
+	if err := scheduler.SaveJob(h.Params.Config, job); err != nil {
+		jsonError(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	h.audit(r, user.Name, auditActionJob, "", map[string]string{
+		"job":      job.Name,
+		"schedule": job.Schedule,
+		"query":    job.Query,
+		"target":   scheduler.RedactTarget(job.Target),
+		"dryrun":   fmt.Sprintf("%v", job.DryRun),
+	})
+
+	jsonOutput(w, job)
+}
+
+func (h *handler) deleteJobHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.authorizeRequest(w, r, RoleAdmin)
+	if !ok {
+		return
+	}
+
+	name := mux.Vars(r)["job"]
+
+	if err := scheduler.DeleteJob(h.Params.Config, name); err != nil {
+		jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.scheduler.Forget(name); err != nil {
+		jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.audit(r, user.Name, auditActionDeleteJob, "", map[string]string{"job": name})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) runJobHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.authorizeRequest(w, r, RoleAdmin); !ok {
+		return
+	}
+
+	job, err := scheduler.LoadJob(h.Params.Config, mux.Vars(r)["job"])
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	// a one off dry run checks what a job would push, without changing the job or its status
+	if r.URL.Query().Get("dryrun") == "true" {
+		status, err := h.scheduler.DryRun(job)
+		if err != nil {
+			jsonError(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		jsonOutput(w, jobView{Job: job, Status: status})
+		return
+	}
+
+	if err := h.scheduler.Run(job); err != nil {
+		jsonError(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	jsonOutput(w, jobView{Job: job, Status: h.scheduler.Status(job)})
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cardigann/cardigann/indexer"
+	"github.com/gorilla/mux"
+)
+
+// layoutsBucket is where the baseline layout of each indexer's search results page is stored
+const layoutsBucket = "layouts"
+
+// layoutView is a sharp change in an indexer's search results page, which usually means that a
+// redesign of the site has broken its definition
+type layoutView struct {
+	Changes []string  `json:"changes"`
+	Since   time.Time `json:"since"`
+}
+
+// observeLayout compares a snapshot of an indexer's search results page to its baseline, and
+// reports the first snapshot that has changed sharply in the log and the error feed
+func (h *handler) observeLayout(s indexer.LayoutSnapshot) {
+	if h.Params.Store == nil {
+		return
+	}
+
+	h.layoutsLock.Lock()
+	defer h.layoutsLock.Unlock()
+
+	var b indexer.LayoutBaseline
+	if _, err := h.Params.Store.Get(layoutsBucket, s.Site, &b); err != nil {
+		log.WithError(err).Warn("Failed to read layout baseline")
+		return
+	}
+
+	changedBefore := len(b.Changes) > 0
+	changes := b.Observe(s)
+
+	if err := h.Params.Store.Put(layoutsBucket, s.Site, b); err != nil {
+		log.WithError(err).Warn("Failed to save layout baseline")
+	}
+
+	l := log.WithFields(logrus.Fields{"site": s.Site, "rows": s.Rows})
+	switch {
+	case len(changes) == 0 && changedBefore:
+		l.Info("Search results layout is back to normal")
+	case len(changes) > 0 && !changedBefore:
+		err := &indexer.LayoutChangedError{Site: s.Site, Changes: changes}
+		l.Warn(err.Error())
+		h.recordFailure(indexer.Failure{Site: s.Site, Operation: "layout", Err: err})
+	}
+}
+
+// layoutView returns how an indexer's search results page has changed, if it has
+func (h *handler) layoutView(key string) *layoutView {
+	if h.Params.Store == nil {
+		return nil
+	}
+
+	h.layoutsLock.Lock()
+	defer h.layoutsLock.Unlock()
+
+	var b indexer.LayoutBaseline
+	if ok, err := h.Params.Store.Get(layoutsBucket, key, &b); err != nil || !ok || len(b.Changes) == 0 {
+		return nil
+	}
+
+	view := &layoutView{Since: b.ChangedAt}
+	for _, c := range b.Changes {
+		view.Changes = append(view.Changes, c.String())
+	}
+	return view
+}
+
+// deleteLayoutHandler forgets an indexer's baseline layout, for when its search results page
+// has changed for good and a new baseline should be taken from the next snapshots
+func (h *handler) deleteLayoutHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.authorizeRequest(w, r, RoleAdmin)
+	if !ok {
+		return
+	}
+
+	key := mux.Vars(r)["indexer"]
+
+	if h.Params.Store != nil {
+		h.layoutsLock.Lock()
+		err := h.Params.Store.Delete(layoutsBucket, key)
+		h.layoutsLock.Unlock()
+
+		if err != nil {
+			jsonError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	h.audit(r, user.Name, auditActionResetLayout, key, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
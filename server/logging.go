@@ -0,0 +1,82 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cardigann/cardigann/logger"
+)
+
+// loggingView is the runtime log level, along with any indexers that log at a different level
+type loggingView struct {
+	Level string            `json:"level"`
+	Sites map[string]string `json:"sites"`
+}
+
+func currentLogging() loggingView {
+	view := loggingView{
+		Level: logger.Level().String(),
+		Sites: map[string]string{},
+	}
+
+	for site, level := range logger.SiteLevels() {
+		view.Sites[site] = level.String()
+	}
+
+	return view
+}
+
+func (h *handler) getLoggingHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.authorizeRequest(w, r, RoleAdmin); !ok {
+		return
+	}
+
+	jsonOutput(w, currentLogging())
+}
+
+func (h *handler) putLoggingHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.authorizeRequest(w, r, RoleAdmin)
+	if !ok {
+		return
+	}
+
+	var req loggingView
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	// validate everything before changing anything
+	level, err := logrus.ParseLevel(req.Level)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	siteLevels := map[string]logrus.Level{}
+	for site, l := range req.Sites {
+		if siteLevels[site], err = logrus.ParseLevel(l); err != nil {
+			jsonError(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+	}
+
+	logger.SetLevel(level)
+
+	for site := range logger.SiteLevels() {
+		if _, ok := siteLevels[site]; !ok {
+			logger.ClearSiteLevel(site)
+		}
+	}
+
+	details := map[string]string{"level": level.String()}
+	for site, l := range siteLevels {
+		logger.SetSiteLevel(site, l)
+		details[site] = l.String()
+	}
+
+	h.audit(r, user.Name, auditActionLogging, "", details)
+	jsonOutput(w, currentLogging())
+}
@@ -0,0 +1,278 @@
+package server
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cardigann/cardigann/config"
+	"github.com/cardigann/cardigann/indexer"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// posterCacheAge is how long a poster is served from the cache before being fetched again
+	posterCacheAge = 7 * 24 * time.Hour
+
+	// posterMaxSize is the largest poster image that will be proxied
+	posterMaxSize = 5 * 1024 * 1024
+
+	// posterLinkLifetime is how long a rewritten poster link works for
+	posterLinkLifetime = 7 * 24 * time.Hour
+
+	// defaultPosterCacheSize is how much space cached posters take up before the least recently
+	// used are removed, unless postercachesize says otherwise
+	defaultPosterCacheSize int64 = 100 * 1024 * 1024
+)
+
+var errPosterExpired = errors.New("Poster link has expired, search again for a new one")
+
+// posterCache keeps posters in files in a dir, removing the least recently used ones once they
+// take up more than the size given to put
+type posterCache struct {
+	dir string
+
+	mu      sync.Mutex
+	loaded  bool
+	used    *list.List
+	entries map[string]*list.Element
+	total   int64
+}
+
+type posterCacheEntry struct {
+	name string
+	size int64
+}
+
+func newPosterCache(dir string) *posterCache {
+	return &posterCache{dir: dir, used: list.New(), entries: map[string]*list.Element{}}
+}
+
+// posterCacheName returns the name of the file that a poster fetched from a url is cached in
+func posterCacheName(link string) string {
+	sum := sha1.Sum([]byte(link))
+	return hex.EncodeToString(sum[:])
+}
+
+// load reads what's in the cache dir, oldest first, the first time the cache is used. It must
+// be called whilst holding the lock
+func (c *posterCache) load() {
+	if c.loaded {
+		return
+	}
+	c.loaded = true
+
+	files, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return
+	}
+
+	sort.Sort(filesByModTime(files))
+	for _, fi := range files {
+		if fi.IsDir() || strings.HasPrefix(fi.Name(), ".") {
+			continue
+		}
+		c.entries[fi.Name()] = c.used.PushFront(&posterCacheEntry{name: fi.Name(), size: fi.Size()})
+		c.total += fi.Size()
+	}
+}
+
+// get returns a poster from the cache, if it was cached recently enough
+func (c *posterCache) get(link string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.load()
+
+	name := posterCacheName(link)
+	f := filepath.Join(c.dir, name)
+
+	fi, err := os.Stat(f)
+	if err != nil || time.Since(fi.ModTime()) > posterCacheAge {
+		return nil, false
+	}
+
+	b, err := ioutil.ReadFile(f)
+	if err != nil {
+		return nil, false
+	}
+
+	if el, ok := c.entries[name]; ok {
+		c.used.MoveToFront(el)
+	}
+
+	return b, true
+}
+
+// put writes a poster to the cache via a temp file, so that concurrent requests never see half
+// of one, and then removes the least recently used posters until they fit within maxSize
+func (c *posterCache) put(link string, b []byte, maxSize int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.load()
+
+	if err := os.MkdirAll(c.dir, 0700); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(c.dir, ".poster")
+	if err != nil {
+		return err
+	}
+
+	if _, err = tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	name := posterCacheName(link)
+	if err = os.Rename(tmp.Name(), filepath.Join(c.dir, name)); err != nil {
+		return err
+	}
+
+	if el, ok := c.entries[name]; ok {
+		c.total -= el.Value.(*posterCacheEntry).size
+		c.used.Remove(el)
+	}
+	c.entries[name] = c.used.PushFront(&posterCacheEntry{name: name, size: int64(len(b))})
+	c.total += int64(len(b))
+
+	for c.total > maxSize && c.used.Len() > 1 {
+		entry := c.used.Remove(c.used.Back()).(*posterCacheEntry)
+		delete(c.entries, entry.name)
+		c.total -= entry.size
+		if err := os.Remove(filepath.Join(c.dir, entry.name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type filesByModTime []os.FileInfo
+
+func (slice filesByModTime) Len() int {
+	return len(slice)
+}
+
+func (slice filesByModTime) Less(i, j int) bool {
+	return slice[i].ModTime().Before(slice[j].ModTime())
+}
+
+func (slice filesByModTime) Swap(i, j int) {
+	slice[i], slice[j] = slice[j], slice[i]
+}
+
+// posterCacheSize returns how much space cached posters can take up, from postercachesize
+func (h *handler) posterCacheSize() int64 {
+	val, err := config.GetGlobalConfig("postercachesize", "", h.Params.Config)
+	if err != nil || val == "" {
+		return defaultPosterCacheSize
+	}
+
+	n, err := indexer.ParseSize(val)
+	if err != nil {
+		log.Warnf("Ignoring invalid postercachesize %q", val)
+		return defaultPosterCacheSize
+	}
+
+	return n
+}
+
+// newPosterToken returns a token for proxying a poster, which expires after posterLinkLifetime
+func newPosterToken(site, link string) *token {
+	return &token{
+		Site:    site,
+		Link:    link,
+		Expires: time.Now().Add(posterLinkLifetime),
+		Purpose: tokenPurposePoster,
+	}
+}
+
+// fetchPoster downloads a poster via the indexer, so that images on sites that need a
+// login to see them can be shown by clients
+func (h *handler) fetchPoster(site, link string) ([]byte, error) {
+	indexer, err := h.lookupIndexer(site)
+	if err != nil {
+		return nil, err
+	}
+
+	rc, _, err := indexer.Download(link)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	b, err := ioutil.ReadAll(io.LimitReader(rc, posterMaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) > posterMaxSize {
+		return nil, fmt.Errorf("Poster at %s is larger than %d bytes", link, posterMaxSize)
+	}
+
+	if ct := http.DetectContentType(b); !strings.HasPrefix(ct, "image/") {
+		return nil, fmt.Errorf("Poster at %s is %s rather than an image", link, ct)
+	}
+
+	return b, nil
+}
+
+func (h *handler) posterHandler(w http.ResponseWriter, r *http.Request) {
+	k, err := h.sharedKey()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	t, err := decodeToken(mux.Vars(r)["token"], k)
+	if err == errTokenExpired || (err == nil && t.Expires.IsZero()) {
+		http.Error(w, errPosterExpired.Error(), http.StatusGone)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	} else if t.Purpose != tokenPurposePoster {
+		http.Error(w, errTokenPurpose.Error(), http.StatusForbidden)
+		return
+	}
+
+	b, ok := h.posters.get(t.Link)
+	if !ok {
+		if b, err = h.fetchPoster(t.Site, t.Link); err != nil {
+			log.WithFields(logrus.Fields{"site": t.Site, "request": requestID(r)}).
+				WithError(err).Warn("Fetching poster failed")
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		if err = h.posters.put(t.Link, b, h.posterCacheSize()); err != nil {
+			log.WithError(err).Warn("Failed to cache poster")
+		}
+	}
+
+	w.Header().Set("Content-Type", http.DetectContentType(b))
+	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", int(posterCacheAge.Seconds())))
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(b))
+}
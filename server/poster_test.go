@@ -0,0 +1,46 @@
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestPosterCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "posters")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := newPosterCache(dir)
+	poster := bytes.Repeat([]byte("x"), 100)
+
+	for _, link := range []string{"a", "b"} {
+		if err := c.put(link, poster, 250); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a is shown again, so b is the least recently used when c doesn't fit
+	if _, ok := c.get("a"); !ok {
+		t.Fatal("Expected a to be cached")
+	}
+
+	if err := c.put("c", poster, 250); err != nil {
+		t.Fatal(err)
+	}
+
+	for link, expected := range map[string]bool{"a": true, "b": false, "c": true} {
+		if _, ok := c.get(link); ok != expected {
+			t.Errorf("Expected %s to be cached %v, got %v", link, expected, ok)
+		}
+	}
+
+	// a new cache over the same dir picks up what's there
+	reloaded := newPosterCache(dir)
+	if reloaded.get("a"); reloaded.total != 200 {
+		t.Fatalf("Expected the cache to hold 200 bytes, got %d", reloaded.total)
+	}
+}
@@ -0,0 +1,63 @@
+//go:build !windows
+// +build !windows
+
+package server
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+func isRoot() bool {
+	return os.Geteuid() == 0
+}
+
+// dropPrivileges switches the process to run as another user and group, which is
+// done after binding so that ports below 1024 can be used
+func dropPrivileges(username, groupname string) error {
+	u, err := user.Lookup(username)
+	if err != nil {
+		return err
+	}
+
+	gidStr := u.Gid
+	if groupname != "" {
+		g, err := user.LookupGroup(groupname)
+		if err != nil {
+			return err
+		}
+		gidStr = g.Gid
+	}
+
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return fmt.Errorf("Invalid uid %q for user %s", u.Uid, username)
+	}
+
+	gid, err := strconv.Atoi(gidStr)
+	if err != nil {
+		return fmt.Errorf("Invalid gid %q", gidStr)
+	}
+
+	// the group has to be changed first, as it can't be once we are no longer root
+	if err = syscall.Setgroups([]int{gid}); err != nil {
+		return fmt.Errorf("Failed to set supplementary groups: %v", err)
+	}
+
+	if err = syscall.Setgid(gid); err != nil {
+		return fmt.Errorf("Failed to set group to %d: %v", gid, err)
+	}
+
+	if err = syscall.Setuid(uid); err != nil {
+		return fmt.Errorf("Failed to set user to %d: %v", uid, err)
+	}
+
+	// cache and data dirs are resolved from the home directory
+	os.Setenv("HOME", u.HomeDir)
+	os.Setenv("USER", u.Username)
+
+	return nil
+}
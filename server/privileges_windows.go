@@ -0,0 +1,11 @@
+package server
+
+import "errors"
+
+func isRoot() bool {
+	return false
+}
+
+func dropPrivileges(username, groupname string) error {
+	return errors.New("Running as another user isn't supported on windows, use the service account instead")
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// recoverHandler logs a panic in a handler along with its stack trace and answers with a 500,
+// rather than the client seeing its connection dropped. Indexers recover from their own panics
+// and back off, this catches bugs in the handlers themselves. It must be deferred directly
+func recoverHandler(w http.ResponseWriter, r *http.Request) {
+	rec := recover()
+	if rec == nil {
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"method":  r.Method,
+		"path":    r.URL.Path,
+		"request": requestID(r),
+		"panic":   fmt.Sprintf("%v", rec),
+		"stack":   string(debug.Stack()),
+	}).Error("Recovered from a crash handling a request")
+
+	msg := "Internal server error"
+	if id := requestID(r); id != "" {
+		msg += ", see the log for request " + id
+	}
+	http.Error(w, msg, http.StatusInternalServerError)
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+)
+
+const requestIDHeader = "X-Request-Id"
+
+type requestIDKey struct{}
+
+// ids passed in by a client or an upstream proxy are reused, as long as they are safe to log
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// withRequestID assigns an id to the request and returns it in a response header, so that
+// a failure seen by a client can be matched up with the log lines it caused
+func withRequestID(w http.ResponseWriter, r *http.Request) *http.Request {
+	id := r.Header.Get(requestIDHeader)
+	if !validRequestID.MatchString(id) {
+		var err error
+		if id, err = randomHex(8); err != nil {
+			log.WithError(err).Warn("Failed to generate request id")
+			return r
+		}
+	}
+
+	w.Header().Set(requestIDHeader, id)
+	return r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id))
+}
+
+// requestID returns the id assigned to a request, or an empty string if it hasn't got one
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
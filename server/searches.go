@@ -0,0 +1,405 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cardigann/cardigann/config"
+	"github.com/cardigann/cardigann/indexer"
+	"github.com/cardigann/cardigann/torznab"
+	"github.com/gorilla/mux"
+)
+
+const (
+	searchSectionPrefix = "search:"
+)
+
+// SavedSearch is a named search across some indexers, with filters applied to the results, that
+// has its own torznab feed
+type SavedSearch struct {
+	Name     string   `json:"name"`
+	Query    string   `json:"query"`
+	Indexers []string `json:"indexers"`
+
+	// MinSeeders, MaxSize (like 4G), Include and Exclude (regular expressions matched against
+	// titles) filter the results
+	MinSeeders int    `json:"minseeders,omitempty"`
+	MaxSize    string `json:"maxsize,omitempty"`
+	Include    string `json:"include,omitempty"`
+	Exclude    string `json:"exclude,omitempty"`
+}
+
+// ParseQuery parses the search's query, which is in the same format as a torznab query string
+func (s SavedSearch) ParseQuery() (torznab.Query, error) {
+	vals, err := url.ParseQuery(s.Query)
+	if err != nil {
+		return torznab.Query{}, fmt.Errorf("Invalid query %q: %v", s.Query, err)
+	}
+	return torznab.ParseQuery(vals)
+}
+
+// Validate checks that the query and filters of the search can be parsed
+func (s SavedSearch) Validate() error {
+	if s.Name == "" {
+		return errors.New("A saved search must have a name")
+	}
+
+	if strings.ContainsAny(s.Name, "/?#") {
+		return errors.New("A saved search name can't contain /, ? or #")
+	}
+
+	if _, err := s.ParseQuery(); err != nil {
+		return err
+	}
+
+	if len(s.Indexers) == 0 {
+		return errors.New("A saved search must have at least one indexer")
+	}
+
+	_, err := s.filter()
+	return err
+}
+
+// searchFilter is the compiled filters of a saved search
+type searchFilter struct {
+	minSeeders int
+	maxSize    uint64
+	include    *regexp.Regexp
+	exclude    *regexp.Regexp
+}
+
+func (s SavedSearch) filter() (*searchFilter, error) {
+	f := &searchFilter{minSeeders: s.MinSeeders}
+
+	if s.MaxSize != "" {
+		n, err := indexer.ParseSize(s.MaxSize)
+		if err != nil {
+			return nil, err
+		}
+		f.maxSize = uint64(n)
+	}
+
+	var err error
+	if s.Include != "" {
+		if f.include, err = regexp.Compile("(?i)" + s.Include); err != nil {
+			return nil, fmt.Errorf("Invalid include pattern %q: %v", s.Include, err)
+		}
+	}
+
+	if s.Exclude != "" {
+		if f.exclude, err = regexp.Compile("(?i)" + s.Exclude); err != nil {
+			return nil, fmt.Errorf("Invalid exclude pattern %q: %v", s.Exclude, err)
+		}
+	}
+
+	return f, nil
+}
+
+func (f *searchFilter) matches(item torznab.ResultItem) bool {
+	switch {
+	case item.Seeders < f.minSeeders:
+		return false
+	case f.maxSize > 0 && item.Size > f.maxSize:
+		return false
+	case f.include != nil && !f.include.MatchString(item.Title):
+		return false
+	case f.exclude != nil && f.exclude.MatchString(item.Title):
+		return false
+	}
+	return true
+}
+
+// LoadSavedSearches returns the saved searches defined in the config, sorted by name
+func LoadSavedSearches(conf config.Config) ([]SavedSearch, error) {
+	sections, err := conf.Sections()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(sections)
+
+	searches := []SavedSearch{}
+	for _, section := range sections {
+		if !strings.HasPrefix(section, searchSectionPrefix) {
+			continue
+		}
+
+		vals, err := conf.Section(section)
+		if err != nil {
+			return nil, err
+		}
+
+		minSeeders, _ := strconv.Atoi(vals["minseeders"])
+
+		searches = append(searches, SavedSearch{
+			Name:       strings.TrimPrefix(section, searchSectionPrefix),
+			Query:      vals["query"],
+			Indexers:   splitList(vals["indexers"]),
+			MinSeeders: minSeeders,
+			MaxSize:    vals["maxsize"],
+			Include:    vals["include"],
+			Exclude:    vals["exclude"],
+		})
+	}
+
+	return searches, nil
+}
+
+// LoadSavedSearch returns a single saved search from the config
+func LoadSavedSearch(conf config.Config, name string) (SavedSearch, error) {
+	searches, err := LoadSavedSearches(conf)
+	if err != nil {
+		return SavedSearch{}, err
+	}
+
+	for _, s := range searches {
+		if s.Name == name {
+			return s, nil
+		}
+	}
+
+	return SavedSearch{}, fmt.Errorf("Unknown saved search %q", name)
+}
+
+// SaveSavedSearch validates a saved search and then writes it to the config
+func SaveSavedSearch(conf config.Config, s SavedSearch) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+
+	section := searchSectionPrefix + s.Name
+
+	for key, val := range map[string]string{
+		"query":      s.Query,
+		"indexers":   strings.Join(s.Indexers, ","),
+		"minseeders": strconv.Itoa(s.MinSeeders),
+		"maxsize":    s.MaxSize,
+		"include":    s.Include,
+		"exclude":    s.Exclude,
+	} {
+		if err := conf.Set(section, key, val); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteSavedSearch removes a saved search from the config
+func DeleteSavedSearch(conf config.Config, name string) error {
+	return conf.DeleteSection(searchSectionPrefix + name)
+}
+
+func splitList(s string) []string {
+	results := []string{}
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			results = append(results, item)
+		}
+	}
+	return results
+}
+
+// savedSearchIndexer runs a saved search whenever it's searched, so that it can be served as a feed
+type savedSearchIndexer struct {
+	torznab.Indexer
+	search SavedSearch
+	filter *searchFilter
+	events *eventHub
+}
+
+func (s savedSearchIndexer) Info() torznab.Info {
+	info := s.Indexer.Info()
+	info.ID = searchSectionPrefix + s.search.Name
+	info.Title = s.search.Name
+	return info
+}
+
+// queryResolver is implemented by indexers that run a different query from the one they're
+// given, so that their results are filtered by the query that was run
+type queryResolver interface {
+	resolveQuery(query torznab.Query) (torznab.Query, error)
+}
+
+// resolveQuery returns the saved query, with the paging and request id of the one given
+func (s savedSearchIndexer) resolveQuery(query torznab.Query) (torznab.Query, error) {
+	saved, err := s.search.ParseQuery()
+	if err != nil {
+		return saved, err
+	}
+
+	saved.Limit = query.Limit
+	saved.Offset = query.Offset
+	saved.RequestID = query.RequestID
+	return saved, nil
+}
+
+// Search runs the saved query rather than the one given, apart from paging. The results are
+// filtered by the saved search's filters, the query's own are applied by the caller. Results
+// that weren't in the feed before are published to event subscribers
+func (s savedSearchIndexer) Search(query torznab.Query) ([]torznab.ResultItem, error) {
+	saved, err := s.resolveQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := s.Indexer.Search(saved)
+	if err != nil && !isSoftError(err) {
+		return nil, err
+	}
+
+	filtered := []torznab.ResultItem{}
+	for _, item := range items {
+		if s.filter.matches(item) {
+			filtered = append(filtered, item)
+		}
+	}
+
+	// later pages are older results, which aren't new to the feed
+	if s.events != nil && query.Offset == 0 {
+		s.events.discover(s.search.Name, filtered)
+	}
+
+	return filtered, err
+}
+
+// lookupSavedSearch returns an indexer that runs a saved search across its indexers
+func (h *handler) lookupSavedSearch(name string) (torznab.Indexer, error) {
+	s, err := LoadSavedSearch(h.Params.Config, name)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := s.filter()
+	if err != nil {
+		return nil, err
+	}
+
+	var ixr torznab.Indexer
+	if len(s.Indexers) == 1 {
+		if ixr, err = h.lookupIndexer(s.Indexers[0]); err != nil {
+			return nil, err
+		}
+	} else {
+		agg := indexer.Aggregate{
+			Timeout:    indexer.AggregateTimeout(h.Params.Config),
+			MaxLatency: indexer.AggregateMaxLatency(h.Params.Config),
+		}
+		for _, key := range s.Indexers {
+			i, err := h.lookupIndexer(key)
+			if err != nil {
+				return nil, err
+			}
+			agg.Indexers = append(agg.Indexers, i)
+		}
+		ixr = agg
+	}
+
+	return savedSearchIndexer{Indexer: ixr, search: s, filter: filter, events: h.events}, nil
+}
+
+// savedSearchHandler serves a saved search as a torznab feed
+func (h *handler) savedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.lookupAPIKey(r.URL.Query().Get("apikey"))
+	if !ok {
+		torznab.Error(w, "Invalid apikey parameter", torznab.ErrInsufficientPrivs)
+		return
+	}
+
+	ixr, err := h.lookupSavedSearch(mux.Vars(r)["search"])
+	if err != nil {
+		torznab.Error(w, err.Error(), torznab.ErrIncorrectParameter)
+		return
+	}
+
+	// a feed reader won't send a search type, so show the results rather than the caps
+	if r.URL.Query().Get("t") == "" {
+		q := r.URL.Query()
+		q.Set("t", "search")
+		r.URL.RawQuery = q.Encode()
+	}
+
+	h.serveTorznab(w, r, ixr, user)
+}
+
+type savedSearchView struct {
+	SavedSearch
+	Feed string `json:"feed"`
+}
+
+func (h *handler) getSavedSearchesHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.authorizeRequest(w, r, RoleReadOnly); !ok {
+		return
+	}
+
+	searches, err := LoadSavedSearches(h.Params.Config)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	views := []savedSearchView{}
+	for _, s := range searches {
+		feed, err := h.baseURL(r, "/search/"+url.PathEscape(s.Name)+"/api")
+		if err != nil {
+			jsonError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		views = append(views, savedSearchView{SavedSearch: s, Feed: feed.String()})
+	}
+
+	jsonOutput(w, views)
+}
+
+func (h *handler) putSavedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.authorizeRequest(w, r, RoleAdmin)
+	if !ok {
+		return
+	}
+
+	var s SavedSearch
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	s.Name = mux.Vars(r)["search"]
+
+	if err := SaveSavedSearch(h.Params.Config, s); err != nil {
+		jsonError(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	h.audit(r, user.Name, auditActionSavedSearch, "", map[string]string{
+		"search":   s.Name,
+		"query":    s.Query,
+		"indexers": strings.Join(s.Indexers, ","),
+	})
+
+	jsonOutput(w, s)
+}
+
+func (h *handler) deleteSavedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.authorizeRequest(w, r, RoleAdmin)
+	if !ok {
+		return
+	}
+
+	name := mux.Vars(r)["search"]
+
+	if err := DeleteSavedSearch(h.Params.Config, name); err != nil {
+		jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.audit(r, user.Name, auditActionDeleteSavedSearch, "", map[string]string{"search": name})
+	w.WriteHeader(http.StatusNoContent)
+}
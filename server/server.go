@@ -1,20 +1,36 @@
 package server
 
 import (
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
+	"runtime/debug"
+	"strconv"
 
 	"github.com/cardigann/cardigann/config"
 	"github.com/cardigann/cardigann/indexer"
 	"github.com/cardigann/cardigann/logger"
+	"github.com/cardigann/cardigann/store"
 )
 
+// lowMemoryGCPercent makes the garbage collector run more often in low memory mode, trading
+// some cpu for a smaller heap
+const lowMemoryGCPercent = 50
+
 // Server is an http server which wraps the Handler
 type Server struct {
 	Bind, Port, Passphrase string
+	GRPCPort               string
 	PathPrefix             string
 	Hostname               string
+	WebDir                 string
+	User, Group            string
+	AllowRoot              bool
+	ReadOnly               bool
+	LowMemory              bool
+	Offline                bool
 	version                string
 	config                 config.Config
 }
@@ -40,6 +56,26 @@ func New(conf config.Config, version string) (*Server, error) {
 		return nil, err
 	}
 
+	webDir, err := config.GetGlobalConfig("webdir", "", conf)
+	if err != nil {
+		return nil, err
+	}
+
+	grpcPort, err := config.GetGlobalConfig("grpcport", "", conf)
+	if err != nil {
+		return nil, err
+	}
+
+	readOnlyVal, err := config.GetGlobalConfig("readonly", "false", conf)
+	if err != nil {
+		return nil, err
+	}
+
+	readOnly, err := strconv.ParseBool(readOnlyVal)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid readonly %q", readOnlyVal)
+	}
+
 	if envPort := os.Getenv("PORT"); envPort != "" {
 		port = envPort
 	}
@@ -52,8 +88,13 @@ func New(conf config.Config, version string) (*Server, error) {
 		Hostname:   "localhost",
 		Bind:       bind,
 		Port:       port,
+		GRPCPort:   grpcPort,
 		Passphrase: passphrase,
 		PathPrefix: prefix,
+		WebDir:     webDir,
+		ReadOnly:   readOnly,
+		LowMemory:  indexer.IsLowMemory(conf),
+		Offline:    indexer.IsOfflineMode(conf),
 		config:     conf,
 		version:    version,
 	}, nil
@@ -62,6 +103,42 @@ func New(conf config.Config, version string) (*Server, error) {
 func (s *Server) Listen() error {
 	logger.Logger.Infof("Cardigann %s", s.version)
 
+	if s.Group != "" && s.User == "" {
+		return errors.New("A group can only be given along with a user to run as")
+	}
+
+	if isRoot() && s.User == "" && !s.AllowRoot {
+		return errors.New("Refusing to run as root, use --user to drop privileges after binding or --allow-root")
+	}
+
+	// bind before anything else, so the port can be below 1024 when we're about to drop privileges
+	listenOn := fmt.Sprintf("%s:%s", s.Bind, s.Port)
+	ln, err := net.Listen("tcp", listenOn)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+
+	var grpcLn net.Listener
+	if s.GRPCPort != "" {
+		if !grpcSupported {
+			return errors.New("A grpc port was given but cardigann was built without gRPC support, rebuild it with -tags grpc")
+		}
+
+		grpcLn, err = net.Listen("tcp", fmt.Sprintf("%s:%s", s.Bind, s.GRPCPort))
+		if err != nil {
+			return err
+		}
+		defer grpcLn.Close()
+	}
+
+	if s.User != "" {
+		if err = dropPrivileges(s.User, s.Group); err != nil {
+			return err
+		}
+		logger.Logger.Infof("Running as user %s", s.User)
+	}
+
 	path, err := config.GetConfigPath()
 	if err != nil {
 		return err
@@ -97,19 +174,52 @@ func (s *Server) Listen() error {
 
 	logger.Logger.Infof("Found %d indexers enabled in configuration", active)
 
-	listenOn := fmt.Sprintf("%s:%s", s.Bind, s.Port)
+	st, err := store.Open(config.GetDataPath(""))
+	if err != nil {
+		return err
+	}
+
+	logger.Logger.Debugf("Data dir is %s", st.Dir())
+
+	if s.ReadOnly {
+		logger.Logger.Info("Running in read-only mode, the config can't be changed")
+	}
+
+	if s.LowMemory {
+		debug.SetGCPercent(lowMemoryGCPercent)
+		logger.Logger.Info("Running in low memory mode")
+	}
+
+	if s.Offline {
+		logger.Logger.Info("Running in offline mode, searches are served from cached results")
+	}
+
 	logger.Logger.Infof("Listening on %s", listenOn)
 
-	h, err := NewHandler(Params{
+	h, err := newHandler(Params{
 		BaseURL:    fmt.Sprintf("http://%s:%s%s", s.Hostname, s.Port, s.PathPrefix),
 		Passphrase: s.Passphrase,
 		PathPrefix: s.PathPrefix,
 		Config:     s.config,
+		Store:      st,
 		Version:    s.version,
+		WebDir:     s.WebDir,
+		ReadOnly:   s.ReadOnly,
+		LowMemory:  s.LowMemory,
+		Offline:    s.Offline,
 	})
 	if err != nil {
 		return err
 	}
 
-	return http.ListenAndServe(listenOn, h)
+	if grpcLn != nil {
+		logger.Logger.Infof("Serving gRPC on %s", grpcLn.Addr())
+		go func() {
+			if err := serveGRPC(grpcLn, h); err != nil {
+				logger.Logger.WithError(err).Error("Serving gRPC failed")
+			}
+		}()
+	}
+
+	return http.Serve(ln, h)
 }
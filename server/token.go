@@ -1,25 +1,68 @@
 package server
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"time"
 
+	"github.com/cardigann/cardigann/config"
 	"github.com/dgrijalva/jwt-go"
 )
 
+const (
+	// defaultDownloadLinkLifetime is how long a rewritten download link works for, unless the
+	// downloadlinklifetime global config says otherwise
+	defaultDownloadLinkLifetime = 24 * time.Hour
+
+	// tokenPurposeDownload and tokenPurposePoster say what a token was made for, as both are
+	// signed with the same key
+	tokenPurposeDownload = "download"
+	tokenPurposePoster   = "poster"
+)
+
+var (
+	errTokenExpired = errors.New("Download link has expired, search again for a new one")
+	errTokenRevoked = errors.New("Download link was made for an api key that is no longer valid")
+	errTokenPurpose = errors.New("Link was made for something else")
+)
+
 type token struct {
 	Site string `json:"s,omitempty"`
 	Link string `json:"l,omitempty"`
+	User string `json:"u,omitempty"`
+
+	// Key is a hash of the api key the link was made for, and Expires is when it stops working
+	Key     string    `json:"k,omitempty"`
+	Expires time.Time `json:"exp,omitempty"`
+
+	// Issued is when the link was made, and Purpose is what it was made for
+	Issued  time.Time `json:"nbf,omitempty"`
+	Purpose string    `json:"t,omitempty"`
 }
 
 func (t *token) Encode(sharedKey []byte) (string, error) {
-	j := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+	claims := jwt.MapClaims{
 		"s":   t.Site,
 		"l":   t.Link,
+		"u":   t.User,
 		"nbf": time.Now().Unix(),
-	})
+	}
+
+	if t.Key != "" {
+		claims["k"] = t.Key
+	}
+
+	if t.Purpose != "" {
+		claims["t"] = t.Purpose
+	}
+
+	if !t.Expires.IsZero() {
+		claims["exp"] = t.Expires.Unix()
+	}
 
+	j := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return j.SignedString(sharedKey)
 }
 
@@ -30,7 +73,9 @@ func decodeToken(ts string, sharedKey []byte) (*token, error) {
 		}
 		return sharedKey, nil
 	})
-	if err != nil {
+	if ve, ok := err.(*jwt.ValidationError); ok && ve.Errors&jwt.ValidationErrorExpired != 0 {
+		return nil, errTokenExpired
+	} else if err != nil {
 		return nil, err
 	}
 
@@ -39,5 +84,108 @@ func decodeToken(ts string, sharedKey []byte) (*token, error) {
 		return nil, errors.New("Invalid token")
 	}
 
-	return &token{claims["s"].(string), claims["l"].(string)}, nil
+	t := &token{Site: claims["s"].(string), Link: claims["l"].(string)}
+	if u, ok := claims["u"].(string); ok {
+		t.User = u
+	}
+	if k, ok := claims["k"].(string); ok {
+		t.Key = k
+	}
+	if p, ok := claims["t"].(string); ok {
+		t.Purpose = p
+	}
+	if exp, ok := claims["exp"].(float64); ok {
+		t.Expires = time.Unix(int64(exp), 0)
+	}
+	if nbf, ok := claims["nbf"].(float64); ok {
+		t.Issued = time.Unix(int64(nbf), 0)
+	}
+
+	return t, nil
+}
+
+// apiKeyHash identifies an api key in a download link without revealing it
+func apiKeyHash(apiKey []byte) string {
+	sum := sha256.Sum256(apiKey)
+	return hex.EncodeToString(sum[:8])
+}
+
+// downloadLinkLifetime returns how long download links work for, zero means forever
+func (h *handler) downloadLinkLifetime() time.Duration {
+	val, err := config.GetGlobalConfig("downloadlinklifetime", "", h.Params.Config)
+	if err != nil || val == "" {
+		return defaultDownloadLinkLifetime
+	}
+
+	if val == "0" {
+		return 0
+	}
+
+	d, err := time.ParseDuration(val)
+	if err != nil || d < 0 {
+		log.Warnf("Ignoring invalid downloadlinklifetime %q", val)
+		return defaultDownloadLinkLifetime
+	}
+
+	return d
+}
+
+// newDownloadToken returns a token for downloading a link as a user, which expires after the
+// configured lifetime and stops working if the user's api key changes
+func (h *handler) newDownloadToken(site, link string, user *User) *token {
+	t := &token{
+		Site:    site,
+		Link:    link,
+		User:    user.Name,
+		Key:     apiKeyHash(user.APIKey),
+		Purpose: tokenPurposeDownload,
+	}
+
+	if lifetime := h.downloadLinkLifetime(); lifetime > 0 {
+		t.Expires = time.Now().Add(lifetime)
+	}
+
+	return t
+}
+
+// checkDownloadToken checks that a download link hasn't outlived the configured lifetime, and
+// that the api key it was made for is still valid
+func (h *handler) checkDownloadToken(t *token) error {
+	// links from before tokens had a purpose are download links, unless they have the expiry
+	// and no api key of a poster link
+	switch {
+	case t.Purpose == tokenPurposeDownload:
+	case t.Purpose != "", t.Key == "" && !t.Expires.IsZero():
+		return errTokenPurpose
+	}
+
+	// links made before they had an expiry get the lifetime from when they were made, so the
+	// ones clients have queued up keep working for a while after upgrading
+	if lifetime := h.downloadLinkLifetime(); t.Expires.IsZero() && lifetime > 0 &&
+		time.Since(t.Issued) > lifetime {
+		return errTokenExpired
+	}
+
+	// links made before they were tied to api keys only expire
+	if t.Key == "" && t.Purpose == "" {
+		return nil
+	}
+
+	global, err := h.globalUser()
+	if err != nil {
+		return err
+	}
+
+	users, err := LoadUsers(h.Params.Config)
+	if err != nil {
+		return err
+	}
+
+	for _, u := range append(users, global) {
+		if u.Name == t.User && apiKeyHash(u.APIKey) == t.Key {
+			return nil
+		}
+	}
+
+	return errTokenRevoked
 }
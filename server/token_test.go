@@ -0,0 +1,88 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cardigann/cardigann/config"
+	"github.com/gorilla/mux"
+)
+
+func TestCheckDownloadToken_WithoutExpiry(t *testing.T) {
+	h := &handler{Params: Params{Config: &config.ArrayConfig{}}}
+
+	// links from before expiry work for the lifetime from when they were made
+	recent := &token{Site: "llama", Link: "/download/1", Issued: time.Now().Add(-time.Hour)}
+	if err := h.checkDownloadToken(recent); err != nil {
+		t.Fatalf("Expected a recent link without an expiry to work, got %v", err)
+	}
+
+	old := &token{Site: "llama", Link: "/download/1", Issued: time.Now().Add(-48 * time.Hour)}
+	if err := h.checkDownloadToken(old); err != errTokenExpired {
+		t.Fatalf("Expected an old link without an expiry to have expired, got %v", err)
+	}
+
+	if err := h.Params.Config.Set("global", "downloadlinklifetime", "0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.checkDownloadToken(old); err != nil {
+		t.Fatalf("Expected links to work forever without a lifetime, got %v", err)
+	}
+}
+
+func TestDecodeToken_Issued(t *testing.T) {
+	key := []byte("secret")
+	ts, err := (&token{Site: "llama", Link: "/download/1"}).Encode(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := decodeToken(ts, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Issued.IsZero() || time.Since(decoded.Issued) > time.Minute {
+		t.Fatalf("Expected the issue time to be decoded, got %v", decoded.Issued)
+	}
+}
+
+func TestCheckDownloadToken_Purpose(t *testing.T) {
+	h := &handler{Params: Params{Config: &config.ArrayConfig{}}}
+
+	if err := h.checkDownloadToken(newPosterToken("llama", "/poster.jpg")); err != errTokenPurpose {
+		t.Fatalf("Expected a poster link to be refused for downloads, got %v", err)
+	}
+
+	// a poster link from before tokens had a purpose
+	poster := &token{Site: "llama", Link: "/poster.jpg", Expires: time.Now().Add(time.Hour)}
+	if err := h.checkDownloadToken(poster); err != errTokenPurpose {
+		t.Fatalf("Expected an old poster link to be refused for downloads, got %v", err)
+	}
+}
+
+func TestPosterHandler_RefusesDownloadLinks(t *testing.T) {
+	h := &handler{Params: Params{Config: &config.ArrayConfig{}, APIKey: []byte("secret")}}
+
+	k, err := h.sharedKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dl := h.newDownloadToken("llama", "/download/1", &User{Name: "llama", APIKey: []byte("key")})
+	ts, err := dl.Encode(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/posters/{token}", h.posterHandler)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/posters/"+ts, nil))
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("Expected a download link to be refused for posters, got %d", w.Code)
+	}
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cardigann/cardigann/config"
+	"github.com/cardigann/cardigann/updates"
+)
+
+// updateCheckInterval is how often the server checks for new releases
+const updateCheckInterval = 24 * time.Hour
+
+// updateCheckEnabled returns whether the updatecheck config allows checking for updates,
+// which can be turned off for installs without internet access
+func (h *handler) updateCheckEnabled() bool {
+	val, err := config.GetGlobalConfig("updatecheck", "true", h.Params.Config)
+	if err != nil {
+		return false
+	}
+	enabled, err := strconv.ParseBool(val)
+	return err == nil && enabled
+}
+
+// startUpdateCheck checks for updates in the background, unless it's disabled
+func (h *handler) startUpdateCheck() {
+	if !h.updateCheckEnabled() {
+		log.Debug("Update checks are disabled")
+		return
+	}
+
+	go func() {
+		for {
+			status, err := updates.Check(h.Params.Version)
+			if err != nil {
+				log.WithError(err).Debug("Checking for updates failed")
+			}
+			if status != nil {
+				if status.Available {
+					log.Infof("Cardigann %s is available, see %s", status.Latest, status.URL)
+				}
+				h.updatesLock.Lock()
+				h.updates = status
+				h.updatesLock.Unlock()
+			}
+			time.Sleep(updateCheckInterval)
+		}
+	}()
+}
+
+func (h *handler) getUpdatesHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.authorizeRequest(w, r, RoleReadOnly); !ok {
+		return
+	}
+
+	h.updatesLock.Lock()
+	defer h.updatesLock.Unlock()
+
+	jsonOutput(w, struct {
+		Enabled bool            `json:"enabled"`
+		Status  *updates.Status `json:"status,omitempty"`
+	}{
+		h.updateCheckEnabled(),
+		h.updates,
+	})
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cardigann/cardigann/config"
+	"github.com/cardigann/cardigann/torznab"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	RoleAdmin    = "admin"
+	RoleReadOnly = "readonly"
+
+	userSectionPrefix = "user:"
+)
+
+var (
+	ErrUnknownRole = errors.New("Unknown role, must be either admin or readonly")
+)
+
+// User is an account that can log into the web interface, each with their own api key
+type User struct {
+	Name   string
+	Role   string
+	APIKey []byte
+
+	// Languages are the languages that results are filtered to for searches with the user's
+	// api key that don't ask for any
+	Languages []string
+
+	passwordHash string
+}
+
+// IsAdmin returns true if the user is allowed to manage credentials and definitions
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+func (u *User) checkPassphrase(passphrase string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(u.passwordHash), []byte(passphrase)) == nil
+}
+
+func hashPassphrase(passphrase string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(passphrase), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// LoadUsers returns all the users that are defined in the config, sorted by name
+func LoadUsers(conf config.Config) ([]*User, error) {
+	sections, err := conf.Sections()
+	if err != nil {
+		return nil, err
+	}
+
+	users := []*User{}
+	for _, section := range sections {
+		if !strings.HasPrefix(section, userSectionPrefix) {
+			continue
+		}
+
+		vals, err := conf.Section(section)
+		if err != nil {
+			return nil, err
+		}
+
+		k, err := hex.DecodeString(vals["apikey"])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid apikey for %s: %v", section, err)
+		}
+
+		langs, err := torznab.ParseLanguages(vals["languages"])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid languages for %s: %v", section, err)
+		}
+
+		users = append(users, &User{
+			Name:         strings.TrimPrefix(section, userSectionPrefix),
+			Role:         vals["role"],
+			APIKey:       k,
+			Languages:    langs,
+			passwordHash: vals["passphrase"],
+		})
+	}
+
+	sort.Sort(usersByName(users))
+	return users, nil
+}
+
+type usersByName []*User
+
+func (slice usersByName) Len() int {
+	return len(slice)
+}
+
+func (slice usersByName) Less(i, j int) bool {
+	return slice[i].Name < slice[j].Name
+}
+
+func (slice usersByName) Swap(i, j int) {
+	slice[i], slice[j] = slice[j], slice[i]
+}
+
+// SetUserLanguages sets the languages that results are filtered to for searches with a
+// user's api key, given as a comma separated list
+func SetUserLanguages(conf config.Config, name, languages string) error {
+	section := userSectionPrefix + name
+
+	if _, ok, err := conf.Get(section, "apikey"); err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("Unknown user %q", name)
+	}
+
+	langs, err := torznab.ParseLanguages(languages)
+	if err != nil {
+		return err
+	}
+
+	return conf.Set(section, "languages", strings.Join(langs, ","))
+}
+
+// SetUser creates or updates a user in the config, an api key is generated for new users
+func SetUser(conf config.Config, name, passphrase, role string) (*User, error) {
+	if name == "" {
+		return nil, errors.New("A user must have a name")
+	}
+
+	if role != RoleAdmin && role != RoleReadOnly {
+		return nil, ErrUnknownRole
+	}
+
+	section := userSectionPrefix + name
+
+	apiKey, hasKey, err := conf.Get(section, "apikey")
+	if err != nil {
+		return nil, err
+	}
+
+	if !hasKey {
+		if apiKey, err = randomHex(16); err != nil {
+			return nil, err
+		}
+	}
+
+	hash, err := hashPassphrase(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, val := range map[string]string{
+		"role":       role,
+		"apikey":     apiKey,
+		"passphrase": hash,
+	} {
+		if err := conf.Set(section, key, val); err != nil {
+			return nil, err
+		}
+	}
+
+	k, _ := hex.DecodeString(apiKey)
+	return &User{Name: name, Role: role, APIKey: k}, nil
+}
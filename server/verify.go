@@ -0,0 +1,262 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cardigann/cardigann/config"
+	"github.com/cardigann/cardigann/indexer"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// verificationsBucket is where the latest verification of each indexer is stored
+	verificationsBucket = "verifications"
+
+	// verifyPollInterval is how often the background verification looks for indexers that are due
+	verifyPollInterval = time.Hour
+)
+
+// verifier is implemented by indexers that can check their credentials and search
+type verifier interface {
+	Verify() indexer.Verification
+}
+
+// verificationView is the latest verification of an indexer, and whether another is running
+type verificationView struct {
+	Running bool `json:"running"`
+	*indexer.Verification
+}
+
+// verification returns the latest verification of an indexer, if it's been verified
+func (h *handler) verification(key string) *indexer.Verification {
+	h.verificationsLock.Lock()
+	defer h.verificationsLock.Unlock()
+
+	if v, ok := h.verifications[key]; ok {
+		return &v
+	}
+
+	if h.Params.Store == nil {
+		return nil
+	}
+
+	var v indexer.Verification
+	if ok, err := h.Params.Store.Get(verificationsBucket, key, &v); err != nil || !ok {
+		return nil
+	}
+
+	h.verifications[key] = v
+	return &v
+}
+
+func (h *handler) verificationView(key string) *verificationView {
+	h.verificationsLock.Lock()
+	running := h.verifying[key]
+	h.verificationsLock.Unlock()
+
+	v := h.verification(key)
+	if v == nil && !running {
+		return nil
+	}
+
+	return &verificationView{Running: running, Verification: v}
+}
+
+// startVerify verifies an indexer in the background, returning false if it's already being verified
+func (h *handler) startVerify(key string, v verifier) bool {
+	h.verificationsLock.Lock()
+	defer h.verificationsLock.Unlock()
+
+	if h.verifying[key] {
+		return false
+	}
+	h.verifying[key] = true
+
+	go h.verify(key, v)
+	return true
+}
+
+func (h *handler) verify(key string, v verifier) {
+	result := v.Verify()
+
+	l := log.WithFields(logrus.Fields{"site": key, "results": result.Results, "time": result.Duration})
+	if result.OK {
+		l.Debug("Verified indexer")
+	} else {
+		l.WithFields(logrus.Fields{"stage": result.Stage, "reason": result.Reason}).
+			Warnf("Verifying indexer failed: %s", result.Error)
+	}
+
+	h.verificationsLock.Lock()
+	h.verifications[key] = result
+	delete(h.verifying, key)
+	h.verificationsLock.Unlock()
+
+	if h.Params.Store != nil {
+		if err := h.Params.Store.Put(verificationsBucket, key, result); err != nil {
+			log.WithError(err).Warn("Failed to save verification")
+		}
+	}
+}
+
+// startVerification verifies each enabled indexer in the background once per verifyinterval.
+// It's off unless verifyinterval is set, as it logs in and searches every indexer each time
+func (h *handler) startVerification() error {
+	var interval time.Duration
+
+	if val, err := config.GetGlobalConfig("verifyinterval", "", h.Params.Config); err != nil {
+		return err
+	} else if val != "" {
+		if interval, err = time.ParseDuration(val); err != nil {
+			log.Warnf("Ignoring invalid verifyinterval %q", val)
+			interval = 0
+		}
+	}
+
+	if interval <= 0 {
+		log.Debug("Background verification of indexers is disabled")
+		return nil
+	}
+
+	go func() {
+		for {
+			h.verifyDue(interval)
+			time.Sleep(verifyPollInterval)
+		}
+	}()
+
+	return nil
+}
+
+// verifyDue verifies the enabled indexers that haven't been verified within interval, one
+// at a time so that a check never competes with searches for more than one indexer
+func (h *handler) verifyDue(interval time.Duration) {
+	keys, err := indexer.DefaultDefinitionLoader.List()
+	if err != nil {
+		log.WithError(err).Warn("Failed to list indexers to verify")
+		return
+	}
+
+	for _, key := range keys {
+		if !config.IsSectionEnabled(key, h.Params.Config) {
+			continue
+		}
+
+		if last := h.verification(key); last != nil && time.Since(last.Checked) < interval {
+			continue
+		}
+
+		ixr, err := h.lookupIndexer(key)
+		if err != nil {
+			continue
+		}
+
+		v, ok := ixr.(verifier)
+		if !ok {
+			continue
+		}
+
+		// it's verified once its quiet hours are over
+		if isQuiet(ixr) {
+			continue
+		}
+
+		h.verificationsLock.Lock()
+		running := h.verifying[key]
+		h.verifying[key] = true
+		h.verificationsLock.Unlock()
+
+		if !running {
+			h.verify(key, v)
+		}
+	}
+}
+
+// getIndexerTestHandler tests an indexer's login and search, and returns once it's done
+func (h *handler) getIndexerTestHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.authorizeRequest(w, r, RoleAdmin); !ok {
+		return
+	}
+	params := mux.Vars(r)
+	indexerID := params["indexer"]
+
+	i, err := h.lookupIndexer(indexerID)
+	if err != nil {
+		log.WithError(err).Error(err)
+		jsonError(w, "Indexer not Found", http.StatusNotFound)
+		return
+	}
+
+	runner, ok := i.(*indexer.Runner)
+	if !ok {
+		jsonError(w, "Indexer can't be tested", http.StatusBadRequest)
+		return
+	}
+
+	tester := indexer.Tester{Runner: runner}
+	if err = tester.Test(); err != nil {
+		log.WithError(err).Error("Test failed")
+	}
+
+	var resp = struct {
+		OK     bool   `json:"ok"`
+		Error  string `json:"error,omitempty"`
+		Reason string `json:"reason,omitempty"`
+	}{}
+
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Reason = indexer.LoginErrorReason(err)
+	} else {
+		resp.OK = true
+	}
+
+	jsonOutput(w, resp)
+}
+
+// getIndexerStatusHandler returns the latest verification of an indexer, and whether one is running
+func (h *handler) getIndexerStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.authorizeRequest(w, r, RoleReadOnly); !ok {
+		return
+	}
+
+	key := mux.Vars(r)["indexer"]
+	if _, err := h.lookupIndexer(key); err != nil {
+		jsonError(w, "Indexer not Found", http.StatusNotFound)
+		return
+	}
+
+	view := h.verificationView(key)
+	if view == nil {
+		view = &verificationView{}
+	}
+
+	jsonOutput(w, view)
+}
+
+func (h *handler) postIndexerTestHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.authorizeRequest(w, r, RoleAdmin); !ok {
+		return
+	}
+
+	key := mux.Vars(r)["indexer"]
+	ixr, err := h.lookupIndexer(key)
+	if err != nil {
+		jsonError(w, "Indexer not Found", http.StatusNotFound)
+		return
+	}
+
+	v, ok := ixr.(verifier)
+	if !ok {
+		jsonError(w, "Indexer can't be tested", http.StatusBadRequest)
+		return
+	}
+
+	h.startVerify(key, v)
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusAccepted)
+	jsonOutput(w, h.verificationView(key))
+}
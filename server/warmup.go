@@ -0,0 +1,122 @@
+package server
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cardigann/cardigann/config"
+	"github.com/cardigann/cardigann/indexer"
+)
+
+const (
+	// sessionsLazy logs in to an indexer when it's first searched, sessionsEager logs in to all
+	// of the enabled indexers when the server starts
+	sessionsLazy  = "lazy"
+	sessionsEager = "eager"
+
+	defaultWarmUpConcurrency = 4
+)
+
+// loginer is implemented by indexers that can log in ahead of being searched
+type loginer interface {
+	Login() error
+}
+
+// quieter is implemented by indexers that can have quiet hours, during which nothing is done
+// with them in the background
+type quieter interface {
+	QuietUntil(now time.Time) (time.Time, bool)
+}
+
+// isQuiet returns whether an indexer is in its quiet hours
+func isQuiet(ixr interface{}) bool {
+	if q, ok := ixr.(quieter); ok {
+		_, quiet := q.QuietUntil(time.Now())
+		return quiet
+	}
+	return false
+}
+
+// startWarmUp logs in to the enabled indexers in the background if sessions are eager
+func (h *handler) startWarmUp() error {
+	mode, err := config.GetGlobalConfig("sessions", sessionsLazy, h.Params.Config)
+	if err != nil {
+		return err
+	}
+
+	switch mode {
+	case sessionsLazy, "":
+		return nil
+	case sessionsEager:
+	default:
+		log.Warnf("Unknown sessions mode %q, logging in lazily", mode)
+		return nil
+	}
+
+	concurrency := defaultWarmUpConcurrency
+	if h.Params.LowMemory {
+		concurrency = 1
+	}
+	if val, err := config.GetGlobalConfig("warmupconcurrency", "", h.Params.Config); err == nil && val != "" {
+		if n, err := strconv.Atoi(val); err == nil && n > 0 {
+			concurrency = n
+		} else {
+			log.Warnf("Ignoring invalid warmupconcurrency %q", val)
+		}
+	}
+
+	go h.warmUp(concurrency)
+	return nil
+}
+
+// warmUp logs in to each of the enabled indexers, with at most concurrency logins at once
+func (h *handler) warmUp(concurrency int) {
+	keys, err := indexer.DefaultDefinitionLoader.List()
+	if err != nil {
+		log.WithError(err).Warn("Failed to list indexers to log in to")
+		return
+	}
+
+	timer := time.Now()
+	slots := make(chan struct{}, concurrency)
+	wg := sync.WaitGroup{}
+
+	for _, key := range keys {
+		if !config.IsSectionEnabled(key, h.Params.Config) {
+			continue
+		}
+
+		ixr, err := h.lookupIndexer(key)
+		if err != nil {
+			continue
+		}
+
+		l, ok := ixr.(loginer)
+		if !ok {
+			continue
+		}
+
+		if isQuiet(ixr) {
+			log.WithFields(logrus.Fields{"site": key}).Debug("Not logging in on startup in quiet hours")
+			continue
+		}
+
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			if err := l.Login(); err != nil {
+				log.WithFields(logrus.Fields{"site": key}).WithError(err).Warn("Failed to log in on startup")
+				return
+			}
+			log.WithFields(logrus.Fields{"site": key}).Debug("Logged in on startup")
+		}(key)
+	}
+
+	wg.Wait()
+	log.WithFields(logrus.Fields{"time": time.Now().Sub(timer)}).Info("Finished logging in to indexers")
+}
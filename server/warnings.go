@@ -0,0 +1,56 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cardigann/cardigann/indexer"
+)
+
+// warningHeader carries problems that didn't stop a response being returned, like an indexer
+// being down for maintenance, limiting requests, out of requests in its budget or held off after
+// crashing and returning an empty or cached feed, an aggregate search returning before all of
+// its indexers responded, serving cached results offline, or an indexer in its strict quiet hours
+const warningHeader = "X-Cardigann-Warning"
+
+// isSoftError returns whether an error searching an indexer should be reported to clients as
+// an empty result with a warning, rather than as a failure that might get the indexer disabled
+func isSoftError(err error) bool {
+	return indexer.IsMaintenance(err) || indexer.IsThrottled(err) || indexer.IsBudgetExhausted(err) ||
+		indexer.IsCrash(err) || indexer.IsPartialResults(err) || indexer.IsOffline(err) ||
+		indexer.IsQuietHours(err)
+}
+
+func setWarning(w http.ResponseWriter, err error) {
+	log.WithError(err).Warn("Returning results with a warning")
+	w.Header().Add(warningHeader, err.Error())
+}
+
+// setRetryAfter tells clients when to retry a request that failed because the indexer is down
+// for maintenance, limiting requests, out of requests, held off after crashing or in its quiet
+// hours, returning false for other errors
+func setRetryAfter(w http.ResponseWriter, err error) bool {
+	var until time.Time
+	switch e := err.(type) {
+	case *indexer.MaintenanceError:
+		until = e.Until
+	case *indexer.ThrottledError:
+		until = e.Until
+	case *indexer.BudgetExhaustedError:
+		until = e.Until
+	case *indexer.CrashError:
+		until = e.Until
+	case *indexer.QuietHoursError:
+		until = e.Until
+	default:
+		return false
+	}
+
+	secs := int(until.Sub(time.Now()).Seconds()) + 1
+	if secs < 1 {
+		secs = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	return true
+}
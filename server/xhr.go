@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/Sirupsen/logrus"
@@ -40,6 +41,31 @@ type indexerView struct {
 	Feeds    indexerFeedsView      `json:"feeds"`
 	Settings []indexerSettingsView `json:"settings"`
 	Stats    indexerStatsView      `json:"stats"`
+
+	// Verification is the latest check of the indexer's credentials and search
+	Verification *verificationView `json:"verification,omitempty"`
+
+	// Backoff is set whilst requests to the indexer are held off because it asked for them to
+	// slow down, its request budget is used up, or it crashed
+	Backoff *backoffView `json:"backoff,omitempty"`
+
+	// Budget is how much of the indexer's request budget has been used, if it has one
+	Budget []budgetView `json:"budget,omitempty"`
+
+	// Layout is set when the indexer's search results page has changed sharply
+	Layout *layoutView `json:"layout,omitempty"`
+}
+
+type budgetView struct {
+	Limit    string `json:"limit"`
+	Requests int    `json:"requests"`
+	Used     int    `json:"used"`
+}
+
+type backoffView struct {
+	Reason  string    `json:"reason"`
+	Message string    `json:"message,omitempty"`
+	Until   time.Time `json:"until"`
 }
 
 type indexerViewByName []indexerView
@@ -111,6 +137,10 @@ func (h *handler) loadIndexerViews(baseURL string) ([]indexerView, error) {
 				Size:    stats.Size,
 				Source:  stats.Source,
 			},
+			Verification: h.verificationView(info.ID),
+			Backoff:      h.backoffView(info.ID),
+			Budget:       h.budgetView(info.ID),
+			Layout:       h.layoutView(info.ID),
 		})
 	}
 
@@ -119,9 +149,68 @@ func (h *handler) loadIndexerViews(baseURL string) ([]indexerView, error) {
 	return reply, nil
 }
 
+// throttler is implemented by indexers that hold off requests when the site asks them to, when
+// they run out of requests in their budget, or after they crash
+type throttler interface {
+	Crashed() *indexer.CrashError
+	Throttled() *indexer.ThrottledError
+	BudgetExhausted() *indexer.BudgetExhaustedError
+	BudgetUsage() []indexer.BudgetUsage
+}
+
+// lookupThrottler returns the indexer for a key if it has been searched since the server started,
+// as only those can be held off
+func (h *handler) lookupThrottler(key string) (throttler, bool) {
+	h.indexersLock.Lock()
+	ixr, ok := h.indexers[key]
+	h.indexersLock.Unlock()
+
+	if !ok {
+		return nil, false
+	}
+
+	t, ok := ixr.(throttler)
+	return t, ok
+}
+
+// backoffView returns why requests to an indexer are being held off, if they are
+func (h *handler) backoffView(key string) *backoffView {
+	t, ok := h.lookupThrottler(key)
+	if !ok {
+		return nil
+	}
+
+	if err := t.Crashed(); err != nil {
+		return &backoffView{Reason: errorCategoryCrash, Message: err.Panic, Until: err.Until}
+	}
+
+	if err := t.Throttled(); err != nil {
+		return &backoffView{Reason: errorCategoryThrottled, Message: err.Message, Until: err.Until}
+	}
+
+	if err := t.BudgetExhausted(); err != nil {
+		return &backoffView{Reason: errorCategoryBudget, Message: err.Error(), Until: err.Until}
+	}
+
+	return nil
+}
+
+// budgetView returns how much of an indexer's request budget has been used, if it has one
+func (h *handler) budgetView(key string) []budgetView {
+	t, ok := h.lookupThrottler(key)
+	if !ok {
+		return nil
+	}
+
+	var views []budgetView
+	for _, u := range t.BudgetUsage() {
+		views = append(views, budgetView{Limit: u.BudgetLimit.String(), Requests: u.Requests, Used: u.Used})
+	}
+	return views
+}
+
 func (h *handler) getIndexersHandler(w http.ResponseWriter, r *http.Request) {
-	if !h.checkRequestAuthorized(r) {
-		jsonError(w, "Not Authorized", http.StatusUnauthorized)
+	if _, ok := h.authorizeRequest(w, r, RoleReadOnly); !ok {
 		return
 	}
 
@@ -141,8 +230,7 @@ func (h *handler) getIndexersHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *handler) getIndexersConfigHandler(w http.ResponseWriter, r *http.Request) {
-	if !h.checkRequestAuthorized(r) {
-		jsonError(w, "Not Authorized", http.StatusUnauthorized)
+	if _, ok := h.authorizeRequest(w, r, RoleAdmin); !ok {
 		return
 	}
 
@@ -187,8 +275,8 @@ func (h *handler) getIndexersConfigHandler(w http.ResponseWriter, r *http.Reques
 }
 
 func (h *handler) patchIndexersConfigHandler(w http.ResponseWriter, r *http.Request) {
-	if !h.checkRequestAuthorized(r) {
-		jsonError(w, "Not Authorized", http.StatusUnauthorized)
+	user, ok := h.authorizeRequest(w, r, RoleAdmin)
+	if !ok {
 		return
 	}
 
@@ -202,16 +290,43 @@ func (h *handler) patchIndexersConfigHandler(w http.ResponseWriter, r *http.Requ
 	}
 	defer r.Body.Close()
 
+	changed := []string{}
 	for k, v := range req {
 		if err := h.Params.Config.Set(indexerID, k, v); err != nil {
+			h.auditConfigKeys(r, user, indexerID, changed)
 			jsonError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		changed = append(changed, k)
+	}
+
+	h.auditConfigKeys(r, user, indexerID, changed)
+
+	if enabled, ok := req["enabled"]; ok {
+		action := auditActionDisable
+		if enabled == "true" || enabled == "ok" {
+			action = auditActionEnable
 		}
+		h.audit(r, user.Name, action, indexerID, nil)
 	}
 
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	w.WriteHeader(http.StatusOK)
 }
 
+// auditConfigKeys records which config keys of an indexer were saved, values aren't recorded
+// as they are likely to be credentials
+func (h *handler) auditConfigKeys(r *http.Request, user *User, indexerID string, keys []string) {
+	if len(keys) == 0 {
+		return
+	}
+
+	sort.Strings(keys)
+	h.audit(r, user.Name, auditActionConfig, indexerID, map[string]string{
+		"keys": strings.Join(keys, ","),
+	})
+}
+
 func (h *handler) getVersionHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	w.WriteHeader(http.StatusOK)
@@ -224,45 +339,9 @@ func (h *handler) getVersionHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "%q", version)
 }
 
-func (h *handler) getIndexerTestHandler(w http.ResponseWriter, r *http.Request) {
-	if !h.checkRequestAuthorized(r) {
-		jsonError(w, "Not Authorized", http.StatusUnauthorized)
-		return
-	}
-	params := mux.Vars(r)
-	indexerID := params["indexer"]
-
-	i, err := h.lookupIndexer(indexerID)
-	if err != nil {
-		log.WithError(err).Error(err)
-		jsonError(w, "Indexer not Found", http.StatusNotFound)
-		return
-	}
-
-	if err == nil {
-		tester := indexer.Tester{Runner: i.(*indexer.Runner)}
-		if err = tester.Test(); err != nil {
-			log.WithError(err).Error("Test failed")
-		}
-	}
-
-	var resp = struct {
-		OK    bool   `json:"ok"`
-		Error string `json:"error,omitempty"`
-	}{}
-
-	if err != nil {
-		resp.Error = err.Error()
-	} else {
-		resp.OK = true
-	}
-
-	jsonOutput(w, resp)
-}
-
 func (h *handler) patchIndexersHandler(w http.ResponseWriter, r *http.Request) {
-	if !h.checkRequestAuthorized(r) {
-		jsonError(w, "Not Authorized", http.StatusUnauthorized)
+	user, ok := h.authorizeRequest(w, r, RoleAdmin)
+	if !ok {
 		return
 	}
 
@@ -279,8 +358,11 @@ func (h *handler) patchIndexersHandler(w http.ResponseWriter, r *http.Request) {
 		if err := json.NewEncoder(w).Encode(err); err != nil {
 			panic(err)
 		}
+		return
 	}
 
+	h.audit(r, user.Name, auditActionConfig, iv.ID, nil)
+
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	w.WriteHeader(http.StatusCreated)
 }
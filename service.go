@@ -1,41 +1,148 @@
 package main
 
 import (
-	"encoding/json"
+	"bytes"
 	"fmt"
 	_ "log"
 	"os"
+	"os/exec"
+	"os/user"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/cardigann/cardigann/logger"
 	"github.com/cardigann/cardigann/server"
 	"github.com/kardianos/service"
 )
 
+const (
+	defaultServiceName   = "Cardigann"
+	defaultRestartDelay  = time.Minute
+	recoveryResetSeconds = 86400
+
+	// the log file a service tees to is rotated like the server's default
+	serviceLogMaxSize    = 10 * 1024 * 1024
+	serviceLogMaxAge     = 7 * 24 * time.Hour
+	serviceLogMaxBackups = 5
+)
+
 type programOpts struct {
 	UserService bool
+	Name        string
+
+	// these are baked into the arguments the service runs with when it's installed
+	Port       string
+	Bind       string
+	ConfigFile string
+	DataDir    string
+	RunAs      string
+	RunAsGroup string
+	LogFile    string
+}
+
+// serviceName returns the name the service is installed as. User services get a
+// distinct name so that they can be installed alongside a system one
+func (o programOpts) serviceName() string {
+	if o.Name != "" {
+		return o.Name
+	}
+
+	if o.UserService {
+		if u, err := user.Current(); err == nil {
+			return defaultServiceName + "-" + u.Username
+		}
+	}
+
+	return defaultServiceName
+}
+
+func (o programOpts) arguments() []string {
+	args := []string{"service", "run"}
+
+	if o.UserService {
+		args = append(args, "--user")
+	}
+
+	for _, flag := range []struct{ name, val string }{
+		{"name", o.Name},
+		{"port", o.Port},
+		{"bind", o.Bind},
+		{"config", o.ConfigFile},
+		{"data-dir", o.DataDir},
+		{"run-as", o.RunAs},
+		{"run-as-group", o.RunAsGroup},
+		{"log-file", o.LogFile},
+	} {
+		if flag.val != "" {
+			args = append(args, "--"+flag.name, flag.val)
+		}
+	}
+
+	return args
+}
+
+// applyEnv makes the config and data locations visible to the rest of cardigann
+func (o programOpts) applyEnv() {
+	if o.ConfigFile != "" {
+		os.Setenv("CONFIG_FILE", o.ConfigFile)
+	}
+
+	if o.DataDir != "" {
+		os.Setenv("DATA_DIR", o.DataDir)
+	}
+}
+
+// configureServiceRecovery tells the windows service control manager to restart the service when it
+// fails, which kardianos/service doesn't expose. The launchd, systemd and upstart services that are
+// installed on other platforms already restart when they fail
+func configureServiceRecovery(name string, delay time.Duration) error {
+	if runtime.GOOS != "windows" {
+		return nil
+	}
+
+	ms := fmt.Sprintf("%d", delay/time.Millisecond)
+	actions := strings.Join([]string{"restart", ms, "restart", ms, "restart", ms}, "/")
+
+	out, err := exec.Command("sc.exe", "failure", name,
+		"reset=", fmt.Sprintf("%d", recoveryResetSeconds),
+		"actions=", actions,
+	).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("Failed to set recovery options for service %s: %v: %s", name, err, out)
+	}
+
+	log.Debugf("Service %s will restart %s after failing", name, delay)
+	return nil
 }
 
 type program struct {
 	exit    chan struct{}
 	service service.Service
 	logger  service.Logger
+	opts    programOpts
 }
 
 func newProgram(opts programOpts) (*program, error) {
 	svcConfig := &service.Config{
-		Name:        "Cardigann",
+		Name:        opts.serviceName(),
 		DisplayName: "Cardigann Proxy",
 		Description: "Cardigann Torrent Indexer Proxy",
 		Option: service.KeyValue{
 			"RunAtLoad":   true,
 			"UserService": opts.UserService,
 		},
-		Arguments: []string{
-			"service", "run",
-		},
+		Arguments: opts.arguments(),
+	}
+
+	if opts.serviceName() != defaultServiceName {
+		svcConfig.DisplayName = fmt.Sprintf("Cardigann Proxy (%s)", opts.serviceName())
 	}
 
-	prg := &program{}
+	prg := &program{opts: opts}
 	s, err := service.New(prg, svcConfig)
 	if err != nil {
 		return nil, err
@@ -63,11 +170,30 @@ func (p *program) run() error {
 		return err
 	}
 
+	if err := runMigrations(conf); err != nil {
+		return err
+	}
+
 	s, err := server.New(conf, Version)
 	if err != nil {
 		return err
 	}
 
+	if p.opts.Port != "" {
+		s.Port = p.opts.Port
+	}
+
+	if p.opts.Bind != "" {
+		s.Bind = p.opts.Bind
+	}
+
+	// services installed before privileges could be dropped have no user to run as,
+	// so they are allowed to keep running as root rather than failing to start
+	s.User, s.Group = p.opts.RunAs, p.opts.RunAsGroup
+	if s.User == "" {
+		s.AllowRoot = true
+	}
+
 	go s.Listen()
 
 	// block until exit
@@ -81,46 +207,108 @@ func (p *program) Stop(s service.Service) error {
 	return nil
 }
 
+// serviceEventIDs are the ids entries are logged with in the windows event log, so that they
+// can be filtered on. Debug entries have their own, as the event log has no debug severity
+var serviceEventIDs = map[logrus.Level]uint32{
+	logrus.PanicLevel: 1,
+	logrus.FatalLevel: 1,
+	logrus.ErrorLevel: 2,
+	logrus.WarnLevel:  3,
+	logrus.InfoLevel:  4,
+	logrus.DebugLevel: 5,
+}
+
+// eventLogger is implemented by the windows event log, which takes an event id
+type eventLogger interface {
+	NError(eventID uint32, v ...interface{}) error
+	NWarning(eventID uint32, v ...interface{}) error
+	NInfo(eventID uint32, v ...interface{}) error
+}
+
+// sysLogger is implemented by syslog, which macOS passes on to its unified logging, and has
+// severities the service logger doesn't
+type sysLogger interface {
+	Crit(m string) error
+	Debug(m string) error
+}
+
 type serviceLogHook struct {
 	service.Logger
 }
 
 func (hook *serviceLogHook) Fire(entry *logrus.Entry) error {
-	line, err := entry.String()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Unable to read entry, %v", err)
-		return err
+	if !logger.Allowed(entry) {
+		return nil
+	}
+
+	line := logger.Redact(serviceLogLine(entry))
+
+	if l, ok := hook.Logger.(eventLogger); ok {
+		id := serviceEventIDs[entry.Level]
+		switch entry.Level {
+		case logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel:
+			return l.NError(id, line)
+		case logrus.WarnLevel:
+			return l.NWarning(id, line)
+		default:
+			return l.NInfo(id, line)
+		}
+	}
+
+	if l, ok := hook.Logger.(sysLogger); ok {
+		switch entry.Level {
+		case logrus.PanicLevel, logrus.FatalLevel:
+			return l.Crit(line)
+		case logrus.DebugLevel:
+			return l.Debug(line)
+		}
 	}
 
 	switch entry.Level {
-	case logrus.PanicLevel:
-		hook.Logger.Error(line)
-	case logrus.FatalLevel:
-		hook.Logger.Error(line)
-	case logrus.ErrorLevel:
-		hook.Logger.Error(line)
+	case logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel:
+		return hook.Logger.Error(line)
 	case logrus.WarnLevel:
-		hook.Logger.Warning(line)
-	case logrus.InfoLevel:
-		hook.Logger.Info(line)
-	case logrus.DebugLevel:
-		hook.Logger.Info(line)
+		return hook.Logger.Warning(line)
+	default:
+		return hook.Logger.Info(line)
 	}
-
-	return nil
 }
 
 func (hook *serviceLogHook) Levels() []logrus.Level {
 	return logrus.AllLevels
 }
 
-type serviceLogFormatter struct {
-}
+// serviceLogLine formats an entry for the service log as its message followed by its fields
+// in key=value form, sorted by key. The service log adds the time and severity itself
+func serviceLogLine(entry *logrus.Entry) string {
+	keys := make([]string, 0, len(entry.Data))
+	for k := range entry.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
 
-func (f *serviceLogFormatter) Format(entry *logrus.Entry) ([]byte, error) {
-	serialized, err := json.Marshal(entry.Data)
-	if err != nil {
-		return nil, fmt.Errorf("Failed to marshal fields to JSON, %v", err)
+	buf := &bytes.Buffer{}
+	buf.WriteString(entry.Message)
+
+	if entry.Level == logrus.DebugLevel {
+		buf.WriteString(" level=debug")
+	}
+
+	for _, k := range keys {
+		var val string
+		switch v := entry.Data[k].(type) {
+		case error:
+			val = v.Error()
+		default:
+			val = fmt.Sprint(v)
+		}
+
+		if val == "" || strings.ContainsAny(val, " \t\n\"=") {
+			val = strconv.Quote(val)
+		}
+
+		fmt.Fprintf(buf, " %s=%s", k, val)
 	}
-	return []byte(fmt.Sprintf("%s %s", entry.Message, serialized)), nil
+
+	return buf.String()
 }
@@ -0,0 +1,355 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// logChunkSize is how much of a log is read at a time when reading it from the end
+const logChunkSize = 64 * 1024
+
+// ErrStopReading can be returned by the func passed to ReadLog or ReadLogReverse to stop
+// reading the log early, without it being returned as an error
+var ErrStopReading = errors.New("Stop reading")
+
+// Store persists state that isn't configuration (audit logs, seen releases, etc) as json files in a directory.
+// Buckets are key/value maps stored in a single file, logs are append-only files with one json value per line
+// and blobs are raw files stored in a directory of their own.
+type Store struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// Open returns a store backed by files in the given directory, which is created if it doesn't exist
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Dir returns the directory the store is backed by
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+func (s *Store) bucketPath(bucket string) string {
+	return filepath.Join(s.dir, bucket+".json")
+}
+
+func (s *Store) logPath(log string) string {
+	return filepath.Join(s.dir, log+".jsonl")
+}
+
+func (s *Store) blobPath(dir, key string) string {
+	return filepath.Join(s.dir, dir, filepath.Base(key))
+}
+
+func (s *Store) loadBucket(bucket string) (map[string]json.RawMessage, error) {
+	m := map[string]json.RawMessage{}
+
+	data, err := ioutil.ReadFile(s.bucketPath(bucket))
+	if os.IsNotExist(err) {
+		return m, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func (s *Store) saveBucket(bucket string, m map[string]json.RawMessage) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// write to a temp file and rename so a crash never leaves a half written bucket
+	tmp := s.bucketPath(bucket) + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.bucketPath(bucket))
+}
+
+// Put stores a value under a key in a bucket
+func (s *Store) Put(bucket, key string, v interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, err := s.loadBucket(bucket)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	m[key] = b
+	return s.saveBucket(bucket, m)
+}
+
+// Get loads the value of a key in a bucket into v, returning false if it doesn't exist
+func (s *Store) Get(bucket, key string, v interface{}) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, err := s.loadBucket(bucket)
+	if err != nil {
+		return false, err
+	}
+
+	b, ok := m[key]
+	if !ok {
+		return false, nil
+	}
+
+	return true, json.Unmarshal(b, v)
+}
+
+// Delete removes keys from a bucket
+func (s *Store) Delete(bucket string, keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, err := s.loadBucket(bucket)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		delete(m, key)
+	}
+
+	return s.saveBucket(bucket, m)
+}
+
+// Keys returns the sorted keys in a bucket
+func (s *Store) Keys(bucket string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, err := s.loadBucket(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Append adds a value to the end of a log
+func (s *Store) Append(log string, v interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(s.logPath(log), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err = f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// ReadLog calls fn with every value in a log, in the order they were appended
+func (s *Store) ReadLog(log string, fn func(json.RawMessage) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.Open(s.logPath(log))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		if err := fn(json.RawMessage(append([]byte{}, line...))); err == ErrStopReading {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// ReadLogReverse calls fn with the values in a log, most recently appended first. The log is read
+// from the end, so stopping early with ErrStopReading doesn't read the older values at all
+func (s *Store) ReadLogReverse(log string, fn func(json.RawMessage) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.readLogReverse(log, fn)
+}
+
+// readLogReverse is ReadLogReverse, it must be called whilst holding the lock
+func (s *Store) readLogReverse(log string, fn func(json.RawMessage) error) error {
+	f, err := os.Open(s.logPath(log))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	// partial is the start of a line whose beginning is in a chunk that hasn't been read yet
+	var partial []byte
+	chunk := make([]byte, logChunkSize)
+
+	for offset > 0 {
+		n := int64(logChunkSize)
+		if offset < n {
+			n = offset
+		}
+		offset -= n
+
+		if _, err := f.ReadAt(chunk[:n], offset); err != nil {
+			return err
+		}
+
+		buf := append(append([]byte{}, chunk[:n]...), partial...)
+		lines := bytes.Split(buf, []byte("\n"))
+
+		// the first line might continue into the chunk before, unless this is the start
+		partial, lines = lines[0], lines[1:]
+		if offset == 0 {
+			lines = append([][]byte{partial}, lines...)
+			partial = nil
+		}
+
+		for idx := len(lines) - 1; idx >= 0; idx-- {
+			if len(lines[idx]) == 0 {
+				continue
+			}
+			if err := fn(json.RawMessage(lines[idx])); err == ErrStopReading {
+				return nil
+			} else if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// TrimLog drops all but the most recent keep values from a log
+func (s *Store) TrimLog(log string, keep int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// one more than is kept is read, to tell whether there's anything to drop
+	kept := [][]byte{}
+	err := s.readLogReverse(log, func(raw json.RawMessage) error {
+		kept = append(kept, raw)
+		if len(kept) > keep {
+			return ErrStopReading
+		}
+		return nil
+	})
+	if err != nil || len(kept) <= keep {
+		return err
+	}
+	kept = kept[:keep]
+
+	buf := &bytes.Buffer{}
+	for idx := len(kept) - 1; idx >= 0; idx-- {
+		buf.Write(kept[idx])
+		buf.WriteByte('\n')
+	}
+
+	tmp := s.logPath(log) + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.logPath(log))
+}
+
+// PutBlob stores the raw contents of a file under a key in a blob directory
+func (s *Store) PutBlob(dir, key string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Join(s.dir, dir), 0700); err != nil {
+		return err
+	}
+
+	tmp := s.blobPath(dir, key) + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.blobPath(dir, key))
+}
+
+// OpenBlob opens the file stored under a key in a blob directory, returning false if it doesn't exist
+func (s *Store) OpenBlob(dir, key string) (io.ReadCloser, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.Open(s.blobPath(dir, key))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	return f, true, nil
+}
+
+// DeleteBlobs removes the files stored under keys in a blob directory
+func (s *Store) DeleteBlobs(dir string, keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range keys {
+		if err := os.Remove(s.blobPath(dir, key)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,174 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestStoreBuckets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Put("llamas", "first", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put("llamas", "second", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	var v int
+	if ok, err := s.Get("llamas", "second", &v); err != nil || !ok || v != 2 {
+		t.Fatalf("Expected second to be 2, got %d (%v, %v)", v, ok, err)
+	}
+
+	if err := s.Delete("llamas", "first"); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := s.Keys("llamas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0] != "second" {
+		t.Fatalf("Expected only second to remain, got %v", keys)
+	}
+}
+
+func TestStoreLogs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, val := range []string{"a", "b", "c"} {
+		if err := s.Append("log", val); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var vals []string
+	err = s.ReadLog("log", func(raw json.RawMessage) error {
+		var v string
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return err
+		}
+		vals = append(vals, v)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(vals) != 3 || vals[0] != "a" || vals[2] != "c" {
+		t.Fatalf("Unexpected log contents %v", vals)
+	}
+}
+
+func TestStoreLogsReverse(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// enough values to span a few chunks
+	long := strings.Repeat("x", 1000)
+	for i := 0; i < 200; i++ {
+		if err := s.Append("log", fmt.Sprintf("%d %s", i, long)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	readNewest := func(n int) []string {
+		vals := []string{}
+		err := s.ReadLogReverse("log", func(raw json.RawMessage) error {
+			var v string
+			if err := json.Unmarshal(raw, &v); err != nil {
+				return err
+			}
+			vals = append(vals, strings.Fields(v)[0])
+			if len(vals) == n {
+				return ErrStopReading
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return vals
+	}
+
+	if vals := readNewest(3); strings.Join(vals, ",") != "199,198,197" {
+		t.Fatalf("Expected the newest values first, got %v", vals)
+	}
+
+	if vals := readNewest(1000); len(vals) != 200 || vals[199] != "0" {
+		t.Fatalf("Expected all 200 values ending with the oldest, got %d", len(vals))
+	}
+
+	if err := s.TrimLog("log", 50); err != nil {
+		t.Fatal(err)
+	}
+
+	if vals := readNewest(1000); len(vals) != 50 || vals[0] != "199" || vals[49] != "150" {
+		t.Fatalf("Expected the newest 50 values to be kept, got %v", vals)
+	}
+}
+
+func TestStoreBlobs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.PutBlob("torrents", "llamas", []byte("d4:infoe")); err != nil {
+		t.Fatal(err)
+	}
+
+	rc, ok, err := s.OpenBlob("torrents", "llamas")
+	if err != nil || !ok {
+		t.Fatalf("Expected llamas to exist, got %v, %v", ok, err)
+	}
+	b, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil || string(b) != "d4:infoe" {
+		t.Fatalf("Unexpected blob contents %q (%v)", b, err)
+	}
+
+	if err := s.DeleteBlobs("torrents", "llamas", "alpacas"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok, err := s.OpenBlob("torrents", "llamas"); err != nil || ok {
+		t.Fatalf("Expected llamas to be deleted, got %v, %v", ok, err)
+	}
+}
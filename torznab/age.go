@@ -0,0 +1,53 @@
+package torznab
+
+import "time"
+
+// DateFormat is the format of the mindate and maxdate query parameters
+const DateFormat = "2006-01-02"
+
+// DateRange returns the earliest and latest times that results can be published at, from the
+// query's maxage and its date range. Either is zero if that end of the range is open
+func (query Query) DateRange(now time.Time) (from, to time.Time) {
+	from = query.MinDate
+	if query.MaxAge > 0 {
+		if since := now.AddDate(0, 0, -query.MaxAge); since.After(from) {
+			from = since
+		}
+	}
+
+	// the maxdate is a whole day
+	if !query.MaxDate.IsZero() {
+		to = query.MaxDate.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+
+	return from, to
+}
+
+// FilterDates returns the items published within the query's date range, along with the ones
+// without a publish date. All of the items are returned if the query has no range
+func FilterDates(items []ResultItem, query Query) []ResultItem {
+	return filterDates(items, query, time.Now())
+}
+
+func filterDates(items []ResultItem, query Query, now time.Time) []ResultItem {
+	from, to := query.DateRange(now)
+	if from.IsZero() && to.IsZero() {
+		return items
+	}
+
+	filtered := []ResultItem{}
+	for _, item := range items {
+		published := item.PublishDate
+		if !published.IsZero() {
+			if !from.IsZero() && published.Before(from) {
+				continue
+			}
+			if !to.IsZero() && published.After(to) {
+				continue
+			}
+		}
+		filtered = append(filtered, item)
+	}
+
+	return filtered
+}
@@ -0,0 +1,65 @@
+package torznab
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQueryDates(t *testing.T) {
+	q, err := ParseQuery(url.Values{"maxage": {"30"}, "mindate": {"2017-01-01"}, "maxdate": {"2017-02-28"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if q.MaxAge != 30 || q.MinDate.Format(DateFormat) != "2017-01-01" || q.MaxDate.Format(DateFormat) != "2017-02-28" {
+		t.Fatalf("Unexpected dates in %#v", q)
+	}
+
+	if encoded := q.Encode(); !strings.Contains(encoded, "maxage=30&maxdate=2017-02-28&mindate=2017-01-01") {
+		t.Fatalf("Expected dates to be encoded, got %q", encoded)
+	}
+
+	for _, vals := range []url.Values{
+		{"maxage": {"a week"}},
+		{"maxage": {"-1"}},
+		{"mindate": {"01/02/2017"}},
+		{"mindate": {"2017-02-01"}, "maxdate": {"2017-01-01"}},
+	} {
+		if _, err := ParseQuery(vals); err == nil {
+			t.Errorf("Expected %v to be an error", vals)
+		}
+	}
+}
+
+func TestFilterDates(t *testing.T) {
+	now := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	items := []ResultItem{
+		{Title: "today", PublishDate: now.Add(-time.Hour)},
+		{Title: "last week", PublishDate: now.AddDate(0, 0, -7)},
+		{Title: "last year", PublishDate: now.AddDate(-1, 0, 0)},
+		{Title: "undated"},
+	}
+
+	for idx, example := range []struct {
+		query    Query
+		expected []string
+	}{
+		{Query{}, []string{"today", "last week", "last year", "undated"}},
+		{Query{MaxAge: 3}, []string{"today", "undated"}},
+		{Query{MaxAge: 30}, []string{"today", "last week", "undated"}},
+		{Query{MaxDate: now.AddDate(0, 0, -7).Truncate(24 * time.Hour)}, []string{"last week", "last year", "undated"}},
+		{Query{MinDate: now.AddDate(0, 0, -8), MaxDate: now.AddDate(0, 0, -1).Truncate(24 * time.Hour)}, []string{"last week", "undated"}},
+		{Query{MaxAge: 3, MinDate: now.AddDate(0, 0, -30)}, []string{"today", "undated"}},
+	} {
+		titles := []string{}
+		for _, item := range filterDates(items, example.query, now) {
+			titles = append(titles, item.Title)
+		}
+		if strings.Join(titles, ",") != strings.Join(example.expected, ",") {
+			t.Errorf("Row #%d expected %v, got %v", idx+1, example.expected, titles)
+		}
+	}
+}
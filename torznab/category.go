@@ -177,6 +177,28 @@ func ParentCategory(c Category) Category {
 	return CategoryOther
 }
 
+// CategoryMatches returns whether a result in category id belongs in a search for the requested
+// categories. A result matches the categories it is in, their parents, and also their children
+// as sites often only have the parent category. Unknown and custom categories always match
+func CategoryMatches(requested []int, id int) bool {
+	if len(requested) == 0 || id == 0 || id >= CustomCategoryOffset {
+		return true
+	}
+
+	for _, req := range requested {
+		switch {
+		case req == id:
+			return true
+		case req >= CustomCategoryOffset || req/1000 != id/1000:
+			continue
+		case req%1000 == 0 || id%1000 == 0:
+			return true
+		}
+	}
+
+	return false
+}
+
 type Categories []Category
 
 func (slice Categories) Subset(ids ...int) Categories {
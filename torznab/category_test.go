@@ -29,3 +29,25 @@ func TestCategorySubset(t *testing.T) {
 		t.Fatalf("Expected to resolve to %s, instead got %s", expected, s)
 	}
 }
+
+func TestCategoryMatches(t *testing.T) {
+	for idx, test := range []struct {
+		requested []int
+		id        int
+		expected  bool
+	}{
+		{nil, 5040, true},
+		{[]int{5040}, 5040, true},
+		{[]int{5000}, 5040, true},
+		{[]int{5040}, 5000, true},
+		{[]int{5030}, 5040, false},
+		{[]int{5000}, 2040, false},
+		{[]int{2000, 5040}, 2010, true},
+		{[]int{5000}, 0, true},
+		{[]int{5000}, CustomCategoryOffset + 12, true},
+	} {
+		if got := CategoryMatches(test.requested, test.id); got != test.expected {
+			t.Errorf("Row #%d: expected %v, got %v", idx+1, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+package torznab
+
+// Filter returns the items that match the query's languages, flags and date range, which every
+// search is filtered by once its results are in. Callers that have default languages, like
+// those of a user, should set them on the query first
+func Filter(items []ResultItem, query Query) []ResultItem {
+	items = FilterLanguages(items, query.Languages)
+	items = FilterFlags(items, query.Flags)
+	return FilterDates(items, query)
+}
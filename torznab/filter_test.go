@@ -0,0 +1,33 @@
+package torznab
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFilter(t *testing.T) {
+	now := time.Now()
+
+	items := []ResultItem{
+		{Title: "a", Language: "fr", Internal: true, PublishDate: now},
+		{Title: "b", Language: "en", Internal: true, PublishDate: now},
+		{Title: "c", Language: "fr", PublishDate: now},
+		{Title: "d", Language: "fr", Internal: true, PublishDate: now.AddDate(0, 0, -30)},
+		{Title: "e", Internal: true},
+	}
+
+	query := Query{Languages: []string{"fr"}, Flags: map[string]bool{FlagInternal: true}, MaxAge: 7}
+
+	titles := ""
+	for _, item := range Filter(items, query) {
+		titles += item.Title
+	}
+
+	if titles != "ae" {
+		t.Fatalf("Expected a and e, got %q", titles)
+	}
+
+	if filtered := Filter(items, Query{}); len(filtered) != len(items) {
+		t.Fatalf("Expected every item without filters, got %d", len(filtered))
+	}
+}
@@ -0,0 +1,90 @@
+package torznab
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The flags that sites mark releases with, which are sent as tag attributes and can be
+// required or excluded by searches
+const (
+	FlagInternal  = "internal"
+	FlagScene     = "scene"
+	FlagExclusive = "exclusive"
+)
+
+// Flags are the release flags that are known
+var Flags = []string{FlagInternal, FlagScene, FlagExclusive}
+
+// ParseFlag parses the extracted value of a flag, which is true for the usual boolean values
+// and for the flag's own name, so that a badge's text or a case can be used for it
+func ParseFlag(name, val string) (bool, error) {
+	switch v := strings.ToLower(strings.TrimSpace(val)); v {
+	case name, "yes", "y":
+		return true, nil
+	case "", "no", "n":
+		return false, nil
+	default:
+		return strconv.ParseBool(v)
+	}
+}
+
+// Flag returns whether the item has a release flag
+func (ri ResultItem) Flag(name string) bool {
+	switch name {
+	case FlagInternal:
+		return ri.Internal
+	case FlagScene:
+		return ri.Scene
+	case FlagExclusive:
+		return ri.Exclusive
+	}
+	return false
+}
+
+// SetFlag sets one of the item's release flags
+func (ri *ResultItem) SetFlag(name string, val bool) {
+	switch name {
+	case FlagInternal:
+		ri.Internal = val
+	case FlagScene:
+		ri.Scene = val
+	case FlagExclusive:
+		ri.Exclusive = val
+	}
+}
+
+// FilterFlags returns the items that have the flags that are true and don't have the ones
+// that are false. All of the items are returned if no flags are given
+func FilterFlags(items []ResultItem, flags map[string]bool) []ResultItem {
+	if len(flags) == 0 {
+		return items
+	}
+
+	filtered := []ResultItem{}
+	for _, item := range items {
+		matches := true
+		for name, want := range flags {
+			if item.Flag(name) != want {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			filtered = append(filtered, item)
+		}
+	}
+
+	return filtered
+}
+
+// sortedFlags returns the names of the flags in a query in a stable order
+func sortedFlags(flags map[string]bool) []string {
+	names := []string{}
+	for name := range flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,85 @@
+package torznab
+
+import (
+	"encoding/xml"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestParseFlag(t *testing.T) {
+	for val, expected := range map[string]bool{
+		"1":        true,
+		"true":     true,
+		"Internal": true,
+		"yes":      true,
+		"0":        false,
+		"":         false,
+		"no":       false,
+	} {
+		actual, err := ParseFlag(FlagInternal, val)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual != expected {
+			t.Errorf("Expected %q to be %v, got %v", val, expected, actual)
+		}
+	}
+
+	if _, err := ParseFlag(FlagInternal, "scene"); err == nil {
+		t.Fatal("Expected another flag's name to be an error")
+	}
+}
+
+func TestQueryFlags(t *testing.T) {
+	q, err := ParseQuery(url.Values{"internal": {"1"}, "scene": {"0"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(q.Flags) != 2 || !q.Flags[FlagInternal] || q.Flags[FlagScene] {
+		t.Fatalf("Unexpected flags %#v", q.Flags)
+	}
+
+	if encoded := q.Encode(); !strings.Contains(encoded, "internal=1&scene=0") {
+		t.Fatalf("Expected flags to be encoded, got %q", encoded)
+	}
+
+	if _, err := ParseQuery(url.Values{"internal": {"maybe"}}); err == nil {
+		t.Fatal("Expected an unparseable flag to be an error")
+	}
+}
+
+func TestFilterFlags(t *testing.T) {
+	items := []ResultItem{
+		{Title: "internal", Internal: true},
+		{Title: "scene", Scene: true},
+		{Title: "internal scene", Internal: true, Scene: true},
+	}
+
+	filtered := FilterFlags(items, map[string]bool{FlagInternal: true, FlagScene: false})
+	if len(filtered) != 1 || filtered[0].Title != "internal" {
+		t.Fatalf("Expected only the internal result, got %#v", filtered)
+	}
+
+	if len(FilterFlags(items, nil)) != 3 {
+		t.Fatal("Expected no flags not to filter anything")
+	}
+}
+
+func TestResultItemFlagTags(t *testing.T) {
+	x, err := xml.Marshal(ResultItem{Title: "llamas", Internal: true, Exclusive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tag := range []string{`name="tag" value="internal"`, `name="tag" value="exclusive"`} {
+		if !strings.Contains(string(x), tag) {
+			t.Errorf("Expected %s in %s", tag, x)
+		}
+	}
+
+	if strings.Contains(string(x), `value="scene"`) {
+		t.Errorf("Expected no scene tag in %s", x)
+	}
+}
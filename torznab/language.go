@@ -0,0 +1,113 @@
+package torznab
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// languageNames maps the ways sites name languages to their ISO 639-1 code, including the ISO
+// 639-2 codes and the country codes of flags that aren't also a language's code
+var languageNames = map[string]string{
+	"english": "en", "eng": "en", "gb": "en", "us": "en",
+	"french": "fr", "français": "fr", "francais": "fr", "fre": "fr", "fra": "fr",
+	"german": "de", "deutsch": "de", "ger": "de", "deu": "de", "at": "de",
+	"spanish": "es", "español": "es", "espanol": "es", "castellano": "es", "spa": "es", "mx": "es",
+	"italian": "it", "italiano": "it", "ita": "it",
+	"portuguese": "pt", "português": "pt", "portugues": "pt", "por": "pt", "br": "pt",
+	"russian": "ru", "русский": "ru", "rus": "ru",
+	"japanese": "ja", "日本語": "ja", "jpn": "ja", "jp": "ja",
+	"chinese": "zh", "中文": "zh", "chi": "zh", "zho": "zh", "cn": "zh",
+	"korean": "ko", "한국어": "ko", "kor": "ko", "kr": "ko",
+	"dutch": "nl", "nederlands": "nl", "dut": "nl", "nld": "nl",
+	"swedish": "sv", "svenska": "sv", "swe": "sv", "se": "sv",
+	"norwegian": "no", "norsk": "no", "nor": "no",
+	"danish": "da", "dansk": "da", "dan": "da", "dk": "da",
+	"finnish": "fi", "suomi": "fi", "fin": "fi",
+	"polish": "pl", "polski": "pl", "pol": "pl",
+	"turkish": "tr", "türkçe": "tr", "turkce": "tr", "tur": "tr",
+	"arabic": "ar", "العربية": "ar", "ara": "ar",
+	"hindi": "hi", "हिन्दी": "hi", "hin": "hi",
+	"hungarian": "hu", "magyar": "hu", "hun": "hu",
+	"czech": "cs", "čeština": "cs", "cestina": "cs", "cze": "cs", "ces": "cs", "cz": "cs",
+	"greek": "el", "ελληνικά": "el", "gre": "el", "ell": "el", "gr": "el",
+	"hebrew": "he", "עברית": "he", "heb": "he", "il": "he",
+	"ukrainian": "uk", "українська": "uk", "ukr": "uk", "ua": "uk",
+	"romanian": "ro", "română": "ro", "romana": "ro", "rum": "ro", "ron": "ro",
+}
+
+var languageCodes = map[string]bool{}
+
+func init() {
+	for _, code := range languageNames {
+		languageCodes[code] = true
+	}
+}
+
+// NormalizeLanguage returns the ISO 639-1 code of a language given as a code like fr or fr-FR,
+// a name like French or Français, or the url of a flag icon like /pic/flags/fr.png. It returns
+// an empty string if the language isn't known
+func NormalizeLanguage(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+
+	// flag icons, like /pic/flags/fr.png or flag-fr
+	if strings.Contains(s, "/") || strings.HasSuffix(s, ".png") || strings.HasSuffix(s, ".gif") {
+		s = strings.TrimSuffix(path.Base(s), path.Ext(s))
+	}
+	for _, prefix := range []string{"flag-", "flag_", "flag"} {
+		s = strings.TrimPrefix(s, prefix)
+	}
+
+	if code, ok := languageNames[s]; ok {
+		return code
+	}
+
+	// a region like en-us or pt_BR is more specific than results are tagged with
+	if idx := strings.IndexAny(s, "-_"); idx > 0 {
+		s = s[:idx]
+	}
+
+	if languageCodes[s] {
+		return s
+	}
+
+	return languageNames[s]
+}
+
+// ParseLanguages parses a comma separated list of languages into their codes
+func ParseLanguages(s string) ([]string, error) {
+	langs := []string{}
+	for _, val := range strings.Split(s, ",") {
+		if val = strings.TrimSpace(val); val == "" {
+			continue
+		}
+		code := NormalizeLanguage(val)
+		if code == "" {
+			return nil, fmt.Errorf("Unknown language %q", val)
+		}
+		langs = append(langs, code)
+	}
+	return langs, nil
+}
+
+// FilterLanguages returns the items in one of the languages given, along with the ones in an
+// unknown language. All of the items are returned if no languages are given
+func FilterLanguages(items []ResultItem, langs []string) []ResultItem {
+	if len(langs) == 0 {
+		return items
+	}
+
+	wanted := map[string]bool{}
+	for _, l := range langs {
+		wanted[l] = true
+	}
+
+	filtered := []ResultItem{}
+	for _, item := range items {
+		if item.Language == "" || wanted[item.Language] {
+			filtered = append(filtered, item)
+		}
+	}
+
+	return filtered
+}
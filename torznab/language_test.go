@@ -0,0 +1,60 @@
+package torznab
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeLanguage(t *testing.T) {
+	for input, expected := range map[string]string{
+		"fr":                   "fr",
+		"fr-FR":                "fr",
+		"pt_BR":                "pt",
+		"French":               "fr",
+		"Français":             "fr",
+		"ger":                  "de",
+		"/pic/flags/gb.png":    "en",
+		"images/flag_es.gif":   "es",
+		"flag-jp":              "ja",
+		"klingon":              "",
+		"":                     "",
+		"https://x.org/de.png": "de",
+	} {
+		if actual := NormalizeLanguage(input); actual != expected {
+			t.Errorf("Expected %q to be %q, got %q", input, expected, actual)
+		}
+	}
+}
+
+func TestQueryLanguages(t *testing.T) {
+	q, err := ParseQuery(url.Values{"q": {"llamas"}, "language": {"en,French"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(q.Languages, []string{"en", "fr"}) {
+		t.Fatalf("Expected languages en and fr, got %#v", q.Languages)
+	}
+
+	if _, err := ParseQuery(url.Values{"language": {"klingon"}}); err == nil {
+		t.Fatal("Expected an unknown language to be an error")
+	}
+}
+
+func TestFilterLanguages(t *testing.T) {
+	items := []ResultItem{
+		{Title: "english", Language: "en"},
+		{Title: "french", Language: "fr"},
+		{Title: "unknown"},
+	}
+
+	filtered := FilterLanguages(items, []string{"fr"})
+	if len(filtered) != 2 || filtered[0].Title != "french" || filtered[1].Title != "unknown" {
+		t.Fatalf("Expected french and unknown results, got %#v", filtered)
+	}
+
+	if len(FilterLanguages(items, nil)) != 3 {
+		t.Fatal("Expected no languages not to filter anything")
+	}
+}
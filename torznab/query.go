@@ -6,6 +6,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/cardigann/cardigann/logger"
 )
@@ -19,6 +20,30 @@ type Query struct {
 	Categories                         []int
 	APIKey                             string
 
+	// Languages are the ISO 639-1 codes of the languages results should be in
+	Languages []string
+
+	// Flags are release flags like internal or scene that results must have when true, or must
+	// not have when false
+	Flags map[string]bool
+
+	// MaxAge is how many days old results can be at most, zero for any age
+	MaxAge int
+
+	// MinDate and MaxDate are the first and last days that results can be published on, either
+	// can be zero to leave that end of the range open
+	MinDate, MaxDate time.Time
+
+	// Raw is site specific search syntax that is passed through to the indexer as-is
+	Raw string
+
+	// RequestID identifies the client request that the query came from, for logging
+	RequestID string
+
+	// Automatic is set for searches that no one is waiting on, like those of scheduled jobs,
+	// which indexers don't make during their quiet hours
+	Automatic bool
+
 	// identifier types
 	TVDBID   string
 	TVRageID string
@@ -146,6 +171,34 @@ func (query Query) Encode() string {
 		v.Set("imdbid", query.IMDBID)
 	}
 
+	if query.Raw != "" {
+		v.Set("raw", query.Raw)
+	}
+
+	if len(query.Languages) > 0 {
+		v.Set("language", strings.Join(query.Languages, ","))
+	}
+
+	for _, flag := range sortedFlags(query.Flags) {
+		if query.Flags[flag] {
+			v.Set(flag, "1")
+		} else {
+			v.Set(flag, "0")
+		}
+	}
+
+	if query.MaxAge != 0 {
+		v.Set("maxage", strconv.Itoa(query.MaxAge))
+	}
+
+	if !query.MinDate.IsZero() {
+		v.Set("mindate", query.MinDate.Format(DateFormat))
+	}
+
+	if !query.MaxDate.IsZero() {
+		v.Set("maxdate", query.MaxDate.Format(DateFormat))
+	}
+
 	return v.Encode()
 }
 
@@ -264,11 +317,67 @@ func ParseQuery(v url.Values) (Query, error) {
 			}
 			query.IMDBID = vals[0]
 
+		case "raw":
+			if len(vals) > 1 {
+				return query, errors.New("Multiple raw parameters not allowed")
+			}
+			query.Raw = vals[0]
+
+		case "language":
+			for _, val := range vals {
+				langs, err := ParseLanguages(val)
+				if err != nil {
+					return Query{}, err
+				}
+				query.Languages = append(query.Languages, langs...)
+			}
+
+		case FlagInternal, FlagScene, FlagExclusive:
+			if len(vals) > 1 {
+				return query, fmt.Errorf("Multiple %s parameters not allowed", k)
+			}
+			want, err := strconv.ParseBool(vals[0])
+			if err != nil {
+				return query, fmt.Errorf("Unable to parse %s %q", k, vals[0])
+			}
+			if query.Flags == nil {
+				query.Flags = map[string]bool{}
+			}
+			query.Flags[k] = want
+
+		case "maxage":
+			if len(vals) > 1 {
+				return query, errors.New("Multiple maxage parameters not allowed")
+			}
+			maxAge, err := strconv.Atoi(vals[0])
+			if err != nil || maxAge < 0 {
+				return query, fmt.Errorf("Unable to parse maxage %q, expected a number of days", vals[0])
+			}
+			query.MaxAge = maxAge
+
+		case "mindate", "maxdate":
+			if len(vals) > 1 {
+				return query, fmt.Errorf("Multiple %s parameters not allowed", k)
+			}
+			date, err := time.Parse(DateFormat, vals[0])
+			if err != nil {
+				return query, fmt.Errorf("Unable to parse %s %q, expected a date like %s", k, vals[0], DateFormat)
+			}
+			if k == "mindate" {
+				query.MinDate = date
+			} else {
+				query.MaxDate = date
+			}
+
 		default:
 			logger.Logger.Warnf("Unknown torznab request key %q", k)
 		}
 	}
 
+	if !query.MinDate.IsZero() && !query.MaxDate.IsZero() && query.MaxDate.Before(query.MinDate) {
+		return query, errors.New("The maxdate can't be before the mindate")
+	}
+
 	return query, nil
 }
 
@@ -33,6 +33,7 @@ func TestQueryEncode(t *testing.T) {
 	}{
 		{Query{}, Query{}},
 		{Query{Type: "search", Q: "the llama show"}, Query{Q: "the llama show"}},
+		{Query{Type: "search", Raw: "artist:llamas"}, Query{Raw: "artist:llamas"}},
 	} {
 		if row.left.Encode() != row.right.Encode() {
 			t.Fatalf("Expected %#v to equal %#v", row.left.Encode(), row.right.Encode())
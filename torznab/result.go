@@ -11,6 +11,7 @@ const rfc822 = "Mon, 02 Jan 2006 15:04:05 -0700"
 
 type ResultItem struct {
 	Site        string
+	SiteName    string
 	Title       string
 	Description string
 	GUID        string
@@ -21,6 +22,14 @@ type ResultItem struct {
 	Files       int
 	Grabs       int
 	PublishDate time.Time
+	Poster      string
+	Genre       string
+	Language    string
+
+	// release flags, which sites mark internal, scene and exclusive releases with
+	Internal  bool
+	Scene     bool
+	Exclusive bool
 
 	Seeders              int
 	Peers                int
@@ -47,7 +56,7 @@ func (ri ResultItem) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
 		// standard rss elements
 		Title       string      `xml:"title,omitempty"`
 		Description string      `xml:"description,omitempty"`
-		GUID        string      `xml:"guid,omitempty"`
+		GUID        *guidView   `xml:"guid,omitempty"`
 		Comments    string      `xml:"comments,omitempty"`
 		Link        string      `xml:"link,omitempty"`
 		Category    string      `xml:"category,omitempty"`
@@ -56,12 +65,14 @@ func (ri ResultItem) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
 		PublishDate string      `xml:"pubDate,omitempty"`
 		Enclosure   interface{} `xml:"enclosure,omitempty"`
 
+		// jackett's name for the indexer, which some clients show
+		JackettIndexer *jackettIndexerView
+
 		// torznab elements
 		Attrs []torznabAttrView
 	}{
 		Title:       ri.Title,
 		Description: ri.Description,
-		GUID:        ri.GUID,
 		Comments:    ri.Comments,
 		Link:        ri.Link,
 		Category:    strconv.Itoa(ri.Category),
@@ -81,6 +92,36 @@ func (ri ResultItem) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
 		},
 	}
 
+	// guids identify releases rather than being links to them
+	if ri.GUID != "" {
+		itemView.GUID = &guidView{IsPermaLink: false, Value: ri.GUID}
+	}
+
+	if ri.SiteName != "" {
+		itemView.JackettIndexer = &jackettIndexerView{ID: ri.Site, Name: ri.SiteName}
+	}
+
+	// extended attributes that clients of jackett have come to expect, when they're known
+	if ri.Grabs > 0 {
+		itemView.Attrs = append(itemView.Attrs, torznabAttrView{Name: "grabs", Value: strconv.Itoa(ri.Grabs)})
+	}
+
+	for _, attr := range []torznabAttrView{
+		{Name: "coverurl", Value: ri.Poster},
+		{Name: "genre", Value: ri.Genre},
+		{Name: "language", Value: ri.Language},
+	} {
+		if attr.Value != "" {
+			itemView.Attrs = append(itemView.Attrs, attr)
+		}
+	}
+
+	for _, flag := range Flags {
+		if ri.Flag(flag) {
+			itemView.Attrs = append(itemView.Attrs, torznabAttrView{Name: "tag", Value: flag})
+		}
+	}
+
 	e.Encode(itemView)
 	return nil
 }
@@ -91,6 +132,17 @@ type torznabAttrView struct {
 	Value   string   `xml:"value,attr"`
 }
 
+type guidView struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type jackettIndexerView struct {
+	XMLName struct{} `xml:"jackettindexer"`
+	ID      string   `xml:"id,attr"`
+	Name    string   `xml:",chardata"`
+}
+
 type ResultFeed struct {
 	Info  Info
 	Items []ResultItem
@@ -0,0 +1,45 @@
+package torznab
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func TestResultItemMarshalXML(t *testing.T) {
+	item := ResultItem{
+		Site:     "llamas",
+		SiteName: "Llamas & Co",
+		Title:    "Llama llama S01E01",
+		GUID:     "llamas:1234",
+		Poster:   "https://example.org/poster.jpg",
+		Genre:    "Comedy",
+	}
+
+	b, err := xml.Marshal(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		`<guid isPermaLink="false">llamas:1234</guid>`,
+		`<jackettindexer id="llamas">Llamas &amp; Co</jackettindexer>`,
+		`<torznab:attr name="coverurl" value="https://example.org/poster.jpg"></torznab:attr>`,
+		`<torznab:attr name="genre" value="Comedy"></torznab:attr>`,
+	} {
+		if !strings.Contains(string(b), expected) {
+			t.Errorf("Expected %s in %s", expected, b)
+		}
+	}
+
+	b, err = xml.Marshal(ResultItem{Site: "llamas", Title: "Llama llama S01E01"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, unexpected := range []string{"jackettindexer", "coverurl", "genre"} {
+		if strings.Contains(string(b), unexpected) {
+			t.Errorf("Expected no %s in %s", unexpected, b)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+// Package updates checks for newer releases of cardigann and for definitions that have
+// changed upstream since the running version was released
+package updates
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultAPIURL is the github api that releases are published to
+const DefaultAPIURL = "https://api.github.com/repos/cardigann/cardigann"
+
+// defaultClient is used when a Checker has no Client, with a timeout so that an unresponsive api
+// doesn't hold up the check forever
+var defaultClient = &http.Client{Timeout: 30 * time.Second}
+
+var versionRegexp = regexp.MustCompile(`^v?(\d+)\.(\d+)(?:\.(\d+))?`)
+
+// Status is the outcome of checking for updates
+type Status struct {
+	Current     string    `json:"current"`
+	Latest      string    `json:"latest,omitempty"`
+	Available   bool      `json:"available"`
+	URL         string    `json:"url,omitempty"`
+	Definitions []string  `json:"definitions,omitempty"`
+	Checked     time.Time `json:"checked"`
+}
+
+// Checker looks up the latest release from the api at APIURL, with Client if it's set
+type Checker struct {
+	APIURL string
+	Client *http.Client
+}
+
+// Check checks for updates to the given version with the default checker
+func Check(current string) (*Status, error) {
+	return (&Checker{}).Check(current)
+}
+
+func (c *Checker) get(p string, v interface{}) error {
+	apiURL, client := c.APIURL, c.Client
+	if apiURL == "" {
+		apiURL = DefaultAPIURL
+	}
+	if client == nil {
+		client = defaultClient
+	}
+
+	req, err := http.NewRequest("GET", strings.TrimSuffix(apiURL, "/")+p, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Checking for updates failed: %s returned %s", req.URL, resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// Check finds the latest release, and which definitions have changed since the current version
+func (c *Checker) Check(current string) (*Status, error) {
+	var release struct {
+		TagName string `json:"tag_name"`
+		HTMLURL string `json:"html_url"`
+	}
+
+	if err := c.get("/releases/latest", &release); err != nil {
+		return nil, err
+	}
+
+	status := &Status{
+		Current:   current,
+		Latest:    release.TagName,
+		Available: IsNewer(release.TagName, current),
+		URL:       release.HTMLURL,
+		Checked:   time.Now(),
+	}
+
+	// dev builds don't have a release to compare definitions against
+	if m := versionRegexp.FindString(current); m != "" {
+		var compare struct {
+			Files []struct {
+				Filename string `json:"filename"`
+				Status   string `json:"status"`
+			} `json:"files"`
+		}
+
+		if err := c.get("/compare/"+m+"...master", &compare); err != nil {
+			return status, err
+		}
+
+		for _, f := range compare.Files {
+			if path.Dir(f.Filename) == "definitions" && path.Ext(f.Filename) == ".yml" && f.Status != "removed" {
+				status.Definitions = append(status.Definitions,
+					strings.TrimSuffix(path.Base(f.Filename), ".yml"))
+			}
+		}
+	}
+
+	return status, nil
+}
+
+func parseVersion(v string) ([3]int, bool) {
+	parsed := [3]int{}
+	m := versionRegexp.FindStringSubmatch(v)
+	if m == nil {
+		return parsed, false
+	}
+	for idx := range parsed {
+		parsed[idx], _ = strconv.Atoi(m[idx+1])
+	}
+	return parsed, true
+}
+
+// IsNewer returns whether the latest version is newer than the current one. Versions that
+// aren't like v1.2.3, like dev builds, are never out of date
+func IsNewer(latest, current string) bool {
+	l, ok := parseVersion(latest)
+	if !ok {
+		return false
+	}
+	c, ok := parseVersion(current)
+	if !ok {
+		return false
+	}
+
+	for idx := range l {
+		if l[idx] != c[idx] {
+			return l[idx] > c[idx]
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,56 @@
+package updates
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+)
+
+func TestIsNewer(t *testing.T) {
+	for idx, test := range []struct {
+		latest, current string
+		expected        bool
+	}{
+		{"v1.2.0", "v1.1.0", true},
+		{"v1.10.0", "v1.9.3", true},
+		{"v1.1.0", "v1.1.0", false},
+		{"v1.1.0", "v1.1.0-4-g1234abc", false},
+		{"v1.1.1", "v1.1.0-dirty", true},
+		{"v1.0.0", "v1.1.0", false},
+		{"v1.2.0", "dev", false},
+		{"nonsense", "v1.1.0", false},
+	} {
+		if got := IsNewer(test.latest, test.current); got != test.expected {
+			t.Errorf("Row #%d: expected IsNewer(%q, %q) to be %v", idx+1, test.latest, test.current, test.expected)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("GET", "https://example.org/repo/releases/latest",
+		httpmock.NewStringResponder(200, `{"tag_name": "v1.2.0", "html_url": "https://example.org/v1.2.0"}`))
+
+	httpmock.RegisterResponder("GET", "https://example.org/repo/compare/v1.1.0...master",
+		httpmock.NewStringResponder(200, `{"files": [
+			{"filename": "definitions/llamas.yml", "status": "modified"},
+			{"filename": "definitions/alpacas.yml", "status": "removed"},
+			{"filename": "indexer/runner.go", "status": "modified"}
+		]}`))
+
+	status, err := (&Checker{APIURL: "https://example.org/repo"}).Check("v1.1.0-3-g1234abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !status.Available || status.Latest != "v1.2.0" || status.URL != "https://example.org/v1.2.0" {
+		t.Fatalf("Expected v1.2.0 to be available, got %#v", status)
+	}
+
+	if !reflect.DeepEqual(status.Definitions, []string{"llamas"}) {
+		t.Fatalf("Expected llamas definition to be updated, got %q", status.Definitions)
+	}
+}
@@ -14,7 +14,7 @@ class AlertDismissable extends Component {
   render() {
     if (this.state.visible) {
       return (
-        <Alert bsStyle="danger" onDismiss={this.handleAlertDismiss}>
+        <Alert bsStyle={this.props.bsStyle || "danger"} onDismiss={this.handleAlertDismiss}>
           {this.props.children}
         </Alert>
       );
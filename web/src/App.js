@@ -7,6 +7,12 @@ import AddIndexer from "./AddIndexer";
 import IndexerList from "./IndexerList";
 import ConfigModal from "./ConfigModal";
 import SearchModal from "./SearchModal";
+import AuditModal from "./AuditModal";
+import ErrorsModal from "./ErrorsModal";
+import JobsModal from "./JobsModal";
+import SavedSearchesModal from "./SavedSearchesModal";
+import GrabsModal from "./GrabsModal";
+import LoggingModal from "./LoggingModal";
 import AlertDismissable from "./AlertDismissable";
 import Login from './Login';
 import Logo from './cardigann.gif';
@@ -17,17 +23,28 @@ class App extends Component {
     indexers: [],
     enabledIndexers: [],
     apiKey: localStorage.getItem('apiKey'),
+    role: localStorage.getItem('role'),
   }
   state = {
     indexers: this.props.indexers,
     enabledIndexers: this.props.enabledIndexers,
     configure: null,
     search: null,
+    audit: null,
+    errors: null,
+    jobs: null,
+    searches: null,
+    grabs: null,
+    logging: null,
     authChecked: false,
     apiKey: this.props.apiKey,
+    role: this.props.role,
+    readOnly: false,
+    offline: false,
     apiKeyCopied: false,
     errorMessage: false,
     version: "unknown",
+    updates: null,
   }
   isEnabled = (indexer) => {
     return this.state.enabledIndexers.filter((x) => x === indexer.id).length > 0;
@@ -74,34 +91,55 @@ class App extends Component {
     });
   }
   handleTestIndexer = (indexer, afterFunc) => {
-    fetch(xhrUrl("xhr/indexers/"+indexer.id+"/test"), {
-        headers: {
-          'Accept': 'application/json',
-          'Authorization': 'apitoken ' + this.state.apiKey,
-        },
-        method: "GET"
-    })
-    .then((response) => response.json())
-    .then((data) => {
-      if(data.ok) {
-        afterFunc(true);
-      } else {
-        afterFunc(false, data.error);
-        throw Error(data.error);
-      }
-    })
-    .catch((err) => {
-      console.warn(err);
-      this.setState({errorMessage: err.message}, () => afterFunc(false, err.message))
-    });
+    // the test runs in the background, so poll for its result until it's finished
+    let poll = (method) => {
+      fetch(xhrUrl("xhr/indexers/"+indexer.id+(method === "POST" ? "/test" : "/status")), {
+          headers: {
+            'Accept': 'application/json',
+            'Authorization': 'apitoken ' + this.state.apiKey,
+          },
+          method: method,
+      })
+      .then((response) => {
+        if (!response.ok) {
+          return response.json().then((resp) => {
+            throw Error(resp.error);
+          });
+        }
+        return response.json();
+      })
+      .then((data) => {
+        if (data.running) {
+          setTimeout(() => poll("GET"), 2000);
+        } else {
+          afterFunc(data);
+        }
+      })
+      .catch((err) => {
+        console.warn(err);
+        this.setState({errorMessage: err.message}, () => afterFunc({ok: false, error: err.message}))
+      });
+    };
+    poll("POST");
   }
   handleSearchIndexer = (indexer, afterFunc) => {
     this.showSearchModal(indexer, afterFunc);
   }
-  handleAuthenticate = (apiKey) => {
+  handleAuthenticate = (apiKey, role, readOnly, offline) => {
     apiKey = (apiKey === "") ? null : apiKey;
+    role = role || "admin";
     localStorage.setItem("apiKey", apiKey);
-    this.setState({apiKey: apiKey}, this.loadIndexers);
+    localStorage.setItem("role", role);
+    this.setState({apiKey: apiKey, role: role, readOnly: !!readOnly, offline: !!offline}, () => {
+      this.loadIndexers();
+      this.checkUpdates();
+    });
+  }
+  isAdmin = () => {
+    return this.state.role === "admin";
+  }
+  canConfigure = () => {
+    return this.isAdmin() && !this.state.readOnly;
   }
   loadIndexerConfig = (indexer, dataFunc) => {
     fetch(xhrUrl("xhr/indexers/"+indexer.id+"/config"), {
@@ -136,7 +174,7 @@ class App extends Component {
     })
     .then((data) => {
       this.setState({authChecked: true}, () => {
-        this.handleAuthenticate(data.token);
+        this.handleAuthenticate(data.token, data.role, data.readOnly, data.offline);
       });
     })
     .catch((err) => {
@@ -201,6 +239,37 @@ class App extends Component {
       search: <SearchModal indexer={indexer} show={true} onClose={afterFunc} apiKey={this.state.apiKey} />
     });
   }
+  showAuditModal = () => {
+    this.setState({
+      audit: <AuditModal show={true} apiKey={this.state.apiKey} onClose={() => this.setState({audit: null})} />
+    });
+  }
+  showErrorsModal = () => {
+    this.setState({
+      errors: <ErrorsModal show={true} apiKey={this.state.apiKey} onClose={() => this.setState({errors: null})} />
+    });
+  }
+  showJobsModal = () => {
+    this.setState({
+      jobs: <JobsModal show={true} apiKey={this.state.apiKey} onClose={() => this.setState({jobs: null})} />
+    });
+  }
+  showSavedSearchesModal = () => {
+    this.setState({
+      searches: <SavedSearchesModal show={true} apiKey={this.state.apiKey} readOnly={!this.canConfigure()} onClose={() => this.setState({searches: null})} />
+    });
+  }
+  showGrabsModal = () => {
+    this.setState({
+      grabs: <GrabsModal show={true} apiKey={this.state.apiKey} allowDelete={this.canConfigure()} onClose={() => this.setState({grabs: null})} />
+    });
+  }
+  showLoggingModal = () => {
+    let indexers = this.state.indexers.filter((x) => this.isEnabled(x));
+    this.setState({
+      logging: <LoggingModal show={true} apiKey={this.state.apiKey} indexers={indexers} onClose={() => this.setState({logging: null})} />
+    });
+  }
   checkVersion = () => {
     fetch(xhrUrl("xhr/version")).then((response) => {
       response.json().then((json) => {
@@ -208,6 +277,17 @@ class App extends Component {
       });
     });
   }
+  checkUpdates = () => {
+    fetch(xhrUrl("xhr/updates"), {
+        headers: {
+          'Accept': 'application/json',
+          'Authorization': 'apitoken ' + this.state.apiKey,
+        },
+    })
+    .then((response) => response.ok ? response.json() : null)
+    .then((updates) => this.setState({updates: updates}))
+    .catch((err) => console.warn(err));
+  }
   componentWillMount() {
     if (!this.state.authChecked) {
       this.checkAuth();
@@ -237,12 +317,22 @@ class App extends Component {
       </AlertDismissable>;
     }
 
+    let updateAlert = null;
+    let updates = this.state.updates && this.state.updates.status;
+    if (updates && (updates.available || updates.definitions)) {
+      updateAlert = <AlertDismissable bsStyle="info">
+        {updates.available ? <p>Cardigann {updates.latest} is available, <a href={updates.url}>see what's new</a>.</p> : null}
+        {updates.definitions ? <p>Updated definitions since this release: {updates.definitions.join(", ")}.</p> : null}
+      </AlertDismissable>;
+    }
+
     var issueLink = "https://github.com/cardigann/cardigann/issues/new?title=Bug+in+version+" + this.state.version;
 
     return (
       <div className="App container-fluid">
         <PageHeader><img src={Logo} height="40" width="35" alt="line drawing of cardigan"/> Cardigann <small>Proxy</small></PageHeader>
         {errorAlert}
+        {updateAlert}
         <div className="App__apiKey">
           <strong>API Key: </strong>
           <code>{this.state.apiKey}</code>
@@ -252,11 +342,13 @@ class App extends Component {
           {this.state.apiKeyCopied ? <span className="copied">Copied.</span> : null}
         </div>
         <div className="App__body">
-          <AddIndexer
+          {this.canConfigure() ? <AddIndexer
             indexers={addableIndexers}
-            onAdd={this.handleAddIndexer} />
+            onAdd={this.handleAddIndexer} /> : null}
           <IndexerList
             indexers={enabledIndexers}
+            readOnly={!this.canConfigure()}
+            allowTest={this.isAdmin()}
             onEdit={this.handleEditIndexer}
             onSave={this.handleSaveIndexer}
             onTest={this.handleTestIndexer}
@@ -264,10 +356,22 @@ class App extends Component {
             onSearch={this.handleSearchIndexer} />
           {this.state.configure}
           {this.state.search}
+          {this.state.audit}
+          {this.state.errors}
+          {this.state.jobs}
+          {this.state.searches}
+          {this.state.grabs}
+          {this.state.logging}
         </div>
         <footer className="footer">
           <p className="text-muted">
             <a href={issueLink}>Report a bug</a> in <code>{this.state.version}</code>.
+            {' '}<a onClick={this.showSavedSearchesModal}>Saved searches</a>.
+            {' '}<a onClick={this.showGrabsModal}>Grabbed torrents</a>.
+            {this.isAdmin() ? <span> <a onClick={this.showAuditModal}>View audit log</a>. <a onClick={this.showErrorsModal}>Recent errors</a>.</span> : null}
+            {this.canConfigure() ? <span> <a onClick={this.showJobsModal}>Scheduled jobs</a>. <a onClick={this.showLoggingModal}>Logging</a>.</span> : null}
+            {this.state.readOnly ? <span> Settings can't be changed, the server is in read-only mode.</span> : null}
+            {this.state.offline ? <span> The server is offline, searches show the results cached when they were last searched.</span> : null}
           </p>
         </footer>
       </div>
@@ -0,0 +1,86 @@
+import React, { Component } from 'react';
+import { Modal, Button } from 'react-bootstrap';
+import { BootstrapTable, TableHeaderColumn }  from 'react-bootstrap-table';
+import moment from 'moment';
+import xhrUrl from './xhr';
+
+import 'react-bootstrap-table/dist/react-bootstrap-table.min.css';
+
+class AuditModal extends Component {
+  static defaultProps = {
+    events: [],
+  }
+  state = {
+    show: this.props.show,
+    events: this.props.events,
+  }
+  componentWillReceiveProps(newProps) {
+    this.setState({
+      show: typeof(newProps).show !== undefined ? newProps.show : this.state.show,
+    });
+  }
+  componentDidMount() {
+    fetch(xhrUrl("xhr/audit?limit=500"), {
+        headers: {
+          'Accept': 'application/json',
+          'Authorization': 'apitoken ' + this.props.apiKey,
+        },
+    })
+    .then((response) => {
+      if (!response.ok) {
+        return response.json().then((resp) => {
+          throw Error(resp.error);
+        });
+      }
+      return response.json()
+    })
+    .then((events) => {
+      this.setState({events: events.map((ev, idx) => Object.assign({id: idx}, ev))});
+    })
+    .catch((err) => {
+      console.error(err);
+    });
+  }
+  handleClose = () => {
+    this.props.onClose();
+    this.setState({show: false});
+  }
+  render() {
+    let timeFormatter = (cell, row) => {
+      return moment(cell).format("YYYY-MM-DD HH:mm:ss");
+    };
+
+    let detailsFormatter = (cell, row) => {
+      if (!cell) {
+        return "";
+      }
+      return Object.keys(cell).map((k) => k + "=" + cell[k]).join(" ");
+    };
+
+    let exportHref = xhrUrl("xhr/audit?download=1&apikey=" + this.props.apiKey);
+
+    return (
+      <Modal show={this.state.show} onHide={this.handleClose} dialogClassName="App__SearchModal">
+        <Modal.Header closeButton>
+          <Modal.Title>Audit Log</Modal.Title>
+        </Modal.Header>
+        <Modal.Body>
+          <BootstrapTable data={this.state.events} striped={true} hover={true} pagination={true}>
+            <TableHeaderColumn dataField="id" isKey={true} hidden={true}>ID</TableHeaderColumn>
+            <TableHeaderColumn dataField="time" dataSort={true} dataFormat={timeFormatter} width="160px">Time</TableHeaderColumn>
+            <TableHeaderColumn dataField="user" dataSort={true} width="100px">User</TableHeaderColumn>
+            <TableHeaderColumn dataField="action" dataSort={true} width="80px">Action</TableHeaderColumn>
+            <TableHeaderColumn dataField="indexer" dataSort={true} width="120px">Indexer</TableHeaderColumn>
+            <TableHeaderColumn dataField="details" dataFormat={detailsFormatter}>Details</TableHeaderColumn>
+          </BootstrapTable>
+        </Modal.Body>
+        <Modal.Footer>
+          <Button href={exportHref}>Export JSON</Button>
+          <Button onClick={this.handleClose}>Close</Button>
+        </Modal.Footer>
+      </Modal>
+    );
+  }
+}
+
+export default AuditModal;
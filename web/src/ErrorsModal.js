@@ -0,0 +1,81 @@
+import React, { Component } from 'react';
+import { Modal, Button } from 'react-bootstrap';
+import { BootstrapTable, TableHeaderColumn }  from 'react-bootstrap-table';
+import moment from 'moment';
+import xhrUrl from './xhr';
+
+import 'react-bootstrap-table/dist/react-bootstrap-table.min.css';
+
+class ErrorsModal extends Component {
+  static defaultProps = {
+    events: [],
+  }
+  state = {
+    show: this.props.show,
+    events: this.props.events,
+  }
+  componentWillReceiveProps(newProps) {
+    this.setState({
+      show: typeof(newProps).show !== undefined ? newProps.show : this.state.show,
+    });
+  }
+  componentDidMount() {
+    fetch(xhrUrl("xhr/errors?limit=500"), {
+        headers: {
+          'Accept': 'application/json',
+          'Authorization': 'apitoken ' + this.props.apiKey,
+        },
+    })
+    .then((response) => {
+      if (!response.ok) {
+        return response.json().then((resp) => {
+          throw Error(resp.error);
+        });
+      }
+      return response.json()
+    })
+    .then((events) => {
+      this.setState({events: events.map((ev, idx) => Object.assign({id: idx}, ev))});
+    })
+    .catch((err) => {
+      console.error(err);
+    });
+  }
+  handleClose = () => {
+    this.props.onClose();
+    this.setState({show: false});
+  }
+  render() {
+    let timeFormatter = (cell, row) => {
+      return moment(cell).format("YYYY-MM-DD HH:mm:ss");
+    };
+
+    let categoryFormatter = (cell, row) => {
+      return row.reason ? cell + " (" + row.reason + ")" : cell;
+    };
+
+    return (
+      <Modal show={this.state.show} onHide={this.handleClose} dialogClassName="App__SearchModal">
+        <Modal.Header closeButton>
+          <Modal.Title>Recent Errors</Modal.Title>
+        </Modal.Header>
+        <Modal.Body>
+          <BootstrapTable data={this.state.events} striped={true} hover={true} pagination={true}>
+            <TableHeaderColumn dataField="id" isKey={true} hidden={true}>ID</TableHeaderColumn>
+            <TableHeaderColumn dataField="time" dataSort={true} dataFormat={timeFormatter} width="160px">Time</TableHeaderColumn>
+            <TableHeaderColumn dataField="indexer" dataSort={true} filter={{type: 'TextFilter'}} width="140px">Indexer</TableHeaderColumn>
+            <TableHeaderColumn dataField="operation" dataSort={true} width="90px">Operation</TableHeaderColumn>
+            <TableHeaderColumn dataField="category" dataSort={true} dataFormat={categoryFormatter} width="140px">Category</TableHeaderColumn>
+            <TableHeaderColumn dataField="error" tdStyle={{whiteSpace: 'normal'}}>Error</TableHeaderColumn>
+            <TableHeaderColumn dataField="query" tdStyle={{whiteSpace: 'normal'}} width="200px">Query</TableHeaderColumn>
+          </BootstrapTable>
+        </Modal.Body>
+        <Modal.Footer>
+          <Button onClick={this.handleClose}>Close</Button>
+        </Modal.Footer>
+      </Modal>
+    );
+  }
+}
+
+export default ErrorsModal;
@@ -0,0 +1,102 @@
+import React, { Component } from 'react';
+import { Modal, Button, Alert } from 'react-bootstrap';
+import { BootstrapTable, TableHeaderColumn }  from 'react-bootstrap-table';
+import moment from 'moment';
+import xhrUrl from './xhr';
+
+import 'react-bootstrap-table/dist/react-bootstrap-table.min.css';
+
+class GrabsModal extends Component {
+  static defaultProps = {
+    grabs: [],
+  }
+  state = {
+    show: this.props.show,
+    grabs: this.props.grabs,
+    errorMessage: null,
+  }
+  componentWillReceiveProps(newProps) {
+    this.setState({
+      show: typeof(newProps).show !== undefined ? newProps.show : this.state.show,
+    });
+  }
+  componentDidMount() {
+    this.loadGrabs();
+  }
+  request = (path, options) => {
+    return fetch(xhrUrl(path), Object.assign({
+      headers: {
+        'Accept': 'application/json',
+        'Authorization': 'apitoken ' + this.props.apiKey,
+      },
+    }, options))
+    .then((response) => {
+      if (!response.ok) {
+        return response.json().then((resp) => {
+          throw Error(resp.error);
+        });
+      }
+      return response.json();
+    });
+  }
+  handleError = (err) => {
+    console.warn(err);
+    this.setState({errorMessage: err.message});
+  }
+  loadGrabs = () => {
+    this.request("xhr/grabs")
+      .then((grabs) => this.setState({grabs: grabs}))
+      .catch(this.handleError);
+  }
+  handleClose = () => {
+    this.props.onClose();
+    this.setState({show: false});
+  }
+  handleDelete = (grab) => {
+    this.request("xhr/grabs/" + grab.id, {method: "DELETE"})
+      .then(this.loadGrabs)
+      .catch(this.handleError);
+  }
+  render() {
+    let timeFormatter = (cell, row) => {
+      return moment(cell).format("YYYY-MM-DD HH:mm:ss");
+    };
+
+    let sizeFormatter = (cell, row) => {
+      return (cell / 1024).toFixed(1) + " KB";
+    };
+
+    let actionsFormatter = (cell, row) => {
+      let href = xhrUrl("xhr/grabs/" + row.id + "/torrent?apikey=" + this.props.apiKey);
+      return <span>
+        <Button bsSize="xsmall" href={href}>Download</Button>{' '}
+        {this.props.allowDelete ? <Button bsSize="xsmall" bsStyle="danger" onClick={() => this.handleDelete(row)}>Delete</Button> : null}
+      </span>;
+    };
+
+    return (
+      <Modal show={this.state.show} onHide={this.handleClose} dialogClassName="App__SearchModal">
+        <Modal.Header closeButton>
+          <Modal.Title>Grabbed Torrents</Modal.Title>
+        </Modal.Header>
+        <Modal.Body>
+          {this.state.errorMessage ? <Alert bsStyle="danger">{this.state.errorMessage}</Alert> : null}
+          <BootstrapTable data={this.state.grabs} striped={true} hover={true} pagination={true}>
+            <TableHeaderColumn dataField="id" isKey={true} hidden={true}>ID</TableHeaderColumn>
+            <TableHeaderColumn dataField="time" dataSort={true} dataFormat={timeFormatter} width="160px">Time</TableHeaderColumn>
+            <TableHeaderColumn dataField="user" dataSort={true} width="100px">User</TableHeaderColumn>
+            <TableHeaderColumn dataField="indexer" dataSort={true} width="120px">Indexer</TableHeaderColumn>
+            <TableHeaderColumn dataField="filename" dataSort={true}>Filename</TableHeaderColumn>
+            <TableHeaderColumn dataField="size" dataFormat={sizeFormatter} width="90px">Size</TableHeaderColumn>
+            <TableHeaderColumn dataField="id" dataFormat={actionsFormatter} width="140px">Actions</TableHeaderColumn>
+          </BootstrapTable>
+        </Modal.Body>
+        <Modal.Footer>
+          <Button onClick={this.handleClose}>Close</Button>
+        </Modal.Footer>
+      </Modal>
+    );
+  }
+}
+
+export default GrabsModal;
@@ -1,5 +1,5 @@
 import React, { Component } from 'react';
-import { Table, ButtonToolbar, Button, Panel } from 'react-bootstrap';
+import { Table, ButtonToolbar, Button, Panel, Label } from 'react-bootstrap';
 import { OverlayTrigger, Tooltip } from 'react-bootstrap';
 import CopyToClipboard from 'react-copy-to-clipboard';
 import xhrUrl from './xhr';
@@ -54,6 +54,87 @@ class FeedLink extends Component {
   }
 }
 
+const loginFailureStatus = {
+  "credentials": "Wrong password",
+  "banned": "Banned",
+  "maintenance": "Maintenance",
+  "2fa": "Needs 2FA",
+};
+
+const stageFailureStatus = {
+  "config": "Not configured",
+  "login": "Login failed",
+  "search": "Search failed",
+  "results": "No results",
+};
+
+class VerificationBadge extends Component {
+  render() {
+    let v = this.props.verification;
+    if (this.props.testing || (v && v.running)) {
+      return <Label bsStyle="info">Testing</Label>;
+    }
+    if (!v || !v.checked) {
+      return <Label>Untested</Label>;
+    }
+
+    let title = "Checked " + new Date(v.checked).toLocaleString();
+    if (v.ok) {
+      return <Label bsStyle="success" title={title + ", " + v.results + " results"}>OK</Label>;
+    }
+
+    let status = loginFailureStatus[v.reason] || stageFailureStatus[v.stage] || "Failed";
+    return <Label bsStyle={v.reason === "maintenance" ? "warning" : "danger"} title={title + ": " + v.error}>{status}</Label>;
+  }
+}
+
+const backoffStatus = {
+  "throttled": "Rate limited",
+  "budget": "Out of requests",
+  "crash": "Crashed",
+};
+
+class BackoffBadge extends Component {
+  render() {
+    let b = this.props.backoff;
+    if (!b) {
+      return null;
+    }
+
+    let title = "Paused until " + new Date(b.until).toLocaleString();
+    if (b.message) {
+      title += ": " + b.message;
+    }
+    let style = b.reason === "crash" ? "danger" : "warning";
+    return <span>{' '}<Label bsStyle={style} title={title}>{backoffStatus[b.reason] || "Paused"}</Label></span>;
+  }
+}
+
+class BudgetBadge extends Component {
+  render() {
+    let budget = this.props.budget;
+    if (!budget || !budget.length || this.props.backoff) {
+      return null;
+    }
+
+    let title = budget.map((b) => b.used + " of " + b.limit + " requests used").join(", ");
+    let used = Math.max(...budget.map((b) => b.used / b.requests));
+    return <span>{' '}<Label bsStyle={used >= 0.8 ? "warning" : "default"} title={title}>{Math.round(used * 100)}%</Label></span>;
+  }
+}
+
+class LayoutBadge extends Component {
+  render() {
+    let layout = this.props.layout;
+    if (!layout) {
+      return null;
+    }
+
+    let title = "Search results changed since " + new Date(layout.since).toLocaleString() + ": " + layout.changes.join(", ");
+    return <span>{' '}<Label bsStyle="danger" title={title}>Layout changed</Label></span>;
+  }
+}
+
 class IndexerListRow extends Component {
   static defaultProps = {
     editing: false,
@@ -63,10 +144,11 @@ class IndexerListRow extends Component {
     allowDisable: true,
     allowTest: true,
     allowSearch: true,
+    showStatus: true,
   }
   state = {
     config: {},
-    status: "OK",
+    verification: this.props.indexer.verification,
     editing: this.props.editing,
     testing: this.props.testing,
     disabling: this.props.disabling,
@@ -85,12 +167,11 @@ class IndexerListRow extends Component {
   }
   handleTestClick = () => {
     this.setState({
-      status: "Testing",
       testing: true,
     });
-    this.props.onTest(this.props.indexer, (ok) => {
+    this.props.onTest(this.props.indexer, (verification) => {
       this.setState({
-        status: ok ? "OK" : "Failed",
+        verification: verification,
         testing: false,
       });
     })
@@ -174,7 +255,12 @@ class IndexerListRow extends Component {
               feedHref={xhrUrl(this.props.indexer.feeds.torrentpotato)}
               label="potato" /> : ''}
         </td>
-        <td className="col-md-1">{this.state.status}</td>
+        <td className="col-md-1">
+          {this.props.showStatus ? <VerificationBadge verification={this.state.verification} testing={this.state.testing} /> : null}
+          {this.props.showStatus ? <BackoffBadge backoff={this.props.indexer.backoff} /> : null}
+          {this.props.showStatus ? <BudgetBadge budget={this.props.indexer.budget} backoff={this.props.indexer.backoff} /> : null}
+          {this.props.showStatus ? <LayoutBadge layout={this.props.indexer.layout} /> : null}
+        </td>
         <td className="col-md-3">
           <ButtonToolbar>{buttons}</ButtonToolbar>
         </td>
@@ -195,6 +281,9 @@ class IndexerList extends Component {
           onTest={this.props.onTest}
           onSearch={this.props.onSearch}
           onDisable={this.props.onDisable}
+          allowEdit={!this.props.readOnly}
+          allowDisable={!this.props.readOnly}
+          allowTest={this.props.allowTest}
         />
       );
     });
@@ -232,6 +321,7 @@ class IndexerList extends Component {
               allowEdit={false}
               allowDisable={false}
               allowTest={false}
+              showStatus={false}
               onSearch={this.props.onSearch}
             />
           </tbody>
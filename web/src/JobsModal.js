@@ -0,0 +1,219 @@
+import React, { Component } from 'react';
+import ReactDOM from 'react-dom';
+import { Col, Modal, Button, Form, FormGroup, FormControl, ControlLabel, Checkbox, Alert }  from 'react-bootstrap';
+import { BootstrapTable, TableHeaderColumn }  from 'react-bootstrap-table';
+import moment from 'moment';
+import xhrUrl from './xhr';
+
+import 'react-bootstrap-table/dist/react-bootstrap-table.min.css';
+
+class JobForm extends Component {
+  getValues = () => {
+    let value = (ref) => ReactDOM.findDOMNode(this.refs[ref]).value;
+    return {
+      name: value("name"),
+      schedule: value("schedule"),
+      query: value("query"),
+      indexers: value("indexers").split(",").map((x) => x.trim()).filter((x) => x !== ""),
+      target: value("target"),
+      retention: value("retention"),
+      enabled: ReactDOM.findDOMNode(this.refs.enabled).querySelector("input").checked,
+      dryrun: ReactDOM.findDOMNode(this.refs.dryrun).querySelector("input").checked,
+    };
+  }
+  render() {
+    let job = this.props.job || {};
+    let fields = [
+      {name: "name", label: "Name", placeholder: "tv-weekly"},
+      {name: "schedule", label: "Schedule", placeholder: "0 */6 * * * or @every 30m"},
+      {name: "query", label: "Query", placeholder: "t=tvsearch&q=Show&season=1"},
+      {name: "indexers", label: "Indexers", placeholder: "aggregate or comma separated indexer ids"},
+      {name: "target", label: "Target", placeholder: "blackhole:/downloads/watch"},
+      {name: "retention", label: "Remember", placeholder: "how long to remember pushed releases, e.g 30d"},
+    ];
+    return <Form horizontal>
+      {fields.map((field) => {
+        let value = job[field.name];
+        if (Array.isArray(value)) {
+          value = value.join(",");
+        }
+        return (
+          <FormGroup controlId={"formJob" + field.name} key={field.name}>
+            <Col componentClass={ControlLabel} sm={2}>{field.label}</Col>
+            <Col sm={10}>
+              <FormControl type="text" placeholder={field.placeholder} defaultValue={value}
+                disabled={field.name === "name" && job.name !== undefined} ref={field.name} />
+            </Col>
+          </FormGroup>
+        );
+      })}
+      <FormGroup controlId="formJobEnabled">
+        <Col smOffset={2} sm={10}>
+          <Checkbox defaultChecked={job.enabled !== false} ref="enabled">Enabled</Checkbox>
+          <Checkbox defaultChecked={job.dryrun === true} ref="dryrun">
+            Dry run, only log what would be pushed
+          </Checkbox>
+        </Col>
+      </FormGroup>
+    </Form>;
+  }
+}
+
+class JobsModal extends Component {
+  static defaultProps = {
+    jobs: [],
+  }
+  state = {
+    show: this.props.show,
+    jobs: this.props.jobs,
+    editing: null,
+    errorMessage: null,
+    planned: null,
+  }
+  componentWillReceiveProps(newProps) {
+    this.setState({
+      show: typeof(newProps).show !== undefined ? newProps.show : this.state.show,
+    });
+  }
+  componentDidMount() {
+    this.loadJobs();
+  }
+  request = (path, options) => {
+    return fetch(xhrUrl(path), Object.assign({
+      headers: {
+        'Accept': 'application/json',
+        'Content-Type': 'application/json',
+        'Authorization': 'apitoken ' + this.props.apiKey,
+      },
+    }, options))
+    .then((response) => {
+      if (!response.ok) {
+        return response.json().then((resp) => {
+          throw Error(resp.error);
+        });
+      }
+      return response.status === 204 ? null : response.json();
+    });
+  }
+  handleError = (err) => {
+    console.warn(err);
+    this.setState({errorMessage: err.message});
+  }
+  loadJobs = () => {
+    this.request("xhr/jobs")
+      .then((jobs) => this.setState({jobs: jobs}))
+      .catch(this.handleError);
+  }
+  handleClose = () => {
+    this.props.onClose();
+    this.setState({show: false});
+  }
+  handleSave = () => {
+    let job = this.refs.form.getValues();
+    this.request("xhr/jobs/" + encodeURIComponent(job.name), {method: "PUT", body: JSON.stringify(job)})
+      .then(() => this.setState({editing: null, errorMessage: null}, this.loadJobs))
+      .catch(this.handleError);
+  }
+  handleDelete = (job) => {
+    this.request("xhr/jobs/" + encodeURIComponent(job.name), {method: "DELETE"})
+      .then(this.loadJobs)
+      .catch(this.handleError);
+  }
+  handleRun = (job, dryRun) => {
+    let path = "xhr/jobs/" + encodeURIComponent(job.name) + "/run" + (dryRun ? "?dryrun=true" : "");
+    this.request(path, {method: "POST"})
+      .then((view) => {
+        this.setState({planned: view.status.dryrun ? view : null});
+        this.loadJobs();
+      })
+      .catch((err) => {
+        this.handleError(err);
+        this.loadJobs();
+      });
+  }
+  renderEditor() {
+    return (
+      <div>
+        <JobForm job={this.state.editing} ref="form" />
+        <Button bsStyle="primary" onClick={this.handleSave}>Save</Button>{' '}
+        <Button onClick={() => this.setState({editing: null})}>Cancel</Button>
+      </div>
+    );
+  }
+  renderTable() {
+    let timeFormatter = (cell, row) => {
+      return (cell && !cell.startsWith("0001")) ? moment(cell).format("YYYY-MM-DD HH:mm") : "";
+    };
+
+    let statusFormatter = (cell, row) => {
+      if (cell.running) {
+        return "Running";
+      }
+      if (cell.error) {
+        return "Failed: " + cell.error;
+      }
+      if (cell.dryrun) {
+        return "Dry run, would push " + cell.pushed + ", skipped " + cell.skipped;
+      }
+      if (!timeFormatter(cell.lastrun)) {
+        return "";
+      }
+      let quiet = cell.quiet ? ", left out " + cell.quiet.join(", ") + " in quiet hours" : "";
+      return "Pushed " + cell.pushed + ", skipped " + cell.skipped + quiet;
+    };
+
+    let actionsFormatter = (cell, row) => {
+      return <span>
+        <Button bsSize="xsmall" onClick={() => this.setState({editing: row})}>Edit</Button>{' '}
+        <Button bsSize="xsmall" onClick={() => this.handleRun(row, false)}>Run now</Button>{' '}
+        <Button bsSize="xsmall" onClick={() => this.handleRun(row, true)}>Dry run</Button>{' '}
+        <Button bsSize="xsmall" bsStyle="danger" onClick={() => this.handleDelete(row)}>Delete</Button>
+      </span>;
+    };
+
+    return (
+      <BootstrapTable data={this.state.jobs} striped={true} hover={true}>
+        <TableHeaderColumn dataField="name" isKey={true} dataSort={true} width="120px">Name</TableHeaderColumn>
+        <TableHeaderColumn dataField="schedule" width="120px">Schedule</TableHeaderColumn>
+        <TableHeaderColumn dataField="query">Query</TableHeaderColumn>
+        <TableHeaderColumn dataField="status" dataFormat={(cell) => timeFormatter(cell.nextrun)} width="140px">Next Run</TableHeaderColumn>
+        <TableHeaderColumn dataField="status" dataFormat={statusFormatter}>Last Run</TableHeaderColumn>
+        <TableHeaderColumn dataField="name" dataFormat={actionsFormatter} width="260px">Actions</TableHeaderColumn>
+      </BootstrapTable>
+    );
+  }
+  renderPlanned() {
+    let view = this.state.planned;
+    let planned = view.status.planned || [];
+    return (
+      <Alert bsStyle="info" onDismiss={() => this.setState({planned: null})}>
+        <p>A dry run of {view.name} would push {view.status.pushed} release(s):</p>
+        <ul>
+          {planned.map((p, idx) => (
+            <li key={idx}>{p.title} from {p.indexer}: {p.action}{p.fetch ? ", downloading " + p.fetch : ""}</li>
+          ))}
+        </ul>
+      </Alert>
+    );
+  }
+  render() {
+    return (
+      <Modal show={this.state.show} onHide={this.handleClose} dialogClassName="App__SearchModal">
+        <Modal.Header closeButton>
+          <Modal.Title>Scheduled Jobs</Modal.Title>
+        </Modal.Header>
+        <Modal.Body>
+          {this.state.errorMessage ? <Alert bsStyle="danger">{this.state.errorMessage}</Alert> : null}
+          {this.state.planned && !this.state.editing ? this.renderPlanned() : null}
+          {this.state.editing ? this.renderEditor() : this.renderTable()}
+        </Modal.Body>
+        <Modal.Footer>
+          {this.state.editing ? null : <Button onClick={() => this.setState({editing: {}})}>Add Job</Button>}
+          <Button onClick={this.handleClose}>Close</Button>
+        </Modal.Footer>
+      </Modal>
+    );
+  }
+}
+
+export default JobsModal;
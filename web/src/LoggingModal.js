@@ -0,0 +1,106 @@
+import React, { Component } from 'react';
+import { Modal, Button, FormGroup, FormControl, ControlLabel, Checkbox, Alert }  from 'react-bootstrap';
+import xhrUrl from './xhr';
+
+const levels = ["panic", "fatal", "error", "warning", "info", "debug"];
+
+class LoggingModal extends Component {
+  static defaultProps = {
+    indexers: [],
+  }
+  state = {
+    show: this.props.show,
+    level: "info",
+    sites: {},
+    errorMessage: null,
+  }
+  componentWillReceiveProps(newProps) {
+    this.setState({
+      show: typeof(newProps).show !== undefined ? newProps.show : this.state.show,
+    });
+  }
+  componentDidMount() {
+    this.request("GET")
+      .then((logging) => this.setState({level: logging.level, sites: logging.sites}))
+      .catch(this.handleError);
+  }
+  request = (method, body) => {
+    return fetch(xhrUrl("xhr/logging"), {
+      headers: {
+        'Accept': 'application/json',
+        'Content-Type': 'application/json',
+        'Authorization': 'apitoken ' + this.props.apiKey,
+      },
+      method: method,
+      body: body ? JSON.stringify(body) : undefined,
+    })
+    .then((response) => {
+      if (!response.ok) {
+        return response.json().then((resp) => {
+          throw Error(resp.error);
+        });
+      }
+      return response.json();
+    });
+  }
+  handleError = (err) => {
+    console.warn(err);
+    this.setState({errorMessage: err.message});
+  }
+  handleClose = () => {
+    this.props.onClose();
+    this.setState({show: false});
+  }
+  handleSave = () => {
+    this.request("PUT", {level: this.state.level, sites: this.state.sites})
+      .then(this.handleClose)
+      .catch(this.handleError);
+  }
+  toggleDebug = (id, enabled) => {
+    let sites = Object.assign({}, this.state.sites);
+    if (enabled) {
+      sites[id] = "debug";
+    } else {
+      delete sites[id];
+    }
+    this.setState({sites: sites});
+  }
+  render() {
+    let indexers = this.props.indexers.map((indexer) => {
+      return (
+        <Checkbox key={indexer.id} checked={this.state.sites[indexer.id] === "debug"}
+          onChange={(e) => this.toggleDebug(indexer.id, e.target.checked)}>
+          {indexer.name}
+        </Checkbox>
+      );
+    });
+
+    return (
+      <Modal show={this.state.show} onHide={this.handleClose}>
+        <Modal.Header closeButton>
+          <Modal.Title>Logging</Modal.Title>
+        </Modal.Header>
+        <Modal.Body>
+          {this.state.errorMessage ? <Alert bsStyle="danger">{this.state.errorMessage}</Alert> : null}
+          <FormGroup controlId="formLoggingLevel">
+            <ControlLabel>Log level</ControlLabel>
+            <FormControl componentClass="select" value={this.state.level}
+              onChange={(e) => this.setState({level: e.target.value})}>
+              {levels.map((l) => <option key={l} value={l}>{l}</option>)}
+            </FormControl>
+          </FormGroup>
+          <FormGroup>
+            <ControlLabel>Debug logging for individual indexers</ControlLabel>
+            {indexers}
+          </FormGroup>
+        </Modal.Body>
+        <Modal.Footer>
+          <Button bsStyle="primary" onClick={this.handleSave}>Save</Button>
+          <Button onClick={this.handleClose}>Close</Button>
+        </Modal.Footer>
+      </Modal>
+    );
+  }
+}
+
+export default LoggingModal;
@@ -9,16 +9,20 @@ class Login extends Component {
   }
   state = {
     show: true,
+    username: "",
     passphrase: "",
     helpBlock: "",
     validationState: null,
   }
+  handleUsernameChange = (e) => {
+    this.setState({username: e.target.value})
+  }
   handlePassphraseChange = (e) => {
     this.setState({passphrase: e.target.value})
   }
   handleSubmit = (e) => {
     e.preventDefault();
-    this.authenticate(this.state.passphrase);
+    this.authenticate(this.state.username, this.state.passphrase);
   }
   handleAuthError = (err) => {
     console.error("Auth error:", err);
@@ -27,14 +31,14 @@ class Login extends Component {
       validationState: "error",
     });
   }
-  authenticate = (passphrase) => {
+  authenticate = (username, passphrase) => {
     fetch(xhrUrl(this.props.authUrl), {
         headers: {
           'Accept': 'application/json',
           'Content-Type': 'application/json'
         },
         method: "POST",
-        body: JSON.stringify({ passphrase: passphrase })
+        body: JSON.stringify({ username: username, passphrase: passphrase })
     })
     .then((res) => {
       if (!res.ok) {
@@ -45,7 +49,7 @@ class Login extends Component {
     .then((res) => {
       res.json().then((data) => {
         if (!data.hasOwnProperty("error")) {
-          this.props.onAuthenticate(data.token);
+          this.props.onAuthenticate(data.token, data.role, data.readOnly, data.offline);
         } else {
           this.handleAuthError(data.error);
         }
@@ -64,6 +68,14 @@ class Login extends Component {
         </Modal.Header>
         <Modal.Body>
           <Form horizontal onSubmit={this.handleSubmit}>
+            <FormGroup controlId="formHorizontalUsername">
+              <Col componentClass={ControlLabel} sm={2}>
+                Username
+              </Col>
+              <Col sm={10}>
+                <FormControl type="text" placeholder="Leave blank to use the global passphrase" onChange={this.handleUsernameChange} />
+              </Col>
+            </FormGroup>
             <FormGroup controlId="formHorizontalPassword" validationState={this.state.validationState}>
               <Col componentClass={ControlLabel} sm={2}>
                 Password
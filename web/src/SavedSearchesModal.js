@@ -0,0 +1,180 @@
+import React, { Component } from 'react';
+import ReactDOM from 'react-dom';
+import { Col, Modal, Button, Form, FormGroup, FormControl, ControlLabel, Alert }  from 'react-bootstrap';
+import { BootstrapTable, TableHeaderColumn }  from 'react-bootstrap-table';
+import xhrUrl from './xhr';
+
+import 'react-bootstrap-table/dist/react-bootstrap-table.min.css';
+
+class SavedSearchForm extends Component {
+  getValues = () => {
+    let value = (ref) => ReactDOM.findDOMNode(this.refs[ref]).value;
+    return {
+      name: value("name"),
+      query: value("query"),
+      indexers: value("indexers").split(",").map((x) => x.trim()).filter((x) => x !== ""),
+      minseeders: parseInt(value("minseeders"), 10) || 0,
+      maxsize: value("maxsize"),
+      include: value("include"),
+      exclude: value("exclude"),
+    };
+  }
+  render() {
+    let search = this.props.search || {};
+    let fields = [
+      {name: "name", label: "Name", placeholder: "new-documentaries"},
+      {name: "query", label: "Query", placeholder: "t=search&q=documentary&cat=5000"},
+      {name: "indexers", label: "Indexers", placeholder: "aggregate or comma separated indexer ids"},
+      {name: "minseeders", label: "Min Seeders", placeholder: "0"},
+      {name: "maxsize", label: "Max Size", placeholder: "e.g 4G, blank for no limit"},
+      {name: "include", label: "Include", placeholder: "only titles matching this regular expression"},
+      {name: "exclude", label: "Exclude", placeholder: "leave out titles matching this regular expression"},
+    ];
+    return <Form horizontal>
+      {fields.map((field) => {
+        let value = search[field.name];
+        if (Array.isArray(value)) {
+          value = value.join(",");
+        }
+        return (
+          <FormGroup controlId={"formSavedSearch" + field.name} key={field.name}>
+            <Col componentClass={ControlLabel} sm={2}>{field.label}</Col>
+            <Col sm={10}>
+              <FormControl type="text" placeholder={field.placeholder} defaultValue={value}
+                disabled={field.name === "name" && search.name !== undefined} ref={field.name} />
+            </Col>
+          </FormGroup>
+        );
+      })}
+    </Form>;
+  }
+}
+
+class SavedSearchesModal extends Component {
+  static defaultProps = {
+    searches: [],
+  }
+  state = {
+    show: this.props.show,
+    searches: this.props.searches,
+    editing: null,
+    errorMessage: null,
+  }
+  componentWillReceiveProps(newProps) {
+    this.setState({
+      show: typeof(newProps).show !== undefined ? newProps.show : this.state.show,
+    });
+  }
+  componentDidMount() {
+    this.loadSearches();
+  }
+  request = (path, options) => {
+    return fetch(xhrUrl(path), Object.assign({
+      headers: {
+        'Accept': 'application/json',
+        'Content-Type': 'application/json',
+        'Authorization': 'apitoken ' + this.props.apiKey,
+      },
+    }, options))
+    .then((response) => {
+      if (!response.ok) {
+        return response.json().then((resp) => {
+          throw Error(resp.error);
+        });
+      }
+      return response.status === 204 ? null : response.json();
+    });
+  }
+  handleError = (err) => {
+    console.warn(err);
+    this.setState({errorMessage: err.message});
+  }
+  loadSearches = () => {
+    this.request("xhr/searches")
+      .then((searches) => this.setState({searches: searches}))
+      .catch(this.handleError);
+  }
+  handleClose = () => {
+    this.props.onClose();
+    this.setState({show: false});
+  }
+  handleSave = () => {
+    let search = this.refs.form.getValues();
+    this.request("xhr/searches/" + encodeURIComponent(search.name), {method: "PUT", body: JSON.stringify(search)})
+      .then(() => this.setState({editing: null, errorMessage: null}, this.loadSearches))
+      .catch(this.handleError);
+  }
+  handleDelete = (search) => {
+    this.request("xhr/searches/" + encodeURIComponent(search.name), {method: "DELETE"})
+      .then(this.loadSearches)
+      .catch(this.handleError);
+  }
+  renderEditor() {
+    return (
+      <div>
+        <SavedSearchForm search={this.state.editing} ref="form" />
+        <Button bsStyle="primary" onClick={this.handleSave}>Save</Button>{' '}
+        <Button onClick={() => this.setState({editing: null})}>Cancel</Button>
+      </div>
+    );
+  }
+  renderTable() {
+    let filtersFormatter = (cell, row) => {
+      let filters = [];
+      if (row.minseeders) {
+        filters.push(row.minseeders + "+ seeders");
+      }
+      if (row.maxsize) {
+        filters.push("under " + row.maxsize);
+      }
+      if (row.include) {
+        filters.push("matching " + row.include);
+      }
+      if (row.exclude) {
+        filters.push("not matching " + row.exclude);
+      }
+      return filters.join(", ");
+    };
+
+    let feedFormatter = (cell, row) => {
+      return <a href={xhrUrl(cell)} target="_blank">torznab</a>;
+    };
+
+    let actionsFormatter = (cell, row) => {
+      return <span>
+        <Button bsSize="xsmall" onClick={() => this.setState({editing: row})} disabled={this.props.readOnly}>Edit</Button>{' '}
+        <Button bsSize="xsmall" bsStyle="danger" onClick={() => this.handleDelete(row)} disabled={this.props.readOnly}>Delete</Button>
+      </span>;
+    };
+
+    return (
+      <BootstrapTable data={this.state.searches} striped={true} hover={true}>
+        <TableHeaderColumn dataField="name" isKey={true} dataSort={true} width="140px">Name</TableHeaderColumn>
+        <TableHeaderColumn dataField="query">Query</TableHeaderColumn>
+        <TableHeaderColumn dataField="indexers" dataFormat={(cell) => cell.join(", ")} width="140px">Indexers</TableHeaderColumn>
+        <TableHeaderColumn dataField="name" dataFormat={filtersFormatter}>Filters</TableHeaderColumn>
+        <TableHeaderColumn dataField="feed" dataFormat={feedFormatter} width="80px">Feed</TableHeaderColumn>
+        <TableHeaderColumn dataField="name" dataFormat={actionsFormatter} width="120px">Actions</TableHeaderColumn>
+      </BootstrapTable>
+    );
+  }
+  render() {
+    return (
+      <Modal show={this.state.show} onHide={this.handleClose} dialogClassName="App__SearchModal">
+        <Modal.Header closeButton>
+          <Modal.Title>Saved Searches</Modal.Title>
+        </Modal.Header>
+        <Modal.Body>
+          {this.state.errorMessage ? <Alert bsStyle="danger">{this.state.errorMessage}</Alert> : null}
+          {this.state.editing ? this.renderEditor() : this.renderTable()}
+        </Modal.Body>
+        <Modal.Footer>
+          {this.state.editing || this.props.readOnly ? null : <Button onClick={() => this.setState({editing: {}})}>Add Search</Button>}
+          <Button onClick={this.handleClose}>Close</Button>
+        </Modal.Footer>
+      </Modal>
+    );
+  }
+}
+
+export default SavedSearchesModal;
@@ -15,7 +15,10 @@ class SearchForm extends Component {
   }
   onSubmit = (e) => {
     e.preventDefault();
-    this.props.onSearch({keywords: ReactDOM.findDOMNode(this.refs.keywords).value});
+    this.props.onSearch({
+      keywords: ReactDOM.findDOMNode(this.refs.keywords).value,
+      raw: ReactDOM.findDOMNode(this.refs.raw).value,
+    });
   }
   render() {
     return <Form inline onSubmit={this.onSubmit} className={this.props.searching?'searching':''}>
@@ -25,6 +28,12 @@ class SearchForm extends Component {
         <FormControl type="text" placeholder="" ref="keywords" />
       </FormGroup>
       {' '}
+      <FormGroup controlId="formInlineRaw">
+        <ControlLabel>Raw</ControlLabel>
+        {' '}
+        <FormControl type="text" placeholder="site specific syntax" ref="raw" />
+      </FormGroup>
+      {' '}
       <Button type="submit">Go</Button>
       {' '}
       <img src={spinner} height="50" width="50" alt="loading..." className="loading" />
@@ -54,6 +63,7 @@ class SearchModal extends Component {
       format: "json",
       apikey: this.state.apiKey,
       q: query.keywords,
+      raw: query.raw || undefined,
     })))
     .then((response) => {
       if (!response.ok) {